@@ -1,9 +1,13 @@
 package common
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -19,34 +23,245 @@ type Config struct {
 	// 分别用于图片生成与图片编辑的模型名称
 	GenAIGenModelName  string
 	GenAIEditModelName string
+	// 模型别名表（来自 GENAI_MODEL_ALIASES JSON，小写别名 → 模型 ID），与内置别名表合并
+	GenAIModelAliases map[string]string
+	// 是否检测提示词语言（记录日志并在结构化输出中返回 language）
+	DetectLanguage bool
+	// 按提示词语言路由的生成 / 编辑模型（语言代码 → 模型），需开启 GENAI_DETECT_LANGUAGE
+	LanguageGenModels  map[string]string
+	LanguageEditModels map[string]string
 
 	ServerAddress string
 	ServerPort    string
+	// 是否对 HTTP JSON 响应启用 gzip 压缩
+	HTTPCompression bool
+	// 是否在 / 提供调试用的 Web 页面
+	DebugUI bool
+	// 健康检查接口路径（供负载均衡器探活）
+	HealthzPath string
+	// 对象存储后端（OSS_BACKEND）：s3（默认，S3 兼容的 OSS）、local（本地目录）、gcs（Google Cloud Storage）
+	// 或 memory（进程内存，由本服务的 /image/{id} 提供）
+	OSSBackend string
+	// local 后端的根目录与对象的 HTTP 访问前缀；前缀为空时返回 file:// URL
+	OSSLocalDir     string
+	OSSLocalBaseURL string
+	// memory 后端：结果 URL 的前缀（本服务对客户端可见的地址，默认 http://localhost:<SERVER_PORT>）、
+	// 缓存总大小上限（MB）与对象保留时长（分钟）
+	OSSMemoryBaseURL    string
+	OSSMemoryMaxMB      int
+	OSSMemoryTTLMinutes int
 	// OSS 配置
 	OSSEndpoint  string
 	OSSRegion    string
 	OSSAccessKey string
 	OSSSecretKey string
 	OSSBucket    string
-	// 图片输出格式: base64 或 url
+	// 服务端加密：AES256 / aws:kms，为空表示不显式指定
+	OSSSSE         string
+	OSSSSEKMSKeyID string
+	// 上传对象的存储类型（如 STANDARD_IA），为空表示使用 bucket 默认存储类型
+	OSSStorageClass string
+	// 图片对象的路径分区方案（OSS_PATH_SCHEME）：daily / hourly / flat 或自定义模板，由 utils.SetImagePathScheme 校验
+	OSSPathScheme string
+	// 附加到所有上传对象的标签（来自 OSS_OBJECT_TAGS，key=value 逗号分隔）
+	OSSObjectTags map[string]string
+	// 上传时的 Content-Type 覆盖表（来自 OSS_CONTENT_TYPE_OVERRIDES JSON），与内置规范化表合并
+	OSSContentTypeOverrides map[string]string
+	// 上传图片的存储压缩质量（1-100）：JPEG 按该质量重编码、PNG 无损最高压缩，0 表示不压缩
+	OSSArchiveQuality int
+	// OSS 过期结果清理（janitor），默认关闭
+	OSSJanitorEnabled         bool
+	OSSJanitorPrefixes        []string // 只清理这些前缀下的对象
+	OSSJanitorMaxAgeHours     int      // 超过该时长（小时）的对象会被删除
+	OSSJanitorIntervalMinutes int      // 清理间隔（分钟）
+	OSSJanitorBatchSize       int      // 每次 DeleteObjects 删除的最大 key 数（1-1000）
+	OSSJanitorConcurrency     int      // 并发的 DeleteObjects 请求数
+	// 图片输出格式: base64、url 或 auto（启动时解析为 base64 / url）
 	GenAIImageFormat string
+	// 透明图片转为 JPEG 时合成的默认背景色（#RRGGBB / #RGB）
+	GenAIFlattenBGColor string
+	// 多张结果图片时是否按质量启发式评分排序（分辨率 + 清晰度估计）
+	GenAIRankResults bool
 	// GenAI 请求超时时间（秒）
 	GenAITimeoutSeconds int
+	// 按请求规模放大超时：每百万输出像素、每张图片（输入 + 输出）增加的秒数，及放大后的上限（秒）
+	TimeoutPerMegapixelSeconds float64
+	TimeoutPerImageSeconds     float64
+	TimeoutMaxSeconds          int
+	// 单次工具调用的整体超时时间（秒），涵盖下载、上传与多次上游请求；0 表示不限制
+	ToolTimeoutSeconds int
+	// 允许请求的最大输出分辨率（如 2K、2048、2048*2048），为空表示不限制
+	MaxOutputResolution string
+	// 价格表（JSON），用于 estimate_cost 工具
+	GenAIPricing string
+	// 生成 / 编辑工具每日（UTC）的请求数与估算费用上限，0 表示不限；费用按 GENAI_PRICING 估算
+	DailyRequestLimit int
+	DailyCostLimit    float64
+	// 多实例共享用量计数的 Redis 地址（redis://...），为空时在进程内计数
+	QuotaRedisURL string
+	// 附加到所有 provider 出站请求的自定义 HTTP 头（来自 GENAI_EXTRA_HEADERS JSON）
+	GenAIExtraHeaders map[string]string
+	// Gemini 各模型图片编辑最大输入图片数（JSON 对象），覆盖内置默认值
+	GeminiModelMaxImages string
+	// Gemini 无法拉取编辑输入的图片 URL 时，是否由服务端下载后内联重试
+	GeminiInlineFallback bool
+	// Gemini 内联重试时单个编辑请求内同时下载的最大图片数
+	GeminiEditDownloadConcurrency int
+	// Gemini 模型过载（503 / UNAVAILABLE）时的最大重试次数，0 表示不重试
+	GeminiOverloadRetries int
+	// 重试时采用服务端建议等待时间（Retry-After / RetryInfo）的上限（秒），超过时改用退避间隔，0 表示忽略服务端建议
+	MaxRetryAfterSeconds int
+	// Wan / APIMart 请求遇到连接错误与 429 / 5xx 响应时的最大重试次数（不含首次请求），0 表示不重试
+	HTTPMaxRetries int
+	// 所有出站 HTTP 请求使用的代理（GENAI_HTTP_PROXY，未设置时取 HTTPS_PROXY / HTTP_PROXY），为空表示直连
+	HTTPProxy string
+	// 不走代理的主机列表（GENAI_NO_PROXY，未设置时取 NO_PROXY）
+	NoProxy []string
+	// 启动时是否预检配置的模型是否存在且可访问，失败时拒绝启动
+	GenAIPreflight bool
+	// 生成前是否先用文本模型扩写提示词（额外一次调用与费用，默认关闭）
+	EnhancePrompt bool
+	// 扩写提示词使用的文本模型，未设置时按 provider 取默认值
+	EnhanceModel string
+	// 扩写使用的 OpenAI 兼容接口地址（以 /v1 结尾），未设置时按 provider 推导；Gemini 未设置时使用 Gemini SDK
+	EnhanceBaseURL string
+	// 扩写接口的 API Key，未设置时使用 GENAI_API_KEY
+	EnhanceAPIKey string
+	// 扩写时发送给文本模型的指令（system prompt），为空时使用内置指令
+	EnhanceInstruction string
+	// Wan 编辑工具收到空提示词时的处理方式：reject（拒绝）、omit（不发送 prompt）、default（使用 WanEditDefaultPrompt）
+	WanEditEmptyPrompt   string
+	WanEditDefaultPrompt string // WanEditEmptyPrompt 为 default 时发送的中性提示词
+	// Wan 文生图宽高比 → 宽*高 的覆盖表（JSON 对象），覆盖或补充内置映射
+	WanSizeMap string
+	// APIMart 任务查询结果中图片 URL 的提取路径（按顺序尝试），为空时使用内置顺序
+	ApimartImageURLPaths []string
+	// 是否合并并发的相同生成 / 编辑请求，使其共享一次 provider 调用
+	CoalesceRequests bool
+	// 异步任务返回的图片少于请求数时，自动为缺少的图片创建补齐任务
+	TopUpPartialResults bool
+	// url 输出时直接返回 provider 结果 URL（未签名时）、跳过 OSS 转存的 provider 列表
+	DirectURLProviders []string
+	// edit_session 多轮编辑会话在最后一次编辑后保留的时长（分钟）
+	EditSessionTTLMinutes int
+	// 严格模式：只配置了生成 / 编辑模型之一时，拒绝另一类调用而不是复用已配置的模型
+	StrictModels bool
+	// 要求同时配置生成与编辑模型：只配置其一时启动失败，而不是复用已配置的模型
+	RequireBothModels bool
+	// 单次编辑请求允许的最大输入图片数（与模型自身上限取较小值），0 表示不限制
+	MaxEditImages int
+	// 服务端下载单张图片的最大字节数，超过时拒绝（防止超大响应耗尽内存）
+	MaxImageBytes int
+	// base64 输出时内联图片的最大字节数，超过时改为上传 OSS 返回 URL（需配置 OSS），0 表示不限制
+	Base64MaxBytes int
+	// 工具 url_expiry_seconds 参数允许的最大签名 URL 有效期（秒）
+	OSSURLMaxExpirySeconds int
+	// 上传 OSS 后返回的 URL 形式：public（不带签名，默认）或 signed（预签名）
+	OSSURLMode string
+	// signed 模式下结果 URL 的默认有效期（秒），未设置时等于 OSS_URL_MAX_EXPIRY_SECONDS
+	OSSURLExpirySeconds int
+	// OSS 不可用时 url 输出降级为返回 provider 原始结果 URL 或 data URI，而不是让请求失败
+	OSSDegrade bool
+	// 降级时以 data URI 内联返回的最大图片字节数
+	OSSDegradeMaxBytes int
+	// 降级开启时 OSS 健康检查的间隔（秒）
+	OSSHealthCheckIntervalSeconds int
+	// 结果图片上传 OSS 时附带生成的缩略图长边像素数，0 表示不生成
+	ThumbnailSize int
+	// 查询工具阻塞等待任务完成（wait_seconds）时的轮询参数
+	PollIntervalSeconds    int     // 初始轮询间隔（秒）
+	PollMaxIntervalSeconds int     // 退避后的最大轮询间隔（秒）
+	PollBackoff            float64 // 每次轮询后间隔的增长倍数，1 表示不退避
+	PollJitter             float64 // 轮询间隔的随机抖动比例（0-1）
+	PollMaxWaitSeconds     int     // wait_seconds 允许的最大值（秒）
+	// 允许注册的 MCP 工具名列表（GENAI_ENABLED_TOOLS，逗号分隔），为空表示全部启用
+	GenAIEnabledTools []string
+	// 管理员令牌：非空时注册管理类工具（如 reload_provider），调用时需提供相同的 admin_token
+	AdminToken string
+	// 输入图片主机访问策略（防止 SSRF）
+	ImageHostAllowlist     []string // 允许的图片主机列表，为空表示不限制
+	ImageHostDenylist      []string // 拒绝的图片主机列表
+	AllowPrivateImageHosts bool     // 是否允许访问回环 / 内网地址
+	RequireHTTPSImages     bool     // 是否拒绝 http:// 图片 URL，只允许 https
 	// 日志配置
 	LogLevel  string // 日志级别: debug, info, warn, error
 	LogFormat string // 日志格式: json, text
 	LogOutput string // 输出位置: stdout, stderr, file
 	LogFile   string // 日志文件路径（当 LogOutput 为 file 时）
+	// 各子系统的日志级别（来自 LOG_LEVEL_<SUBSYSTEM>，如 LOG_LEVEL_OSS=debug），键为小写子系统名
+	LogSubsystemLevels map[string]string
 }
 
+// processEnvKeys 启动时进程环境中已存在的变量名。
+// 这些变量优先于 .env 文件，重新加载配置时不会被 .env 覆盖。
+var processEnvKeys map[string]bool
+
 // LoadConfig 从 .env 文件加载配置
 func LoadConfig() (*Config, error) {
+	processEnvKeys = make(map[string]bool)
+	for _, kv := range os.Environ() {
+		if k, _, ok := strings.Cut(kv, "="); ok {
+			processEnvKeys[k] = true
+		}
+	}
+
 	// 加载 .env 文件（如果存在）
 	if err := godotenv.Load(); err != nil {
 		// .env 文件不存在时，尝试从环境变量读取
 		fmt.Println("Warning: .env file not found, using environment variables")
 	}
 
+	config, err := loadConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	// 初始化日志系统
+	logConfig := &LogConfig{
+		Level:    config.LogLevel,
+		Format:   config.LogFormat,
+		Output:   config.LogOutput,
+		FilePath: config.LogFile,
+
+		SubsystemLevels: config.LogSubsystemLevels,
+	}
+	if err := InitLogger(logConfig); err != nil {
+		return nil, fmt.Errorf("failed to initialize logger: %w", err)
+	}
+
+	// 日志系统就绪后再解析模型别名，以便记录映射结果
+	config.resolveModelNames()
+
+	return config, nil
+}
+
+// ReloadConfig 运行时重新读取 .env 文件与环境变量并返回新配置（用于密钥轮换、切换模型等）。
+//
+// 与启动时一致，进程环境变量优先于 .env 文件；日志系统不会重新初始化。
+func ReloadConfig() (*Config, error) {
+	values, err := godotenv.Read()
+	if err != nil {
+		Warnf("Failed to read .env file during config reload, using environment variables: %v", err)
+	}
+	for k, v := range values {
+		if processEnvKeys[k] {
+			continue
+		}
+		if err := os.Setenv(k, v); err != nil {
+			return nil, fmt.Errorf("failed to set %s from .env: %w", k, err)
+		}
+	}
+
+	config, err := loadConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	config.resolveModelNames()
+	return config, nil
+}
+
+// loadConfigFromEnv 从当前环境变量构建并校验配置
+func loadConfigFromEnv() (*Config, error) {
 	config := &Config{
 		GenAIProvider:      getEnv("GENAI_PROVIDER", "gemini"),
 		GenAIBaseURL:       getEnv("GENAI_BASE_URL", ""),
@@ -55,24 +270,342 @@ func LoadConfig() (*Config, error) {
 		GenAIEditModelName: getEnv("GENAI_EDIT_MODEL_NAME", ""),
 		ServerAddress:      getEnv("SERVER_ADDRESS", "0.0.0.0"),
 		ServerPort:         getEnv("SERVER_PORT", "8080"),
+		HTTPCompression:    getEnvBool("HTTP_COMPRESSION", false),
+		DebugUI:            getEnvBool("DEBUG_UI", false),
+		HealthzPath:        getEnv("HEALTHZ_PATH", "/healthz"),
 		// OSS 配置
+		OSSBackend:          strings.ToLower(getEnv("OSS_BACKEND", OSSBackendS3)),
+		OSSLocalDir:         getEnv("OSS_LOCAL_DIR", ""),
+		OSSLocalBaseURL:     getEnv("OSS_LOCAL_BASE_URL", ""),
+		OSSMemoryBaseURL:    getEnv("OSS_MEMORY_BASE_URL", ""),
+		OSSMemoryMaxMB:      getEnvInt("OSS_MEMORY_MAX_MB", 256),
+		OSSMemoryTTLMinutes: getEnvInt("OSS_MEMORY_TTL_MINUTES", 60),
 		OSSEndpoint:         getEnv("OSS_ENDPOINT", ""),
 		OSSRegion:           getEnv("OSS_REGION", "us-east-1"),
 		OSSAccessKey:        getEnv("OSS_ACCESS_KEY", ""),
 		OSSSecretKey:        getEnv("OSS_SECRET_KEY", ""),
 		OSSBucket:           getEnv("OSS_BUCKET", ""),
+		OSSSSE:              getEnv("OSS_SSE", ""),
+		OSSSSEKMSKeyID:      getEnv("OSS_SSE_KMS_KEY_ID", ""),
+		OSSStorageClass:     getEnv("OSS_STORAGE_CLASS", ""),
+		OSSPathScheme:       getEnv("OSS_PATH_SCHEME", "daily"),
 		GenAIImageFormat:    getEnv("GENAI_IMAGE_FORMAT", "base64"),
+		GenAIRankResults:    getEnvBool("GENAI_RANK_RESULTS", false),
+		GenAIFlattenBGColor: getEnv("GENAI_FLATTEN_BG_COLOR", "#ffffff"),
 		GenAITimeoutSeconds: getEnvInt("GENAI_TIMEOUT_SECONDS", 60),
+		ToolTimeoutSeconds:  getEnvInt("GENAI_TOOL_TIMEOUT_SECONDS", 600),
+		MaxOutputResolution: getEnv("GENAI_MAX_OUTPUT_RESOLUTION", ""),
+		GenAIPricing:        getEnv("GENAI_PRICING", ""),
+		DailyRequestLimit:   getEnvInt("GENAI_DAILY_REQUEST_LIMIT", 0),
+		DailyCostLimit:      getEnvFloat("GENAI_DAILY_COST_LIMIT", 0),
+		QuotaRedisURL:       getEnv("GENAI_QUOTA_REDIS_URL", ""),
+		// 按请求规模放大超时
+		TimeoutPerMegapixelSeconds: getEnvFloat("GENAI_TIMEOUT_PER_MEGAPIXEL_SECONDS", 0),
+		TimeoutPerImageSeconds:     getEnvFloat("GENAI_TIMEOUT_PER_IMAGE_SECONDS", 0),
+		TimeoutMaxSeconds:          getEnvInt("GENAI_TIMEOUT_MAX_SECONDS", 600),
+		// Gemini 模型图片数上限覆盖表
+		GeminiModelMaxImages: getEnv("GEMINI_MODEL_MAX_IMAGES", ""),
+		GeminiInlineFallback: getEnvBool("GEMINI_INLINE_FALLBACK", true),
+		// 单个编辑请求内的并发下载数
+		GeminiEditDownloadConcurrency: getEnvInt("GEMINI_EDIT_DOWNLOAD_CONCURRENCY", 4),
+		// Gemini 模型过载重试
+		GeminiOverloadRetries: getEnvInt("GEMINI_OVERLOAD_RETRIES", 2),
+		MaxRetryAfterSeconds:  getEnvInt("GENAI_MAX_RETRY_AFTER_SECONDS", 30),
+		// Wan / APIMart 短暂错误重试
+		HTTPMaxRetries: getEnvInt("GENAI_HTTP_MAX_RETRIES", DefaultHTTPMaxRetries),
+		// 出站代理
+		HTTPProxy: firstEnv("GENAI_HTTP_PROXY", "HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"),
+		NoProxy:   getEnvList(firstEnvKey("GENAI_NO_PROXY", "NO_PROXY", "no_proxy")),
+		// 启动预检
+		GenAIPreflight: getEnvBool("GENAI_PREFLIGHT", false),
+		// 提示词扩写
+		EnhancePrompt:      getEnvBool("GENAI_ENHANCE_PROMPT", false),
+		EnhanceModel:       getEnv("GENAI_ENHANCE_MODEL", ""),
+		EnhanceBaseURL:     getEnv("GENAI_ENHANCE_BASE_URL", ""),
+		EnhanceAPIKey:      getEnv("GENAI_ENHANCE_API_KEY", ""),
+		EnhanceInstruction: getEnv("GENAI_ENHANCE_INSTRUCTION", ""),
+		// Wan 编辑空提示词处理
+		WanEditEmptyPrompt:   strings.ToLower(getEnv("WAN_EDIT_EMPTY_PROMPT", "reject")),
+		WanEditDefaultPrompt: getEnv("WAN_EDIT_DEFAULT_PROMPT", "Blend the input images naturally into a single coherent image."),
+		AdminToken:           getEnv("GENAI_ADMIN_TOKEN", ""),
+		GenAIEnabledTools:    getEnvList("GENAI_ENABLED_TOOLS"),
+		// 任务轮询参数
+		PollIntervalSeconds:    getEnvInt("GENAI_POLL_INTERVAL_SECONDS", 3),
+		PollMaxIntervalSeconds: getEnvInt("GENAI_POLL_MAX_INTERVAL_SECONDS", 15),
+		PollBackoff:            getEnvFloat("GENAI_POLL_BACKOFF", 1.2),
+		PollJitter:             getEnvFloat("GENAI_POLL_JITTER", 0.2),
+		PollMaxWaitSeconds:     getEnvInt("GENAI_POLL_MAX_WAIT_SECONDS", 300),
+		// 输入图片主机访问策略
+		ImageHostAllowlist:     getEnvList("GENAI_IMAGE_HOST_ALLOWLIST"),
+		ImageHostDenylist:      getEnvList("GENAI_IMAGE_HOST_DENYLIST"),
+		AllowPrivateImageHosts: getEnvBool("GENAI_ALLOW_PRIVATE_IMAGE_HOSTS", false),
+		RequireHTTPSImages:     getEnvBool("GENAI_REQUIRE_HTTPS_IMAGES", false),
 		// 日志配置
 		LogLevel:  getEnv("LOG_LEVEL", "info"),
 		LogFormat: getEnv("LOG_FORMAT", "text"),
 		LogOutput: getEnv("LOG_OUTPUT", "stdout"),
 		LogFile:   getEnv("LOG_FILE", ""),
+		// 各子系统日志级别
+		LogSubsystemLevels: getEnvWithPrefix("LOG_LEVEL_"),
+		// Wan 宽高比映射
+		WanSizeMap: getEnv("WAN_SIZE_MAP", ""),
+		// APIMart 图片 URL 提取路径
+		ApimartImageURLPaths: getEnvList("APIMART_IMAGE_URL_PATHS"),
+		// 并发相同请求合并
+		CoalesceRequests: getEnvBool("GENAI_COALESCE_REQUESTS", false),
+		// 部分成功时补齐
+		TopUpPartialResults: getEnvBool("GENAI_TOP_UP_PARTIAL_RESULTS", false),
+		// 多轮编辑会话的过期时间
+		EditSessionTTLMinutes: getEnvInt("GENAI_EDIT_SESSION_TTL_MINUTES", 60),
+		// 未显式配置模型时拒绝对应调用
+		StrictModels: getEnvBool("GENAI_STRICT_MODELS", false),
+		// 只配置了一个模型时启动失败
+		RequireBothModels: getEnvBool("GENAI_REQUIRE_BOTH_MODELS", false),
+		// 服务端统一的编辑输入图片数上限
+		MaxEditImages: getEnvInt("GENAI_MAX_EDIT_IMAGES", 0),
+		// 下载图片的大小上限（默认 20MB）
+		MaxImageBytes: getEnvInt("GENAI_MAX_IMAGE_BYTES", 20<<20),
+		// 超过该大小的 base64 输出改为上传 OSS
+		Base64MaxBytes: getEnvInt("GENAI_BASE64_MAX_BYTES", 0),
+		// 按请求覆盖签名 URL 有效期的上限（默认 7 天，即 S3 预签名允许的最大值）
+		OSSURLMaxExpirySeconds: getEnvInt("OSS_URL_MAX_EXPIRY_SECONDS", 604800),
+		// 结果 URL 形式与默认签名有效期
+		OSSURLMode:          getEnv("OSS_URL_MODE", "public"),
+		OSSURLExpirySeconds: getEnvInt("OSS_URL_EXPIRY_SECONDS", 0),
+		// OSS 不可用时的降级（默认关闭）与健康检查
+		OSSDegrade:                    getEnvBool("GENAI_OSS_DEGRADE", false),
+		OSSDegradeMaxBytes:            getEnvInt("GENAI_OSS_DEGRADE_MAX_BYTES", 4194304),
+		OSSHealthCheckIntervalSeconds: getEnvInt("OSS_HEALTH_CHECK_INTERVAL_SECONDS", 30),
+		// 结果缩略图
+		ThumbnailSize: getEnvInt("GENAI_GENERATE_THUMBNAIL", 0),
+		// 上传图片的存储压缩质量
+		OSSArchiveQuality: getEnvInt("OSS_ARCHIVE_QUALITY", 0),
+		// 直接返回 provider 结果 URL
+		DirectURLProviders: getEnvList("GENAI_DIRECT_URL_PROVIDERS"),
+		// OSS 过期结果清理
+		OSSJanitorEnabled:         getEnvBool("OSS_JANITOR_ENABLED", false),
+		OSSJanitorPrefixes:        getEnvList("OSS_JANITOR_PREFIXES"),
+		OSSJanitorMaxAgeHours:     getEnvInt("OSS_JANITOR_MAX_AGE_HOURS", 168),
+		OSSJanitorIntervalMinutes: getEnvInt("OSS_JANITOR_INTERVAL_MINUTES", 60),
+		OSSJanitorBatchSize:       getEnvInt("OSS_JANITOR_BATCH_SIZE", 1000),
+		OSSJanitorConcurrency:     getEnvInt("OSS_JANITOR_CONCURRENCY", 4),
+	}
+
+	// 解析模型别名表
+	modelAliases, err := parseModelAliases(getEnv("GENAI_MODEL_ALIASES", ""))
+	if err != nil {
+		return nil, err
 	}
+	config.GenAIModelAliases = modelAliases
 
-	// 根据提供方校验必需的配置（Gemini、Wan 和 APIMart 共用 GENAI_* 三个字段）
+	// 解析按提示词语言路由的模型表（模型名同样支持别名）
+	config.DetectLanguage = getEnvBool("GENAI_DETECT_LANGUAGE", false)
+	if config.LanguageGenModels, err = parseLanguageModels("GENAI_LANGUAGE_GEN_MODELS", getEnv("GENAI_LANGUAGE_GEN_MODELS", ""), modelAliases); err != nil {
+		return nil, err
+	}
+	if config.LanguageEditModels, err = parseLanguageModels("GENAI_LANGUAGE_EDIT_MODELS", getEnv("GENAI_LANGUAGE_EDIT_MODELS", ""), modelAliases); err != nil {
+		return nil, err
+	}
+	if !config.DetectLanguage && (len(config.LanguageGenModels) > 0 || len(config.LanguageEditModels) > 0) {
+		return nil, fmt.Errorf("GENAI_LANGUAGE_GEN_MODELS / GENAI_LANGUAGE_EDIT_MODELS require GENAI_DETECT_LANGUAGE=true")
+	}
+
+	// 解析 OSS 上传 Content-Type 覆盖表
+	if raw := getEnv("OSS_CONTENT_TYPE_OVERRIDES", ""); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &config.OSSContentTypeOverrides); err != nil {
+			return nil, fmt.Errorf("OSS_CONTENT_TYPE_OVERRIDES must be a JSON object of content type to replacement: %w", err)
+		}
+	}
+
+	// 解析 OSS 对象标签
+	objectTags, err := parseObjectTags(getEnv("OSS_OBJECT_TAGS", ""))
+	if err != nil {
+		return nil, err
+	}
+	config.OSSObjectTags = objectTags
+
+	// 解析自定义请求头
+	extraHeaders, err := parseExtraHeaders(getEnv("GENAI_EXTRA_HEADERS", ""))
+	if err != nil {
+		return nil, err
+	}
+	config.GenAIExtraHeaders = extraHeaders
+
+	switch config.WanEditEmptyPrompt {
+	case "reject", "omit", "default":
+	default:
+		return nil, fmt.Errorf("WAN_EDIT_EMPTY_PROMPT must be one of reject, omit, default, got %q", config.WanEditEmptyPrompt)
+	}
+
+	if config.DailyRequestLimit < 0 || config.DailyCostLimit < 0 {
+		return nil, fmt.Errorf("GENAI_DAILY_REQUEST_LIMIT and GENAI_DAILY_COST_LIMIT must not be negative")
+	}
+
+	// 校验对象存储后端；local 后端不使用 bucket，填充占位值以复用各处"bucket 已配置"的判断
+	switch config.OSSBackend {
+	case OSSBackendS3:
+	case OSSBackendLocal:
+		if strings.TrimSpace(config.OSSLocalDir) == "" {
+			return nil, fmt.Errorf("OSS_BACKEND=local requires OSS_LOCAL_DIR")
+		}
+		if config.OSSLocalBaseURL != "" {
+			u, err := url.Parse(config.OSSLocalBaseURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("OSS_LOCAL_BASE_URL must be an http(s) URL, got %q", config.OSSLocalBaseURL)
+			}
+			// 文件在该路径下由本服务提供，不能占用根路径或 MCP 端点
+			if p := strings.TrimRight(u.Path, "/"); p == "" || p == "/mcp" || p == config.HealthzPath {
+				return nil, fmt.Errorf("OSS_LOCAL_BASE_URL needs a path of its own, such as http://localhost:8080/files, got %q", config.OSSLocalBaseURL)
+			}
+		}
+		if config.OSSBucket == "" {
+			config.OSSBucket = OSSBackendLocal
+		}
+	case OSSBackendMemory:
+		// 结果保存在进程内存中，由本服务的 /image/{id} 提供
+		if config.OSSMemoryMaxMB <= 0 || config.OSSMemoryTTLMinutes <= 0 {
+			return nil, fmt.Errorf("OSS_MEMORY_MAX_MB and OSS_MEMORY_TTL_MINUTES must be positive")
+		}
+		if config.OSSMemoryBaseURL == "" {
+			config.OSSMemoryBaseURL = "http://localhost:" + config.ServerPort
+		}
+		u, err := url.Parse(config.OSSMemoryBaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.TrimRight(u.Path, "/") != "" {
+			return nil, fmt.Errorf("OSS_MEMORY_BASE_URL must be the server's http(s) origin, such as https://genai.example.com, got %q", config.OSSMemoryBaseURL)
+		}
+		if config.OSSBucket == "" {
+			config.OSSBucket = OSSBackendMemory
+		}
+	case OSSBackendGCS:
+		// GCS 凭证来自 GOOGLE_APPLICATION_CREDENTIALS（或 GCP 元数据服务器），只需要 bucket
+		if config.OSSBucket == "" {
+			return nil, fmt.Errorf("OSS_BACKEND=gcs requires OSS_BUCKET")
+		}
+	default:
+		return nil, fmt.Errorf("OSS_BACKEND must be s3, local, gcs or memory, got %q", config.OSSBackend)
+	}
+
+	// 校验 OSS 清理参数（未设置前缀时清理本服务写入的 images/ 与 archives/）
+	if len(config.OSSJanitorPrefixes) == 0 {
+		config.OSSJanitorPrefixes = []string{"images/", "archives/"}
+	}
+	if config.OSSJanitorEnabled {
+		if !config.IsOSSConfigured() {
+			return nil, fmt.Errorf("OSS_JANITOR_ENABLED requires OSS_BUCKET, OSS_ACCESS_KEY and OSS_SECRET_KEY (or OSS_BACKEND=local / gcs)")
+		}
+		if config.OSSJanitorMaxAgeHours <= 0 || config.OSSJanitorIntervalMinutes <= 0 {
+			return nil, fmt.Errorf("OSS_JANITOR_MAX_AGE_HOURS and OSS_JANITOR_INTERVAL_MINUTES must be positive")
+		}
+		if config.OSSJanitorBatchSize < 1 || config.OSSJanitorBatchSize > 1000 {
+			return nil, fmt.Errorf("OSS_JANITOR_BATCH_SIZE must be between 1 and 1000, got %d", config.OSSJanitorBatchSize)
+		}
+		if config.OSSJanitorConcurrency < 1 {
+			return nil, fmt.Errorf("OSS_JANITOR_CONCURRENCY must be at least 1, got %d", config.OSSJanitorConcurrency)
+		}
+	}
+
+	if config.GeminiEditDownloadConcurrency < 1 {
+		return nil, fmt.Errorf("GEMINI_EDIT_DOWNLOAD_CONCURRENCY must be at least 1, got %d", config.GeminiEditDownloadConcurrency)
+	}
+	if config.HTTPProxy != "" {
+		if _, err := parseProxyURL(config.HTTPProxy); err != nil {
+			return nil, err
+		}
+	}
+	if config.HTTPMaxRetries < 0 {
+		return nil, fmt.Errorf("GENAI_HTTP_MAX_RETRIES must not be negative, got %d", config.HTTPMaxRetries)
+	}
+	if config.MaxRetryAfterSeconds < 0 {
+		return nil, fmt.Errorf("GENAI_MAX_RETRY_AFTER_SECONDS must not be negative, got %d", config.MaxRetryAfterSeconds)
+	}
+	if config.GeminiOverloadRetries < 0 {
+		return nil, fmt.Errorf("GEMINI_OVERLOAD_RETRIES must not be negative, got %d", config.GeminiOverloadRetries)
+	}
+
+	if config.TimeoutPerMegapixelSeconds < 0 || config.TimeoutPerImageSeconds < 0 {
+		return nil, fmt.Errorf("GENAI_TIMEOUT_PER_MEGAPIXEL_SECONDS and GENAI_TIMEOUT_PER_IMAGE_SECONDS must not be negative")
+	}
+	if (config.TimeoutPerMegapixelSeconds > 0 || config.TimeoutPerImageSeconds > 0) && config.TimeoutMaxSeconds < config.GenAITimeoutSeconds {
+		return nil, fmt.Errorf("GENAI_TIMEOUT_MAX_SECONDS (%d) must be >= GENAI_TIMEOUT_SECONDS (%d)", config.TimeoutMaxSeconds, config.GenAITimeoutSeconds)
+	}
+
+	if config.OSSArchiveQuality < 0 || config.OSSArchiveQuality > 100 {
+		return nil, fmt.Errorf("OSS_ARCHIVE_QUALITY must be between 0 and 100, got %d", config.OSSArchiveQuality)
+	}
+
+	if config.EditSessionTTLMinutes <= 0 {
+		return nil, fmt.Errorf("GENAI_EDIT_SESSION_TTL_MINUTES must be positive, got %d", config.EditSessionTTLMinutes)
+	}
+
+	if config.OSSURLMaxExpirySeconds <= 0 || config.OSSURLMaxExpirySeconds > 604800 {
+		return nil, fmt.Errorf("OSS_URL_MAX_EXPIRY_SECONDS must be between 1 and 604800 (7 days), got %d", config.OSSURLMaxExpirySeconds)
+	}
+	if config.OSSURLExpirySeconds == 0 {
+		config.OSSURLExpirySeconds = config.OSSURLMaxExpirySeconds
+	}
+	if config.OSSURLExpirySeconds < 0 || config.OSSURLExpirySeconds > config.OSSURLMaxExpirySeconds {
+		return nil, fmt.Errorf("OSS_URL_EXPIRY_SECONDS must be between 1 and OSS_URL_MAX_EXPIRY_SECONDS (%d), got %d", config.OSSURLMaxExpirySeconds, config.OSSURLExpirySeconds)
+	}
+	if !strings.HasPrefix(config.HealthzPath, "/") || config.HealthzPath == "/" || config.HealthzPath == "/mcp" || strings.ContainsAny(config.HealthzPath, " {}") {
+		return nil, fmt.Errorf("HEALTHZ_PATH must be an absolute path other than / and /mcp, got %q", config.HealthzPath)
+	}
+	if config.MaxImageBytes <= 0 {
+		return nil, fmt.Errorf("GENAI_MAX_IMAGE_BYTES must be positive, got %d", config.MaxImageBytes)
+	}
+	if config.OSSDegradeMaxBytes <= 0 {
+		return nil, fmt.Errorf("GENAI_OSS_DEGRADE_MAX_BYTES must be positive, got %d", config.OSSDegradeMaxBytes)
+	}
+	if config.OSSHealthCheckIntervalSeconds <= 0 {
+		return nil, fmt.Errorf("OSS_HEALTH_CHECK_INTERVAL_SECONDS must be positive, got %d", config.OSSHealthCheckIntervalSeconds)
+	}
+	if config.ThumbnailSize < 0 {
+		return nil, fmt.Errorf("GENAI_GENERATE_THUMBNAIL must not be negative, got %d", config.ThumbnailSize)
+	}
+	if config.RequireBothModels {
+		var missing []string
+		if strings.TrimSpace(config.GenAIGenModelName) == "" {
+			missing = append(missing, "GENAI_GEN_MODEL_NAME")
+		}
+		if strings.TrimSpace(config.GenAIEditModelName) == "" {
+			missing = append(missing, "GENAI_EDIT_MODEL_NAME")
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("GENAI_REQUIRE_BOTH_MODELS is enabled but %s is empty", strings.Join(missing, ", "))
+		}
+	}
+	if config.Base64MaxBytes < 0 {
+		return nil, fmt.Errorf("GENAI_BASE64_MAX_BYTES must not be negative, got %d", config.Base64MaxBytes)
+	}
+	if config.MaxEditImages < 0 {
+		return nil, fmt.Errorf("GENAI_MAX_EDIT_IMAGES must not be negative, got %d", config.MaxEditImages)
+	}
+
+	if config.ToolTimeoutSeconds < 0 {
+		return nil, fmt.Errorf("GENAI_TOOL_TIMEOUT_SECONDS must not be negative, got %d", config.ToolTimeoutSeconds)
+	}
+
+	// 校验任务轮询参数
+	if config.PollIntervalSeconds <= 0 || config.PollMaxIntervalSeconds <= 0 || config.PollMaxWaitSeconds < 0 {
+		return nil, fmt.Errorf("GENAI_POLL_INTERVAL_SECONDS and GENAI_POLL_MAX_INTERVAL_SECONDS must be positive, GENAI_POLL_MAX_WAIT_SECONDS must not be negative")
+	}
+	if config.PollBackoff < 1 {
+		return nil, fmt.Errorf("GENAI_POLL_BACKOFF must be >= 1, got %v", config.PollBackoff)
+	}
+	if config.PollJitter < 0 || config.PollJitter >= 1 {
+		return nil, fmt.Errorf("GENAI_POLL_JITTER must be in [0, 1), got %v", config.PollJitter)
+	}
+
+	for _, provider := range config.DirectURLProviders {
+		switch provider {
+		case "wan", "gemini", "apimart":
+		default:
+			return nil, fmt.Errorf("GENAI_DIRECT_URL_PROVIDERS: unsupported provider %q (expected gemini, wan or apimart)", provider)
+		}
+	}
+
+	// 根据提供方校验必需的配置（Gemini、Wan、APIMart 和 Stability 共用 GENAI_* 三个字段）
 	switch config.GenAIProvider {
-	case "wan", "gemini", "apimart":
+	case "wan", "gemini", "apimart", "stability":
 		if config.GenAIAPIKey == "" {
 			return nil, fmt.Errorf("GENAI_API_KEY is required when GENAI_PROVIDER=%s", config.GenAIProvider)
 		}
@@ -80,16 +613,18 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("unsupported GENAI_PROVIDER: %s", config.GenAIProvider)
 	}
 
-	// 初始化日志系统
-	logConfig := &LogConfig{
-		Level:    config.LogLevel,
-		Format:   config.LogFormat,
-		Output:   config.LogOutput,
-		FilePath: config.LogFile,
+	if config.EnhancePrompt {
+		if err := config.resolveEnhanceDefaults(); err != nil {
+			return nil, err
+		}
 	}
-	if err := InitLogger(logConfig); err != nil {
-		return nil, fmt.Errorf("failed to initialize logger: %w", err)
+
+	// 解析图片输出格式（auto 根据传输方式与 OSS 配置决定）
+	imageFormat, err := config.ResolveImageFormat(TransportHTTP)
+	if err != nil {
+		return nil, err
 	}
+	config.GenAIImageFormat = imageFormat
 
 	return config, nil
 }
@@ -123,11 +658,214 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvFloat 获取浮点类型环境变量
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f
+	}
+	return defaultValue
+}
+
+// getEnvWithPrefix 收集所有以 prefix 开头且值非空的环境变量，返回去掉前缀并转为小写的变量名 → 值
+func getEnvWithPrefix(prefix string) map[string]string {
+	var result map[string]string
+	for _, kv := range os.Environ() {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || v == "" || !strings.HasPrefix(k, prefix) || len(k) == len(prefix) {
+			continue
+		}
+		if result == nil {
+			result = make(map[string]string)
+		}
+		result[strings.ToLower(strings.TrimPrefix(k, prefix))] = v
+	}
+	return result
+}
+
+// getEnvList 获取逗号分隔的列表类型环境变量（忽略空项）
+// firstEnv 按顺序返回第一个非空环境变量的值
+func firstEnv(keys ...string) string {
+	return os.Getenv(firstEnvKey(keys...))
+}
+
+// firstEnvKey 按顺序返回第一个非空环境变量的名称，都为空时返回第一个
+func firstEnvKey(keys ...string) string {
+	for _, key := range keys {
+		if os.Getenv(key) != "" {
+			return key
+		}
+	}
+	return keys[0]
+}
+
+func getEnvList(key string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// reservedHeaders 由客户端自行设置、不允许被 GENAI_EXTRA_HEADERS 覆盖的请求头
+var reservedHeaders = map[string]bool{
+	"Authorization":  true,
+	"Content-Type":   true,
+	"X-Goog-Api-Key": true,
+}
+
+// IsReservedHeader 判断请求头是否由客户端保留（认证 / Content-Type），自定义头不得覆盖
+func IsReservedHeader(name string) bool {
+	return reservedHeaders[http.CanonicalHeaderKey(name)]
+}
+
+// parseExtraHeaders 解析 GENAI_EXTRA_HEADERS（JSON 对象，头名称 → 值）
+func parseExtraHeaders(raw string) (map[string]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(raw), &headers); err != nil {
+		return nil, fmt.Errorf("GENAI_EXTRA_HEADERS must be a JSON object of header name to value: %w", err)
+	}
+	return headers, nil
+}
+
+// parseObjectTags 解析 OSS_OBJECT_TAGS（逗号分隔的 key=value 列表，如 app=genai-mcp,env=prod）
+func parseObjectTags(raw string) (map[string]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	tags := make(map[string]string)
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(item, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("OSS_OBJECT_TAGS entries must be key=value, got %q", item)
+		}
+		tags[k] = strings.TrimSpace(v)
+	}
+	return tags, nil
+}
+
 // GetServerAddr 返回完整的服务器地址
 func (c *Config) GetServerAddr() string {
 	return fmt.Sprintf("%s:%s", c.ServerAddress, c.ServerPort)
 }
 
+// 对象存储后端（OSS_BACKEND）
+const (
+	OSSBackendS3     = "s3"
+	OSSBackendLocal  = "local"
+	OSSBackendGCS    = "gcs"
+	OSSBackendMemory = "memory"
+)
+
+// 服务的传输方式，用于 GENAI_IMAGE_FORMAT=auto 的决策
+const (
+	TransportHTTP  = "http"
+	TransportStdio = "stdio"
+)
+
+// IsOSSConfigured 判断 OSS 上传所需的配置是否齐全
+func (c *Config) IsOSSConfigured() bool {
+	switch c.OSSBackend {
+	case OSSBackendMemory:
+		return true
+	case OSSBackendLocal:
+		return c.OSSLocalDir != ""
+	case OSSBackendGCS:
+		return c.OSSBucket != ""
+	}
+	return c.OSSBucket != "" && c.OSSAccessKey != "" && c.OSSSecretKey != ""
+}
+
+// ResolveImageFormat 返回实际生效的图片输出格式（base64 或 url）。
+//
+// 显式配置 base64 / url 时原样返回；配置为 auto 时：
+//   - HTTP 传输且 OSS 已配置 → url（便于分享，避免大体积响应）
+//   - 其它情况（stdio 传输、或未配置 OSS）→ base64（无需对象存储）
+func (c *Config) ResolveImageFormat(transport string) (string, error) {
+	format := strings.ToLower(strings.TrimSpace(c.GenAIImageFormat))
+	switch format {
+	case "", "base64":
+		return "base64", nil
+	case "base64-raw":
+		return "base64-raw", nil
+	case "url":
+		return "url", nil
+	case "auto":
+		if transport == TransportHTTP && c.IsOSSConfigured() {
+			return "url", nil
+		}
+		return "base64", nil
+	default:
+		return "", fmt.Errorf("unsupported GENAI_IMAGE_FORMAT: %s (expected base64, base64-raw, url or auto)", c.GenAIImageFormat)
+	}
+}
+
+// DirectURLEnabled 判断 url 输出时是否对该 provider 直接返回其结果 URL（GENAI_DIRECT_URL_PROVIDERS）
+func (c *Config) DirectURLEnabled(provider string) bool {
+	for _, p := range c.DirectURLProviders {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultEnhanceModels 各 provider 扩写提示词默认使用的文本模型
+var defaultEnhanceModels = map[string]string{
+	"gemini":  "gemini-2.5-flash",
+	"wan":     "qwen-plus",
+	"apimart": "gpt-4o-mini",
+}
+
+// resolveEnhanceDefaults 补全提示词扩写（GENAI_ENHANCE_PROMPT）的默认模型、接口地址与 API Key：
+// Gemini 未设置 GENAI_ENHANCE_BASE_URL 时走 Gemini SDK；Wan 使用 DashScope 的 OpenAI 兼容模式，
+// APIMart 使用其 /v1 接口；Stability 没有文本模型，必须显式配置 GENAI_ENHANCE_BASE_URL 与 GENAI_ENHANCE_MODEL。
+func (c *Config) resolveEnhanceDefaults() error {
+	if c.EnhanceModel == "" {
+		c.EnhanceModel = defaultEnhanceModels[c.GenAIProvider]
+	}
+	if c.EnhanceAPIKey == "" {
+		c.EnhanceAPIKey = c.GenAIAPIKey
+	}
+	if c.EnhanceBaseURL == "" {
+		base := strings.TrimRight(c.GenAIBaseURL, "/")
+		switch c.GenAIProvider {
+		case "wan":
+			if base != "" {
+				c.EnhanceBaseURL = base + "/compatible-mode/v1"
+			}
+		case "apimart":
+			if base != "" {
+				c.EnhanceBaseURL = base + "/v1"
+			}
+		}
+		if c.EnhanceBaseURL == "" && c.GenAIProvider != "gemini" {
+			return fmt.Errorf("GENAI_ENHANCE_PROMPT requires GENAI_ENHANCE_BASE_URL (an OpenAI-compatible /v1 endpoint) when GENAI_PROVIDER=%s", c.GenAIProvider)
+		}
+	}
+	if c.EnhanceModel == "" {
+		return fmt.Errorf("GENAI_ENHANCE_PROMPT requires GENAI_ENHANCE_MODEL when GENAI_PROVIDER=%s", c.GenAIProvider)
+	}
+	return nil
+}
+
 // GetOSSConfig 返回 OSS 配置，用于创建 OSS 客户端
 func (c *Config) GetOSSConfig() map[string]string {
 	return map[string]string{
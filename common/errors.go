@@ -0,0 +1,120 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrorCode 机器可读的错误码，用于 MCP tool 结果中的结构化错误
+type ErrorCode string
+
+const (
+	ErrCodeInvalidArgument ErrorCode = "invalid_argument" // 参数错误，需要调用方修改输入
+	ErrCodeUnauthorized    ErrorCode = "unauthorized"     // 认证 / 权限失败
+	ErrCodeNotFound        ErrorCode = "not_found"        // 资源（如任务）不存在
+	ErrCodeRateLimited     ErrorCode = "rate_limited"     // 被上游限流
+	ErrCodeTimeout         ErrorCode = "timeout"          // 请求超时
+	ErrCodeCanceled        ErrorCode = "canceled"         // 请求被取消
+	ErrCodeUpstream        ErrorCode = "upstream_error"   // 上游服务端错误（5xx）
+	ErrCodeInternal        ErrorCode = "internal"         // 其它内部错误
+	ErrCodeQuotaExceeded   ErrorCode = "quota_exceeded"   // 超出本服务配置的用量上限（GENAI_DAILY_*_LIMIT）
+)
+
+// GenAIError 带错误码与可重试标记的错误类型。
+// 各 provider 客户端在能够判断错误类别时（如 HTTP 状态码）返回该类型，
+// tools 层据此生成结构化的错误结果。
+type GenAIError struct {
+	Code       ErrorCode
+	Message    string
+	Retryable  bool
+	StatusCode int // 上游 HTTP 状态码（如有）
+	Err        error
+}
+
+// Error 实现 error 接口
+func (e *GenAIError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+// Unwrap 支持 errors.Is / errors.As
+func (e *GenAIError) Unwrap() error {
+	return e.Err
+}
+
+// NewError 创建 GenAIError
+func NewError(code ErrorCode, retryable bool, format string, args ...interface{}) *GenAIError {
+	return &GenAIError{
+		Code:      code,
+		Message:   fmt.Sprintf(format, args...),
+		Retryable: retryable,
+	}
+}
+
+// NewHTTPStatusError 根据上游 HTTP 状态码创建 GenAIError
+func NewHTTPStatusError(statusCode int, format string, args ...interface{}) *GenAIError {
+	code, retryable := classifyHTTPStatus(statusCode)
+	return &GenAIError{
+		Code:       code,
+		Message:    fmt.Sprintf(format, args...),
+		Retryable:  retryable,
+		StatusCode: statusCode,
+	}
+}
+
+// classifyHTTPStatus 将 HTTP 状态码映射为错误码与是否可重试
+func classifyHTTPStatus(statusCode int) (ErrorCode, bool) {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrCodeUnauthorized, false
+	case statusCode == http.StatusNotFound:
+		return ErrCodeNotFound, false
+	case statusCode == http.StatusTooManyRequests:
+		return ErrCodeRateLimited, true
+	case statusCode == http.StatusRequestTimeout || statusCode == http.StatusGatewayTimeout:
+		return ErrCodeTimeout, true
+	case statusCode >= 500:
+		return ErrCodeUpstream, true
+	case statusCode >= 400:
+		return ErrCodeInvalidArgument, false
+	default:
+		return ErrCodeInternal, false
+	}
+}
+
+// WithProviderContext 为 provider 客户端返回的错误附加 provider 与模型信息（%w 包装，保留错误类别），
+// 使工具错误结果与错误日志能说明是哪个 provider / 模型失败。err 为 nil 时返回 nil，model 为空时只附加 provider。
+func WithProviderContext(err error, provider, model string) error {
+	if err == nil {
+		return nil
+	}
+	if model == "" {
+		return fmt.Errorf("%s: %w", provider, err)
+	}
+	return fmt.Errorf("%s (model %s): %w", provider, model, err)
+}
+
+// ClassifyError 从任意错误中提取 GenAIError；无法识别时根据 context 错误推断，否则归为 internal。
+func ClassifyError(err error) *GenAIError {
+	if err == nil {
+		return nil
+	}
+
+	var genaiErr *GenAIError
+	if errors.As(err, &genaiErr) {
+		return genaiErr
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return &GenAIError{Code: ErrCodeTimeout, Message: err.Error(), Retryable: true}
+	case errors.Is(err, context.Canceled):
+		return &GenAIError{Code: ErrCodeCanceled, Message: err.Error(), Retryable: true}
+	default:
+		return &GenAIError{Code: ErrCodeInternal, Message: err.Error(), Retryable: false}
+	}
+}
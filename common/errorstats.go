@@ -0,0 +1,95 @@
+package common
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrEmptyResult provider 请求成功但响应中没有图片（如被安全策略拦截、结果字段缺失）
+var ErrEmptyResult = errors.New("empty result")
+
+// ErrorCategory provider 错误分类，用于统计与日志，帮助区分配置问题、provider 故障与用量问题
+type ErrorCategory string
+
+const (
+	ErrCategoryAuth        ErrorCategory = "auth"         // 认证 / 权限失败，通常是 API key 等配置问题
+	ErrCategoryRateLimit   ErrorCategory = "rate_limit"   // 被 provider 限流
+	ErrCategoryTimeout     ErrorCategory = "timeout"      // 请求超时
+	ErrCategoryBadRequest  ErrorCategory = "bad_request"  // 4xx 参数错误、资源不存在
+	ErrCategoryServerError ErrorCategory = "server_error" // provider 5xx、网络错误或任务失败
+	ErrCategoryEmptyResult ErrorCategory = "empty_result" // 请求成功但没有返回图片
+	ErrCategoryOther       ErrorCategory = "other"        // 其它无法归类的错误
+)
+
+var (
+	providerErrorsMu sync.Mutex
+	providerErrors   = map[string]map[ErrorCategory]int64{}
+)
+
+// CategorizeError 根据错误类型（GenAIError 错误码、context 错误、ErrEmptyResult）推断错误分类。
+// 调用方主动取消的请求不属于 provider 错误，返回空字符串。
+func CategorizeError(err error) ErrorCategory {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, ErrEmptyResult) {
+		return ErrCategoryEmptyResult
+	}
+
+	switch ClassifyError(err).Code {
+	case ErrCodeUnauthorized:
+		return ErrCategoryAuth
+	case ErrCodeRateLimited:
+		return ErrCategoryRateLimit
+	case ErrCodeTimeout:
+		return ErrCategoryTimeout
+	case ErrCodeInvalidArgument, ErrCodeNotFound:
+		return ErrCategoryBadRequest
+	case ErrCodeUpstream:
+		return ErrCategoryServerError
+	case ErrCodeCanceled:
+		return ""
+	default:
+		return ErrCategoryOther
+	}
+}
+
+// RecordProviderError 按分类累计 provider 的错误次数，并以结构化 warn 日志输出本次分类与累计计数
+func RecordProviderError(provider string, err error) {
+	category := CategorizeError(err)
+	if category == "" {
+		return
+	}
+
+	providerErrorsMu.Lock()
+	counts, ok := providerErrors[provider]
+	if !ok {
+		counts = map[ErrorCategory]int64{}
+		providerErrors[provider] = counts
+	}
+	counts[category]++
+	total := counts[category]
+	providerErrorsMu.Unlock()
+
+	WithError(err).WithFields(map[string]interface{}{
+		"provider":       provider,
+		"error_category": category,
+		"category_total": total,
+	}).Warn("Provider error")
+}
+
+// ProviderErrorStats 返回各 provider 按分类累计的错误次数副本，键为 provider 名称
+func ProviderErrorStats() map[string]map[ErrorCategory]int64 {
+	providerErrorsMu.Lock()
+	defer providerErrorsMu.Unlock()
+
+	snapshot := make(map[string]map[ErrorCategory]int64, len(providerErrors))
+	for provider, counts := range providerErrors {
+		copied := make(map[ErrorCategory]int64, len(counts))
+		for category, n := range counts {
+			copied[category] = n
+		}
+		snapshot[provider] = copied
+	}
+	return snapshot
+}
@@ -0,0 +1,144 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultHTTPMaxRetries provider HTTP 请求默认的最大重试次数（不含首次请求，即最多尝试 3 次）
+const DefaultHTTPMaxRetries = 2
+
+// HTTP 重试的退避参数：第 n 次重试前等待 base*2^(n-1)（以 max 封顶），再叠加 ±25% 抖动
+const (
+	httpRetryBaseDelay = 500 * time.Millisecond
+	httpRetryMaxDelay  = 8 * time.Second
+	httpRetryJitter    = 0.25
+)
+
+// HTTPRetry Wan / APIMart 等直接发送 HTTP 请求的 provider 遇到短暂错误时的有限重试策略。
+//
+// 可重试的错误：连接错误，以及 429 / 500 / 502 / 503 / 504 响应。其它 4xx（400 / 401 / 403 等）立即失败。
+// 创建任务等非幂等请求（POST）只在请求确定未被处理时重试：建立连接失败、429 与 503，
+// 避免 500 / 502 / 504 之后重复创建付费任务。
+type HTTPRetry struct {
+	// MaxRetries 首次请求之外的最大重试次数，0 表示不重试
+	MaxRetries int
+	// MaxRetryAfter 采用 Retry-After 响应头建议等待时间的上限，超过时改用退避间隔；0 表示忽略 Retry-After
+	MaxRetryAfter time.Duration
+}
+
+// Do 调用 send 发送请求，遇到可重试的错误时等待后重试。send 返回响应体、响应头（未收到响应时为 nil）与错误。
+// 等待时间优先采用 Retry-After（以 MaxRetryAfter 为上限），否则指数退避；
+// 等待会超过 ctx 的截止时间或 ctx 结束时，不再重试并返回最后一次的错误。
+func (r HTTPRetry) Do(ctx context.Context, provider, method string, send func() ([]byte, http.Header, error)) ([]byte, error) {
+	idempotent := method == http.MethodGet || method == http.MethodHead
+	for attempt := 1; ; attempt++ {
+		body, header, err := send()
+		if err == nil || attempt > r.MaxRetries || ctx.Err() != nil || !retryableHTTPError(err, idempotent) {
+			return body, err
+		}
+
+		delay := r.delay(attempt, header)
+		fields := map[string]interface{}{
+			"provider":    provider,
+			"method":      method,
+			"attempt":     attempt,
+			"max_retries": r.MaxRetries,
+			"delay_ms":    delay.Milliseconds(),
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			WithError(err).WithFields(fields).Warn("Provider request failed, not retrying: delay exceeds the remaining timeout")
+			return body, err
+		}
+		WithError(err).WithFields(fields).Warn("Provider request failed, retrying")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return body, err
+		case <-timer.C:
+		}
+	}
+}
+
+// delay 返回第 attempt 次重试（从 1 开始）前的等待时间
+func (r HTTPRetry) delay(attempt int, header http.Header) time.Duration {
+	backoff := httpRetryBaseDelay << (attempt - 1)
+	if backoff <= 0 || backoff > httpRetryMaxDelay {
+		backoff = httpRetryMaxDelay
+	}
+	backoff = time.Duration(float64(backoff) * (1 + httpRetryJitter*(2*rand.Float64()-1)))
+
+	if r.MaxRetryAfter <= 0 || header == nil {
+		return backoff
+	}
+	suggested, ok := ParseRetryAfter(header.Get("Retry-After"), time.Now())
+	if !ok {
+		return backoff
+	}
+	if suggested > r.MaxRetryAfter {
+		WithFields(map[string]interface{}{
+			"suggested_ms": suggested.Milliseconds(),
+			"max_ms":       r.MaxRetryAfter.Milliseconds(),
+			"backoff_ms":   backoff.Milliseconds(),
+		}).Warn("Retry-After exceeds GENAI_MAX_RETRY_AFTER_SECONDS, using backoff instead")
+		return backoff
+	}
+	return suggested
+}
+
+// ParseRetryAfter 解析 Retry-After 响应头：秒数或 HTTP 日期。日期早于 now 时返回 0。
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// retryableHTTPError 判断请求错误是否值得重试（见 HTTPRetry 的说明）
+func retryableHTTPError(err error, idempotent bool) bool {
+	var genaiErr *GenAIError
+	if !errors.As(err, &genaiErr) {
+		return false
+	}
+
+	switch genaiErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	case 0:
+		// 未收到响应的连接错误：幂等请求总是重试，非幂等请求只在连接未建立时重试
+		if genaiErr.Code != ErrCodeUpstream || genaiErr.Err == nil {
+			return false
+		}
+		if idempotent {
+			return true
+		}
+		var opErr *net.OpError
+		return errors.As(genaiErr.Err, &opErr) && opErr.Op == "dial"
+	default:
+		return false
+	}
+}
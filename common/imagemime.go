@@ -0,0 +1,40 @@
+package common
+
+import (
+	"context"
+	"sync"
+)
+
+// imageMIMEKey context 中 ImageMIMERecorder 的键
+type imageMIMEKey struct{}
+
+// ImageMIMERecorder 收集 base64-raw 输出时图片的 MIME 类型。
+// 不带 data URI 前缀的 base64 无法携带 MIME 类型，由格式化图片的一方写入、tools 层读取并放入结构化输出。
+type ImageMIMERecorder struct {
+	mu       sync.Mutex
+	mimeType string
+}
+
+// WithImageMIMERecorder 在 context 中挂载一个新的 MIME 类型记录器
+func WithImageMIMERecorder(ctx context.Context) (context.Context, *ImageMIMERecorder) {
+	r := &ImageMIMERecorder{}
+	return context.WithValue(ctx, imageMIMEKey{}, r), r
+}
+
+// RecordImageMIME 记录输出图片的 MIME 类型；context 中没有记录器或类型为空时忽略
+func RecordImageMIME(ctx context.Context, mimeType string) {
+	r, ok := ctx.Value(imageMIMEKey{}).(*ImageMIMERecorder)
+	if !ok || mimeType == "" {
+		return
+	}
+	r.mu.Lock()
+	r.mimeType = mimeType
+	r.mu.Unlock()
+}
+
+// MIMEType 返回最近一次记录的 MIME 类型，未记录时为空
+func (r *ImageMIMERecorder) MIMEType() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.mimeType
+}
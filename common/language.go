@@ -0,0 +1,150 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// scriptLanguages 非拉丁文字对应的语言（ISO 639-1）；日文按假名单独判断
+var scriptLanguages = []struct {
+	table *unicode.RangeTable
+	lang  string
+	// perChar 为 true 的文字不以空格分词，按字符计数，否则按词计数
+	perChar bool
+}{
+	{unicode.Han, "zh", true},
+	{unicode.Hangul, "ko", true},
+	{unicode.Thai, "th", true},
+	{unicode.Cyrillic, "ru", false},
+	{unicode.Arabic, "ar", false},
+	{unicode.Hebrew, "he", false},
+	{unicode.Devanagari, "hi", false},
+	{unicode.Greek, "el", false},
+	{unicode.Latin, "latin", false},
+}
+
+// latinStopwords 拉丁文字语言的常见虚词，用于区分英 / 西 / 法 / 德 / 意 / 葡
+var latinStopwords = map[string][]string{
+	"en": {"the", "a", "an", "and", "of", "with", "in", "on", "at", "for", "to", "is", "by", "from"},
+	"es": {"el", "la", "los", "las", "de", "del", "y", "con", "en", "un", "una", "por", "para", "que"},
+	"fr": {"le", "la", "les", "des", "du", "de", "et", "avec", "dans", "un", "une", "sur", "pour", "au"},
+	"de": {"der", "die", "das", "und", "mit", "ein", "eine", "im", "auf", "von", "zu", "den", "dem", "des"},
+	"it": {"il", "lo", "la", "gli", "le", "di", "del", "della", "e", "con", "un", "una", "per", "nel"},
+	"pt": {"o", "a", "os", "as", "de", "do", "da", "e", "com", "em", "um", "uma", "para", "no", "na"},
+}
+
+// latinLanguages 拉丁文字语言的判定顺序（得分相同时靠前的优先）
+var latinLanguages = []string{"en", "es", "fr", "de", "it", "pt"}
+
+// latinMarkers 只出现在某一种语言中的字母
+var latinMarkers = map[rune]string{'ñ': "es", 'ß': "de", 'ã': "pt", 'õ': "pt"}
+
+// DetectLanguage 轻量的提示词语言检测，返回 ISO 639-1 语言代码（如 en、zh、ja），无法判断（没有文字）时返回空字符串。
+//
+// 先按文字判断：含假名为 ja，否则取占比最高的文字（汉字 / 谚文 / 泰文按字符计数，其它按词计数）；
+// 拉丁文字再按常见虚词与特有字母区分英 / 西 / 法 / 德 / 意 / 葡，都未命中时视为 en。
+func DetectLanguage(text string) string {
+	counts := make(map[string]int)
+	inWord := ""
+	for _, r := range text {
+		if unicode.In(r, unicode.Hiragana, unicode.Katakana) {
+			return "ja"
+		}
+		script := ""
+		for _, s := range scriptLanguages {
+			if unicode.Is(s.table, r) {
+				script = s.lang
+				if s.perChar {
+					counts[script]++
+					script = ""
+				}
+				break
+			}
+		}
+		if script != "" && script != inWord {
+			counts[script]++
+		}
+		inWord = script
+	}
+
+	best, bestCount := "", 0
+	for _, s := range scriptLanguages {
+		if counts[s.lang] > bestCount {
+			best, bestCount = s.lang, counts[s.lang]
+		}
+	}
+	if best == "latin" {
+		return detectLatinLanguage(text)
+	}
+	return best
+}
+
+// detectLatinLanguage 按常见虚词与特有字母区分拉丁文字语言，都未命中时返回 en
+func detectLatinLanguage(text string) string {
+	scores := make(map[string]int)
+	lower := strings.ToLower(text)
+	for _, r := range lower {
+		if lang, ok := latinMarkers[r]; ok {
+			scores[lang] += 2
+		}
+	}
+	words := strings.FieldsFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) })
+	for _, w := range words {
+		for lang, stopwords := range latinStopwords {
+			for _, sw := range stopwords {
+				if w == sw {
+					scores[lang]++
+					break
+				}
+			}
+		}
+	}
+
+	best, bestScore := "en", 0
+	for _, lang := range latinLanguages {
+		if scores[lang] > bestScore {
+			best, bestScore = lang, scores[lang]
+		}
+	}
+	return best
+}
+
+// parseLanguageModels 解析语言 → 模型的路由表（JSON 对象），语言代码不区分大小写，模型名按别名表规范化。为空时返回 nil。
+func parseLanguageModels(env, raw string, aliases map[string]string) (map[string]string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+
+	var models map[string]string
+	if err := json.Unmarshal([]byte(raw), &models); err != nil {
+		return nil, fmt.Errorf("%s must be a JSON object of language code to model name: %w", env, err)
+	}
+	normalized := make(map[string]string, len(models))
+	for lang, model := range models {
+		model = ResolveModelName(model, aliases)
+		if model == "" {
+			return nil, fmt.Errorf("%s: model for language %q must not be empty", env, lang)
+		}
+		normalized[strings.ToLower(strings.TrimSpace(lang))] = model
+	}
+	return normalized, nil
+}
+
+type routedModelKey struct{}
+
+// WithRoutedModel 为本次请求指定模型（如按提示词语言路由），覆盖 provider 客户端配置的模型
+func WithRoutedModel(ctx context.Context, model string) context.Context {
+	return context.WithValue(ctx, routedModelKey{}, model)
+}
+
+// RoutedModel 返回本次请求应使用的模型：设置了路由模型时返回它，否则返回配置的模型
+func RoutedModel(ctx context.Context, configured string) string {
+	if model, ok := ctx.Value(routedModelKey{}).(string); ok && model != "" {
+		return model
+	}
+	return configured
+}
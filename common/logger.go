@@ -26,6 +26,8 @@ type LogConfig struct {
 	MaxBackups int    // 保留的旧日志文件数量
 	MaxAge     int    // 保留日志文件的天数
 	Compress   bool   // 是否压缩旧日志文件
+	// SubsystemLevels 子系统 → 日志级别（如 oss: debug），未配置的子系统使用 Level
+	SubsystemLevels map[string]string
 }
 
 // InitLogger 初始化日志系统
@@ -72,6 +74,22 @@ func InitLogger(cfg *LogConfig) error {
 	}
 	logger.SetOutput(output)
 
+	// 按子系统设置级别：Logger 放开到最详细的级别，由 hook 过滤后写入实际输出
+	if len(cfg.SubsystemLevels) > 0 {
+		levels, lowest, err := parseSubsystemLevels(level, cfg.SubsystemLevels)
+		if err != nil {
+			return fmt.Errorf("invalid subsystem log level: %w", err)
+		}
+		logger.AddHook(&subsystemLevelHook{
+			global:    level,
+			levels:    levels,
+			formatter: logger.Formatter,
+			out:       output,
+		})
+		logger.SetLevel(lowest)
+		logger.SetOutput(io.Discard)
+	}
+
 	Logger = logger
 	return nil
 }
@@ -167,11 +185,29 @@ func WithField(key string, value interface{}) *logrus.Entry {
 	return GetLogger().WithField(key, value)
 }
 
-// WithFields 添加多个字段到日志
+// WithFields 添加多个字段到日志。
+// fields 应为本次调用新建的 map：传入后不得再修改或复用，也不要在 goroutine 间共享；
+// 需要组合多组字段时使用 MergeFields 生成新的 map。
 func WithFields(fields map[string]interface{}) *logrus.Entry {
 	return GetLogger().WithFields(logrus.Fields(fields))
 }
 
+// MergeFields 将多组日志字段合并为一个新的 map，同名字段以后面的为准。
+// 不修改任何传入的 map，可安全用于并发的处理函数（传入的 map 本身不得被并发写入）。
+func MergeFields(fieldSets ...map[string]interface{}) map[string]interface{} {
+	size := 0
+	for _, fields := range fieldSets {
+		size += len(fields)
+	}
+	merged := make(map[string]interface{}, size)
+	for _, fields := range fieldSets {
+		for k, v := range fields {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
 // WithError 添加错误到日志
 func WithError(err error) *logrus.Entry {
 	return GetLogger().WithError(err)
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TestMergeFieldsConcurrent 多个 goroutine 以同一组共享字段调用 MergeFields / WithFields 并输出日志，
+// 应当没有数据竞争（以 go test -race 运行），且共享的 map 不被修改
+func TestMergeFieldsConcurrent(t *testing.T) {
+	saved := Logger
+	defer func() { Logger = saved }()
+	Logger = logrus.New()
+	Logger.SetOutput(io.Discard)
+	Logger.SetLevel(logrus.DebugLevel)
+	Logger.SetFormatter(newFormatter("json"))
+
+	base := map[string]interface{}{"provider": "wan", "model": "wan2.2-t2i-flash"}
+	overrides := map[string]interface{}{"model": "wan2.5-t2i-preview", "stage": "query"}
+
+	const workers = 16
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				fields := MergeFields(base, overrides, map[string]interface{}{"worker": i, "iteration": j})
+				WithFields(fields).Info("concurrent log line")
+				WithFields(base).WithField("worker", i).Debug("shared fields")
+				WithRequestID(ContextWithRequestID(t.Context(), fmt.Sprintf("req-%d", i))).WithFields(MergeFields(base)).Info("with request id")
+
+				if fields["model"] != "wan2.5-t2i-preview" || fields["worker"] != i || fields["provider"] != "wan" {
+					t.Errorf("MergeFields = %v, want later sets to override earlier ones", fields)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(base) != 2 || base["model"] != "wan2.2-t2i-flash" {
+		t.Errorf("shared base fields were modified: %v", base)
+	}
+	if len(overrides) != 2 {
+		t.Errorf("shared override fields were modified: %v", overrides)
+	}
+}
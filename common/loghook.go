@@ -0,0 +1,129 @@
+package common
+
+import (
+	"io"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SubsystemField 日志条目中标记所属子系统的字段名
+const SubsystemField = "subsystem"
+
+// subsystemLevelHook 按子系统过滤日志的 logrus hook。
+//
+// logrus 的 hook 无法丢弃日志条目，因此启用按子系统级别时，Logger 本身的级别设为所有配置中最详细的级别、
+// 输出指向 io.Discard，由该 hook 为条目打上 subsystem 字段，按子系统级别（未配置时使用全局级别）过滤后
+// 自行格式化并写入真正的输出。
+type subsystemLevelHook struct {
+	global    logrus.Level
+	levels    map[string]logrus.Level
+	formatter logrus.Formatter
+
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// Levels 实现 logrus.Hook，对所有级别生效
+func (h *subsystemLevelHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire 实现 logrus.Hook：标记子系统并按对应级别决定是否输出
+func (h *subsystemLevelHook) Fire(entry *logrus.Entry) error {
+	subsystem, ok := entry.Data[SubsystemField].(string)
+	if !ok || subsystem == "" {
+		caller := entry.Caller
+		if caller == nil || strings.HasSuffix(filepath.ToSlash(caller.File), "/common/logger.go") {
+			// 通过 common.Info 等包装函数记录时，logrus 报告的调用方是 logger.go，需要再向外查找
+			caller = callerOutsideLogger()
+		}
+		subsystem = subsystemFromCaller(caller)
+		entry.Data[SubsystemField] = subsystem
+	}
+
+	threshold, ok := h.levels[subsystem]
+	if !ok {
+		threshold = h.global
+	}
+	if entry.Level > threshold {
+		return nil
+	}
+
+	data, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err = h.out.Write(data)
+	return err
+}
+
+// callerOutsideLogger 返回调用栈中第一个不属于 logrus 与 common 日志包装的帧
+func callerOutsideLogger() *runtime.Frame {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		file := filepath.ToSlash(frame.File)
+		if !strings.Contains(file, "/sirupsen/logrus") &&
+			!strings.HasSuffix(file, "/common/logger.go") &&
+			!strings.HasSuffix(file, "/common/loghook.go") {
+			return &frame
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+// subsystemFromCaller 根据调用方源文件路径推断子系统：
+// internal/genai/<provider>/ → provider（gemini / wan / apimart / stability），internal/<pkg>/ → pkg（oss / tools / utils …），
+// common/ → common，其余（main 包）→ server。
+func subsystemFromCaller(caller *runtime.Frame) string {
+	if caller == nil {
+		return "server"
+	}
+	dir := path.Dir(filepath.ToSlash(caller.File))
+
+	if _, rest, ok := strings.Cut(dir, "/internal/genai/"); ok {
+		return firstSegment(rest)
+	}
+	if _, rest, ok := strings.Cut(dir, "/internal/"); ok {
+		return firstSegment(rest)
+	}
+	if path.Base(dir) == "common" {
+		return "common"
+	}
+	return "server"
+}
+
+// firstSegment 返回路径的第一段
+func firstSegment(p string) string {
+	seg, _, _ := strings.Cut(p, "/")
+	return seg
+}
+
+// parseSubsystemLevels 解析各子系统的日志级别，返回其中最详细的级别（用于设置 Logger 本身的级别）
+func parseSubsystemLevels(global logrus.Level, raw map[string]string) (map[string]logrus.Level, logrus.Level, error) {
+	levels := make(map[string]logrus.Level, len(raw))
+	lowest := global
+	for subsystem, value := range raw {
+		level, err := logrus.ParseLevel(value)
+		if err != nil {
+			return nil, global, err
+		}
+		levels[strings.ToLower(subsystem)] = level
+		if level > lowest {
+			lowest = level
+		}
+	}
+	return levels, lowest, nil
+}
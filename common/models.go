@@ -0,0 +1,129 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// defaultModelAliases 内置的模型别名表（小写别名 → provider 模型 ID），
+// 覆盖常见的简写与旧名称。可通过 GENAI_MODEL_ALIASES 覆盖或补充。
+var defaultModelAliases = map[string]string{
+	"gemini-3-pro":                   "gemini-3-pro-image-preview",
+	"gemini-3-pro-image":             "gemini-3-pro-image-preview",
+	"gemini-2.5-flash-image-preview": "gemini-2.5-flash-image",
+	"nano-banana":                    "gemini-2.5-flash-image",
+	"nano-banana-pro":                "gemini-3-pro-image-preview",
+}
+
+// parseModelAliases 解析 GENAI_MODEL_ALIASES（JSON 对象，别名 → 模型 ID），别名不区分大小写。为空时返回 nil。
+func parseModelAliases(raw string) (map[string]string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+
+	var aliases map[string]string
+	if err := json.Unmarshal([]byte(raw), &aliases); err != nil {
+		return nil, fmt.Errorf("GENAI_MODEL_ALIASES must be a JSON object of alias to model ID: %w", err)
+	}
+	normalized := make(map[string]string, len(aliases))
+	for alias, model := range aliases {
+		model = strings.TrimSpace(model)
+		if model == "" {
+			return nil, fmt.Errorf("GENAI_MODEL_ALIASES: model ID for alias %q must not be empty", alias)
+		}
+		normalized[strings.ToLower(strings.TrimSpace(alias))] = model
+	}
+	return normalized, nil
+}
+
+// ResolveModelName 将模型名规范化为 provider 的模型 ID：去掉首尾空白后按别名表（不区分大小写）映射，
+// 优先使用 overrides，其次内置表；未命中别名时原样返回（保留大小写）。
+func ResolveModelName(name string, overrides map[string]string) string {
+	name = strings.TrimSpace(name)
+	key := strings.ToLower(name)
+	if model, ok := overrides[key]; ok {
+		return model
+	}
+	if model, ok := defaultModelAliases[key]; ok {
+		return model
+	}
+	return name
+}
+
+// resolveModelNames 将配置中的生成 / 编辑模型名规范化为 provider 模型 ID，
+// 保证图片数上限、价格表与 API 调用都使用规范名称；发生映射时记录日志。
+func (c *Config) resolveModelNames() {
+	for _, m := range []struct {
+		env  string
+		name *string
+	}{
+		{"GENAI_GEN_MODEL_NAME", &c.GenAIGenModelName},
+		{"GENAI_EDIT_MODEL_NAME", &c.GenAIEditModelName},
+	} {
+		resolved := ResolveModelName(*m.name, c.GenAIModelAliases)
+		if resolved != *m.name {
+			WithFields(map[string]interface{}{
+				"setting":  m.env,
+				"alias":    *m.name,
+				"model_id": resolved,
+			}).Info("Resolved model alias")
+		}
+		*m.name = resolved
+	}
+}
+
+// ModelPair provider 客户端使用的生成 / 编辑模型。只配置了其中之一时另一个复用它，
+// 并记录是哪一个为复用，以便严格模式（GENAI_STRICT_MODELS）拒绝使用未显式配置的模型。
+type ModelPair struct {
+	Gen        string
+	Edit       string
+	GenReused  bool // 生成模型未配置，复用了编辑模型
+	EditReused bool // 编辑模型未配置，复用了生成模型
+	Strict     bool // 严格模式：调用未显式配置的模型时返回错误
+}
+
+// NewModelPair 补齐只配置了一个的生成 / 编辑模型，发生复用时记录 warn 日志
+func NewModelPair(provider, gen, edit string, strict bool) ModelPair {
+	p := ModelPair{Gen: gen, Edit: edit, Strict: strict}
+	if p.Gen == "" && p.Edit != "" {
+		p.Gen, p.GenReused = p.Edit, true
+		warnModelReused(provider, "generate", "GENAI_GEN_MODEL_NAME", p.Edit, strict)
+	}
+	if p.Edit == "" && p.Gen != "" {
+		p.Edit, p.EditReused = p.Gen, true
+		warnModelReused(provider, "edit", "GENAI_EDIT_MODEL_NAME", p.Gen, strict)
+	}
+	return p
+}
+
+// warnModelReused 记录某类操作复用另一类操作模型的 warn 日志
+func warnModelReused(provider, operation, env, model string, strict bool) {
+	msg := "Model not configured for operation, reusing the other configured model"
+	if strict {
+		msg = "Model not configured for operation, calls will be rejected (GENAI_STRICT_MODELS)"
+	}
+	WithFields(map[string]interface{}{
+		"provider":  provider,
+		"operation": operation,
+		"setting":   env,
+		"model":     model,
+	}).Warn(msg)
+}
+
+// CheckGenerate 严格模式下生成模型为复用时返回错误
+func (p ModelPair) CheckGenerate() error {
+	if p.Strict && p.GenReused {
+		return NewError(ErrCodeInternal, false, "no generate model configured: set GENAI_GEN_MODEL_NAME (GENAI_STRICT_MODELS is enabled)")
+	}
+	return nil
+}
+
+// CheckEdit 严格模式下编辑模型为复用时返回错误
+func (p ModelPair) CheckEdit() error {
+	if p.Strict && p.EditReused {
+		return NewError(ErrCodeInternal, false, "no edit model configured: set GENAI_EDIT_MODEL_NAME (GENAI_STRICT_MODELS is enabled)")
+	}
+	return nil
+}
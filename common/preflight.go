@@ -0,0 +1,55 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ConfiguredModel 启动预检中待验证的模型及其来源配置项
+type ConfiguredModel struct {
+	Role string // generate / edit
+	Env  string // 配置项名称，用于错误信息
+	Name string
+}
+
+// ConfiguredModels 返回需要预检的生成与编辑模型；两者相同时只返回一次
+func ConfiguredModels(genModel, editModel string) []ConfiguredModel {
+	models := []ConfiguredModel{{Role: "generate", Env: "GENAI_GEN_MODEL_NAME", Name: genModel}}
+	if editModel != genModel {
+		models = append(models, ConfiguredModel{Role: "edit", Env: "GENAI_EDIT_MODEL_NAME", Name: editModel})
+	}
+	return models
+}
+
+// String 返回用于错误信息的模型描述，如 generate model "wanx-v1" (GENAI_GEN_MODEL_NAME)
+func (m ConfiguredModel) String() string {
+	return fmt.Sprintf("%s model %q (%s)", m.Role, m.Name, m.Env)
+}
+
+// CheckModelsListed 解析 OpenAI 兼容的模型列表响应（{"data":[{"id":"..."}]}），
+// 校验每个配置的模型都在列表中；缺失时返回指明模型与配置项的错误
+func CheckModelsListed(provider string, models []ConfiguredModel, body []byte) error {
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return fmt.Errorf("failed to parse %s model list: %w", provider, err)
+	}
+	if len(list.Data) == 0 {
+		return fmt.Errorf("%s model list is empty", provider)
+	}
+
+	available := make(map[string]bool, len(list.Data))
+	for _, m := range list.Data {
+		available[strings.ToLower(m.ID)] = true
+	}
+	for _, m := range models {
+		if !available[strings.ToLower(m.Name)] {
+			return fmt.Errorf("%s is not available from %s; check the model name for typos", m, provider)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package common
+
+import (
+	"context"
+	"sync"
+)
+
+// providerPromptKey context 中 ProviderPromptRecorder 的键
+type providerPromptKey struct{}
+
+// ProviderPromptRecorder 收集 provider 在响应中报告的改写后提示词（如 revised_prompt）。
+// 查询结果只返回图片的 provider 无法通过返回值带出提示词，由 client 写入、tools 层读取。
+type ProviderPromptRecorder struct {
+	mu     sync.Mutex
+	prompt string
+}
+
+// WithProviderPromptRecorder 在 context 中挂载一个新的提示词记录器
+func WithProviderPromptRecorder(ctx context.Context) (context.Context, *ProviderPromptRecorder) {
+	r := &ProviderPromptRecorder{}
+	return context.WithValue(ctx, providerPromptKey{}, r), r
+}
+
+// RecordProviderPrompt 记录 provider 报告的改写后提示词；context 中没有记录器或提示词为空时忽略
+func RecordProviderPrompt(ctx context.Context, prompt string) {
+	r, ok := ctx.Value(providerPromptKey{}).(*ProviderPromptRecorder)
+	if !ok || prompt == "" {
+		return
+	}
+	r.mu.Lock()
+	r.prompt = prompt
+	r.mu.Unlock()
+}
+
+// Prompt 返回最近一次记录的提示词，未记录时为空
+func (r *ProviderPromptRecorder) Prompt() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.prompt
+}
@@ -0,0 +1,113 @@
+package common
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+var (
+	proxyMu sync.RWMutex
+	// proxyURL 出站 HTTP 代理（GENAI_HTTP_PROXY），nil 表示直连
+	proxyURL *url.URL
+	// proxyFunc 按 GENAI_NO_PROXY 判断请求是否走代理
+	proxyFunc func(*url.URL) (*url.URL, error)
+)
+
+// SetHTTPProxy 设置所有出站 HTTP 请求（provider、图片下载、OSS）使用的代理（通常在启动时根据配置调用一次）。
+// proxy 为空表示直连；noProxy 中的主机（域名后缀、IP、CIDR，或 "*"）不走代理。
+func SetHTTPProxy(proxy string, noProxy []string) error {
+	proxyMu.Lock()
+	defer proxyMu.Unlock()
+
+	if proxy == "" {
+		proxyURL, proxyFunc = nil, nil
+		return nil
+	}
+	u, err := parseProxyURL(proxy)
+	if err != nil {
+		return err
+	}
+	cfg := &httpproxy.Config{
+		HTTPProxy:  u.String(),
+		HTTPSProxy: u.String(),
+		NoProxy:    strings.Join(noProxy, ","),
+	}
+	proxyURL, proxyFunc = u, cfg.ProxyFunc()
+	return nil
+}
+
+// parseProxyURL 解析代理地址，未写协议时按 http:// 处理
+func parseProxyURL(proxy string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GENAI_HTTP_PROXY: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid GENAI_HTTP_PROXY scheme %q: expected http, https or socks5", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid GENAI_HTTP_PROXY: missing host")
+	}
+	return u, nil
+}
+
+// HTTPProxy 作为 http.Transport.Proxy 使用：返回请求应使用的代理，不走代理时返回 nil
+func HTTPProxy(req *http.Request) (*url.URL, error) {
+	proxyMu.RLock()
+	f := proxyFunc
+	proxyMu.RUnlock()
+	if f == nil {
+		return nil, nil
+	}
+	return f(req.URL)
+}
+
+// HTTPProxyAddr 返回代理的 host:port（未配置代理时为空），
+// 供连接前校验目标地址的 Transport（图片下载的 SSRF 防护）放行到代理本身的连接
+func HTTPProxyAddr() string {
+	proxyMu.RLock()
+	defer proxyMu.RUnlock()
+	if proxyURL == nil {
+		return ""
+	}
+	port := proxyURL.Port()
+	if port == "" {
+		switch proxyURL.Scheme {
+		case "https":
+			port = "443"
+		case "socks5", "socks5h":
+			port = "1080"
+		default:
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
+
+// NewHTTPTransport 基于 http.DefaultTransport 创建 Transport，按 GENAI_HTTP_PROXY / GENAI_NO_PROXY 使用代理。
+// 所有出站 http.Client 都应使用它（或 NewHTTPClient），而不是直接使用默认 Transport。
+func NewHTTPTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = HTTPProxy
+	return transport
+}
+
+// NewHTTPClient 创建使用 NewHTTPTransport 的 http.Client，timeout 为 0 表示不设置整体超时
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: NewHTTPTransport(),
+	}
+}
@@ -0,0 +1,125 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RateLimit provider 响应头中的限流信息。字段均为可选，provider 未返回的字段为空。
+type RateLimit struct {
+	// Provider 返回限流信息的 provider（gemini / wan / apimart / stability）
+	Provider string `json:"provider"`
+	// Limit 当前窗口内允许的请求数
+	Limit *int64 `json:"limit,omitempty"`
+	// Remaining 当前窗口内剩余的请求数
+	Remaining *int64 `json:"remaining,omitempty"`
+	// Reset 额度重置时间，原样保留 provider 返回的值（秒数或时间戳，取决于 provider）
+	Reset string `json:"reset,omitempty"`
+}
+
+// 各字段依次尝试的响应头：常见的 X-RateLimit-*、按请求数计的 *-Requests 变体与 IETF 草案的 RateLimit-*
+var (
+	rateLimitLimitHeaders     = []string{"X-RateLimit-Limit", "X-RateLimit-Limit-Requests", "RateLimit-Limit"}
+	rateLimitRemainingHeaders = []string{"X-RateLimit-Remaining", "X-RateLimit-Remaining-Requests", "RateLimit-Remaining"}
+	rateLimitResetHeaders     = []string{"X-RateLimit-Reset", "X-RateLimit-Reset-Requests", "RateLimit-Reset"}
+)
+
+// ParseRateLimitHeaders 从响应头解析限流信息；没有任何限流头时返回 nil
+func ParseRateLimitHeaders(provider string, header http.Header) *RateLimit {
+	if header == nil {
+		return nil
+	}
+	rl := &RateLimit{
+		Provider:  provider,
+		Limit:     headerInt(header, rateLimitLimitHeaders),
+		Remaining: headerInt(header, rateLimitRemainingHeaders),
+		Reset:     headerValue(header, rateLimitResetHeaders),
+	}
+	if rl.Limit == nil && rl.Remaining == nil && rl.Reset == "" {
+		return nil
+	}
+	return rl
+}
+
+// headerValue 返回 names 中第一个非空响应头的值
+func headerValue(header http.Header, names []string) string {
+	for _, name := range names {
+		if v := strings.TrimSpace(header.Get(name)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// headerInt 返回 names 中第一个可解析为整数的响应头的值
+func headerInt(header http.Header, names []string) *int64 {
+	for _, name := range names {
+		v := strings.TrimSpace(header.Get(name))
+		if v == "" {
+			continue
+		}
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return &n
+		}
+	}
+	return nil
+}
+
+// rateLimitKey context 中 RateLimitRecorder 的键
+type rateLimitKey struct{}
+
+// RateLimitRecorder 收集一次工具调用中 provider 最近一次返回的限流信息。
+// 发送 provider 请求的一方写入，tools 层读取并放入结构化输出的 rate_limit 字段。
+type RateLimitRecorder struct {
+	mu sync.Mutex
+	rl *RateLimit
+}
+
+// WithRateLimitRecorder 在 context 中挂载一个新的限流信息记录器
+func WithRateLimitRecorder(ctx context.Context) (context.Context, *RateLimitRecorder) {
+	r := &RateLimitRecorder{}
+	return context.WithValue(ctx, rateLimitKey{}, r), r
+}
+
+// RecordRateLimit 解析 provider 响应头中的限流信息，记录日志并写入 context 中的记录器（如有）。
+// 没有限流头时忽略；剩余额度为 0 时记录警告。
+func RecordRateLimit(ctx context.Context, provider string, header http.Header) {
+	rl := ParseRateLimitHeaders(provider, header)
+	if rl == nil {
+		return
+	}
+
+	fields := map[string]interface{}{"provider": provider}
+	if rl.Limit != nil {
+		fields["rate_limit"] = *rl.Limit
+	}
+	if rl.Remaining != nil {
+		fields["rate_limit_remaining"] = *rl.Remaining
+	}
+	if rl.Reset != "" {
+		fields["rate_limit_reset"] = rl.Reset
+	}
+	if rl.Remaining != nil && *rl.Remaining <= 0 {
+		WithFields(fields).Warn("Provider rate limit exhausted")
+	} else {
+		WithFields(fields).Debug("Provider rate limit")
+	}
+
+	r, ok := ctx.Value(rateLimitKey{}).(*RateLimitRecorder)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	r.rl = rl
+	r.mu.Unlock()
+}
+
+// RateLimit 返回最近一次记录的限流信息，未记录时为 nil
+func (r *RateLimitRecorder) RateLimit() *RateLimit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rl
+}
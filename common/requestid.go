@@ -0,0 +1,59 @@
+package common
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader 调用方可通过该 HTTP 头传入自己的请求 ID，便于与上游系统的日志关联
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength 调用方传入的请求 ID 的最大长度，超长时截断，避免日志被任意长度的头部撑大
+const maxRequestIDLength = 128
+
+// requestIDKey context 中请求 ID 的键
+type requestIDKey struct{}
+
+// NewRequestID 生成一个新的请求 ID（16 字节随机数的十六进制）
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// ContextWithRequestID 在 context 中设置请求 ID；id 为空时原样返回 ctx
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return ctx
+	}
+	if len(id) > maxRequestIDLength {
+		id = id[:maxRequestIDLength]
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext 返回 context 中的请求 ID，没有时返回空字符串
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithRequestID 返回带有 context 中请求 ID（request_id 字段）的日志条目，
+// 用法：common.WithRequestID(ctx).WithFields(...)。context 中没有请求 ID 时与直接使用 WithFields 等价。
+func WithRequestID(ctx context.Context) *logrus.Entry {
+	entry := logrus.NewEntry(GetLogger())
+	if id := RequestIDFromContext(ctx); id != "" {
+		entry = entry.WithField("request_id", id)
+	}
+	return entry
+}
@@ -0,0 +1,11 @@
+package common
+
+// EmptyJSONObject 返回空 JSON 对象 {}。
+//
+// provider 返回 2xx 且响应体为空（如 204 No Content）时，doRequest 以它代替空字节，
+// 使调用方的 json.Unmarshal 得到零值结构体，而不是 "unexpected end of JSON input"。
+// 需要特定字段的调用方应继续校验字段（如 task_id）并返回明确的错误；
+// 不返回内容的操作（取消 / 删除等）可直接视为成功。
+func EmptyJSONObject() []byte {
+	return []byte("{}")
+}
@@ -0,0 +1,58 @@
+package common
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultTaskQueryConcurrency 批量查询任务时的默认并发数
+const DefaultTaskQueryConcurrency = 8
+
+// TaskQueryResult 批量查询中单个任务的查询结果
+type TaskQueryResult struct {
+	TaskID string
+	Result string // 与单任务查询接口的返回值一致
+	Err    error
+	// ProviderPrompt provider 报告的改写后提示词（查询时通过 RecordProviderPrompt 记录，如 APIMart 的 revised_prompt）
+	ProviderPrompt string
+	// MimeType base64-raw 输出时结果图片的 MIME 类型（查询时通过 RecordImageMIME 记录）
+	MimeType string
+}
+
+// QueryTasksConcurrently 对不支持批量查询接口的 provider，在内部以有限并发逐个查询任务，
+// 并按输入顺序汇总为一个批量结果。单个任务失败不影响其它任务，错误记录在对应结果的 Err 中。
+func QueryTasksConcurrently(ctx context.Context, taskIDs []string, concurrency int, query func(ctx context.Context, taskID string) (string, error)) []TaskQueryResult {
+	if concurrency <= 0 {
+		concurrency = DefaultTaskQueryConcurrency
+	}
+
+	results := make([]TaskQueryResult, len(taskIDs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, taskID := range taskIDs {
+		results[i].TaskID = taskID
+
+		wg.Add(1)
+		go func(i int, taskID string) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				results[i].Err = ctx.Err()
+				return
+			}
+
+			taskCtx, prompt := WithProviderPromptRecorder(ctx)
+			taskCtx, mime := WithImageMIMERecorder(taskCtx)
+			results[i].Result, results[i].Err = query(taskCtx, taskID)
+			results[i].ProviderPrompt = prompt.Prompt()
+			results[i].MimeType = mime.MIMEType()
+		}(i, taskID)
+	}
+
+	wg.Wait()
+	return results
+}
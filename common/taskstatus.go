@@ -0,0 +1,33 @@
+package common
+
+// 统一的任务状态取值，各 provider 的原始状态映射到其中之一
+const (
+	TaskStatusPending   = "pending"
+	TaskStatusRunning   = "running"
+	TaskStatusSucceeded = "succeeded"
+	TaskStatusFailed    = "failed"
+)
+
+// TaskStatus 与 provider 无关的异步任务状态，由各 provider 从自身的查询响应解析得到，
+// 使调用方无需理解各家不同的响应 JSON 结构。
+type TaskStatus struct {
+	TaskID string `json:"task_id"`
+	// Status 统一状态：pending / running / succeeded / failed
+	Status string `json:"status"`
+	// ProviderStatus provider 返回的原始状态，便于排查映射问题
+	ProviderStatus string `json:"provider_status,omitempty"`
+	// Progress 任务进度（0-100），provider 未报告时为空
+	Progress *int `json:"progress,omitempty"`
+	// ImageURLs 任务成功时的结果图片，已按 GENAI_IMAGE_FORMAT 格式化（URL、data URI 或纯 base64）
+	ImageURLs []string `json:"image_urls,omitempty"`
+	// Error 任务失败时的错误信息
+	Error string `json:"error,omitempty"`
+	// Requested 创建任务时请求的图片数（provider 报告时，如 Wan 的 task_metrics），0 表示未知；
+	// 由 tools 层与返回的图片数一起放入结构化输出的 image_count
+	Requested int `json:"-"`
+}
+
+// Finished 判断任务是否已进入终态（成功或失败）
+func (s *TaskStatus) Finished() bool {
+	return s.Status == TaskStatusSucceeded || s.Status == TaskStatusFailed
+}
@@ -0,0 +1,40 @@
+package common
+
+import (
+	"context"
+	"sync"
+)
+
+// thumbnailKey context 中 ThumbnailRecorder 的键
+type thumbnailKey struct{}
+
+// ThumbnailRecorder 收集结果图片缩略图的 URL（GENAI_GENERATE_THUMBNAIL）。
+// 上传结果图片的一方生成并上传缩略图后写入，tools 层读取并放入结构化输出的 thumbnail_url。
+type ThumbnailRecorder struct {
+	mu  sync.Mutex
+	url string
+}
+
+// WithThumbnailRecorder 在 context 中挂载一个新的缩略图记录器
+func WithThumbnailRecorder(ctx context.Context) (context.Context, *ThumbnailRecorder) {
+	r := &ThumbnailRecorder{}
+	return context.WithValue(ctx, thumbnailKey{}, r), r
+}
+
+// RecordThumbnailURL 记录缩略图 URL；context 中没有记录器或 URL 为空时忽略
+func RecordThumbnailURL(ctx context.Context, url string) {
+	r, ok := ctx.Value(thumbnailKey{}).(*ThumbnailRecorder)
+	if !ok || url == "" {
+		return
+	}
+	r.mu.Lock()
+	r.url = url
+	r.mu.Unlock()
+}
+
+// URL 返回最近一次记录的缩略图 URL，未记录时为空
+func (r *ThumbnailRecorder) URL() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.url
+}
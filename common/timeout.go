@@ -0,0 +1,86 @@
+package common
+
+import (
+	"context"
+	"time"
+)
+
+// TimeoutScaling 按请求规模放大单次请求超时：
+//
+//	超时 = Base + PerMegapixel × 输出总百万像素 + PerImage × 涉及的图片数（输入 + 输出）
+//
+// 结果不小于 Base，且在 Max > Base 时不超过 Max。两个增量都为 0 时始终使用 Base。
+type TimeoutScaling struct {
+	Base         time.Duration
+	PerMegapixel time.Duration
+	PerImage     time.Duration
+	Max          time.Duration
+}
+
+// NewTimeoutScaling 从配置构建超时放大参数，Base 为 GENAI_TIMEOUT_SECONDS
+func NewTimeoutScaling(cfg *Config) TimeoutScaling {
+	return TimeoutScaling{
+		Base:         time.Duration(cfg.GenAITimeoutSeconds) * time.Second,
+		PerMegapixel: time.Duration(cfg.TimeoutPerMegapixelSeconds * float64(time.Second)),
+		PerImage:     time.Duration(cfg.TimeoutPerImageSeconds * float64(time.Second)),
+		Max:          time.Duration(cfg.TimeoutMaxSeconds) * time.Second,
+	}
+}
+
+// For 返回输出总像素为 megapixels、涉及 images 张图片的请求的超时
+func (s TimeoutScaling) For(megapixels float64, images int) time.Duration {
+	timeout := s.Base + time.Duration(megapixels*float64(s.PerMegapixel)) + time.Duration(images)*s.PerImage
+	if s.Max > s.Base && timeout > s.Max {
+		timeout = s.Max
+	}
+	return max(timeout, s.Base)
+}
+
+// ForContext 调用方通过 WithTimeoutOverride 指定了超时时返回该值，否则同 For
+func (s TimeoutScaling) ForContext(ctx context.Context, megapixels float64, images int) time.Duration {
+	if timeout, ok := TimeoutOverride(ctx); ok {
+		return timeout
+	}
+	return s.For(megapixels, images)
+}
+
+// Ceiling 返回可能出现的最大超时（按规模放大或工具调用覆盖后的超时都不超过 Max），用于设置底层 HTTP 客户端的超时上限
+func (s TimeoutScaling) Ceiling() time.Duration {
+	return max(s.Base, s.Max)
+}
+
+// Megapixels 按正方形估算长边为 longSide 像素的图片的百万像素数（宽高比未知时的上限估计）
+func Megapixels(longSide int) float64 {
+	return float64(longSide) * float64(longSide) / 1e6
+}
+
+// requestTimeoutKey context 中单次请求超时的键
+type requestTimeoutKey struct{}
+
+// WithRequestTimeout 在 context 中设置按请求规模计算出的单次 HTTP 请求超时，供 client 的 doRequest 使用
+func WithRequestTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, requestTimeoutKey{}, timeout)
+}
+
+// RequestTimeout 返回 context 中设置的单次请求超时，未设置时返回 fallback
+func RequestTimeout(ctx context.Context, fallback time.Duration) time.Duration {
+	if timeout, ok := ctx.Value(requestTimeoutKey{}).(time.Duration); ok && timeout > 0 {
+		return timeout
+	}
+	return fallback
+}
+
+// timeoutOverrideKey context 中调用方指定的 provider 请求超时的键
+type timeoutOverrideKey struct{}
+
+// WithTimeoutOverride 在 context 中设置调用方指定的 provider 请求超时（工具的 timeout_seconds 参数），
+// 替代按请求规模计算出的超时
+func WithTimeoutOverride(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutOverrideKey{}, timeout)
+}
+
+// TimeoutOverride 返回 context 中调用方指定的 provider 请求超时
+func TimeoutOverride(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(timeoutOverrideKey{}).(time.Duration)
+	return timeout, ok && timeout > 0
+}
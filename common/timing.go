@@ -0,0 +1,69 @@
+package common
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 耗时统计的阶段名称
+const (
+	StageCreateTask = "create_task" // 异步 provider 创建任务请求
+	StageQuery      = "query"       // 异步 provider 查询任务请求
+	StagePollWait   = "poll_wait"   // wait_seconds 轮询间的等待
+	StageAPICall    = "api_call"    // 同步 provider（Gemini）的生成请求，含过载重试
+	StageFormat     = "format"      // 结果格式转换与输出处理（包含其中的下载与上传）
+	StageDownload   = "download"    // 图片下载
+	StageUpload     = "upload"      // OSS 上传
+	StageEnhance    = "enhance"     // 生成前的提示词扩写请求（GENAI_ENHANCE_PROMPT）
+)
+
+// timingKey context 中 Timing 的键
+type timingKey struct{}
+
+// Timing 收集一次工具调用中各阶段的累计耗时。
+// 阶段由 client / oss / utils 等各层通过 context 记录，tools 层在结果中输出。
+type Timing struct {
+	mu     sync.Mutex
+	stages map[string]time.Duration
+}
+
+// WithTiming 在 context 中挂载一个新的耗时记录器
+func WithTiming(ctx context.Context) (context.Context, *Timing) {
+	t := &Timing{stages: make(map[string]time.Duration)}
+	return context.WithValue(ctx, timingKey{}, t), t
+}
+
+// RecordTiming 将 d 累加到 stage 的耗时；context 中没有记录器时忽略
+func RecordTiming(ctx context.Context, stage string, d time.Duration) {
+	t, ok := ctx.Value(timingKey{}).(*Timing)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	t.stages[stage] += d
+	t.mu.Unlock()
+}
+
+// StartTiming 开始计时 stage，返回结束计时的函数，用法：defer common.StartTiming(ctx, common.StageUpload)()
+func StartTiming(ctx context.Context, stage string) func() {
+	start := time.Now()
+	return func() {
+		RecordTiming(ctx, stage, time.Since(start))
+	}
+}
+
+// Milliseconds 返回各阶段的累计耗时（毫秒），键为 <stage>_ms；没有记录任何阶段时返回 nil
+func (t *Timing) Milliseconds() map[string]int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.stages) == 0 {
+		return nil
+	}
+	ms := make(map[string]int64, len(t.stages))
+	for stage, d := range t.stages {
+		ms[stage+"_ms"] = d.Milliseconds()
+	}
+	return ms
+}
@@ -0,0 +1,106 @@
+package enhance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"genai-mcp/common"
+)
+
+// chatEnhancer 通过 OpenAI 兼容的 /chat/completions 接口扩写提示词（Wan 的 DashScope 兼容模式、APIMart 或自定义地址）
+type chatEnhancer struct {
+	httpClient   *http.Client
+	endpoint     string
+	apiKey       string
+	model        string
+	instruction  string
+	provider     string
+	extraHeaders map[string]string
+}
+
+// newChatEnhancer 创建 OpenAI 兼容接口的扩写器
+func newChatEnhancer(cfg *common.Config, instruction string, timeout time.Duration) *chatEnhancer {
+	return &chatEnhancer{
+		httpClient:   common.NewHTTPClient(timeout),
+		endpoint:     strings.TrimRight(cfg.EnhanceBaseURL, "/") + "/chat/completions",
+		apiKey:       cfg.EnhanceAPIKey,
+		model:        cfg.EnhanceModel,
+		instruction:  instruction,
+		provider:     cfg.GenAIProvider,
+		extraHeaders: cfg.GenAIExtraHeaders,
+	}
+}
+
+// chatMessage /chat/completions 请求与响应中的单条消息
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatResponse /chat/completions 响应中用到的字段
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// Enhance 实现 Enhancer
+func (e *chatEnhancer) Enhance(ctx context.Context, prompt string) (string, error) {
+	text, err := e.enhance(ctx, prompt)
+	return text, common.WithProviderContext(err, e.provider, e.model)
+}
+
+// enhance Enhance 的实现，错误由 Enhance 附加 provider / 模型信息
+func (e *chatEnhancer) enhance(ctx context.Context, prompt string) (string, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"model": e.model,
+		"messages": []chatMessage{
+			{Role: "system", Content: e.instruction},
+			{Role: "user", Content: prompt},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal enhancement request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create http request: %w", err)
+	}
+	for k, v := range e.extraHeaders {
+		if !common.IsReservedHeader(k) {
+			req.Header.Set(k, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+e.apiKey)
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("prompt enhancement request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read enhancement response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", common.NewHTTPStatusError(resp.StatusCode, "prompt enhancement api error: status %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var parsed chatResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", fmt.Errorf("failed to parse enhancement response: %w", err)
+	}
+	if len(parsed.Choices) == 0 {
+		return "", fmt.Errorf("enhancement response has no choices: %w", common.ErrEmptyResult)
+	}
+	return cleanOutput(parsed.Choices[0].Message.Content)
+}
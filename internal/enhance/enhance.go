@@ -0,0 +1,60 @@
+// Package enhance 生成前的提示词扩写（GENAI_ENHANCE_PROMPT）：把简短的提示词交给文本模型扩写为细节更丰富的描述。
+//
+// Gemini 使用 Gemini SDK 调用文本模型，其它 provider（或显式配置了 GENAI_ENHANCE_BASE_URL 时）
+// 调用 OpenAI 兼容的 /chat/completions 接口。
+package enhance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"genai-mcp/common"
+)
+
+// Enhancer 提示词扩写器
+type Enhancer interface {
+	// Enhance 返回扩写后的提示词
+	Enhance(ctx context.Context, prompt string) (string, error)
+}
+
+// defaultInstruction 未配置 GENAI_ENHANCE_INSTRUCTION 时发送给文本模型的指令
+const defaultInstruction = "You expand short image generation prompts into one detailed prompt. " +
+	"Keep the subject and every detail the user gave, and add concrete setting, composition, lighting and style. " +
+	"Do not add text, captions or watermarks unless the user asked for them. " +
+	"Write in the same language as the user's prompt. Reply with the expanded prompt only, without explanations or quotes."
+
+// NewFromConfig 按配置创建扩写器；未开启 GENAI_ENHANCE_PROMPT 时返回 nil。
+// 模型、接口地址与 API Key 的默认值已在加载配置时补全。
+func NewFromConfig(cfg *common.Config) (Enhancer, error) {
+	if !cfg.EnhancePrompt {
+		return nil, nil
+	}
+
+	instruction := cfg.EnhanceInstruction
+	if strings.TrimSpace(instruction) == "" {
+		instruction = defaultInstruction
+	}
+	timeout := time.Duration(cfg.GenAITimeoutSeconds) * time.Second
+
+	if cfg.EnhanceBaseURL == "" {
+		e, err := newGeminiEnhancer(cfg, instruction, timeout)
+		if err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	return newChatEnhancer(cfg, instruction, timeout), nil
+}
+
+// cleanOutput 去掉文本模型回复首尾的空白与引号；回复为空时返回错误
+func cleanOutput(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	text = strings.Trim(text, "\"'“”")
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("enhancement model returned an empty prompt: %w", common.ErrEmptyResult)
+	}
+	return text, nil
+}
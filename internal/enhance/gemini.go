@@ -0,0 +1,69 @@
+package enhance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"genai-mcp/common"
+
+	"google.golang.org/genai"
+)
+
+// geminiEnhancer 通过 Gemini SDK 调用文本模型扩写提示词（GENAI_PROVIDER=gemini 且未配置 GENAI_ENHANCE_BASE_URL）
+type geminiEnhancer struct {
+	client      *genai.Client
+	model       string
+	instruction string
+	timeout     time.Duration
+}
+
+// newGeminiEnhancer 创建 Gemini 扩写器，与图片客户端共用 GENAI_BASE_URL 与自定义请求头
+func newGeminiEnhancer(cfg *common.Config, instruction string, timeout time.Duration) (*geminiEnhancer, error) {
+	clientConfig := &genai.ClientConfig{
+		APIKey:     cfg.EnhanceAPIKey,
+		Backend:    genai.BackendGeminiAPI,
+		HTTPClient: common.NewHTTPClient(0),
+	}
+	if cfg.GenAIBaseURL != "" {
+		clientConfig.HTTPOptions.BaseURL = cfg.GenAIBaseURL
+	}
+	if len(cfg.GenAIExtraHeaders) > 0 {
+		headers := make(http.Header, len(cfg.GenAIExtraHeaders))
+		for k, v := range cfg.GenAIExtraHeaders {
+			if !common.IsReservedHeader(k) {
+				headers.Set(k, v)
+			}
+		}
+		clientConfig.HTTPOptions.Headers = headers
+	}
+
+	client, err := genai.NewClient(context.Background(), clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create genai client for prompt enhancement: %w", err)
+	}
+	return &geminiEnhancer{
+		client:      client,
+		model:       cfg.EnhanceModel,
+		instruction: instruction,
+		timeout:     timeout,
+	}, nil
+}
+
+// Enhance 实现 Enhancer
+func (e *geminiEnhancer) Enhance(ctx context.Context, prompt string) (string, error) {
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	resp, err := e.client.Models.GenerateContent(ctx, e.model, genai.Text(prompt), &genai.GenerateContentConfig{
+		SystemInstruction: genai.NewContentFromText(e.instruction, genai.RoleUser),
+	})
+	if err != nil {
+		return "", common.WithProviderContext(fmt.Errorf("prompt enhancement request failed: %w", err), "gemini", e.model)
+	}
+	return cleanOutput(resp.Text())
+}
@@ -3,11 +3,12 @@ package apimart
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	neturl "net/url"
 	"strings"
 	"time"
 
@@ -19,6 +20,9 @@ import (
 // 默认请求超时时间（调用 APIMart 接口）
 const defaultApimartTimeout = 60 * time.Second
 
+// defaultOutputLongSide 默认输出分辨率（1K）的长边像素数，用于按请求规模估算超时
+const defaultOutputLongSide = 1024
+
 // Client APIMart 客户端实现，负责调用 APIMart 相关的图片接口。
 //
 // 注意：
@@ -39,7 +43,7 @@ type Client struct {
 	ossClient        oss.OSSIface
 	ossBucket        string
 	ossUploadEnabled bool
-	imageFormat      string // 图片输出格式: "base64" 或 "url"
+	imageFormat      string // 图片输出格式: "base64"、"base64-raw" 或 "url"
 
 	// API 路径
 	generateCreatePath string
@@ -48,6 +52,31 @@ type Client struct {
 	editQueryPath      string
 
 	timeout time.Duration
+	// 按请求规模放大创建任务请求的超时（Base 为 timeout）
+	timeoutScaling common.TimeoutScaling
+	// 连接错误与 429 / 5xx 响应的重试策略
+	retry common.HTTPRetry
+
+	// 附加到每个请求的自定义 HTTP 头（GENAI_EXTRA_HEADERS）
+	extraHeaders map[string]string
+
+	// 多张候选图片时是否按质量启发式评分选出最佳图片（GENAI_RANK_RESULTS）
+	rankResults bool
+
+	// 从任务查询结果中提取图片 URL 的路径，按顺序尝试（APIMART_IMAGE_URL_PATHS）
+	imageURLPaths []imageURLPath
+
+	// url 输出时直接返回未签名的结果 URL，不转存 OSS（GENAI_DIRECT_URL_PROVIDERS）
+	directURLs bool
+
+	// base64 输出时内联图片的最大字节数，超过时改为上传 OSS 返回 URL（GENAI_BASE64_MAX_BYTES）
+	base64MaxBytes int
+
+	// 结果图片上传 OSS 时附带生成的缩略图长边像素数，0 表示不生成（GENAI_GENERATE_THUMBNAIL）
+	thumbnailSize int
+
+	// 生成 / 编辑模型的配置情况，用于复用模型时的严格模式校验（GENAI_STRICT_MODELS）
+	models common.ModelPair
 }
 
 // Config APIMart 客户端配置。
@@ -71,6 +100,34 @@ type Config struct {
 	EditQueryPath      string
 
 	Timeout time.Duration
+	// 可选：按请求规模放大超时的参数，Base 由 Timeout 决定
+	TimeoutScaling common.TimeoutScaling
+
+	// 可选：连接错误与 429 / 500 / 502 / 503 / 504 响应的最大重试次数（不含首次请求），0 表示不重试
+	MaxRetries int
+	// 可选：重试时采用 Retry-After 响应头建议等待时间的上限，超过时改用退避间隔；0 表示忽略 Retry-After
+	MaxRetryAfter time.Duration
+
+	// 可选：附加到每个请求的自定义 HTTP 头，认证与 Content-Type 头始终优先
+	ExtraHeaders map[string]string
+
+	// 可选：多张候选图片时按质量启发式评分返回最佳图片
+	RankResults bool
+
+	// 可选：图片 URL 提取路径（按顺序尝试），为空时使用默认顺序
+	ImageURLPaths []string
+
+	// 可选：url 输出时直接返回未签名的结果 URL，跳过 OSS 转存
+	DirectURLs bool
+
+	// 可选：base64 输出时内联图片的最大字节数，超过且配置了 OSS 时改为上传 OSS 返回 URL，0 表示不限制
+	Base64MaxBytes int
+
+	// 可选：结果图片上传 OSS 时附带生成的缩略图长边像素数，0 表示不生成
+	ThumbnailSize int
+
+	// 可选：严格模式，未显式配置生成 / 编辑模型时拒绝对应调用，而不是复用另一个模型
+	StrictModels bool
 }
 
 // NewApimartClientFromConfig 从通用配置创建 APIMart 客户端。
@@ -88,14 +145,25 @@ func NewApimartClientFromConfig(cfg *common.Config) (*Client, error) {
 		EditModel: cfg.GenAIEditModelName,
 		Timeout:   time.Duration(cfg.GenAITimeoutSeconds) * time.Second,
 
+		TimeoutScaling: common.NewTimeoutScaling(cfg),
+		MaxRetries:     cfg.HTTPMaxRetries,
+		MaxRetryAfter:  time.Duration(cfg.MaxRetryAfterSeconds) * time.Second,
+		ExtraHeaders:   cfg.GenAIExtraHeaders,
+		RankResults:    cfg.GenAIRankResults,
+		ImageURLPaths:  cfg.ApimartImageURLPaths,
+		DirectURLs:     cfg.DirectURLEnabled("apimart"),
+		Base64MaxBytes: cfg.Base64MaxBytes,
+		ThumbnailSize:  cfg.ThumbnailSize,
+		StrictModels:   cfg.StrictModels,
+
 		OSSUploadEnabled: ossUploadEnabled,
 		OSSBucket:        cfg.OSSBucket,
 		ImageFormat:      cfg.GenAIImageFormat,
 	}
 
-	// 如果启用了 OSS 上传，创建 OSS 客户端
-	if ossUploadEnabled {
-		ossClient, err := oss.NewOSSClientFromConfig(cfg)
+	// 如果启用了 OSS 上传，或 base64 输出的大图需要回退到 OSS，创建 OSS 客户端
+	if ossUploadEnabled || (cfg.Base64MaxBytes > 0 && cfg.IsOSSConfigured()) {
+		ossClient, err := oss.SharedOSSClientFromConfig(cfg)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create OSS client for APIMart: %w", err)
 		}
@@ -122,20 +190,21 @@ func NewClient(cfg Config) (*Client, error) {
 		timeout = defaultApimartTimeout
 	}
 
-	// 如果只配置了一个模型，另一个复用它
-	genModel := cfg.GenModel
-	editModel := cfg.EditModel
-	if genModel == "" {
-		genModel = editModel
-	}
-	if editModel == "" {
-		editModel = genModel
+	timeoutScaling := cfg.TimeoutScaling
+	timeoutScaling.Base = timeout
+
+	imageURLPaths, err := parseImageURLPaths(cfg.ImageURLPaths)
+	if err != nil {
+		return nil, err
 	}
 
+	// 如果只配置了一个模型，另一个复用它
+	models := common.NewModelPair("apimart", cfg.GenModel, cfg.EditModel, cfg.StrictModels)
+	genModel, editModel := models.Gen, models.Edit
+
 	c := &Client{
-		httpClient: &http.Client{
-			Timeout: timeout,
-		},
+		// 放大后的单次请求超时由 context 控制，这里只设置上限；按 GENAI_HTTP_PROXY 使用代理
+		httpClient:         common.NewHTTPClient(timeoutScaling.Ceiling()),
 		baseURL:            cfg.BaseURL,
 		apiKey:             cfg.APIKey,
 		genModel:           genModel,
@@ -145,10 +214,19 @@ func NewClient(cfg Config) (*Client, error) {
 		editCreatePath:     cfg.EditCreatePath,
 		editQueryPath:      cfg.EditQueryPath,
 		timeout:            timeout,
+		timeoutScaling:     timeoutScaling,
+		retry:              common.HTTPRetry{MaxRetries: max(cfg.MaxRetries, 0), MaxRetryAfter: cfg.MaxRetryAfter},
 		ossClient:          cfg.OSSClient,
 		ossBucket:          cfg.OSSBucket,
 		ossUploadEnabled:   cfg.OSSUploadEnabled,
 		imageFormat:        cfg.ImageFormat,
+		extraHeaders:       cfg.ExtraHeaders,
+		rankResults:        cfg.RankResults,
+		imageURLPaths:      imageURLPaths,
+		directURLs:         cfg.DirectURLs,
+		base64MaxBytes:     cfg.Base64MaxBytes,
+		thumbnailSize:      cfg.ThumbnailSize,
+		models:             models,
 	}
 
 	// 设置默认路径
@@ -168,6 +246,18 @@ func NewClient(cfg Config) (*Client, error) {
 	return c, nil
 }
 
+// modelsPath OpenAI 兼容的模型列表接口（相对 BaseURL），用于启动预检
+const modelsPath = "/v1/models"
+
+// Preflight 启动预检：通过模型列表接口确认配置的生成 / 编辑模型存在且当前 API Key 可访问
+func (c *Client) Preflight(ctx context.Context) error {
+	body, err := c.doRequest(ctx, http.MethodGet, modelsPath, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list apimart models: %w", err)
+	}
+	return common.CheckModelsListed("apimart", common.ConfiguredModels(c.genModel, c.editModel), body)
+}
+
 // Close 预留关闭方法，当前未持有需要显式关闭的资源。
 func (c *Client) Close() error {
 	return nil
@@ -175,7 +265,17 @@ func (c *Client) Close() error {
 
 // CreateGenerateImageTask 调用文生图任务创建接口。
 func (c *Client) CreateGenerateImageTask(ctx context.Context, prompt string, size string, resolution string, n int) (string, error) {
-	common.WithFields(map[string]interface{}{
+	taskID, err := c.createGenerateImageTask(ctx, prompt, size, resolution, n)
+	return taskID, common.WithProviderContext(err, "apimart", c.models.Gen)
+}
+
+// createGenerateImageTask CreateGenerateImageTask 的实现，错误由 CreateGenerateImageTask 附加 provider / 模型信息
+func (c *Client) createGenerateImageTask(ctx context.Context, prompt string, size string, resolution string, n int) (string, error) {
+	if err := c.models.CheckGenerate(); err != nil {
+		return "", err
+	}
+
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"model":      c.genModel,
 		"prompt":     prompt,
 		"size":       size,
@@ -193,7 +293,7 @@ func (c *Client) CreateGenerateImageTask(ctx context.Context, prompt string, siz
 	//   "resolution": "1K"
 	// }
 	payload := map[string]interface{}{
-		"model":  c.genModel,
+		"model":  common.RoutedModel(ctx, c.genModel), // 按提示词语言路由时使用路由模型
 		"prompt": prompt,
 	}
 
@@ -204,46 +304,67 @@ func (c *Client) CreateGenerateImageTask(ctx context.Context, prompt string, siz
 	if resolution != "" {
 		payload["resolution"] = resolution
 	}
-	if n > 0 {
-		payload["n"] = n
-	} else {
-		payload["n"] = 1
+	if n <= 0 {
+		n = 1
 	}
+	payload["n"] = n
 
+	ctx = common.WithRequestTimeout(ctx, c.generateTimeout(ctx, resolution, n))
+	stopCreate := common.StartTiming(ctx, common.StageCreateTask)
 	body, err := c.doRequest(ctx, http.MethodPost, c.generateCreatePath, payload, nil)
+	stopCreate()
 	if err != nil {
 		return "", fmt.Errorf("failed to create generate image task: %w", err)
 	}
 
 	var resp createTaskResponse
 	if err := json.Unmarshal(body, &resp); err != nil {
-		common.WithError(err).WithField("body", string(body)).Error("Failed to parse APIMart generate-image create-task response")
+		common.WithRequestID(ctx).WithError(err).WithField("body", string(body)).Error("Failed to parse APIMart generate-image create-task response")
 		return "", fmt.Errorf("failed to parse create task response: %w", err)
 	}
 
 	if len(resp.Data) == 0 || resp.Data[0].TaskID == "" {
-		common.WithField("body", string(body)).Error("APIMart create-task response missing task_id")
+		common.WithRequestID(ctx).WithField("body", string(body)).Error("APIMart create-task response missing task_id")
 		return "", fmt.Errorf("apimart create task response missing task_id")
 	}
 
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"task_id": resp.Data[0].TaskID,
+		"status":  resp.Data[0].Status,
+	}).Info("Created APIMart generate-image task")
 	return resp.Data[0].TaskID, nil
 }
 
+// generateTimeout 按请求的分辨率与张数估算文生图创建请求的超时；分辨率为空或无法解析时按默认 1K 估算
+func (c *Client) generateTimeout(ctx context.Context, resolution string, n int) time.Duration {
+	longSide, err := utils.ParseResolution(resolution)
+	if err != nil {
+		longSide = defaultOutputLongSide
+	}
+	return c.timeoutScaling.ForContext(ctx, float64(n)*common.Megapixels(longSide), n)
+}
+
 // QueryGenerateImageTask 查询文生图任务结果。
 func (c *Client) QueryGenerateImageTask(ctx context.Context, task_id string) (string, error) {
-	common.WithFields(map[string]interface{}{
+	result, err := c.queryGenerateImageTask(ctx, task_id)
+	return result, common.WithProviderContext(err, "apimart", c.models.Gen)
+}
+
+// queryGenerateImageTask QueryGenerateImageTask 的实现，错误由 QueryGenerateImageTask 附加 provider / 模型信息
+func (c *Client) queryGenerateImageTask(ctx context.Context, task_id string) (string, error) {
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"task_id":  task_id,
 		"endpoint": c.baseURL + c.generateQueryPath + "/" + task_id,
 	}).Info("Querying APIMart generate-image task")
 
 	// APIMart 查询任务使用 GET 且 task_id 在 URL 路径中
 	queryPath := fmt.Sprintf("%s/%s", c.generateQueryPath, task_id)
-	body, err := c.doRequest(ctx, http.MethodGet, queryPath, nil, nil)
+	body, err := c.fetchTask(ctx, queryPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to query generate image task: %w", err)
 	}
 
-	var resp apimartTaskQueryResponse
+	resp := apimartTaskQueryResponse{body: body}
 	if err := json.Unmarshal(body, &resp); err != nil {
 		return "", fmt.Errorf("failed to parse generate task response: %w", err)
 	}
@@ -251,25 +372,116 @@ func (c *Client) QueryGenerateImageTask(ctx context.Context, task_id string) (st
 	return c.formatImageResult(ctx, &resp)
 }
 
+// QueryGenerateImageTaskStatus 查询文生图任务，并将 APIMart 的响应解析为统一的任务状态。
+// 任务成功时结果图片已按 GENAI_IMAGE_FORMAT 格式化；与 QueryGenerateImageTask 一致，只返回一张（首张或排序后的最佳）图片。
+func (c *Client) QueryGenerateImageTaskStatus(ctx context.Context, task_id string) (*common.TaskStatus, error) {
+	status, err := c.queryGenerateImageTaskStatus(ctx, task_id)
+	return status, common.WithProviderContext(err, "apimart", c.models.Gen)
+}
+
+// queryGenerateImageTaskStatus QueryGenerateImageTaskStatus 的实现，错误由 QueryGenerateImageTaskStatus 附加 provider / 模型信息。
+// 状态映射：成功类状态 → succeeded，失败 / 取消 → failed，submitted / pending / queued 等 → pending，其它 → running
+func (c *Client) queryGenerateImageTaskStatus(ctx context.Context, task_id string) (*common.TaskStatus, error) {
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"task_id":  task_id,
+		"endpoint": c.baseURL + c.generateQueryPath + "/" + task_id,
+	}).Info("Querying APIMart generate-image task status")
+
+	queryPath := fmt.Sprintf("%s/%s", c.generateQueryPath, task_id)
+	body, err := c.fetchTask(ctx, queryPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query generate image task: %w", err)
+	}
+
+	resp := apimartTaskQueryResponse{body: body}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse generate task response: %w", err)
+	}
+	if resp.Data == nil || resp.Data.Status == "" {
+		return nil, common.NewError(common.ErrCodeUpstream, false, "task query response has no status: %s", resp.Message)
+	}
+
+	status := &common.TaskStatus{TaskID: task_id, ProviderStatus: resp.Data.Status}
+	if resp.Data.Progress > 0 {
+		progress := resp.Data.Progress
+		status.Progress = &progress
+	}
+	switch s := strings.ToLower(resp.Data.Status); {
+	case successStatuses[s]:
+		image, err := c.formatImageResult(ctx, &resp)
+		if err != nil {
+			return nil, err
+		}
+		status.Status = common.TaskStatusSucceeded
+		status.ImageURLs = []string{image}
+	case failedStatuses[s]:
+		status.Status = common.TaskStatusFailed
+		status.Error = "task " + s
+		if resp.Message != "" {
+			status.Error += ": " + resp.Message
+		}
+	case s == "submitted" || s == "pending" || s == "queued" || s == "waiting":
+		status.Status = common.TaskStatusPending
+	default:
+		status.Status = common.TaskStatusRunning
+	}
+	return status, nil
+}
+
 // CreateEditImageTask 调用图像编辑任务创建接口。
-func (c *Client) CreateEditImageTask(ctx context.Context, prompt string, image_urls []string, mask_url string) (string, error) {
-	common.WithFields(map[string]interface{}{
+func (c *Client) CreateEditImageTask(ctx context.Context, prompt string, image_urls []string, mask_url string, strength float64) (string, error) {
+	taskID, err := c.createEditImageTask(ctx, prompt, image_urls, mask_url, strength)
+	return taskID, common.WithProviderContext(err, "apimart", c.models.Edit)
+}
+
+// createEditImageTask CreateEditImageTask 的实现，错误由 CreateEditImageTask 附加 provider / 模型信息
+func (c *Client) createEditImageTask(ctx context.Context, prompt string, image_urls []string, mask_url string, strength float64) (string, error) {
+	if err := c.models.CheckEdit(); err != nil {
+		return "", err
+	}
+	if strength < 0 || strength > 1 {
+		return "", common.NewError(common.ErrCodeInvalidArgument, false, "strength must be between 0 and 1, got %v", strength)
+	}
+
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"model":      c.editModel,
 		"prompt":     prompt,
 		"image_urls": image_urls,
 		"mask_url":   mask_url,
+		"strength":   strength,
 		"endpoint":   c.baseURL + c.editCreatePath,
 	}).Info("Creating APIMart edit-image task")
 
+	// 输入图片（除 base64 data URI 外）由 APIMart 拉取，提交前先校验主机访问策略
+	for i, imageURL := range image_urls {
+		if strings.HasPrefix(imageURL, "data:") {
+			continue
+		}
+		if err := utils.ValidateImageURL(ctx, imageURL); err != nil {
+			common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+				"image_url": imageURL,
+				"index":     i,
+			}).Error("APIMart: image URL rejected by host policy")
+			return "", &common.GenAIError{Code: common.ErrCodeInvalidArgument, Message: fmt.Sprintf("image URL at index %d is not allowed", i), Err: err}
+		}
+	}
+	if mask_url != "" && !strings.HasPrefix(mask_url, "data:") {
+		if err := utils.ValidateImageURL(ctx, mask_url); err != nil {
+			common.WithRequestID(ctx).WithError(err).WithField("mask_url", mask_url).Error("APIMart: mask URL rejected by host policy")
+			return "", &common.GenAIError{Code: common.ErrCodeInvalidArgument, Message: "mask URL is not allowed", Err: err}
+		}
+	}
+
 	// 构建请求体，参考 APIMart 文档：
 	// {
 	//   "model": "gemini-3-pro-image-preview",
 	//   "prompt": "...",
 	//   "image_urls": ["url1", "url2", ...],
-	//   "mask_url": "optional_mask_url"
+	//   "mask_url": "optional_mask_url",
+	//   "strength": 0.6
 	// }
 	payload := map[string]interface{}{
-		"model":      c.editModel,
+		"model":      common.RoutedModel(ctx, c.editModel),
 		"prompt":     prompt,
 		"image_urls": image_urls,
 		"n":          1,
@@ -280,40 +492,62 @@ func (c *Client) CreateEditImageTask(ctx context.Context, prompt string, image_u
 		payload["mask_url"] = mask_url
 	}
 
+	// 可选的编辑强度，未指定时使用 APIMart 默认值
+	if strength > 0 {
+		payload["strength"] = strength
+	}
+
+	inputImages := len(image_urls)
+	if mask_url != "" {
+		inputImages++
+	}
+	ctx = common.WithRequestTimeout(ctx, c.timeoutScaling.ForContext(ctx, common.Megapixels(defaultOutputLongSide), inputImages+1))
+	stopCreate := common.StartTiming(ctx, common.StageCreateTask)
 	body, err := c.doRequest(ctx, http.MethodPost, c.editCreatePath, payload, nil)
+	stopCreate()
 	if err != nil {
 		return "", fmt.Errorf("failed to create edit image task: %w", err)
 	}
 
 	var resp createTaskResponse
 	if err := json.Unmarshal(body, &resp); err != nil {
-		common.WithError(err).WithField("body", string(body)).Error("Failed to parse APIMart edit-image create-task response")
+		common.WithRequestID(ctx).WithError(err).WithField("body", string(body)).Error("Failed to parse APIMart edit-image create-task response")
 		return "", fmt.Errorf("failed to parse create task response: %w", err)
 	}
 
 	if len(resp.Data) == 0 || resp.Data[0].TaskID == "" {
-		common.WithField("body", string(body)).Error("APIMart edit-image create-task response missing task_id")
+		common.WithRequestID(ctx).WithField("body", string(body)).Error("APIMart edit-image create-task response missing task_id")
 		return "", fmt.Errorf("apimart create edit image task response missing task_id")
 	}
 
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"task_id": resp.Data[0].TaskID,
+		"status":  resp.Data[0].Status,
+	}).Info("Created APIMart edit-image task")
 	return resp.Data[0].TaskID, nil
 }
 
 // QueryEditImageTask 查询图像编辑任务结果。
 func (c *Client) QueryEditImageTask(ctx context.Context, task_id string) (string, error) {
-	common.WithFields(map[string]interface{}{
+	result, err := c.queryEditImageTask(ctx, task_id)
+	return result, common.WithProviderContext(err, "apimart", c.models.Edit)
+}
+
+// queryEditImageTask QueryEditImageTask 的实现，错误由 QueryEditImageTask 附加 provider / 模型信息
+func (c *Client) queryEditImageTask(ctx context.Context, task_id string) (string, error) {
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"task_id":  task_id,
 		"endpoint": c.baseURL + c.editQueryPath + "/" + task_id,
 	}).Info("Querying APIMart edit-image task")
 
 	// APIMart 查询任务使用 GET 且 task_id 在 URL 路径中
 	queryPath := fmt.Sprintf("%s/%s", c.editQueryPath, task_id)
-	body, err := c.doRequest(ctx, http.MethodGet, queryPath, nil, nil)
+	body, err := c.fetchTask(ctx, queryPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to query edit image task: %w", err)
 	}
 
-	var resp apimartTaskQueryResponse
+	resp := apimartTaskQueryResponse{body: body}
 	if err := json.Unmarshal(body, &resp); err != nil {
 		return "", fmt.Errorf("failed to parse edit task response: %w", err)
 	}
@@ -321,31 +555,117 @@ func (c *Client) QueryEditImageTask(ctx context.Context, task_id string) (string
 	return c.formatImageResult(ctx, &resp)
 }
 
+// QueryTasks 批量查询多个任务。
+//
+// APIMart 没有提供批量查询任务状态的接口，这里在内部并发逐个查询，
+// 对调用方呈现为一次批量结果。文生图与图像编辑任务共用同一个任务查询端点，
+// 因此统一复用 QueryGenerateImageTask 的查询与结果格式化逻辑。
+func (c *Client) QueryTasks(ctx context.Context, taskIDs []string) []common.TaskQueryResult {
+	common.WithRequestID(ctx).WithField("task_count", len(taskIDs)).Info("Querying APIMart tasks in batch")
+	return common.QueryTasksConcurrently(ctx, taskIDs, common.DefaultTaskQueryConcurrency, c.QueryGenerateImageTask)
+}
+
+// QueryTaskRaw 查询任务并原样返回 provider 的响应 JSON。
+//
+// 与 QueryGenerateImageTask / QueryEditImageTask 不同，这里不合并分页、不下载或上传图片，
+// 也不按任务状态返回错误，便于调用方获取生成元数据、安全审核信息等格式化时被省略的字段。
+// 文生图与图像编辑任务共用同一个任务查询端点。
+func (c *Client) QueryTaskRaw(ctx context.Context, task_id string) (string, error) {
+	result, err := c.queryTaskRaw(ctx, task_id)
+	return result, common.WithProviderContext(err, "apimart", "")
+}
+
+// queryTaskRaw QueryTaskRaw 的实现，错误由 QueryTaskRaw 附加 provider / 模型信息
+func (c *Client) queryTaskRaw(ctx context.Context, task_id string) (string, error) {
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"task_id":  task_id,
+		"endpoint": c.baseURL + c.generateQueryPath + "/" + task_id,
+	}).Info("Querying APIMart task (raw)")
+
+	body, err := c.doRequest(ctx, http.MethodGet, fmt.Sprintf("%s/%s", c.generateQueryPath, task_id), nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to query task: %w", err)
+	}
+	return string(body), nil
+}
+
+// resultPaths 任务查询结果中图片结果数组的位置，用于分页聚合
+var resultPaths = [][]string{{"data", "result", "images"}, {"data", "results"}}
+
+// fetchTask 查询任务并拉取全部分页，耗时计入 query 阶段
+func (c *Client) fetchTask(ctx context.Context, queryPath string) ([]byte, error) {
+	defer common.StartTiming(ctx, common.StageQuery)()
+
+	body, err := c.doRequest(ctx, http.MethodGet, queryPath, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.fetchAllPages(ctx, queryPath, body)
+}
+
+// fetchAllPages 若查询结果带有 next_page_token，则依次拉取后续页面并合并 data.result.images / data.results，
+// 最多拉取 utils.DefaultMaxResultPages 页。未分页的响应原样返回。
+func (c *Client) fetchAllPages(ctx context.Context, queryPath string, first []byte) ([]byte, error) {
+	body, truncated, err := utils.AggregatePages(ctx, first, resultPaths, utils.DefaultMaxResultPages,
+		func(ctx context.Context, token string) ([]byte, error) {
+			return c.doRequest(ctx, http.MethodGet, queryPath+"?page_token="+neturl.QueryEscape(token), nil, nil)
+		})
+	if err != nil {
+		return nil, err
+	}
+	if truncated {
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"query_path": queryPath,
+			"max_pages":  utils.DefaultMaxResultPages,
+		}).Warn("APIMart: task results truncated at page cap")
+	}
+	return body, nil
+}
+
 // doRequest 统一封装 HTTP 请求逻辑。
 func (c *Client) doRequest(ctx context.Context, method, path string, body interface{}, extraHeaders map[string]string) ([]byte, error) {
 	url := c.baseURL + path
 
-	var reader io.Reader
+	var payload []byte
 	if body != nil {
 		data, err := json.Marshal(body)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal request body: %w", err)
 		}
-		reader = bytes.NewReader(data)
+		payload = data
 	}
 
-	// 为单次请求设置超时
+	// 为单次请求设置超时（创建任务时按请求规模放大；调用方已有更早的截止时间时以其为准），重试共用该超时
 	var cancel context.CancelFunc
-	if _, ok := ctx.Deadline(); !ok && c.timeout > 0 {
-		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+	if timeout := common.RequestTimeout(ctx, c.timeout); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
 	}
 
+	// 连接错误与 429 / 5xx 等短暂错误按 c.retry 重试
+	return c.retry.Do(ctx, "apimart", method, func() ([]byte, http.Header, error) {
+		return c.sendRequest(ctx, method, url, payload, extraHeaders)
+	})
+}
+
+// sendRequest 发送一次 HTTP 请求，返回响应体与响应头（未收到响应时为 nil）。非 2xx 响应返回带状态码的错误。
+func (c *Client) sendRequest(ctx context.Context, method, url string, payload []byte, extraHeaders map[string]string) ([]byte, http.Header, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
 	req, err := http.NewRequestWithContext(ctx, method, url, reader)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create http request: %w", err)
+		return nil, nil, fmt.Errorf("failed to create http request: %w", err)
 	}
 
+	// 先附加 GENAI_EXTRA_HEADERS，随后设置的认证 / Content-Type 与单次请求头优先
+	for k, v := range c.extraHeaders {
+		if !common.IsReservedHeader(k) {
+			req.Header.Set(k, v)
+		}
+	}
 	req.Header.Set("Content-Type", "application/json")
 	// APIMart 使用 Authorization Bearer 认证
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
@@ -356,25 +676,45 @@ func (c *Client) doRequest(ctx context.Context, method, path string, body interf
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("http request failed: %w", err)
+		// 超时 / 取消由 context 错误表达；其它网络错误视为可重试的上游错误
+		if ctx.Err() != nil {
+			err = fmt.Errorf("http request failed: %w", err)
+		} else {
+			err = &common.GenAIError{Code: common.ErrCodeUpstream, Message: "http request failed", Retryable: true, Err: err}
+		}
+		common.RecordProviderError("apimart", err)
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
+	// 非成功响应（如 429）同样记录限流信息
+	common.RecordRateLimit(ctx, "apimart", resp.Header)
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, resp.Header, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		common.WithFields(map[string]interface{}{
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
 			"status_code": resp.StatusCode,
 			"url":         url,
 			"body":        string(respBody),
 		}).Error("APIMart API returned non-success status")
-		return nil, fmt.Errorf("apimart api error: status %d, body: %s", resp.StatusCode, string(respBody))
+		statusErr := common.NewHTTPStatusError(resp.StatusCode, "apimart api error: status %d, body: %s", resp.StatusCode, string(respBody))
+		common.RecordProviderError("apimart", statusErr)
+		return nil, resp.Header, statusErr
+	}
+
+	// 204 / 空响应体按空 JSON 对象返回，避免调用方解析时报出难以理解的 JSON 错误
+	if len(bytes.TrimSpace(respBody)) == 0 {
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"status_code": resp.StatusCode,
+			"url":         url,
+		}).Debug("APIMart API returned an empty success response")
+		return common.EmptyJSONObject(), resp.Header, nil
 	}
 
-	return respBody, nil
+	return respBody, resp.Header, nil
 }
 
 // createTaskResponse 用于解析创建任务接口中常见的返回结构。
@@ -405,64 +745,123 @@ type apimartTaskQueryResponse struct {
 		Status   string `json:"status,omitempty"`
 		Progress int    `json:"progress,omitempty"`
 		Result   *struct {
-			// Image generation results: result.images[].url is an array of URLs
-			Images []struct {
-				URL      []string `json:"url,omitempty"`
-				ImageURL string   `json:"image_url,omitempty"` // fallback if present
-			} `json:"images,omitempty"`
-			// Legacy fallback fields
-			ImageURL string `json:"image_url,omitempty"`
-			URL      string `json:"url,omitempty"`
+			// 部分模型会改写提示词并在结果中返回实际使用的版本
+			RevisedPrompt string `json:"revised_prompt,omitempty"`
+			ActualPrompt  string `json:"actual_prompt,omitempty"`
 		} `json:"result,omitempty"`
-		// Fallback results array (non-standard but kept for compatibility)
-		Results []struct {
-			ImageURL string `json:"image_url,omitempty"`
-			URL      string `json:"url,omitempty"`
-		} `json:"results,omitempty"`
 	} `json:"data,omitempty"`
 	Message string `json:"message,omitempty"`
+
+	// body 原始响应，图片 URL 按 imageURLPaths 从中提取（不同模型的响应结构不同）
+	body []byte
+}
+
+// revisedPrompt 返回任务结果中 provider 报告的改写后提示词（revised_prompt 优先，其次 actual_prompt），未报告时为空
+func revisedPrompt(resp *apimartTaskQueryResponse) string {
+	if resp.Data == nil || resp.Data.Result == nil {
+		return ""
+	}
+	if resp.Data.Result.RevisedPrompt != "" {
+		return resp.Data.Result.RevisedPrompt
+	}
+	return resp.Data.Result.ActualPrompt
+}
+
+// successStatuses 视为任务成功的状态（小写）
+var successStatuses = map[string]bool{
+	"succeeded": true,
+	"success":   true,
+	"completed": true,
+	"finished":  true,
+	"done":      true,
+}
+
+// failedStatuses 视为任务失败的终态（小写）
+var failedStatuses = map[string]bool{
+	"failed":    true,
+	"failure":   true,
+	"error":     true,
+	"cancelled": true,
+	"canceled":  true,
 }
 
 // formatImageResult 根据配置输出最终图片字符串（URL 或 base64 data URI）。
 // 仅在任务已完成且找到图片时返回字符串；否则返回错误。
 func (c *Client) formatImageResult(ctx context.Context, resp *apimartTaskQueryResponse) (string, error) {
+	defer common.StartTiming(ctx, common.StageFormat)()
+
 	if resp == nil || resp.Data == nil || resp.Data.Status == "" {
 		return "", fmt.Errorf("invalid task response: missing status")
 	}
 
 	status := strings.ToLower(resp.Data.Status)
-	successStatuses := map[string]bool{
-		"succeeded": true,
-		"success":   true,
-		"completed": true,
-		"finished":  true,
-		"done":      true,
+	// 失败 / 取消属于终态，单独返回错误，避免调用方当作未完成而继续轮询
+	if failedStatuses[status] {
+		err := common.NewError(common.ErrCodeUpstream, false, "task failed: status=%s", resp.Data.Status)
+		common.RecordProviderError("apimart", err)
+		return "", err
 	}
 	if !successStatuses[status] {
 		return "", fmt.Errorf("task not completed: status=%s", resp.Data.Status)
 	}
 
-	imageURL := extractFirstImageURL(resp)
-	if imageURL == "" {
-		return "", fmt.Errorf("task completed but image url is empty")
+	candidates, matchedPath := matchImageURLs(resp.body, c.imageURLPaths)
+	if len(candidates) == 0 {
+		err := fmt.Errorf("task completed but image url is empty: %w", common.ErrEmptyResult)
+		common.RecordProviderError("apimart", err)
+		return "", err
+	}
+	imageURL := candidates[0]
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"path":       matchedPath,
+		"image_url":  imageURL,
+		"candidates": len(candidates),
+	}).Info("APIMart: extracted image URL from task result")
+
+	// provider 改写了提示词时记录日志，并交给 tools 层附加到结构化输出中
+	if revised := revisedPrompt(resp); revised != "" {
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"image_url":       imageURL,
+			"provider_prompt": revised,
+		}).Info("APIMart: provider reported a rewritten prompt")
+		common.RecordProviderPrompt(ctx, revised)
+	}
+
+	// 开启结果排序且有多张候选图片时，按质量启发式评分选出最佳图片，下载的数据在后续格式化中复用
+	var data []byte
+	var mimeType string
+	if c.rankResults && len(candidates) > 1 {
+		var err error
+		imageURL, data, mimeType, err = pickBestImage(ctx, candidates)
+		if err != nil {
+			return "", err
+		}
 	}
 
-	// base64 输出：下载原图并转为 data URI
-	if strings.EqualFold(c.imageFormat, "base64") {
+	// base64 / base64-raw 输出：下载原图并转为 data URI 或纯 base64
+	if utils.IsBase64Format(c.imageFormat) {
+		if data != nil {
+			return c.encodeImage(ctx, mimeType, data)
+		}
 		data, mimeType, err := utils.DownloadImageFromURL(ctx, imageURL)
 		if err != nil {
-			common.WithError(err).WithField("image_url", imageURL).Error("APIMart: failed to download image for base64 formatting")
+			common.WithRequestID(ctx).WithError(err).WithField("image_url", imageURL).Error("APIMart: failed to download image for base64 formatting")
 			return "", fmt.Errorf("failed to download image for base64 formatting: %w", err)
 		}
 
-		base64Data := base64.StdEncoding.EncodeToString(data)
-		return fmt.Sprintf("data:%s;base64,%s", mimeType, base64Data), nil
+		return c.encodeImage(ctx, mimeType, data)
+	}
+
+	// url 输出且结果 URL 未签名（持久有效）时直接返回，省去下载与转存
+	if strings.EqualFold(c.imageFormat, "url") && c.directURLs && !utils.IsSignedURL(imageURL) {
+		common.WithRequestID(ctx).WithField("image_url", imageURL).Debug("APIMart: returning result URL directly, skipping OSS upload")
+		return imageURL, nil
 	}
 
 	// url 输出：若开启 OSS 上传则返回 OSS URL，否则直接返回原图 URL
 	if strings.EqualFold(c.imageFormat, "url") && c.ossUploadEnabled {
 		if c.ossClient == nil || c.ossBucket == "" {
-			common.WithFields(map[string]interface{}{
+			common.WithRequestID(ctx).WithFields(map[string]interface{}{
 				"oss_enabled": c.ossUploadEnabled,
 				"has_client":  c.ossClient != nil,
 				"bucket":      c.ossBucket,
@@ -470,9 +869,12 @@ func (c *Client) formatImageResult(ctx context.Context, resp *apimartTaskQueryRe
 			return "", fmt.Errorf("OSS is not configured but image format is set to 'url'")
 		}
 
-		ossURL, err := c.uploadImageToOSS(ctx, imageURL)
+		// OSS 不可用且开启降级时返回原图 URL（GENAI_OSS_DEGRADE）
+		ossURL, err := oss.UploadOrDegrade(ctx, "apimart", imageURL, data, mimeType, func() (string, error) {
+			return c.uploadImageToOSS(ctx, imageURL, data, mimeType)
+		})
 		if err != nil {
-			common.WithError(err).WithField("image_url", imageURL).Error("APIMart: failed to upload image to OSS")
+			common.WithRequestID(ctx).WithError(err).WithField("image_url", imageURL).Error("APIMart: failed to upload image to OSS")
 			return "", fmt.Errorf("failed to upload image to OSS: %w", err)
 		}
 		return ossURL, nil
@@ -482,55 +884,63 @@ func (c *Client) formatImageResult(ctx context.Context, resp *apimartTaskQueryRe
 	return imageURL, nil
 }
 
-// extractFirstImageURL 提取任务结果中的首个图片 URL。
-func extractFirstImageURL(resp *apimartTaskQueryResponse) string {
-	if resp == nil {
-		return ""
-	}
-
-	if resp.Data != nil && resp.Data.Result != nil && len(resp.Data.Result.Images) > 0 {
-		img := resp.Data.Result.Images[0]
-		if len(img.URL) > 0 && img.URL[0] != "" {
-			return img.URL[0]
-		}
-		if img.ImageURL != "" {
-			return img.ImageURL
+// pickBestImage 下载所有候选图片并按质量启发式评分选出得分最高的一张，返回其 URL 与已下载的数据。
+// 无法解码评分的图片排在最后。
+func pickBestImage(ctx context.Context, urls []string) (string, []byte, string, error) {
+	type candidate struct {
+		data     []byte
+		mimeType string
+	}
+	candidates := make([]candidate, len(urls))
+	scores := make([]float64, len(urls))
+	for i, u := range urls {
+		data, mimeType, err := utils.DownloadImageFromURL(ctx, u)
+		if err != nil {
+			return "", nil, "", fmt.Errorf("failed to download image %d for ranking: %w", i, err)
 		}
-	}
+		candidates[i] = candidate{data: data, mimeType: mimeType}
 
-	if resp.Data != nil && resp.Data.Result != nil {
-		if resp.Data.Result.URL != "" {
-			return resp.Data.Result.URL
-		}
-		if resp.Data.Result.ImageURL != "" {
-			return resp.Data.Result.ImageURL
+		scores[i] = math.Inf(-1)
+		if score, err := utils.ScoreImage(data); err == nil {
+			scores[i] = score.Score
+		} else {
+			common.WithRequestID(ctx).WithError(err).WithField("image_index", i).Warn("APIMart: failed to score image, ranking it last")
 		}
 	}
 
-	if resp.Data != nil && len(resp.Data.Results) > 0 {
-		if resp.Data.Results[0].URL != "" {
-			return resp.Data.Results[0].URL
-		}
-		if resp.Data.Results[0].ImageURL != "" {
-			return resp.Data.Results[0].ImageURL
-		}
-	}
+	best := utils.RankByScore(scores)[0]
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"candidates": len(urls),
+		"best_index": best,
+		"best_score": scores[best],
+	}).Debug("APIMart: picked best image by quality heuristic")
+	return urls[best], candidates[best].data, candidates[best].mimeType, nil
+}
 
-	return ""
+// encodeImage base64 / base64-raw 输出时编码图片；超过 GENAI_BASE64_MAX_BYTES 且 OSS 可用时改为上传 OSS 返回 URL
+func (c *Client) encodeImage(ctx context.Context, mimeType string, data []byte) (string, error) {
+	if utils.Base64Fallback(ctx, "apimart", c.base64MaxBytes, len(data), c.ossClient != nil && c.ossBucket != "" && !oss.DegradeActive()) {
+		return c.uploadImageToOSS(ctx, "", data, mimeType)
+	}
+	return utils.EncodeImage(ctx, c.imageFormat, mimeType, data), nil
 }
 
-// uploadImageToOSS 将给定的 HTTP 图片 URL 下载后上传到 OSS，并返回 OSS URL。
-func (c *Client) uploadImageToOSS(ctx context.Context, imageURL string) (string, error) {
-	data, mimeType, err := utils.DownloadImageFromURL(ctx, imageURL)
-	if err != nil {
-		return "", fmt.Errorf("failed to download image from URL: %w", err)
+// uploadImageToOSS 将图片上传到 OSS，并返回 OSS URL。
+// data 为已下载的图片数据（如评分阶段已下载），为空时从 imageURL 下载。
+func (c *Client) uploadImageToOSS(ctx context.Context, imageURL string, data []byte, mimeType string) (string, error) {
+	if data == nil {
+		var err error
+		data, mimeType, err = utils.DownloadImageFromURL(ctx, imageURL)
+		if err != nil {
+			return "", fmt.Errorf("failed to download image from URL: %w", err)
+		}
 	}
 
 	path := utils.GenerateImagePath()
 	fileName := utils.GenerateImageFileName(mimeType)
 	key := fmt.Sprintf("%s%s", path, fileName)
 
-	common.WithFields(map[string]interface{}{
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"bucket":       c.ossBucket,
 		"key":          key,
 		"content_type": mimeType,
@@ -538,20 +948,21 @@ func (c *Client) uploadImageToOSS(ctx context.Context, imageURL string) (string,
 	}).Debug("APIMart: uploading image to OSS")
 
 	reader := bytes.NewReader(data)
-	url, err := c.ossClient.UploadFileWithURL(ctx, c.ossBucket, key, reader, mimeType, 3600*24*7)
+	url, err := c.ossClient.UploadFileWithURL(ctx, c.ossBucket, key, reader, mimeType, oss.URLExpiry(ctx, 0))
 	if err != nil {
-		common.WithError(err).WithFields(map[string]interface{}{
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
 			"bucket": c.ossBucket,
 			"key":    key,
 		}).Error("APIMart: failed to upload image to OSS")
 		return "", fmt.Errorf("failed to upload image to OSS: %w", err)
 	}
 
-	common.WithFields(map[string]interface{}{
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"bucket": c.ossBucket,
 		"key":    key,
 		"url":    url,
 	}).Debug("APIMart: image uploaded to OSS successfully")
 
+	oss.PublishThumbnail(ctx, c.ossClient, c.ossBucket, data, c.thumbnailSize)
 	return url, nil
 }
@@ -1,14 +1,25 @@
 package apimart
 
-import "context"
+import (
+	"context"
+
+	"genai-mcp/common"
+)
 
 type ApimartIface interface {
 	CreateGenerateImageTask(ctx context.Context, prompt string, size string, resolution string, n int) (string, error)
 	QueryGenerateImageTask(ctx context.Context, task_id string) (string, error)
+	// QueryGenerateImageTaskStatus 查询文生图任务并解析为与 provider 无关的统一任务状态
+	QueryGenerateImageTaskStatus(ctx context.Context, task_id string) (*common.TaskStatus, error)
 	// CreateEditImageTask 进行图片编辑。
 	// - prompt: 编辑文案
 	// - image_urls: 输入图片 URL 列表（支持 base64 data URI）
 	// - mask_url: 可选的蒙版图片 URL（PNG 格式）
-	CreateEditImageTask(ctx context.Context, prompt string, image_urls []string, mask_url string) (string, error)
+	// - strength: 可选的编辑强度（0-1，越大越偏离原图），0 表示不发送、使用 APIMart 默认值
+	CreateEditImageTask(ctx context.Context, prompt string, image_urls []string, mask_url string, strength float64) (string, error)
 	QueryEditImageTask(ctx context.Context, task_id string) (string, error)
+	// QueryTasks 批量查询多个任务（文生图与图像编辑任务均可），按输入顺序返回每个任务的结果
+	QueryTasks(ctx context.Context, taskIDs []string) []common.TaskQueryResult
+	// QueryTaskRaw 查询任务并原样返回 provider 的响应 JSON，不做分页合并与图片格式化
+	QueryTaskRaw(ctx context.Context, task_id string) (string, error)
 }
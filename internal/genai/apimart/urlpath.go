@@ -0,0 +1,150 @@
+package apimart
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultImageURLPaths 任务查询结果中图片 URL 的默认提取顺序（APIMART_IMAGE_URL_PATHS 未配置时使用）
+var defaultImageURLPaths = []string{
+	"data.result.images[].url[]",
+	"data.result.images[].image_url",
+	"data.result.url",
+	"data.result.image_url",
+	"data.results[].url",
+	"data.results[].image_url",
+}
+
+// imageURLPath 解析后的图片 URL 提取路径
+type imageURLPath struct {
+	raw   string
+	steps []pathStep
+}
+
+// pathStep 路径中的一段：对象字段 key，可选地展开数组（key[]）或取数组下标（key[N]）
+type pathStep struct {
+	key   string
+	all   bool
+	index int // -1 表示不取下标
+}
+
+// parseImageURLPaths 解析图片 URL 提取路径，为空时使用默认顺序。
+// 路径以 . 分隔对象字段，字段后可跟 [] 展开数组的所有元素或 [N] 取第 N 个元素（从 0 开始），
+// 例如 data.result.images[0].url[]。
+func parseImageURLPaths(raw []string) ([]imageURLPath, error) {
+	if len(raw) == 0 {
+		raw = defaultImageURLPaths
+	}
+	paths := make([]imageURLPath, 0, len(raw))
+	for _, r := range raw {
+		p, err := parseImageURLPath(r)
+		if err != nil {
+			return nil, fmt.Errorf("APIMART_IMAGE_URL_PATHS: %w", err)
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// parseImageURLPath 解析单个提取路径
+func parseImageURLPath(raw string) (imageURLPath, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return imageURLPath{}, fmt.Errorf("empty path")
+	}
+	p := imageURLPath{raw: raw}
+	for _, seg := range strings.Split(raw, ".") {
+		step := pathStep{key: seg, index: -1}
+		if open := strings.IndexByte(seg, '['); open >= 0 {
+			if !strings.HasSuffix(seg, "]") {
+				return imageURLPath{}, fmt.Errorf("invalid segment %q in path %q", seg, raw)
+			}
+			step.key = seg[:open]
+			switch inner := seg[open+1 : len(seg)-1]; inner {
+			case "":
+				step.all = true
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil || n < 0 {
+					return imageURLPath{}, fmt.Errorf("invalid array index %q in path %q", inner, raw)
+				}
+				step.index = n
+			}
+		}
+		if step.key == "" {
+			return imageURLPath{}, fmt.Errorf("empty field name in path %q", raw)
+		}
+		p.steps = append(p.steps, step)
+	}
+	return p, nil
+}
+
+// collect 返回 v 中该路径命中的所有非空字符串。终点为字符串数组时收集其中的全部字符串。
+func (p imageURLPath) collect(v any) []string {
+	var out []string
+	var walk func(v any, steps []pathStep)
+	walk = func(v any, steps []pathStep) {
+		if len(steps) == 0 {
+			switch leaf := v.(type) {
+			case string:
+				if leaf != "" {
+					out = append(out, leaf)
+				}
+			case []any:
+				for _, item := range leaf {
+					if s, ok := item.(string); ok && s != "" {
+						out = append(out, s)
+					}
+				}
+			}
+			return
+		}
+
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return
+		}
+		step, child := steps[0], obj[steps[0].key]
+		switch {
+		case step.all:
+			items, _ := child.([]any)
+			for _, item := range items {
+				walk(item, steps[1:])
+			}
+		case step.index >= 0:
+			if items, ok := child.([]any); ok && step.index < len(items) {
+				walk(items[step.index], steps[1:])
+			}
+		default:
+			walk(child, steps[1:])
+		}
+	}
+	walk(v, p.steps)
+	return out
+}
+
+// matchImageURLs 按 paths 的顺序从任务查询结果中提取所有图片 URL（去重），
+// 并返回首个 URL 命中的路径；没有任何路径命中时 urls 为空。
+func matchImageURLs(body []byte, paths []imageURLPath) (urls []string, matched string) {
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, ""
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		for _, u := range p.collect(doc) {
+			if seen[u] {
+				continue
+			}
+			if matched == "" {
+				matched = p.raw
+			}
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	return urls, matched
+}
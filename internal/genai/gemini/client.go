@@ -3,9 +3,11 @@ package gemini
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"genai-mcp/common"
@@ -18,17 +20,44 @@ import (
 // 默认请求超时时间（调用 Gemini 接口和相关网络请求）
 const defaultGenAITimeout = 60 * time.Second
 
+// defaultOutputLongSide Gemini 默认输出（1K）的长边像素数，用于按请求规模估算超时
+const defaultOutputLongSide = 1024
+
+// defaultDownloadConcurrency 内联重试时单个请求内同时下载的默认最大图片数
+const defaultDownloadConcurrency = 4
+
 // Client Gemini 客户端实现
 type Client struct {
 	client *genai.Client
 	// 分别用于生成与编辑的模型
-	generateModel    string
-	editModel        string
-	ossClient        oss.OSSIface
-	ossBucket        string
-	ossUploadEnabled bool
-	imageFormat      string // 图片输出格式: "base64" 或 "url"
-	timeout          time.Duration
+	generateModel       string
+	editModel           string
+	ossClient           oss.OSSIface
+	ossBucket           string
+	ossUploadEnabled    bool
+	imageFormat         string // 图片输出格式: "base64"、"base64-raw" 或 "url"
+	timeout             time.Duration
+	maxEditImages       int           // 编辑模型允许的最大输入图片数
+	maxStyleImages      int           // 风格参考生成（使用生成模型）允许的最大参考图片数
+	inlineFallback      bool          // Gemini 无法拉取图片 URL 时，是否改为服务端下载后内联重试
+	downloadConcurrency int           // 内联重试时单个请求内同时下载的最大图片数
+	overloadRetries     int           // 模型过载（503 / UNAVAILABLE）时的最大重试次数
+	maxRetryAfter       time.Duration // 采用服务端建议重试等待时间的上限，超过时改用退避间隔
+
+	// 按输入图片数放大单次请求超时（Base 为 timeout）
+	timeoutScaling common.TimeoutScaling
+
+	// url 输出时，结果为未签名的 HTTP URL 则直接返回，不转存 OSS（GENAI_DIRECT_URL_PROVIDERS）
+	directURLs bool
+
+	// base64 输出时内联图片的最大字节数，超过时改为上传 OSS 返回 URL（GENAI_BASE64_MAX_BYTES）
+	base64MaxBytes int
+
+	// 结果图片上传 OSS 时附带生成的缩略图长边像素数，0 表示不生成（GENAI_GENERATE_THUMBNAIL）
+	thumbnailSize int
+
+	// 生成 / 编辑模型的配置情况，用于复用模型时的严格模式校验（GENAI_STRICT_MODELS）
+	models common.ModelPair
 }
 
 // Config Gemini 客户端配置
@@ -44,8 +73,30 @@ type Config struct {
 	OSSClient        oss.OSSIface  // OSS 客户端，如果启用上传则需要
 	OSSBucket        string        // OSS 存储桶名称
 	OSSUploadEnabled bool          // 是否启用 OSS 上传
-	ImageFormat      string        // 图片输出格式: "base64" 或 "url"
+	ImageFormat      string        // 图片输出格式: "base64"、"base64-raw" 或 "url"
 	Timeout          time.Duration // 请求超时时间
+	// TimeoutScaling 按请求规模放大超时的参数（可选），Base 由 Timeout 决定
+	TimeoutScaling common.TimeoutScaling
+	// 附加到每个请求的自定义 HTTP 头（可选），认证与 Content-Type 头不会被覆盖
+	ExtraHeaders map[string]string
+	// 模型 → 图片编辑最大输入图片数的覆盖表（可选），未覆盖的模型使用内置默认值
+	ModelMaxImages map[string]int
+	// InlineFallback 编辑时 Gemini 无法拉取 HTTP 图片 URL 的情况下，服务端下载图片后以内联数据重试
+	InlineFallback bool
+	// EditDownloadConcurrency 内联重试时单个请求内同时下载的最大图片数，<= 0 时使用 defaultDownloadConcurrency
+	EditDownloadConcurrency int
+	// OverloadRetries 模型过载（503 / UNAVAILABLE）时的最大重试次数，0 表示不重试
+	OverloadRetries int
+	// MaxRetryAfter 重试时采用服务端建议等待时间（RetryInfo.retryDelay）的上限，超过时改用退避间隔；0 表示忽略服务端建议
+	MaxRetryAfter time.Duration
+	// DirectURLs url 输出时直接返回未签名的结果 URL，跳过 OSS 转存
+	DirectURLs bool
+	// Base64MaxBytes base64 输出时内联图片的最大字节数，超过且配置了 OSS 时改为上传 OSS 返回 URL，0 表示不限制
+	Base64MaxBytes int
+	// ThumbnailSize 结果图片上传 OSS 时附带生成的缩略图长边像素数，0 表示不生成
+	ThumbnailSize int
+	// StrictModels 严格模式，未显式配置生成 / 编辑模型时拒绝对应调用，而不是复用另一个模型
+	StrictModels bool
 }
 
 // NewClient 创建新的 Gemini 客户端
@@ -62,13 +113,24 @@ func NewClient(cfg Config) (*Client, error) {
 	clientConfig := &genai.ClientConfig{
 		APIKey:  cfg.APIKey,
 		Backend: genai.BackendGeminiAPI,
+		// 按 GENAI_HTTP_PROXY / GENAI_NO_PROXY 使用代理；超时由每次请求的 context 控制
+		HTTPClient: common.NewHTTPClient(0),
 	}
 
 	// 如果提供了自定义 Base URL，设置 HTTPOptions
 	if cfg.BaseURL != "" {
-		clientConfig.HTTPOptions = genai.HTTPOptions{
-			BaseURL: cfg.BaseURL,
+		clientConfig.HTTPOptions.BaseURL = cfg.BaseURL
+	}
+
+	// 自定义请求头（如网关要求的 X-Project-ID）
+	if len(cfg.ExtraHeaders) > 0 {
+		headers := make(http.Header, len(cfg.ExtraHeaders))
+		for k, v := range cfg.ExtraHeaders {
+			if !common.IsReservedHeader(k) {
+				headers.Set(k, v)
+			}
 		}
+		clientConfig.HTTPOptions.Headers = headers
 	}
 
 	// 创建客户端
@@ -87,28 +149,61 @@ func NewClient(cfg Config) (*Client, error) {
 		timeout = defaultGenAITimeout
 	}
 
-	// 如果只配置了其中一个模型，另一个复用它，保持兼容
-	generateModel := cfg.GenerateModelName
-	editModel := cfg.EditModelName
-	if generateModel == "" {
-		generateModel = editModel
-	}
-	if editModel == "" {
-		editModel = generateModel
+	timeoutScaling := cfg.TimeoutScaling
+	timeoutScaling.Base = timeout
+
+	downloadConcurrency := cfg.EditDownloadConcurrency
+	if downloadConcurrency <= 0 {
+		downloadConcurrency = defaultDownloadConcurrency
 	}
 
+	// 如果只配置了其中一个模型，另一个复用它，保持兼容（记录 warn 日志；严格模式下拒绝对应调用）
+	models := common.NewModelPair("gemini", cfg.GenerateModelName, cfg.EditModelName, cfg.StrictModels)
+	generateModel, editModel := models.Gen, models.Edit
+
 	return &Client{
-		client:           client,
-		generateModel:    generateModel,
-		editModel:        editModel,
-		ossClient:        cfg.OSSClient,
-		ossBucket:        cfg.OSSBucket,
-		ossUploadEnabled: cfg.OSSUploadEnabled,
-		imageFormat:      imageFormat,
-		timeout:          timeout,
+		client:              client,
+		generateModel:       generateModel,
+		editModel:           editModel,
+		ossClient:           cfg.OSSClient,
+		ossBucket:           cfg.OSSBucket,
+		ossUploadEnabled:    cfg.OSSUploadEnabled,
+		imageFormat:         imageFormat,
+		timeout:             timeout,
+		timeoutScaling:      timeoutScaling,
+		maxEditImages:       ResolveMaxEditImages(editModel, cfg.ModelMaxImages),
+		maxStyleImages:      ResolveMaxEditImages(generateModel, cfg.ModelMaxImages),
+		inlineFallback:      cfg.InlineFallback,
+		downloadConcurrency: downloadConcurrency,
+		overloadRetries:     max(cfg.OverloadRetries, 0),
+		maxRetryAfter:       cfg.MaxRetryAfter,
+		directURLs:          cfg.DirectURLs,
+		base64MaxBytes:      cfg.Base64MaxBytes,
+		thumbnailSize:       cfg.ThumbnailSize,
+		models:              models,
 	}, nil
 }
 
+// MaxEditImages 返回编辑模型允许的最大输入图片数
+func (c *Client) MaxEditImages() int {
+	return c.maxEditImages
+}
+
+// requestTimeout 返回带 inputImages 张输入图片、输出一张默认尺寸图片的请求超时
+func (c *Client) requestTimeout(ctx context.Context, inputImages int) time.Duration {
+	return c.timeoutScaling.ForContext(ctx, common.Megapixels(defaultOutputLongSide), inputImages+1)
+}
+
+// Preflight 启动预检：逐个获取配置的生成 / 编辑模型信息（models.get），确认模型存在且当前 API Key 可访问
+func (c *Client) Preflight(ctx context.Context) error {
+	for _, m := range common.ConfiguredModels(c.generateModel, c.editModel) {
+		if _, err := c.client.Models.Get(ctx, m.Name, nil); err != nil {
+			return fmt.Errorf("%s is not available from gemini: %w", m, classifyGeminiError(err))
+		}
+	}
+	return nil
+}
+
 // Close 关闭客户端（genai.Client 不需要显式关闭）
 func (c *Client) Close() error {
 	// genai.Client 不需要显式关闭
@@ -116,15 +211,19 @@ func (c *Client) Close() error {
 }
 
 // GenerateImage 文生图：根据文本提示生成图片
-func (c *Client) GenerateImage(ctx context.Context, prompt string) (string, error) {
-	common.WithFields(map[string]interface{}{
+func (c *Client) GenerateImage(ctx context.Context, prompt string, outputMIME string) (string, error) {
+	if err := c.models.CheckGenerate(); err != nil {
+		return "", err
+	}
+
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"model":  c.generateModel,
 		"prompt": prompt,
 	}).Debug("Starting image generation")
 
 	// 为本次请求设置超时时间，避免无休止等待
 	var cancel context.CancelFunc
-	ctx, cancel = context.WithTimeout(ctx, c.timeout)
+	ctx, cancel = context.WithTimeout(ctx, c.requestTimeout(ctx, 0))
 	defer cancel()
 
 	// 构建请求内容
@@ -133,25 +232,24 @@ func (c *Client) GenerateImage(ctx context.Context, prompt string) (string, erro
 	}
 
 	// 调用 GenerateContent API
-	result, err := c.client.Models.GenerateContent(ctx, c.generateModel, []*genai.Content{
-		{Parts: parts},
-	}, nil)
+	model := common.RoutedModel(ctx, c.generateModel) // 按提示词语言路由时使用路由模型
+	result, err := c.generateContent(ctx, model, parts)
 	if err != nil {
-		common.WithError(err).WithFields(map[string]interface{}{
-			"model":  c.generateModel,
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"model":  model,
 			"prompt": prompt,
 		}).Error("Failed to generate image from Gemini API")
-		return "", fmt.Errorf("failed to generate image: %w", err)
+		return "", fmt.Errorf("failed to generate image: %w", classifyGeminiError(err))
 	}
 
 	// 从响应中提取图片 URL 或数据
 	if len(result.Candidates) == 0 {
-		return "", fmt.Errorf("no candidates in response")
+		return "", emptyResultError("no candidates in response")
 	}
 
 	candidate := result.Candidates[0]
 	if candidate.Content == nil || len(candidate.Content.Parts) == 0 {
-		return "", fmt.Errorf("no content in candidate")
+		return "", emptyResultError("no content in candidate")
 	}
 
 	var imageResult string
@@ -161,11 +259,10 @@ func (c *Client) GenerateImage(ctx context.Context, prompt string) (string, erro
 	for _, part := range candidate.Content.Parts {
 		// 检查是否是内联图片数据
 		if part.InlineData != nil {
+			// 只保留原始数据，data URI 延迟到真正需要 base64 输出时再编码，
+			// 避免同时持有原始数据和完整 base64 字符串
 			imageData = part.InlineData.Data
 			mimeType = part.InlineData.MIMEType
-			// 将图片数据编码为 base64
-			base64Data := base64.StdEncoding.EncodeToString(part.InlineData.Data)
-			imageResult = fmt.Sprintf("data:%s;base64,%s", part.InlineData.MIMEType, base64Data)
 			break
 		}
 
@@ -185,51 +282,116 @@ func (c *Client) GenerateImage(ctx context.Context, prompt string) (string, erro
 		*/
 	}
 
-	if imageResult == "" {
-		common.Error("No image data found in Gemini response")
-		return "", fmt.Errorf("no image data found in response")
+	if imageResult == "" && imageData == nil {
+		common.WithRequestID(ctx).Error("No image data found in Gemini response")
+		return "", emptyResultError("no image data found in response")
 	}
 
-	common.WithFields(map[string]interface{}{
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"model":        c.generateModel,
 		"mime_type":    mimeType,
 		"has_data":     len(imageData) > 0,
 		"image_format": c.imageFormat,
 	}).Debug("Image generated successfully")
 
+	// 按请求的输出格式转换（转换与格式化的耗时计入 format 阶段）
+	defer common.StartTiming(ctx, common.StageFormat)()
+	imageResult, imageData, mimeType, err = c.convertOutputMIME(ctx, imageResult, imageData, mimeType, outputMIME)
+	if err != nil {
+		return "", err
+	}
+
 	// 根据配置的图片格式处理结果
 	return c.formatImageResult(ctx, imageResult, imageData, mimeType)
 }
 
 // EditImage 图片编辑：根据文本提示编辑图片
-func (c *Client) EditImage(ctx context.Context, prompt string, imageURLs []string) (string, error) {
-	// 验证图片数量
-	maxImages := 1
-	if c.editModel == "gemini-3-pro-image-preview" {
-		maxImages = 14
+func (c *Client) EditImage(ctx context.Context, prompt string, imageURLs []string, outputMIME string) (string, error) {
+	if err := c.models.CheckEdit(); err != nil {
+		return "", err
 	}
 
+	// 验证图片数量
+	maxImages := c.maxEditImages
+
 	if len(imageURLs) == 0 {
-		return "", fmt.Errorf("at least one image URL is required")
+		return "", common.NewError(common.ErrCodeInvalidArgument, false, "at least one image URL is required")
 	}
 
 	if len(imageURLs) > maxImages {
-		return "", fmt.Errorf("too many images: model %s supports at most %d images, got %d", c.editModel, maxImages, len(imageURLs))
+		return "", common.NewError(common.ErrCodeInvalidArgument, false, "too many images: model %s supports at most %d images, got %d", c.editModel, maxImages, len(imageURLs))
 	}
 
-	common.WithFields(map[string]interface{}{
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"model":       c.editModel,
 		"prompt":      prompt,
 		"image_count": len(imageURLs),
 		"image_urls":  imageURLs,
 	}).Debug("Starting image editing")
 
-	// 为本次请求设置超时时间，避免无休止等待
+	// 为本次请求设置超时时间（按输入图片数放大），避免无休止等待
 	var cancel context.CancelFunc
-	ctx, cancel = context.WithTimeout(ctx, c.timeout)
+	ctx, cancel = context.WithTimeout(ctx, c.requestTimeout(ctx, len(imageURLs)))
 	defer cancel()
 
 	// 构建请求内容：包含所有图片和编辑提示
+	parts, err := c.buildImageParts(ctx, imageURLs)
+	if err != nil {
+		return "", err
+	}
+	parts = append(parts, &genai.Part{Text: prompt})
+
+	return c.generateFromParts(ctx, common.RoutedModel(ctx, c.editModel), parts, outputMIME, "edit")
+}
+
+// styleReferenceInstruction 风格参考生成时置于参考图片之前的说明，避免模型把参考图当作待编辑的原图
+const styleReferenceInstruction = "The following images are style references only. Generate a brand-new image that follows the text prompt and matches the visual style (palette, lighting, medium, brushwork, composition feel) of these references. Do not copy or edit their content."
+
+// GenerateWithStyle 风格参考生成：以文本提示描述内容、以一张或多张参考图片约束风格，生成一张新图片。
+// 使用生成模型，参考图片的处理方式与 EditImage 相同。
+func (c *Client) GenerateWithStyle(ctx context.Context, prompt string, styleImageURLs []string, outputMIME string) (string, error) {
+	if err := c.models.CheckGenerate(); err != nil {
+		return "", err
+	}
+
+	maxImages := c.maxStyleImages
+
+	if len(styleImageURLs) == 0 {
+		return "", common.NewError(common.ErrCodeInvalidArgument, false, "at least one style image URL is required")
+	}
+
+	if len(styleImageURLs) > maxImages {
+		return "", common.NewError(common.ErrCodeInvalidArgument, false, "too many style images: model %s supports at most %d images, got %d", c.generateModel, maxImages, len(styleImageURLs))
+	}
+
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"model":       c.generateModel,
+		"prompt":      prompt,
+		"image_count": len(styleImageURLs),
+		"image_urls":  styleImageURLs,
+	}).Debug("Starting style-guided image generation")
+
+	// 为本次请求设置超时时间（按参考图片数放大），避免无休止等待
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(ctx, c.requestTimeout(ctx, len(styleImageURLs)))
+	defer cancel()
+
+	// 构建请求内容：风格说明 + 参考图片 + 文本提示
+	imageParts, err := c.buildImageParts(ctx, styleImageURLs)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]*genai.Part, 0, len(imageParts)+2)
+	parts = append(parts, &genai.Part{Text: styleReferenceInstruction})
+	parts = append(parts, imageParts...)
+	parts = append(parts, &genai.Part{Text: prompt})
+
+	return c.generateFromParts(ctx, common.RoutedModel(ctx, c.generateModel), parts, outputMIME, "generate")
+}
+
+// buildImageParts 将输入图片（data URI / HTTP URL / 其它需下载的 URL）转换为 Gemini 请求的 parts。
+// HTTP(S) URL 以 FileData 交给 Gemini 自行拉取，拉取前校验主机访问策略。
+func (c *Client) buildImageParts(ctx context.Context, imageURLs []string) ([]*genai.Part, error) {
 	parts := make([]*genai.Part, 0, len(imageURLs)+1)
 
 	// 处理所有图片并添加到 parts
@@ -241,24 +403,24 @@ func (c *Client) EditImage(ctx context.Context, prompt string, imageURLs []strin
 			// 处理 data URI：需要解析为 InlineData
 			dataURIParts := strings.SplitN(imageURL, ",", 2)
 			if len(dataURIParts) != 2 {
-				return "", fmt.Errorf("invalid data URI format at index %d", i)
+				return nil, fmt.Errorf("invalid data URI format at index %d", i)
 			}
 
 			// 解析 MIME 类型
 			mimePart := strings.TrimSuffix(dataURIParts[0], ";base64")
 			mimeType := strings.TrimPrefix(mimePart, "data:")
 
-			// 解码 base64 数据
-			imageData, err := base64.StdEncoding.DecodeString(dataURIParts[1])
+			// 解码 base64 数据（兼容 URL 安全与无填充编码）
+			imageData, err := utils.DecodeBase64(dataURIParts[1])
 			if err != nil {
-				common.WithError(err).WithFields(map[string]interface{}{
+				common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
 					"image_url": utils.TruncateForLog(imageURL, 100),
 					"index":     i,
 				}).Error("Failed to decode data URI")
-				return "", fmt.Errorf("failed to decode data URI at index %d: %w", i, err)
+				return nil, fmt.Errorf("failed to decode data URI at index %d: %w", i, err)
 			}
 
-			common.WithFields(map[string]interface{}{
+			common.WithRequestID(ctx).WithFields(map[string]interface{}{
 				"index":     i,
 				"mime_type": mimeType,
 				"size":      len(imageData),
@@ -273,9 +435,17 @@ func (c *Client) EditImage(ctx context.Context, prompt string, imageURLs []strin
 			}
 		} else if strings.HasPrefix(imageURL, "http://") || strings.HasPrefix(imageURL, "https://") {
 			// 处理 HTTP/HTTPS URL：直接使用 FileData，让 Gemini API 自己获取
+			// 交给模型拉取前先校验主机访问策略
+			if err := utils.ValidateImageURL(ctx, imageURL); err != nil {
+				common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+					"image_url": imageURL,
+					"index":     i,
+				}).Error("Image URL rejected by host policy")
+				return nil, &common.GenAIError{Code: common.ErrCodeInvalidArgument, Message: fmt.Sprintf("image URL at index %d is not allowed", i), Err: err}
+			}
 			mimeType := utils.InferMimeTypeFromURL(imageURL)
 
-			common.WithFields(map[string]interface{}{
+			common.WithRequestID(ctx).WithFields(map[string]interface{}{
 				"image_url": imageURL,
 				"index":     i,
 				"mime_type": mimeType,
@@ -290,21 +460,21 @@ func (c *Client) EditImage(ctx context.Context, prompt string, imageURLs []strin
 			}
 		} else {
 			// 其他格式的 URL，尝试下载后使用 InlineData
-			common.WithFields(map[string]interface{}{
+			common.WithRequestID(ctx).WithFields(map[string]interface{}{
 				"image_url": imageURL,
 				"index":     i,
 			}).Debug("Downloading image (unsupported URL format)")
 
 			imageData, mimeType, err := utils.DownloadImageFromURL(ctx, imageURL)
 			if err != nil {
-				common.WithError(err).WithFields(map[string]interface{}{
+				common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
 					"image_url": imageURL,
 					"index":     i,
 				}).Error("Failed to download image for editing")
-				return "", fmt.Errorf("failed to download image at index %d: %w", i, err)
+				return nil, fmt.Errorf("failed to download image at index %d: %w", i, err)
 			}
 
-			common.WithFields(map[string]interface{}{
+			common.WithRequestID(ctx).WithFields(map[string]interface{}{
 				"image_url": imageURL,
 				"index":     i,
 				"mime_type": mimeType,
@@ -323,52 +493,60 @@ func (c *Client) EditImage(ctx context.Context, prompt string, imageURLs []strin
 		parts = append(parts, part)
 	}
 
-	// 添加文本提示
-	parts = append(parts, &genai.Part{Text: prompt})
+	return parts, nil
+}
 
+// generateFromParts 调用 GenerateContent 并从响应中提取图片，按请求的输出格式转换后按配置格式化。
+// Gemini 无法拉取 FileData 图片 URL 时，按配置以内联数据重试一次。action 用于错误信息与日志（如 edit）。
+func (c *Client) generateFromParts(ctx context.Context, model string, parts []*genai.Part, outputMIME, action string) (string, error) {
 	// 调用 GenerateContent API
-	result, err := c.client.Models.GenerateContent(ctx, c.editModel, []*genai.Content{
-		{Parts: parts},
-	}, nil)
+	result, err := c.generateContent(ctx, model, parts)
+	if err != nil && c.inlineFallback && hasFileData(parts) && isFileFetchError(err) {
+		// Gemini 无法访问图片 URL（私有 CDN、需要鉴权等）：服务端下载后以内联数据重试一次
+		common.WithRequestID(ctx).WithError(err).WithField("model", model).Warn("Gemini could not fetch image URL, retrying with inline image data")
+		inlineParts, inlineErr := c.inlineFileData(ctx, parts)
+		if inlineErr != nil {
+			return "", fmt.Errorf("failed to %s image: %w (inline fallback failed: %v)", action, classifyGeminiError(err), inlineErr)
+		}
+		result, err = c.generateContent(ctx, model, inlineParts)
+	}
 	if err != nil {
-		common.WithError(err).WithFields(map[string]interface{}{
-			"model":       c.editModel,
-			"prompt":      prompt,
-			"image_count": len(imageURLs),
-		}).Error("Failed to edit image from Gemini API")
-		return "", fmt.Errorf("failed to edit image: %w", err)
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"model":      model,
+			"action":     action,
+			"part_count": len(parts),
+		}).Error("Failed to generate content from Gemini API")
+		return "", fmt.Errorf("failed to %s image: %w", action, classifyGeminiError(err))
 	}
 
-	// 从响应中提取编辑后的图片
+	// 从响应中提取生成的图片
 	if len(result.Candidates) == 0 {
-		return "", fmt.Errorf("no candidates in response")
+		return "", emptyResultError("no candidates in response")
 	}
 
 	candidate := result.Candidates[0]
 	if candidate.Content == nil || len(candidate.Content.Parts) == 0 {
-		return "", fmt.Errorf("no content in candidate")
+		return "", emptyResultError("no content in candidate")
 	}
 
 	var imageResult string
-	var editedImageData []byte
-	var editedMimeType string
+	var imageData []byte
+	var mimeType string
 
-	// 查找编辑后的图片数据
+	// 查找生成的图片数据
 	for _, part := range candidate.Content.Parts {
 		// 检查是否是内联图片数据
 		if part.InlineData != nil {
-			editedImageData = part.InlineData.Data
-			editedMimeType = part.InlineData.MIMEType
-			// 将图片数据编码为 base64
-			base64Data := base64.StdEncoding.EncodeToString(part.InlineData.Data)
-			imageResult = fmt.Sprintf("data:%s;base64,%s", part.InlineData.MIMEType, base64Data)
+			// 同 GenerateImage：只保留原始数据，按需再编码为 data URI
+			imageData = part.InlineData.Data
+			mimeType = part.InlineData.MIMEType
 			break
 		}
 
 		// 检查是否是文件 URI
 		if part.FileData != nil {
 			imageResult = part.FileData.FileURI
-			editedMimeType = part.FileData.MIMEType
+			mimeType = part.FileData.MIMEType
 			break
 		}
 
@@ -379,40 +557,208 @@ func (c *Client) EditImage(ctx context.Context, prompt string, imageURLs []strin
 		}
 	}
 
-	if imageResult == "" {
-		common.Error("No edited image data found in Gemini response")
-		return "", fmt.Errorf("no edited image data found in response")
+	if imageResult == "" && imageData == nil {
+		common.WithRequestID(ctx).WithField("action", action).Error("No image data found in Gemini response")
+		return "", emptyResultError("no image data found in response")
 	}
 
-	common.WithFields(map[string]interface{}{
-		"model":        c.editModel,
-		"mime_type":    editedMimeType,
-		"has_data":     len(editedImageData) > 0,
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"model":        model,
+		"mime_type":    mimeType,
+		"has_data":     len(imageData) > 0,
 		"image_format": c.imageFormat,
-	}).Debug("Image edited successfully")
+		"action":       action,
+	}).Debug("Gemini image request succeeded")
+
+	// 按请求的输出格式转换（转换与格式化的耗时计入 format 阶段）
+	defer common.StartTiming(ctx, common.StageFormat)()
+	imageResult, imageData, mimeType, err = c.convertOutputMIME(ctx, imageResult, imageData, mimeType, outputMIME)
+	if err != nil {
+		return "", err
+	}
 
 	// 根据配置的图片格式处理结果
-	return c.formatImageResult(ctx, imageResult, editedImageData, editedMimeType)
+	return c.formatImageResult(ctx, imageResult, imageData, mimeType)
+}
+
+// fileFetchErrorHints Gemini 因无法拉取 FileData URL 而失败时，错误信息中常见的关键词
+var fileFetchErrorHints = []string{"url", "uri", "fetch", "retriev", "download", "access"}
+
+// isFileFetchError 判断错误是否像是 Gemini 无法拉取图片 URL 导致的（4xx 且错误信息提及 URL / 拉取）
+func isFileFetchError(err error) bool {
+	var apiErr genai.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code < 400 || apiErr.Code >= 500 {
+		return false
+	}
+	msg := strings.ToLower(apiErr.Message)
+	for _, hint := range fileFetchErrorHints {
+		if strings.Contains(msg, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFileData 判断请求内容中是否包含交给 Gemini 拉取的 FileData
+func hasFileData(parts []*genai.Part) bool {
+	for _, part := range parts {
+		if part.FileData != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// inlineFileData 在服务端下载所有 FileData 图片并替换为 InlineData，返回新的 parts（不修改原切片）。
+// 同一请求内最多同时下载 downloadConcurrency 张图片；任一下载失败时取消其余下载并返回该错误。
+func (c *Client) inlineFileData(ctx context.Context, parts []*genai.Part) ([]*genai.Part, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	inlined := make([]*genai.Part, len(parts))
+	errs := make([]error, len(parts))
+	sem := make(chan struct{}, c.downloadConcurrency)
+	var wg sync.WaitGroup
+
+	for i, part := range parts {
+		if part.FileData == nil {
+			inlined[i] = part
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, uri string) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+
+			data, mimeType, err := utils.DownloadImageFromURL(ctx, uri)
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to download image %s: %w", uri, err)
+				cancel()
+				return
+			}
+			inlined[i] = &genai.Part{
+				InlineData: &genai.Blob{
+					Data:     data,
+					MIMEType: mimeType,
+				},
+			}
+		}(i, part.FileData.FileURI)
+	}
+	wg.Wait()
+
+	// 优先返回真正的下载错误，而不是因取消导致的 context 错误
+	var firstErr error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return inlined, nil
+}
+
+// classifyGeminiError 将 genai.APIError 转换为带错误码的 GenAIError，便于上层判断是否可重试，
+// 并按错误分类计入 provider 错误统计
+func classifyGeminiError(err error) error {
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		genaiErr := common.NewHTTPStatusError(apiErr.Code, "gemini api error")
+		genaiErr.Err = err
+		err = genaiErr
+	}
+	common.RecordProviderError("gemini", err)
+	return err
+}
+
+// emptyResultError 返回 Gemini 响应中没有图片时的错误，并计入 empty_result 统计
+func emptyResultError(reason string) error {
+	err := fmt.Errorf("%s: %w", reason, common.ErrEmptyResult)
+	common.RecordProviderError("gemini", err)
+	return err
+}
+
+// convertOutputMIME 将模型返回的图片转换为请求的输出格式。
+//
+// Gemini API（非 Vertex AI）不支持在生成配置中指定 ImageConfig.OutputMIMEType，SDK 会直接拒绝该参数，
+// 因此这里在拿到结果后统一转换：outputMIME 为空或与返回格式一致时原样返回；
+// 否则取得图片数据（内联数据 / data URI / 下载 URL）后重新编码，转换后的结果以内联数据形式返回。
+// 透明像素转为 JPEG 时合成到白色背景上。
+func (c *Client) convertOutputMIME(ctx context.Context, imageResult string, imageData []byte, mimeType, outputMIME string) (string, []byte, string, error) {
+	if outputMIME == "" || strings.EqualFold(mimeType, outputMIME) {
+		return imageResult, imageData, mimeType, nil
+	}
+
+	data := imageData
+	if data == nil {
+		var err error
+		if strings.HasPrefix(imageResult, "data:") {
+			data, _, err = utils.DecodeDataURI(imageResult)
+		} else {
+			data, _, err = utils.DownloadImageFromURL(ctx, imageResult)
+		}
+		if err != nil {
+			return "", nil, "", fmt.Errorf("failed to read image for output_mime conversion: %w", err)
+		}
+	}
+
+	converted, convertedMIME, err := utils.ConvertImage(data, strings.TrimPrefix(outputMIME, "image/"), utils.ConvertOptions{Background: utils.FlattenBackground()})
+	if err != nil {
+		return "", nil, "", fmt.Errorf("failed to convert image to %s: %w", outputMIME, err)
+	}
+
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"from_mime": mimeType,
+		"to_mime":   convertedMIME,
+	}).Debug("Converted Gemini image to requested output format")
+
+	return "", converted, convertedMIME, nil
 }
 
 // formatImageResult 根据配置的图片格式格式化结果
-// imageResult: Gemini 返回的原始结果（可能是 data URI 或 URL）
-// imageData: 如果 imageResult 是 data URI，这里包含原始数据；如果是 URL，则为 nil
+// imageResult: Gemini 返回的原始结果（可能是 data URI 或 URL；内联图片时为空）
+// imageData: Gemini 返回的内联图片原始数据；如果是 URL，则为 nil
 // mimeType: 图片的 MIME 类型
 func (c *Client) formatImageResult(ctx context.Context, imageResult string, imageData []byte, mimeType string) (string, error) {
-	// 判断 imageResult 是 data URI 还是 URL
+	// 判断 imageResult 是内联数据、data URI 还是 URL
+	isInline := imageData != nil
 	isDataURI := strings.HasPrefix(imageResult, "data:")
 	isHTTPURL := strings.HasPrefix(imageResult, "http://") || strings.HasPrefix(imageResult, "https://")
 
-	if strings.EqualFold(c.imageFormat, "base64") {
-		// 需要返回 base64 格式
-		if isDataURI {
-			// 已经是 data URI，直接返回
-			return imageResult, nil
+	if utils.IsBase64Format(c.imageFormat) {
+		// 需要返回 base64 格式（data URI 或 base64-raw 的纯 base64）
+		if isInline {
+			// 内联数据直接编码
+			return c.encodeImage(ctx, mimeType, imageData)
+		} else if isDataURI {
+			// 已经是 data URI：base64 且未设置大小上限时直接返回，否则解码后重新编码（base64-raw 需去掉前缀）
+			if !strings.EqualFold(c.imageFormat, utils.ImageFormatBase64Raw) && c.base64MaxBytes <= 0 {
+				return imageResult, nil
+			}
+			data, dataMIME, err := utils.DecodeDataURI(imageResult)
+			if err != nil {
+				return "", fmt.Errorf("invalid data URI in Gemini result: %w", err)
+			}
+			return c.encodeImage(ctx, dataMIME, data)
 		} else {
 			// 期望是 URL，需要下载并转换为 base64
 			if !isHTTPURL {
-				common.WithFields(map[string]interface{}{
+				common.WithRequestID(ctx).WithFields(map[string]interface{}{
 					"is_data_uri": isDataURI,
 					"is_http_url": isHTTPURL,
 					"length":      len(imageResult),
@@ -420,15 +766,14 @@ func (c *Client) formatImageResult(ctx context.Context, imageResult string, imag
 				return "", fmt.Errorf("invalid image result: expected URL or data URI, got text")
 			}
 
-			common.Debug("Converting URL to base64 format")
+			common.WithRequestID(ctx).Debug("Converting URL to base64 format")
 			data, contentType, err := utils.DownloadImageFromURL(ctx, imageResult)
 			if err != nil {
-				common.WithError(err).Error("Failed to download image from URL for base64 conversion")
+				common.WithRequestID(ctx).WithError(err).Error("Failed to download image from URL for base64 conversion")
 				return "", fmt.Errorf("failed to download image: %w", err)
 			}
-			// 转换为 base64 data URI
-			base64Data := base64.StdEncoding.EncodeToString(data)
-			return fmt.Sprintf("data:%s;base64,%s", contentType, base64Data), nil
+			// 转换为 base64 data URI 或纯 base64
+			return c.encodeImage(ctx, contentType, data)
 		}
 	} else if strings.EqualFold(c.imageFormat, "url") {
 		// 需要返回 URL 格式（上传到 OSS）
@@ -436,9 +781,15 @@ func (c *Client) formatImageResult(ctx context.Context, imageResult string, imag
 			return "", fmt.Errorf("OSS is not configured but image format is set to 'url'")
 		}
 
+		// 结果已是 provider 托管的持久 URL 时直接返回，省去下载与转存
+		if !isInline && isHTTPURL && c.directURLs && !utils.IsSignedURL(imageResult) {
+			common.WithRequestID(ctx).WithField("image_url", imageResult).Debug("Returning Gemini result URL directly, skipping OSS upload")
+			return imageResult, nil
+		}
+
 		// 如果既不是 data URI 也不是 http(s) URL，则认为返回的不是图片
-		if !isDataURI && !isHTTPURL {
-			common.WithFields(map[string]interface{}{
+		if !isInline && !isDataURI && !isHTTPURL {
+			common.WithRequestID(ctx).WithFields(map[string]interface{}{
 				"is_data_uri": isDataURI,
 				"is_http_url": isHTTPURL,
 				"length":      len(imageResult),
@@ -446,21 +797,44 @@ func (c *Client) formatImageResult(ctx context.Context, imageResult string, imag
 			return "", fmt.Errorf("invalid image result: expected URL or data URI, got text")
 		}
 
-		common.WithField("bucket", c.ossBucket).Info("Uploading image to OSS")
-		uploadedURL, err := c.uploadImageToOSS(ctx, imageResult, imageData, mimeType)
+		// OSS 不可用且开启降级时返回 Gemini 结果 URL 或 data URI（GENAI_OSS_DEGRADE）
+		nativeURL, degradeData, degradeMIME := "", imageData, mimeType
+		if !isInline && isHTTPURL {
+			nativeURL = imageResult
+		} else if !isInline && isDataURI {
+			if data, dataMIME, err := utils.DecodeDataURI(imageResult); err == nil {
+				degradeData, degradeMIME = data, dataMIME
+			}
+		}
+
+		common.WithRequestID(ctx).WithField("bucket", c.ossBucket).Info("Uploading image to OSS")
+		uploadedURL, err := oss.UploadOrDegrade(ctx, "gemini", nativeURL, degradeData, degradeMIME, func() (string, error) {
+			return c.uploadImageToOSS(ctx, imageResult, imageData, mimeType)
+		})
 		if err != nil {
-			common.WithError(err).Error("Failed to upload image to OSS")
+			common.WithRequestID(ctx).WithError(err).Error("Failed to upload image to OSS")
 			return "", fmt.Errorf("failed to upload image to OSS: %w", err)
 		}
-		common.WithField("uploaded_url", uploadedURL).Info("Image uploaded to OSS successfully")
+		common.WithRequestID(ctx).WithField("uploaded_url", uploadedURL).Info("Image uploaded to OSS successfully")
 		return uploadedURL, nil
 	} else {
 		// 未知格式，返回原始结果
-		common.Warnf("Unknown image format '%s', returning original result", c.imageFormat)
+		common.WithRequestID(ctx).Warnf("Unknown image format '%s', returning original result", c.imageFormat)
+		if isInline {
+			return utils.EncodeDataURI(mimeType, imageData), nil
+		}
 		return imageResult, nil
 	}
 }
 
+// encodeImage base64 / base64-raw 输出时编码图片；超过 GENAI_BASE64_MAX_BYTES 且 OSS 可用时改为上传 OSS 返回 URL
+func (c *Client) encodeImage(ctx context.Context, mimeType string, data []byte) (string, error) {
+	if utils.Base64Fallback(ctx, "gemini", c.base64MaxBytes, len(data), c.ossClient != nil && c.ossBucket != "" && !oss.DegradeActive()) {
+		return c.uploadImageToOSS(ctx, "", data, mimeType)
+	}
+	return utils.EncodeImage(ctx, c.imageFormat, mimeType, data), nil
+}
+
 // 保留旧函数名以兼容历史代码，同时转发到 common 包中的实现。
 // TODO: 后续可直接使用 common.DownloadImageFromURL / common.InferMimeTypeFromURL，并删除这些包装。
 func downloadImageFromURL(ctx context.Context, url string) ([]byte, string, error) {
@@ -472,34 +846,32 @@ func inferMimeTypeFromURL(url string) string {
 }
 
 // uploadImageToOSS 上传图片到 OSS
-// imageResult 可能是 data URI 或 URL
-// imageData 如果是 data URI，这里会包含原始数据；如果是 URL，则为 nil
+// imageResult 可能是 data URI 或 URL（内联图片时为空）
+// imageData 如果是内联图片，这里会包含原始数据；如果是 URL，则为 nil
 // mimeType 图片的 MIME 类型
 func (c *Client) uploadImageToOSS(ctx context.Context, imageResult string, imageData []byte, mimeType string) (string, error) {
 	var data []byte
 	var contentType string
 
-	// 判断是 data URI 还是 URL
-	if strings.HasPrefix(imageResult, "data:") {
-		// 处理 data URI
-		if imageData != nil {
-			data = imageData
-			contentType = mimeType
-		} else {
-			// 从 data URI 中解析数据
-			parts := strings.SplitN(imageResult, ",", 2)
-			if len(parts) != 2 {
-				return "", fmt.Errorf("invalid data URI format")
-			}
-			// 解析 MIME 类型
-			mimePart := strings.TrimSuffix(parts[0], ";base64")
-			contentType = strings.TrimPrefix(mimePart, "data:")
-			// 解码 base64 数据
-			var err error
-			data, err = base64.StdEncoding.DecodeString(parts[1])
-			if err != nil {
-				return "", fmt.Errorf("failed to decode base64 data: %w", err)
-			}
+	// 判断是内联数据、data URI 还是 URL
+	if imageData != nil {
+		// 内联数据直接上传，无需经过 base64
+		data = imageData
+		contentType = mimeType
+	} else if strings.HasPrefix(imageResult, "data:") {
+		// 从 data URI 中解析数据
+		parts := strings.SplitN(imageResult, ",", 2)
+		if len(parts) != 2 {
+			return "", fmt.Errorf("invalid data URI format")
+		}
+		// 解析 MIME 类型
+		mimePart := strings.TrimSuffix(parts[0], ";base64")
+		contentType = strings.TrimPrefix(mimePart, "data:")
+		// 解码 base64 数据（兼容 URL 安全与无填充编码）
+		var err error
+		data, err = utils.DecodeBase64(parts[1])
+		if err != nil {
+			return "", fmt.Errorf("failed to decode base64 data: %w", err)
 		}
 	} else {
 		// 处理 URL，需要下载图片
@@ -515,7 +887,7 @@ func (c *Client) uploadImageToOSS(ctx context.Context, imageResult string, image
 	fileName := utils.GenerateImageFileName(contentType)
 	key := fmt.Sprintf("%s%s", path, fileName)
 
-	common.WithFields(map[string]interface{}{
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"bucket":       c.ossBucket,
 		"key":          key,
 		"content_type": contentType,
@@ -524,20 +896,21 @@ func (c *Client) uploadImageToOSS(ctx context.Context, imageResult string, image
 
 	// 上传到 OSS
 	reader := bytes.NewReader(data)
-	signedURL, err := c.ossClient.UploadFileWithURL(ctx, c.ossBucket, key, reader, contentType, 3600*24*7) // 7天有效期
+	signedURL, err := c.ossClient.UploadFileWithURL(ctx, c.ossBucket, key, reader, contentType, oss.URLExpiry(ctx, 0)) // 默认有效期见 OSS_URL_EXPIRY_SECONDS，可按请求覆盖
 	if err != nil {
-		common.WithError(err).WithFields(map[string]interface{}{
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
 			"bucket": c.ossBucket,
 			"key":    key,
 		}).Error("Failed to upload image to OSS")
 		return "", fmt.Errorf("failed to upload image to OSS: %w", err)
 	}
 
-	common.WithFields(map[string]interface{}{
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"bucket":     c.ossBucket,
 		"key":        key,
 		"signed_url": signedURL,
 	}).Debug("Image uploaded to OSS successfully")
 
+	oss.PublishThumbnail(ctx, c.ossClient, c.ossBucket, data, c.thumbnailSize)
 	return signedURL, nil
 }
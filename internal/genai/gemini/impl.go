@@ -21,20 +21,36 @@ func NewGeminiClientFromConfig(cfg *common.Config) (*GeminiClient, error) {
 	// 当格式为 "url" 时，启用 OSS 上传；否则直接返回 base64/data URI
 	ossUploadEnabled := strings.EqualFold(cfg.GenAIImageFormat, "url")
 
+	modelMaxImages, err := ParseModelMaxImages(cfg.GeminiModelMaxImages)
+	if err != nil {
+		return nil, err
+	}
+
 	config := Config{
-		APIKey:            cfg.GenAIAPIKey,
-		BaseURL:           cfg.GenAIBaseURL,
-		GenerateModelName: cfg.GenAIGenModelName,
-		EditModelName:     cfg.GenAIEditModelName,
-		OSSUploadEnabled:  ossUploadEnabled,
-		OSSBucket:         cfg.OSSBucket,
-		ImageFormat:       cfg.GenAIImageFormat,
-		Timeout:           time.Duration(cfg.GenAITimeoutSeconds) * time.Second,
+		APIKey:                  cfg.GenAIAPIKey,
+		BaseURL:                 cfg.GenAIBaseURL,
+		GenerateModelName:       cfg.GenAIGenModelName,
+		EditModelName:           cfg.GenAIEditModelName,
+		OSSUploadEnabled:        ossUploadEnabled,
+		OSSBucket:               cfg.OSSBucket,
+		ImageFormat:             cfg.GenAIImageFormat,
+		Timeout:                 time.Duration(cfg.GenAITimeoutSeconds) * time.Second,
+		ModelMaxImages:          modelMaxImages,
+		ExtraHeaders:            cfg.GenAIExtraHeaders,
+		InlineFallback:          cfg.GeminiInlineFallback,
+		EditDownloadConcurrency: cfg.GeminiEditDownloadConcurrency,
+		OverloadRetries:         cfg.GeminiOverloadRetries,
+		MaxRetryAfter:           time.Duration(cfg.MaxRetryAfterSeconds) * time.Second,
+		TimeoutScaling:          common.NewTimeoutScaling(cfg),
+		DirectURLs:              cfg.DirectURLEnabled("gemini"),
+		Base64MaxBytes:          cfg.Base64MaxBytes,
+		ThumbnailSize:           cfg.ThumbnailSize,
+		StrictModels:            cfg.StrictModels,
 	}
 
-	// 如果启用了 OSS 上传，创建 OSS 客户端
-	if ossUploadEnabled {
-		ossClient, err := oss.NewOSSClientFromConfig(cfg)
+	// 如果启用了 OSS 上传，或 base64 输出的大图需要回退到 OSS，创建 OSS 客户端
+	if ossUploadEnabled || (cfg.Base64MaxBytes > 0 && cfg.IsOSSConfigured()) {
+		ossClient, err := oss.SharedOSSClientFromConfig(cfg)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create OSS client: %w", err)
 		}
@@ -52,13 +68,31 @@ func NewGeminiClientFromConfig(cfg *common.Config) (*GeminiClient, error) {
 }
 
 // GenerateImage 实现 GenimiIface 接口的文生图方法
-func (g *GeminiClient) GenerateImage(ctx context.Context, prompt string) (string, error) {
-	return g.client.GenerateImage(ctx, prompt)
+func (g *GeminiClient) GenerateImage(ctx context.Context, prompt string, output_mime string) (string, error) {
+	image, err := g.client.GenerateImage(ctx, prompt, output_mime)
+	return image, common.WithProviderContext(err, "gemini", g.client.generateModel)
 }
 
 // EditImage 实现 GenimiIface 接口的图片编辑方法
-func (g *GeminiClient) EditImage(ctx context.Context, prompt string, image_urls []string) (string, error) {
-	return g.client.EditImage(ctx, prompt, image_urls)
+func (g *GeminiClient) EditImage(ctx context.Context, prompt string, image_urls []string, output_mime string) (string, error) {
+	image, err := g.client.EditImage(ctx, prompt, image_urls, output_mime)
+	return image, common.WithProviderContext(err, "gemini", g.client.editModel)
+}
+
+// GenerateWithStyle 实现 GenimiIface 接口的风格参考生成方法
+func (g *GeminiClient) GenerateWithStyle(ctx context.Context, prompt string, style_image_urls []string, output_mime string) (string, error) {
+	image, err := g.client.GenerateWithStyle(ctx, prompt, style_image_urls, output_mime)
+	return image, common.WithProviderContext(err, "gemini", g.client.generateModel)
+}
+
+// MaxEditImages 实现 GenimiIface 接口，返回编辑模型允许的最大输入图片数
+func (g *GeminiClient) MaxEditImages() int {
+	return g.client.MaxEditImages()
+}
+
+// Preflight 启动预检，确认配置的模型可用
+func (g *GeminiClient) Preflight(ctx context.Context) error {
+	return g.client.Preflight(ctx)
 }
 
 // Close 关闭客户端
@@ -3,6 +3,12 @@ package gemini
 import "context"
 
 type GenimiIface interface {
-	GenerateImage(ctx context.Context, prompt string) (string, error)
-	EditImage(ctx context.Context, prompt string, image_urls []string) (string, error)
+	// GenerateImage / EditImage 的 output_mime 为空时保持模型返回的格式，
+	// 否则为规范化后的 MIME 类型（image/png / image/jpeg），结果会被转换为该格式
+	GenerateImage(ctx context.Context, prompt string, output_mime string) (string, error)
+	EditImage(ctx context.Context, prompt string, image_urls []string, output_mime string) (string, error)
+	// GenerateWithStyle 以文本提示 + 风格参考图片生成新图片（使用生成模型）
+	GenerateWithStyle(ctx context.Context, prompt string, style_image_urls []string, output_mime string) (string, error)
+	// MaxEditImages 返回编辑模型允许的最大输入图片数（内置默认值或 GEMINI_MODEL_MAX_IMAGES 覆盖值）
+	MaxEditImages() int
 }
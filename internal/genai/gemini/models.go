@@ -0,0 +1,48 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// defaultMaxEditImages 未在表中登记的模型，图片编辑默认只接受 1 张输入图片
+const defaultMaxEditImages = 1
+
+// defaultModelMaxImages 各模型图片编辑时允许的最大输入图片数（内置表）。
+// 新模型可通过 GEMINI_MODEL_MAX_IMAGES 覆盖或补充，无需重新编译。
+var defaultModelMaxImages = map[string]int{
+	"gemini-3-pro-image-preview": 14,
+	"gemini-2.5-flash-image":     1,
+}
+
+// ParseModelMaxImages 解析 GEMINI_MODEL_MAX_IMAGES（JSON 对象，模型名 → 最大图片数），
+// 例如 {"gemini-3-pro-image-preview": 14, "my-new-model": 4}。为空时返回 nil。
+func ParseModelMaxImages(raw string) (map[string]int, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+
+	var overrides map[string]int
+	if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+		return nil, fmt.Errorf("GEMINI_MODEL_MAX_IMAGES must be a JSON object of model name to max images: %w", err)
+	}
+	for model, n := range overrides {
+		if n <= 0 {
+			return nil, fmt.Errorf("GEMINI_MODEL_MAX_IMAGES: max images for model %q must be positive, got %d", model, n)
+		}
+	}
+	return overrides, nil
+}
+
+// ResolveMaxEditImages 返回模型允许的最大输入图片数：优先使用 overrides，其次内置表，否则为 1。
+func ResolveMaxEditImages(model string, overrides map[string]int) int {
+	if n, ok := overrides[model]; ok {
+		return n
+	}
+	if n, ok := defaultModelMaxImages[model]; ok {
+		return n
+	}
+	return defaultMaxEditImages
+}
@@ -0,0 +1,58 @@
+package gemini
+
+import (
+	"context"
+	"sync/atomic"
+
+	"genai-mcp/common"
+)
+
+// ReloadableClient 可在运行时原子替换底层客户端的 GenimiIface 实现。
+// 进行中的请求继续使用替换前取得的客户端，不受重新加载影响。
+type ReloadableClient struct {
+	current atomic.Pointer[GeminiClient]
+}
+
+// NewReloadableClient 使用初始客户端创建 ReloadableClient
+func NewReloadableClient(client *GeminiClient) *ReloadableClient {
+	r := &ReloadableClient{}
+	r.current.Store(client)
+	return r
+}
+
+// Reload 根据新配置重建客户端并原子替换；创建失败时保留原客户端
+func (r *ReloadableClient) Reload(cfg *common.Config) error {
+	client, err := NewGeminiClientFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if old := r.current.Swap(client); old != nil {
+		_ = old.Close()
+	}
+	return nil
+}
+
+// GenerateImage 实现 GenimiIface
+func (r *ReloadableClient) GenerateImage(ctx context.Context, prompt string, output_mime string) (string, error) {
+	return r.current.Load().GenerateImage(ctx, prompt, output_mime)
+}
+
+// EditImage 实现 GenimiIface
+func (r *ReloadableClient) EditImage(ctx context.Context, prompt string, image_urls []string, output_mime string) (string, error) {
+	return r.current.Load().EditImage(ctx, prompt, image_urls, output_mime)
+}
+
+// GenerateWithStyle 实现 GenimiIface
+func (r *ReloadableClient) GenerateWithStyle(ctx context.Context, prompt string, style_image_urls []string, output_mime string) (string, error) {
+	return r.current.Load().GenerateWithStyle(ctx, prompt, style_image_urls, output_mime)
+}
+
+// MaxEditImages 实现 GenimiIface
+func (r *ReloadableClient) MaxEditImages() int {
+	return r.current.Load().MaxEditImages()
+}
+
+// Close 关闭当前客户端
+func (r *ReloadableClient) Close() error {
+	return r.current.Load().Close()
+}
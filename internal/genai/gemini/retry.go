@@ -0,0 +1,129 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"genai-mcp/common"
+
+	"google.golang.org/genai"
+)
+
+// 模型过载重试的退避参数：第 n 次重试前等待 base*2^(n-1)（以 max 封顶），再叠加 ±25% 抖动
+const (
+	overloadRetryBaseDelay = 2 * time.Second
+	overloadRetryMaxDelay  = 16 * time.Second
+	overloadRetryJitter    = 0.25
+)
+
+// isOverloadedError 判断错误是否为 Gemini 模型过载（503 / UNAVAILABLE）这类短暂错误。
+// 其它 5xx 与所有 4xx（参数错误、鉴权、配额等）都不视为过载。
+func isOverloadedError(err error) bool {
+	var apiErr genai.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Code == http.StatusServiceUnavailable || strings.EqualFold(apiErr.Status, "UNAVAILABLE")
+}
+
+// overloadRetryDelay 返回第 attempt 次重试（从 1 开始）前的等待时间
+func overloadRetryDelay(attempt int) time.Duration {
+	delay := overloadRetryBaseDelay << (attempt - 1)
+	if delay <= 0 || delay > overloadRetryMaxDelay {
+		delay = overloadRetryMaxDelay
+	}
+	return time.Duration(float64(delay) * (1 + overloadRetryJitter*(2*rand.Float64()-1)))
+}
+
+// retryInfoType Gemini 错误详情中携带服务端建议重试等待时间的类型（HTTP Retry-After 的等价物）
+const retryInfoType = "type.googleapis.com/google.rpc.RetryInfo"
+
+// serverRetryDelay 从错误详情的 google.rpc.RetryInfo 中读取服务端建议的重试等待时间（retryDelay，如 "30s"）
+func serverRetryDelay(err error) (time.Duration, bool) {
+	var apiErr genai.APIError
+	if !errors.As(err, &apiErr) {
+		return 0, false
+	}
+	for _, detail := range apiErr.Details {
+		if detail["@type"] != retryInfoType {
+			continue
+		}
+		raw, ok := detail["retryDelay"].(string)
+		if !ok {
+			continue
+		}
+		delay, parseErr := time.ParseDuration(raw)
+		if parseErr != nil || delay < 0 {
+			continue
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// retryDelay 返回第 attempt 次重试前的等待时间：服务端建议了等待时间且不超过 maxRetryAfter
+// （GENAI_MAX_RETRY_AFTER_SECONDS）时采用建议值，否则使用退避间隔，避免异常的超大建议值拖住请求
+func (c *Client) retryDelay(ctx context.Context, err error, attempt int) time.Duration {
+	backoff := overloadRetryDelay(attempt)
+	if c.maxRetryAfter <= 0 {
+		return backoff
+	}
+	suggested, ok := serverRetryDelay(err)
+	if !ok {
+		return backoff
+	}
+	if suggested > c.maxRetryAfter {
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"suggested_ms": suggested.Milliseconds(),
+			"max_ms":       c.maxRetryAfter.Milliseconds(),
+			"backoff_ms":   backoff.Milliseconds(),
+		}).Warn("Gemini suggested retry delay exceeds GENAI_MAX_RETRY_AFTER_SECONDS, using backoff instead")
+		return backoff
+	}
+	return suggested
+}
+
+// generateContent 调用 GenerateContent；遇到模型过载错误时按 overloadRetries 重试，
+// 等待时间优先采用服务端建议值（以 maxRetryAfter 为上限），否则退避。
+// 重试与首次请求共用 ctx 的超时，等待期间 ctx 结束则返回最后一次的错误。
+// 包括重试等待在内的总耗时计入 api_call 阶段。
+func (c *Client) generateContent(ctx context.Context, model string, parts []*genai.Part) (*genai.GenerateContentResponse, error) {
+	defer common.StartTiming(ctx, common.StageAPICall)()
+	for attempt := 0; ; attempt++ {
+		result, err := c.client.Models.GenerateContent(ctx, model, []*genai.Content{
+			{Parts: parts},
+		}, nil)
+		if err == nil && result != nil && result.SDKHTTPResponse != nil {
+			common.RecordRateLimit(ctx, "gemini", result.SDKHTTPResponse.Headers)
+		}
+		if err == nil && result != nil {
+			common.WithRequestID(ctx).WithFields(map[string]interface{}{
+				"model":               model,
+				"provider_request_id": result.ResponseID,
+			}).Debug("Gemini generate response received")
+		}
+		if err == nil || attempt >= c.overloadRetries || !isOverloadedError(err) {
+			return result, err
+		}
+
+		delay := c.retryDelay(ctx, err, attempt+1)
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"model":       model,
+			"attempt":     attempt + 1,
+			"max_retries": c.overloadRetries,
+			"delay_ms":    delay.Milliseconds(),
+		}).Warn("Gemini model overloaded, retrying")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,610 @@
+package stability
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/oss"
+	"genai-mcp/internal/utils"
+)
+
+// defaultBaseURL Stability AI 平台的默认地址（GENAI_BASE_URL 未设置时使用）
+const defaultBaseURL = "https://api.stability.ai"
+
+// 默认请求超时时间（调用 Stability 生成接口）
+const defaultStabilityTimeout = 60 * time.Second
+
+// defaultOutputLongSide 默认输出（1:1，1024*1024 左右）的长边像素数，用于按请求规模估算超时
+const defaultOutputLongSide = 1024
+
+// defaultStrength 图生图未指定 strength 时的默认改动程度
+const defaultStrength = 0.5
+
+// DefaultStrength 作为 EditImage 的 strength 传入时表示未指定，使用默认改动程度（0 是合法取值，表示保持原图）
+const DefaultStrength = -1.0
+
+// balancePath 账户余额接口（相对 BaseURL），用于启动预检校验 API Key
+const balancePath = "/v1/user/balance"
+
+// Client Stability AI 客户端实现，调用 Stable Image v2beta 生成接口（同步返回图片）。
+//
+// 注意：
+//   - 生成接口只接受 multipart/form-data 请求体，不接受 JSON：
+//     https://platform.stability.ai/docs/api-reference#tag/Generate
+//   - 请求头 Accept: image/* 时响应体为原始图片数据，finish-reason / seed 在响应头中返回
+type Client struct {
+	httpClient *http.Client
+
+	baseURL string
+	apiKey  string
+	// 分别用于图片生成与图片编辑的模型名称及其对应的生成接口
+	genModel     string
+	editModel    string
+	genEndpoint  endpoint
+	editEndpoint endpoint
+
+	// 图片输出与 OSS 配置（行为与 Gemini 对齐）
+	ossClient        oss.OSSIface
+	ossBucket        string
+	ossUploadEnabled bool
+	imageFormat      string // 图片输出格式: "base64"、"base64-raw" 或 "url"
+
+	timeout time.Duration
+	// 按请求规模放大单次请求超时（Base 为 timeout）
+	timeoutScaling common.TimeoutScaling
+	// 连接错误与 429 / 5xx 响应的重试策略
+	retry common.HTTPRetry
+
+	// 附加到每个请求的自定义 HTTP 头（GENAI_EXTRA_HEADERS）
+	extraHeaders map[string]string
+
+	// base64 输出时内联图片的最大字节数，超过时改为上传 OSS 返回 URL（GENAI_BASE64_MAX_BYTES）
+	base64MaxBytes int
+
+	// 结果图片上传 OSS 时附带生成的缩略图长边像素数，0 表示不生成（GENAI_GENERATE_THUMBNAIL）
+	thumbnailSize int
+
+	// 生成 / 编辑模型的配置情况，用于复用模型时的严格模式校验（GENAI_STRICT_MODELS）
+	models common.ModelPair
+}
+
+// Config Stability 客户端配置。
+type Config struct {
+	// BaseURL 为空时使用 https://api.stability.ai
+	BaseURL string
+	APIKey  string
+	// 分别用于图片生成与图片编辑的模型名称：core、ultra 或 sd3 系列（如 sd3.5-large）
+	GenModel  string
+	EditModel string
+
+	// 可选：OSS 与图片输出配置（与 Gemini 一致）
+	OSSClient        oss.OSSIface
+	OSSBucket        string
+	OSSUploadEnabled bool
+	ImageFormat      string
+
+	Timeout time.Duration
+	// 可选：按请求规模放大超时的参数，Base 由 Timeout 决定
+	TimeoutScaling common.TimeoutScaling
+
+	// 可选：连接错误与 429 / 500 / 502 / 503 / 504 响应的最大重试次数（不含首次请求），0 表示不重试
+	MaxRetries int
+	// 可选：重试时采用 Retry-After 响应头建议等待时间的上限，超过时改用退避间隔；0 表示忽略 Retry-After
+	MaxRetryAfter time.Duration
+
+	// 可选：附加到每个请求的自定义 HTTP 头，认证与 Content-Type 头始终优先
+	ExtraHeaders map[string]string
+
+	// 可选：base64 输出时内联图片的最大字节数，超过且配置了 OSS 时改为上传 OSS 返回 URL，0 表示不限制
+	Base64MaxBytes int
+
+	// 可选：结果图片上传 OSS 时附带生成的缩略图长边像素数，0 表示不生成
+	ThumbnailSize int
+
+	// 可选：严格模式，未显式配置生成 / 编辑模型时拒绝对应调用，而不是复用另一个模型
+	StrictModels bool
+}
+
+// NewStabilityClientFromConfig 从通用配置创建 Stability 客户端。
+// 仅当 common.Config.GenAIProvider=stability 时使用。
+func NewStabilityClientFromConfig(cfg *common.Config) (*Client, error) {
+	// 根据 GENAI_IMAGE_FORMAT 决定是否上传到 OSS
+	// 当格式为 "url" 时，启用 OSS 上传；否则直接返回 base64
+	ossUploadEnabled := strings.EqualFold(cfg.GenAIImageFormat, "url")
+
+	stabilityCfg := Config{
+		// Stability 与其它 provider 共用 GENAI_BASE_URL / GENAI_API_KEY，两类请求分别使用不同模型
+		BaseURL:   cfg.GenAIBaseURL,
+		APIKey:    cfg.GenAIAPIKey,
+		GenModel:  cfg.GenAIGenModelName,
+		EditModel: cfg.GenAIEditModelName,
+		Timeout:   time.Duration(cfg.GenAITimeoutSeconds) * time.Second,
+
+		TimeoutScaling: common.NewTimeoutScaling(cfg),
+		MaxRetries:     cfg.HTTPMaxRetries,
+		MaxRetryAfter:  time.Duration(cfg.MaxRetryAfterSeconds) * time.Second,
+		ExtraHeaders:   cfg.GenAIExtraHeaders,
+		Base64MaxBytes: cfg.Base64MaxBytes,
+		ThumbnailSize:  cfg.ThumbnailSize,
+		StrictModels:   cfg.StrictModels,
+
+		OSSUploadEnabled: ossUploadEnabled,
+		OSSBucket:        cfg.OSSBucket,
+		ImageFormat:      cfg.GenAIImageFormat,
+	}
+
+	// 如果启用了 OSS 上传，或 base64 输出的大图需要回退到 OSS，创建 OSS 客户端
+	if ossUploadEnabled || (cfg.Base64MaxBytes > 0 && cfg.IsOSSConfigured()) {
+		ossClient, err := oss.SharedOSSClientFromConfig(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OSS client for Stability: %w", err)
+		}
+		stabilityCfg.OSSClient = ossClient
+	}
+
+	return NewClient(stabilityCfg)
+}
+
+// NewClient 创建 Stability 客户端。
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("stability API key is required")
+	}
+	if cfg.GenModel == "" && cfg.EditModel == "" {
+		return nil, fmt.Errorf("at least one of stability gen/edit model is required")
+	}
+
+	baseURL := strings.TrimRight(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultStabilityTimeout
+	}
+
+	timeoutScaling := cfg.TimeoutScaling
+	timeoutScaling.Base = timeout
+
+	// 如果只配置了一个模型，另一个复用它（记录 warn 日志；严格模式下拒绝对应调用）
+	models := common.NewModelPair("stability", cfg.GenModel, cfg.EditModel, cfg.StrictModels)
+	genModel, editModel := models.Gen, models.Edit
+
+	genEndpoint, err := resolveEndpoint(genModel)
+	if err != nil {
+		return nil, fmt.Errorf("GENAI_GEN_MODEL_NAME: %w", err)
+	}
+	editEndpoint, err := resolveEndpoint(editModel)
+	if err != nil {
+		return nil, fmt.Errorf("GENAI_EDIT_MODEL_NAME: %w", err)
+	}
+
+	return &Client{
+		// 放大后的单次请求超时由 context 控制，这里只设置上限；按 GENAI_HTTP_PROXY 使用代理
+		httpClient:       common.NewHTTPClient(timeoutScaling.Ceiling()),
+		baseURL:          baseURL,
+		apiKey:           cfg.APIKey,
+		genModel:         genModel,
+		editModel:        editModel,
+		genEndpoint:      genEndpoint,
+		editEndpoint:     editEndpoint,
+		ossClient:        cfg.OSSClient,
+		ossBucket:        cfg.OSSBucket,
+		ossUploadEnabled: cfg.OSSUploadEnabled,
+		imageFormat:      cfg.ImageFormat,
+		timeout:          timeout,
+		timeoutScaling:   timeoutScaling,
+		retry:            common.HTTPRetry{MaxRetries: max(cfg.MaxRetries, 0), MaxRetryAfter: cfg.MaxRetryAfter},
+		extraHeaders:     cfg.ExtraHeaders,
+		base64MaxBytes:   cfg.Base64MaxBytes,
+		thumbnailSize:    cfg.ThumbnailSize,
+		models:           models,
+	}, nil
+}
+
+// Preflight 启动预检：通过账户余额接口确认 API Key 有效。
+// Stability 没有模型列表接口，模型名称已在 NewClient 中按已知的生成接口校验。
+func (c *Client) Preflight(ctx context.Context) error {
+	if _, _, err := c.doRequest(ctx, http.MethodGet, balancePath, nil, "", "application/json"); err != nil {
+		return fmt.Errorf("failed to verify stability API key: %w", err)
+	}
+	return nil
+}
+
+// Close 预留关闭方法，当前未持有需要显式关闭的资源。
+func (c *Client) Close() error {
+	return nil
+}
+
+// routedEndpoint 按提示词语言路由到其它模型时解析该模型的生成接口，否则返回配置的接口及模型
+func routedEndpoint(ctx context.Context, configured endpoint, configuredModel string) (endpoint, string, error) {
+	model := common.RoutedModel(ctx, configuredModel)
+	if model == configuredModel {
+		return configured, model, nil
+	}
+	ep, err := resolveEndpoint(model)
+	if err != nil {
+		return endpoint{}, "", common.NewError(common.ErrCodeInternal, false, "invalid routed model: %v", err)
+	}
+	return ep, model, nil
+}
+
+// GenerateImage 文生图：调用模型对应的 Stable Image 生成接口，按配置格式化返回的图片。
+func (c *Client) GenerateImage(ctx context.Context, prompt string, negative_prompt string, aspect_ratio string, seed int64, output_format string) (string, error) {
+	image, err := c.generateImage(ctx, prompt, negative_prompt, aspect_ratio, seed, output_format)
+	return image, common.WithProviderContext(err, "stability", c.genModel)
+}
+
+// generateImage GenerateImage 的实现，错误由 GenerateImage 附加 provider / 模型信息
+func (c *Client) generateImage(ctx context.Context, prompt string, negative_prompt string, aspect_ratio string, seed int64, output_format string) (string, error) {
+	if err := c.models.CheckGenerate(); err != nil {
+		return "", err
+	}
+	ep, model, err := routedEndpoint(ctx, c.genEndpoint, c.genModel)
+	if err != nil {
+		return "", err
+	}
+	if err := checkAspectRatio(aspect_ratio); err != nil {
+		return "", common.NewError(common.ErrCodeInvalidArgument, false, "%v", err)
+	}
+	if err := checkSeed(seed); err != nil {
+		return "", common.NewError(common.ErrCodeInvalidArgument, false, "%v", err)
+	}
+	if err := ep.checkOutputFormat(output_format); err != nil {
+		return "", common.NewError(common.ErrCodeInvalidArgument, false, "%v", err)
+	}
+
+	fields := map[string]string{
+		"prompt":          prompt,
+		"negative_prompt": negative_prompt,
+		"aspect_ratio":    aspect_ratio,
+		"output_format":   output_format,
+	}
+	if seed != 0 {
+		fields["seed"] = strconv.FormatInt(seed, 10)
+	}
+	if ep.model != "" {
+		fields["model"] = ep.model
+		fields["mode"] = "text-to-image"
+	}
+
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"model":        model,
+		"prompt":       prompt,
+		"aspect_ratio": aspect_ratio,
+		"seed":         seed,
+	}).Debug("Stability: starting image generation")
+
+	ctx = common.WithRequestTimeout(ctx, c.timeoutScaling.ForContext(ctx, common.Megapixels(defaultOutputLongSide), 1))
+	return c.generate(ctx, ep, fields, nil)
+}
+
+// EditImage 图生图：以输入图片和文本提示调用模型对应的生成接口，按配置格式化返回的图片。
+func (c *Client) EditImage(ctx context.Context, prompt string, image_url string, negative_prompt string, strength float64, seed int64, output_format string) (string, error) {
+	image, err := c.editImage(ctx, prompt, image_url, negative_prompt, strength, seed, output_format)
+	return image, common.WithProviderContext(err, "stability", c.editModel)
+}
+
+// editImage EditImage 的实现，错误由 EditImage 附加 provider / 模型信息
+func (c *Client) editImage(ctx context.Context, prompt string, image_url string, negative_prompt string, strength float64, seed int64, output_format string) (string, error) {
+	if err := c.models.CheckEdit(); err != nil {
+		return "", err
+	}
+	ep, model, err := routedEndpoint(ctx, c.editEndpoint, c.editModel)
+	if err != nil {
+		return "", err
+	}
+	if !ep.imageInput {
+		return "", common.NewError(common.ErrCodeInvalidArgument, false, "model %s does not accept an input image; set GENAI_EDIT_MODEL_NAME to ultra or an sd3 model", model)
+	}
+	if image_url == "" {
+		return "", common.NewError(common.ErrCodeInvalidArgument, false, "an input image URL is required")
+	}
+	if strength == DefaultStrength {
+		strength = defaultStrength
+	}
+	if strength < 0 || strength > 1 {
+		return "", common.NewError(common.ErrCodeInvalidArgument, false, "strength must be between 0 and 1, got %v", strength)
+	}
+	if err := checkSeed(seed); err != nil {
+		return "", common.NewError(common.ErrCodeInvalidArgument, false, "%v", err)
+	}
+	if err := ep.checkOutputFormat(output_format); err != nil {
+		return "", common.NewError(common.ErrCodeInvalidArgument, false, "%v", err)
+	}
+
+	image, err := c.readInputImage(ctx, image_url)
+	if err != nil {
+		return "", err
+	}
+
+	fields := map[string]string{
+		"prompt":          prompt,
+		"negative_prompt": negative_prompt,
+		"strength":        strconv.FormatFloat(strength, 'f', -1, 64),
+		"output_format":   output_format,
+	}
+	if seed != 0 {
+		fields["seed"] = strconv.FormatInt(seed, 10)
+	}
+	if ep.model != "" {
+		fields["model"] = ep.model
+		fields["mode"] = "image-to-image"
+	}
+
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"model":      model,
+		"prompt":     prompt,
+		"strength":   strength,
+		"seed":       seed,
+		"image_size": len(image.data),
+	}).Debug("Stability: starting image-to-image edit")
+
+	ctx = common.WithRequestTimeout(ctx, c.timeoutScaling.ForContext(ctx, common.Megapixels(defaultOutputLongSide), 2))
+	return c.generate(ctx, ep, fields, &image)
+}
+
+// inputImage 图生图的输入图片
+type inputImage struct {
+	data     []byte
+	mimeType string
+}
+
+// readInputImage 读取输入图片：data URI 直接解码，HTTP(S) URL 先经主机策略校验再下载
+func (c *Client) readInputImage(ctx context.Context, imageURL string) (inputImage, error) {
+	if strings.HasPrefix(imageURL, "data:") {
+		data, mimeType, err := utils.DecodeDataURI(imageURL)
+		if err != nil {
+			return inputImage{}, common.NewError(common.ErrCodeInvalidArgument, false, "invalid image data URI: %v", err)
+		}
+		return inputImage{data: data, mimeType: mimeType}, nil
+	}
+
+	if err := utils.ValidateImageURL(ctx, imageURL); err != nil {
+		common.WithRequestID(ctx).WithError(err).WithField("image_url", imageURL).Error("Stability: image URL rejected by host policy")
+		return inputImage{}, &common.GenAIError{Code: common.ErrCodeInvalidArgument, Message: "image URL is not allowed", Err: err}
+	}
+	data, mimeType, err := utils.DownloadImageFromURL(ctx, imageURL)
+	if err != nil {
+		return inputImage{}, fmt.Errorf("failed to download input image: %w", err)
+	}
+	return inputImage{data: data, mimeType: mimeType}, nil
+}
+
+// generate 以 multipart/form-data 调用生成接口，读取响应中的原始图片数据并按配置格式化。
+// fields 中值为空的字段不发送（使用 Stability 默认值）；image 为 nil 时为文生图。
+func (c *Client) generate(ctx context.Context, ep endpoint, fields map[string]string, image *inputImage) (string, error) {
+	body, contentType, err := buildMultipartBody(fields, image)
+	if err != nil {
+		return "", err
+	}
+
+	stopCall := common.StartTiming(ctx, common.StageAPICall)
+	data, header, err := c.doRequest(ctx, http.MethodPost, ep.path, body, contentType, "image/*")
+	stopCall()
+	if err != nil {
+		return "", err
+	}
+
+	// 内容审核未通过时 Stability 仍返回 200 与模糊处理后的图片，这里按错误处理
+	finishReason := header.Get("finish-reason")
+	if finishReason == "CONTENT_FILTERED" {
+		err := common.NewError(common.ErrCodeInvalidArgument, false, "the result was blocked by Stability content moderation (finish-reason CONTENT_FILTERED)")
+		common.RecordProviderError("stability", err)
+		return "", err
+	}
+	if len(data) == 0 {
+		err := fmt.Errorf("no image data in response: %w", common.ErrEmptyResult)
+		common.RecordProviderError("stability", err)
+		return "", err
+	}
+
+	mimeType := header.Get("Content-Type")
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	if !strings.HasPrefix(mimeType, "image/") {
+		mimeType = http.DetectContentType(data)
+	}
+
+	// Stability 在响应头 x-request-id 中返回上游请求 ID，便于与其支持工单对应
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"path":                ep.path,
+		"provider_request_id": header.Get("x-request-id"),
+		"mime_type":           mimeType,
+		"size":                len(data),
+		"seed":                header.Get("seed"),
+		"finish_reason":       finishReason,
+		"image_format":        c.imageFormat,
+	}).Info("Stability image request succeeded")
+
+	defer common.StartTiming(ctx, common.StageFormat)()
+	return c.formatImage(ctx, data, mimeType)
+}
+
+// buildMultipartBody 构造 multipart/form-data 请求体，返回请求体与带 boundary 的 Content-Type
+func buildMultipartBody(fields map[string]string, image *inputImage) ([]byte, string, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(name, value); err != nil {
+			return nil, "", fmt.Errorf("failed to write form field %s: %w", name, err)
+		}
+	}
+	if image != nil {
+		// 显式设置图片部分的 Content-Type（CreateFormFile 固定为 application/octet-stream）
+		partHeader := make(textproto.MIMEHeader)
+		partHeader.Set("Content-Disposition", fmt.Sprintf(`form-data; name="image"; filename="image%s"`, utils.GetExtensionFromMimeType(image.mimeType)))
+		partHeader.Set("Content-Type", image.mimeType)
+		part, err := writer.CreatePart(partHeader)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create image form field: %w", err)
+		}
+		if _, err := part.Write(image.data); err != nil {
+			return nil, "", fmt.Errorf("failed to write image form field: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", fmt.Errorf("failed to finish multipart body: %w", err)
+	}
+	return buf.Bytes(), writer.FormDataContentType(), nil
+}
+
+// doRequest 统一封装 HTTP 请求逻辑：设置超时并按 c.retry 重试短暂错误。
+//
+// - payload / contentType: 请求体及其 Content-Type（multipart/form-data），GET 时为空
+// - accept:                期望的响应类型，生成接口使用 image/* 以直接取得图片数据
+func (c *Client) doRequest(ctx context.Context, method, path string, payload []byte, contentType, accept string) ([]byte, http.Header, error) {
+	url := c.baseURL + path
+
+	// 为单次请求设置超时（生成请求按请求规模放大；调用方已有更早的截止时间时以其为准），重试共用该超时
+	var cancel context.CancelFunc
+	if timeout := common.RequestTimeout(ctx, c.timeout); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// 连接错误与 429 / 5xx 等短暂错误按 c.retry 重试；记录最后一次响应的响应头供调用方读取 finish-reason 等
+	var header http.Header
+	body, err := c.retry.Do(ctx, "stability", method, func() ([]byte, http.Header, error) {
+		respBody, respHeader, err := c.sendRequest(ctx, method, url, payload, contentType, accept)
+		header = respHeader
+		return respBody, respHeader, err
+	})
+	return body, header, err
+}
+
+// sendRequest 发送一次 HTTP 请求，返回响应体与响应头（未收到响应时为 nil）。非 2xx 响应返回带状态码的错误。
+func (c *Client) sendRequest(ctx context.Context, method, url string, payload []byte, contentType, accept string) ([]byte, http.Header, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create http request: %w", err)
+	}
+
+	// 先附加 GENAI_EXTRA_HEADERS，随后设置的认证 / Content-Type / Accept 优先
+	for k, v := range c.extraHeaders {
+		if !common.IsReservedHeader(k) {
+			req.Header.Set(k, v)
+		}
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// 超时 / 取消由 context 错误表达；其它网络错误视为可重试的上游错误
+		if ctx.Err() != nil {
+			err = fmt.Errorf("http request failed: %w", err)
+		} else {
+			err = &common.GenAIError{Code: common.ErrCodeUpstream, Message: "http request failed", Retryable: true, Err: err}
+		}
+		common.RecordProviderError("stability", err)
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	// 非成功响应（如 429）同样记录限流信息
+	common.RecordRateLimit(ctx, "stability", resp.Header)
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.Header, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// 错误响应为 JSON（{"name": ..., "errors": [...]}），即使请求的是 image/*
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"status_code":         resp.StatusCode,
+			"url":                 url,
+			"provider_request_id": resp.Header.Get("x-request-id"),
+			"body":                string(respBody),
+		}).Error("Stability API returned non-success status")
+		statusErr := common.NewHTTPStatusError(resp.StatusCode, "stability api error: status %d, body: %s", resp.StatusCode, string(respBody))
+		common.RecordProviderError("stability", statusErr)
+		return nil, resp.Header, statusErr
+	}
+
+	return respBody, resp.Header, nil
+}
+
+// formatImage 根据配置的图片格式处理生成的图片：
+// base64 → data URI；base64-raw → 纯 base64；url → 上传到 OSS 并返回 OSS URL。
+func (c *Client) formatImage(ctx context.Context, data []byte, mimeType string) (string, error) {
+	if utils.IsBase64Format(c.imageFormat) {
+		return c.encodeImage(ctx, mimeType, data)
+	}
+	if strings.EqualFold(c.imageFormat, "url") {
+		if !c.ossUploadEnabled || c.ossClient == nil || c.ossBucket == "" {
+			return "", fmt.Errorf("OSS is not configured but image format is set to 'url'")
+		}
+		// OSS 不可用且开启降级时以 data URI 返回（GENAI_OSS_DEGRADE）
+		return oss.UploadOrDegrade(ctx, "stability", "", data, mimeType, func() (string, error) {
+			return c.uploadImageToOSS(ctx, data, mimeType)
+		})
+	}
+
+	// 未知格式，返回 data URI
+	common.WithRequestID(ctx).Warnf("Unknown image format '%s', returning data URI", c.imageFormat)
+	return utils.EncodeDataURI(mimeType, data), nil
+}
+
+// encodeImage base64 / base64-raw 输出时编码图片；超过 GENAI_BASE64_MAX_BYTES 且 OSS 可用时改为上传 OSS 返回 URL
+func (c *Client) encodeImage(ctx context.Context, mimeType string, data []byte) (string, error) {
+	if utils.Base64Fallback(ctx, "stability", c.base64MaxBytes, len(data), c.ossClient != nil && c.ossBucket != "" && !oss.DegradeActive()) {
+		return c.uploadImageToOSS(ctx, data, mimeType)
+	}
+	return utils.EncodeImage(ctx, c.imageFormat, mimeType, data), nil
+}
+
+// uploadImageToOSS 将图片数据上传到 OSS，并返回 OSS URL。
+func (c *Client) uploadImageToOSS(ctx context.Context, data []byte, mimeType string) (string, error) {
+	path := utils.GenerateImagePath()
+	fileName := utils.GenerateImageFileName(mimeType)
+	key := fmt.Sprintf("%s%s", path, fileName)
+
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"bucket":       c.ossBucket,
+		"key":          key,
+		"content_type": mimeType,
+		"size":         len(data),
+	}).Debug("Stability: uploading image to OSS")
+
+	reader := bytes.NewReader(data)
+	url, err := c.ossClient.UploadFileWithURL(ctx, c.ossBucket, key, reader, mimeType, oss.URLExpiry(ctx, 0))
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"bucket": c.ossBucket,
+			"key":    key,
+		}).Error("Stability: failed to upload image to OSS")
+		return "", fmt.Errorf("failed to upload image to OSS: %w", err)
+	}
+
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"bucket": c.ossBucket,
+		"key":    key,
+		"url":    url,
+	}).Debug("Stability: image uploaded to OSS successfully")
+
+	oss.PublishThumbnail(ctx, c.ossClient, c.ossBucket, data, c.thumbnailSize)
+	return url, nil
+}
@@ -0,0 +1,11 @@
+package stability
+
+import "context"
+
+type StabilityIface interface {
+	// GenerateImage 文生图。negative_prompt / aspect_ratio / output_format 为空、seed 为 0 时使用 Stability 默认值（seed 0 表示随机）
+	GenerateImage(ctx context.Context, prompt string, negative_prompt string, aspect_ratio string, seed int64, output_format string) (string, error)
+	// EditImage 以单张输入图片进行图生图编辑（支持 URL 与 base64 data URI）。
+	// strength 为输入图片的改动程度（0-1，0 保持原图，越大越偏离原图），DefaultStrength（负数）表示使用默认值 0.5
+	EditImage(ctx context.Context, prompt string, image_url string, negative_prompt string, strength float64, seed int64, output_format string) (string, error)
+}
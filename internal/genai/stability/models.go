@@ -0,0 +1,71 @@
+package stability
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Stable Image v2beta 生成接口（相对 BaseURL）
+const (
+	sd3Path   = "/v2beta/stable-image/generate/sd3"
+	corePath  = "/v2beta/stable-image/generate/core"
+	ultraPath = "/v2beta/stable-image/generate/ultra"
+)
+
+// maxSeed 生成接口允许的最大 seed（0 表示随机）
+const maxSeed = 4294967294
+
+// aspectRatios 文生图支持的宽高比
+var aspectRatios = []string{"16:9", "1:1", "21:9", "2:3", "3:2", "4:5", "5:4", "9:16", "9:21"}
+
+// endpoint 模型对应的生成接口及其能力
+type endpoint struct {
+	path string
+	// model 为 sd3 接口的 model 表单字段，其它接口不需要
+	model string
+	// outputFormats 接口支持的 output_format
+	outputFormats []string
+	// imageInput 是否支持输入图片（图生图）
+	imageInput bool
+}
+
+// resolveEndpoint 根据模型名称确定生成接口：
+// core / ultra 对应 Stable Image Core / Ultra 接口，sd3* （如 sd3.5-large、sd3.5-medium）对应 SD3 接口。
+// SDXL 等 v1 模型不在 v2beta 生成接口上提供，返回错误。
+func resolveEndpoint(model string) (endpoint, error) {
+	switch {
+	case model == "core":
+		return endpoint{path: corePath, outputFormats: []string{"png", "jpeg", "webp"}}, nil
+	case model == "ultra":
+		return endpoint{path: ultraPath, outputFormats: []string{"png", "jpeg", "webp"}, imageInput: true}, nil
+	case strings.HasPrefix(model, "sd3"):
+		return endpoint{path: sd3Path, model: model, outputFormats: []string{"png", "jpeg"}, imageInput: true}, nil
+	default:
+		return endpoint{}, fmt.Errorf("unsupported stability model %q: expected core, ultra or an sd3 model (e.g. sd3.5-large)", model)
+	}
+}
+
+// checkOutputFormat 校验 output_format 是否被接口支持，为空时使用 Stability 默认值（png）
+func (e endpoint) checkOutputFormat(format string) error {
+	if format == "" || slices.Contains(e.outputFormats, format) {
+		return nil
+	}
+	return fmt.Errorf("unsupported output_format %q: expected one of %s", format, strings.Join(e.outputFormats, ", "))
+}
+
+// checkAspectRatio 校验 aspect_ratio，为空时使用 Stability 默认值（1:1）
+func checkAspectRatio(ratio string) error {
+	if ratio == "" || slices.Contains(aspectRatios, ratio) {
+		return nil
+	}
+	return fmt.Errorf("unsupported aspect_ratio %q: expected one of %s", ratio, strings.Join(aspectRatios, ", "))
+}
+
+// checkSeed 校验 seed 范围（0 - 4294967294）
+func checkSeed(seed int64) error {
+	if seed < 0 || seed > maxSeed {
+		return fmt.Errorf("seed must be between 0 and %d, got %d", int64(maxSeed), seed)
+	}
+	return nil
+}
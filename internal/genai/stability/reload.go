@@ -0,0 +1,48 @@
+package stability
+
+import (
+	"context"
+	"sync/atomic"
+
+	"genai-mcp/common"
+)
+
+// ReloadableClient 可在运行时原子替换底层客户端的 StabilityIface 实现。
+// 进行中的请求继续使用替换前取得的客户端，不受重新加载影响。
+type ReloadableClient struct {
+	current atomic.Pointer[Client]
+}
+
+// NewReloadableClient 使用初始客户端创建 ReloadableClient
+func NewReloadableClient(client *Client) *ReloadableClient {
+	r := &ReloadableClient{}
+	r.current.Store(client)
+	return r
+}
+
+// Reload 根据新配置重建客户端并原子替换；创建失败时保留原客户端
+func (r *ReloadableClient) Reload(cfg *common.Config) error {
+	client, err := NewStabilityClientFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if old := r.current.Swap(client); old != nil {
+		_ = old.Close()
+	}
+	return nil
+}
+
+// GenerateImage 实现 StabilityIface
+func (r *ReloadableClient) GenerateImage(ctx context.Context, prompt string, negative_prompt string, aspect_ratio string, seed int64, output_format string) (string, error) {
+	return r.current.Load().GenerateImage(ctx, prompt, negative_prompt, aspect_ratio, seed, output_format)
+}
+
+// EditImage 实现 StabilityIface
+func (r *ReloadableClient) EditImage(ctx context.Context, prompt string, image_url string, negative_prompt string, strength float64, seed int64, output_format string) (string, error) {
+	return r.current.Load().EditImage(ctx, prompt, image_url, negative_prompt, strength, seed, output_format)
+}
+
+// Close 关闭当前客户端
+func (r *ReloadableClient) Close() error {
+	return r.current.Load().Close()
+}
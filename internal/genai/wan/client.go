@@ -3,12 +3,14 @@ package wan
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	neturl "net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"genai-mcp/common"
@@ -19,6 +21,9 @@ import (
 // 默认请求超时时间（调用阿里百炼万相等接口）
 const defaultWanTimeout = 60 * time.Second
 
+// defaultOutputLongSide 默认输出尺寸（1024*1024）的长边像素数，用于按请求规模估算编辑任务的超时
+const defaultOutputLongSide = 1024
+
 // Client Wan 客户端实现，负责调用阿里百炼万相相关的图片接口。
 //
 // 注意：
@@ -41,7 +46,7 @@ type Client struct {
 	ossClient        oss.OSSIface
 	ossBucket        string
 	ossUploadEnabled bool
-	imageFormat      string // 图片输出格式: "base64" 或 "url"
+	imageFormat      string // 图片输出格式: "base64"、"base64-raw" 或 "url"
 
 	// 可选：不同任务的相对路径（如果不配置则使用默认占位路径）
 	generateCreatePath string
@@ -50,6 +55,31 @@ type Client struct {
 	editQueryPath      string
 
 	timeout time.Duration
+	// 按请求规模放大创建任务请求的超时（Base 为 timeout）
+	timeoutScaling common.TimeoutScaling
+	// 连接错误与 429 / 5xx 响应的重试策略
+	retry common.HTTPRetry
+
+	// 附加到每个请求的自定义 HTTP 头（GENAI_EXTRA_HEADERS）
+	extraHeaders map[string]string
+
+	// 多张结果图片时是否按质量启发式评分排序（GENAI_RANK_RESULTS）
+	rankResults bool
+
+	// 宽高比 → 像素尺寸的覆盖表（WAN_SIZE_MAP），未覆盖的宽高比使用内置表
+	sizeMap map[string]string
+
+	// url 输出时直接返回未签名的结果 URL，不转存 OSS（GENAI_DIRECT_URL_PROVIDERS）
+	directURLs bool
+
+	// base64 输出时内联图片的最大字节数，超过时改为上传 OSS 返回 URL（GENAI_BASE64_MAX_BYTES）
+	base64MaxBytes int
+
+	// 结果图片上传 OSS 时附带生成的缩略图长边像素数，0 表示不生成（GENAI_GENERATE_THUMBNAIL）
+	thumbnailSize int
+
+	// 生成 / 编辑模型的配置情况，用于复用模型时的严格模式校验（GENAI_STRICT_MODELS）
+	models common.ModelPair
 }
 
 // Config Wan 客户端配置。
@@ -81,6 +111,34 @@ type Config struct {
 	EditQueryPath      string
 
 	Timeout time.Duration
+	// 可选：按请求规模放大超时的参数，Base 由 Timeout 决定
+	TimeoutScaling common.TimeoutScaling
+
+	// 可选：连接错误与 429 / 500 / 502 / 503 / 504 响应的最大重试次数（不含首次请求），0 表示不重试
+	MaxRetries int
+	// 可选：重试时采用 Retry-After 响应头建议等待时间的上限，超过时改用退避间隔；0 表示忽略 Retry-After
+	MaxRetryAfter time.Duration
+
+	// 可选：附加到每个请求的自定义 HTTP 头，认证与 Content-Type 头始终优先
+	ExtraHeaders map[string]string
+
+	// 可选：多张结果图片时按质量启发式评分从高到低排序
+	RankResults bool
+
+	// 可选：宽高比 → 宽*高 的覆盖表，未覆盖的宽高比使用内置表
+	SizeMap map[string]string
+
+	// 可选：url 输出时直接返回未签名的结果 URL，跳过 OSS 转存
+	DirectURLs bool
+
+	// 可选：base64 输出时内联图片的最大字节数，超过且配置了 OSS 时改为上传 OSS 返回 URL，0 表示不限制
+	Base64MaxBytes int
+
+	// 可选：结果图片上传 OSS 时附带生成的缩略图长边像素数，0 表示不生成
+	ThumbnailSize int
+
+	// 可选：严格模式，未显式配置生成 / 编辑模型时拒绝对应调用，而不是复用另一个模型
+	StrictModels bool
 }
 
 // NewWanClientFromConfig 从通用配置创建 Wan 客户端。
@@ -90,6 +148,11 @@ func NewWanClientFromConfig(cfg *common.Config) (*Client, error) {
 	// 当格式为 "url" 时，启用 OSS 上传；否则直接返回 base64 / 源 URL
 	ossUploadEnabled := strings.EqualFold(cfg.GenAIImageFormat, "url")
 
+	sizeMap, err := ParseSizeMap(cfg.WanSizeMap)
+	if err != nil {
+		return nil, err
+	}
+
 	wanCfg := Config{
 		// Wan 与 Gemini 共用 GENAI_BASE_URL / GENAI_API_KEY，两类任务分别使用不同模型
 		BaseURL:   cfg.GenAIBaseURL,
@@ -98,14 +161,25 @@ func NewWanClientFromConfig(cfg *common.Config) (*Client, error) {
 		EditModel: cfg.GenAIEditModelName,
 		Timeout:   time.Duration(cfg.GenAITimeoutSeconds) * time.Second,
 
+		TimeoutScaling: common.NewTimeoutScaling(cfg),
+		MaxRetries:     cfg.HTTPMaxRetries,
+		MaxRetryAfter:  time.Duration(cfg.MaxRetryAfterSeconds) * time.Second,
+		ExtraHeaders:   cfg.GenAIExtraHeaders,
+		RankResults:    cfg.GenAIRankResults,
+		SizeMap:        sizeMap,
+		DirectURLs:     cfg.DirectURLEnabled("wan"),
+		Base64MaxBytes: cfg.Base64MaxBytes,
+		ThumbnailSize:  cfg.ThumbnailSize,
+		StrictModels:   cfg.StrictModels,
+
 		OSSUploadEnabled: ossUploadEnabled,
 		OSSBucket:        cfg.OSSBucket,
 		ImageFormat:      cfg.GenAIImageFormat,
 	}
 
-	// 如果启用了 OSS 上传，创建 OSS 客户端
-	if ossUploadEnabled {
-		ossClient, err := oss.NewOSSClientFromConfig(cfg)
+	// 如果启用了 OSS 上传，或配置了 OSS（base64 输出的大图回退、编辑输入的 data URI 上传），创建 OSS 客户端
+	if ossUploadEnabled || cfg.IsOSSConfigured() {
+		ossClient, err := oss.SharedOSSClientFromConfig(cfg)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create OSS client for Wan: %w", err)
 		}
@@ -132,20 +206,16 @@ func NewClient(cfg Config) (*Client, error) {
 		timeout = defaultWanTimeout
 	}
 
-	// 如果只配置了一个模型，另一个复用它
-	genModel := cfg.GenModel
-	editModel := cfg.EditModel
-	if genModel == "" {
-		genModel = editModel
-	}
-	if editModel == "" {
-		editModel = genModel
-	}
+	timeoutScaling := cfg.TimeoutScaling
+	timeoutScaling.Base = timeout
+
+	// 如果只配置了一个模型，另一个复用它（记录 warn 日志；严格模式下拒绝对应调用）
+	models := common.NewModelPair("wan", cfg.GenModel, cfg.EditModel, cfg.StrictModels)
+	genModel, editModel := models.Gen, models.Edit
 
 	c := &Client{
-		httpClient: &http.Client{
-			Timeout: timeout,
-		},
+		// 放大后的单次请求超时由 context 控制，这里只设置上限；按 GENAI_HTTP_PROXY 使用代理
+		httpClient:         common.NewHTTPClient(timeoutScaling.Ceiling()),
 		baseURL:            cfg.BaseURL,
 		apiKey:             cfg.APIKey,
 		genModel:           genModel,
@@ -155,10 +225,19 @@ func NewClient(cfg Config) (*Client, error) {
 		editCreatePath:     cfg.EditCreatePath,
 		editQueryPath:      cfg.EditQueryPath,
 		timeout:            timeout,
+		timeoutScaling:     timeoutScaling,
+		retry:              common.HTTPRetry{MaxRetries: max(cfg.MaxRetries, 0), MaxRetryAfter: cfg.MaxRetryAfter},
 		ossClient:          cfg.OSSClient,
 		ossBucket:          cfg.OSSBucket,
 		ossUploadEnabled:   cfg.OSSUploadEnabled,
 		imageFormat:        cfg.ImageFormat,
+		extraHeaders:       cfg.ExtraHeaders,
+		rankResults:        cfg.RankResults,
+		sizeMap:            cfg.SizeMap,
+		directURLs:         cfg.DirectURLs,
+		base64MaxBytes:     cfg.Base64MaxBytes,
+		thumbnailSize:      cfg.ThumbnailSize,
+		models:             models,
 	}
 
 	// 如果未显式配置路径，提供合理的占位默认值，便于后续在一个地方统一调整。
@@ -182,17 +261,56 @@ func NewClient(cfg Config) (*Client, error) {
 	return c, nil
 }
 
+// modelsPath DashScope OpenAI 兼容模式的模型列表接口（相对 BaseURL），用于启动预检
+const modelsPath = "/compatible-mode/v1/models"
+
+// Preflight 启动预检：通过模型列表接口确认配置的生成 / 编辑模型存在且当前 API Key 可访问
+func (c *Client) Preflight(ctx context.Context) error {
+	body, err := c.doRequest(ctx, http.MethodGet, modelsPath, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list wan models: %w", err)
+	}
+	return common.CheckModelsListed("wan", common.ConfiguredModels(c.genModel, c.editModel), body)
+}
+
 // Close 预留关闭方法，当前未持有需要显式关闭的资源。
 func (c *Client) Close() error {
 	return nil
 }
 
 // CreateGenerateImageTask 调用文生图任务创建接口。
-func (c *Client) CreateGenerateImageTask(ctx context.Context, prompt string, negative_prompt string) (string, error) {
-	common.WithFields(map[string]interface{}{
+// size 为空时使用 1024*1024，也可为宽高比（如 16:9，按映射表转换）或 宽*高；
+// n 为生成图片数（1-4），<= 0 时使用 1。
+func (c *Client) CreateGenerateImageTask(ctx context.Context, prompt string, negative_prompt string, size string, n int) (string, error) {
+	taskID, err := c.createGenerateImageTask(ctx, prompt, negative_prompt, size, n)
+	return taskID, common.WithProviderContext(err, "wan", c.models.Gen)
+}
+
+// createGenerateImageTask CreateGenerateImageTask 的实现，错误由 CreateGenerateImageTask 附加 provider / 模型信息
+func (c *Client) createGenerateImageTask(ctx context.Context, prompt string, negative_prompt string, size string, n int) (string, error) {
+	if err := c.models.CheckGenerate(); err != nil {
+		return "", err
+	}
+
+	pixelSize, err := resolveSize(size, c.sizeMap)
+	if err != nil {
+		return "", err
+	}
+	if n <= 0 {
+		n = 1
+	}
+	if n > maxGenerateImages {
+		return "", common.NewError(common.ErrCodeInvalidArgument, false,
+			"n must be between 1 and %d for Wan, got %d", maxGenerateImages, n)
+	}
+
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"model":           c.genModel,
 		"prompt":          prompt,
 		"negative_prompt": negative_prompt,
+		"size":            size,
+		"pixel_size":      pixelSize,
+		"n":               n,
 		"endpoint":        c.baseURL + c.generateCreatePath,
 	}).Info("Creating Wan generate-image task")
 
@@ -210,13 +328,12 @@ func (c *Client) CreateGenerateImageTask(ctx context.Context, prompt string, neg
 	//   "input": { "prompt": "...", "negative_prompt": "..." },
 	//   "parameters": { "size": "1024*1024", "n": 1 }
 	// }
-	// 这里保留 parameters 字段，提供一个合理的默认值，后续可根据需要扩展为可配置。
 	payload := map[string]interface{}{
-		"model": c.genModel,
+		"model": common.RoutedModel(ctx, c.genModel), // 按提示词语言路由时使用路由模型
 		"input": input,
 		"parameters": map[string]interface{}{
-			"size": "1024*1024",
-			"n":    1,
+			"size": pixelSize,
+			"n":    n,
 		},
 	}
 
@@ -226,22 +343,29 @@ func (c *Client) CreateGenerateImageTask(ctx context.Context, prompt string, neg
 		"X-DashScope-Async": "enable",
 	}
 
+	ctx = common.WithRequestTimeout(ctx, c.timeoutScaling.ForContext(ctx, sizeMegapixels(pixelSize)*float64(n), n))
+	stopCreate := common.StartTiming(ctx, common.StageCreateTask)
 	body, err := c.doRequest(ctx, http.MethodPost, c.generateCreatePath, payload, extraHeaders)
+	stopCreate()
 	if err != nil {
 		return "", fmt.Errorf("failed to create generate image task: %w", err)
 	}
 
 	var resp createTaskResponse
 	if err := json.Unmarshal(body, &resp); err != nil {
-		common.WithError(err).WithField("body", string(body)).Error("Failed to parse Wan generate-image create-task response")
+		common.WithRequestID(ctx).WithError(err).WithField("body", string(body)).Error("Failed to parse Wan generate-image create-task response")
 		return "", fmt.Errorf("failed to parse create task response: %w", err)
 	}
 
 	if resp.Output.TaskID == "" {
-		common.WithField("body", string(body)).Error("Wan create-task response missing task_id")
+		common.WithRequestID(ctx).WithField("body", string(body)).Error("Wan create-task response missing task_id")
 		return "", fmt.Errorf("wan create task response missing task_id")
 	}
 
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"task_id":             resp.Output.TaskID,
+		"provider_request_id": resp.RequestID,
+	}).Info("Created Wan generate-image task")
 	return resp.Output.TaskID, nil
 }
 
@@ -255,14 +379,20 @@ func (c *Client) CreateGenerateImageTask(ctx context.Context, prompt string, neg
 // （例如图片 URL、base64 编码、任务状态等）。如需只返回图片 URL，可在后续根据
 // 阿里百炼文档调整解析逻辑。
 func (c *Client) QueryGenerateImageTask(ctx context.Context, task_id string) (string, error) {
-	common.WithFields(map[string]interface{}{
+	result, err := c.queryGenerateImageTask(ctx, task_id)
+	return result, common.WithProviderContext(err, "wan", c.models.Gen)
+}
+
+// queryGenerateImageTask QueryGenerateImageTask 的实现，错误由 QueryGenerateImageTask 附加 provider / 模型信息
+func (c *Client) queryGenerateImageTask(ctx context.Context, task_id string) (string, error) {
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"task_id":  task_id,
 		"endpoint": c.baseURL + c.generateQueryPath + "/" + task_id,
 	}).Info("Querying Wan generate-image task")
 
 	// DashScope 查询任务使用 GET 且 task_id 在 URL 路径中
 	queryPath := fmt.Sprintf("%s/%s", c.generateQueryPath, task_id)
-	body, err := c.doRequest(ctx, http.MethodGet, queryPath, nil, nil)
+	body, err := c.fetchTask(ctx, queryPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to query generate image task: %w", err)
 	}
@@ -271,6 +401,70 @@ func (c *Client) QueryGenerateImageTask(ctx context.Context, task_id string) (st
 	return c.formatImageQueryResult(ctx, body)
 }
 
+// QueryGenerateImageTaskStatus 查询文生图任务，并将 DashScope 的响应解析为统一的任务状态。
+// 任务成功时结果图片已按 GENAI_IMAGE_FORMAT 格式化。
+func (c *Client) QueryGenerateImageTaskStatus(ctx context.Context, task_id string) (*common.TaskStatus, error) {
+	status, err := c.queryGenerateImageTaskStatus(ctx, task_id)
+	return status, common.WithProviderContext(err, "wan", c.models.Gen)
+}
+
+// queryGenerateImageTaskStatus QueryGenerateImageTaskStatus 的实现，错误由 QueryGenerateImageTaskStatus 附加 provider / 模型信息
+func (c *Client) queryGenerateImageTaskStatus(ctx context.Context, task_id string) (*common.TaskStatus, error) {
+	resultJSON, err := c.queryGenerateImageTask(ctx, task_id)
+	if err != nil {
+		return nil, err
+	}
+	return parseTaskStatus(task_id, resultJSON)
+}
+
+// parseTaskStatus 将（已格式化的）任务查询结果解析为统一的任务状态：
+// PENDING / SUSPENDED → pending，RUNNING → running，SUCCEEDED → succeeded，其它（FAILED / CANCELED / UNKNOWN）→ failed
+func parseTaskStatus(taskID, resultJSON string) (*common.TaskStatus, error) {
+	var resp struct {
+		Output *struct {
+			TaskStatus  string          `json:"task_status"`
+			Code        string          `json:"code"`
+			Message     string          `json:"message"`
+			Results     []wanTaskResult `json:"results"`
+			TaskMetrics *wanTaskMetrics `json:"task_metrics"`
+		} `json:"output"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(resultJSON), &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse task query response: %w", err)
+	}
+	if resp.Output == nil || resp.Output.TaskStatus == "" {
+		return nil, common.NewError(common.ErrCodeUpstream, false, "task query response has no task_status: %s %s", resp.Code, resp.Message)
+	}
+
+	status := &common.TaskStatus{TaskID: taskID, ProviderStatus: resp.Output.TaskStatus}
+	switch strings.ToUpper(resp.Output.TaskStatus) {
+	case "PENDING", "SUSPENDED":
+		status.Status = common.TaskStatusPending
+	case "RUNNING":
+		status.Status = common.TaskStatusRunning
+	case "SUCCEEDED":
+		status.Status = common.TaskStatusSucceeded
+		for i := range resp.Output.Results {
+			if imageURL := resp.Output.Results[i].imageURL(); imageURL != "" {
+				status.ImageURLs = append(status.ImageURLs, imageURL)
+			}
+		}
+		if resp.Output.TaskMetrics != nil {
+			status.Requested = resp.Output.TaskMetrics.Total
+		}
+	case "UNKNOWN":
+		// DashScope 对不存在或已过期（超过 24 小时）的任务返回 UNKNOWN
+		status.Status = common.TaskStatusFailed
+		status.Error = "task not found or expired"
+	default:
+		status.Status = common.TaskStatusFailed
+		status.Error = strings.TrimSpace(resp.Output.Code + " " + resp.Output.Message)
+	}
+	return status, nil
+}
+
 // CreateEditImageTask 调用图像编辑 / 多图融合任务创建接口。
 // 对应 DashScope 单图编辑 / 多图融合接口：
 //
@@ -285,22 +479,51 @@ func (c *Client) QueryGenerateImageTask(ctx context.Context, task_id string) (st
 //	  "parameters": { "n": 1 }
 //	}
 func (c *Client) CreateEditImageTask(ctx context.Context, prompt string, image_urls []string) (string, error) {
-	common.WithFields(map[string]interface{}{
+	taskID, err := c.createEditImageTask(ctx, prompt, image_urls)
+	return taskID, common.WithProviderContext(err, "wan", c.models.Edit)
+}
+
+// createEditImageTask CreateEditImageTask 的实现，错误由 CreateEditImageTask 附加 provider / 模型信息
+func (c *Client) createEditImageTask(ctx context.Context, prompt string, image_urls []string) (string, error) {
+	if err := c.models.CheckEdit(); err != nil {
+		return "", err
+	}
+
+	// DashScope 只接受图片 URL：data URI 先上传到 OSS，替换为 OSS URL
+	ctx, image_urls, _, err := oss.UploadDataURIInputs(ctx, c.ossClient, c.ossBucket, image_urls)
+	if err != nil {
+		return "", err
+	}
+
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"model":      c.editModel,
 		"prompt":     prompt,
 		"image_urls": image_urls,
 		"endpoint":   c.baseURL + c.editCreatePath,
 	}).Info("Creating Wan edit-image task")
 
-	// 构建 input，包含提示词和图片数组
+	// 输入图片由 DashScope 拉取，提交前先校验主机访问策略（本服务上传到 OSS 的图片已标记为受信任，直接放行）
+	for i, imageURL := range image_urls {
+		if err := utils.ValidateImageURL(ctx, imageURL); err != nil {
+			common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+				"image_url": imageURL,
+				"index":     i,
+			}).Error("Wan: image URL rejected by host policy")
+			return "", &common.GenAIError{Code: common.ErrCodeInvalidArgument, Message: fmt.Sprintf("image URL at index %d is not allowed", i), Err: err}
+		}
+	}
+
+	// 构建 input，包含提示词和图片数组；提示词为空时不发送 prompt 字段（无文字引导的融合 / 变体）
 	input := map[string]interface{}{
-		"prompt": prompt,
 		"images": image_urls,
 	}
+	if prompt != "" {
+		input["prompt"] = prompt
+	}
 
 	// 保持与 DashScope 示例一致：仅控制输出图片数量 n（输入图片由 images 决定）
 	payload := map[string]interface{}{
-		"model": c.editModel,
+		"model": common.RoutedModel(ctx, c.editModel),
 		"input": input,
 		"parameters": map[string]interface{}{
 			"n": 1,
@@ -312,22 +535,29 @@ func (c *Client) CreateEditImageTask(ctx context.Context, prompt string, image_u
 		"X-DashScope-Async": "enable",
 	}
 
+	ctx = common.WithRequestTimeout(ctx, c.timeoutScaling.ForContext(ctx, common.Megapixels(defaultOutputLongSide), len(image_urls)+1))
+	stopCreate := common.StartTiming(ctx, common.StageCreateTask)
 	body, err := c.doRequest(ctx, http.MethodPost, c.editCreatePath, payload, extraHeaders)
+	stopCreate()
 	if err != nil {
 		return "", fmt.Errorf("failed to create edit image task: %w", err)
 	}
 
 	var resp createTaskResponse
 	if err := json.Unmarshal(body, &resp); err != nil {
-		common.WithError(err).WithField("body", string(body)).Error("Failed to parse Wan edit-image create-task response")
+		common.WithRequestID(ctx).WithError(err).WithField("body", string(body)).Error("Failed to parse Wan edit-image create-task response")
 		return "", fmt.Errorf("failed to parse create task response: %w", err)
 	}
 
 	if resp.Output.TaskID == "" {
-		common.WithField("body", string(body)).Error("Wan edit-image create-task response missing task_id")
+		common.WithRequestID(ctx).WithField("body", string(body)).Error("Wan edit-image create-task response missing task_id")
 		return "", fmt.Errorf("wan create edit image task response missing task_id")
 	}
 
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"task_id":             resp.Output.TaskID,
+		"provider_request_id": resp.RequestID,
+	}).Info("Created Wan edit-image task")
 	return resp.Output.TaskID, nil
 }
 
@@ -341,14 +571,20 @@ func (c *Client) CreateEditImageTask(ctx context.Context, prompt string, image_u
 // （例如图片 URL、base64 编码、任务状态等）。如需只返回图片 URL，可在后续根据
 // 阿里百炼文档调整解析逻辑。
 func (c *Client) QueryEditImageTask(ctx context.Context, task_id string) (string, error) {
-	common.WithFields(map[string]interface{}{
+	result, err := c.queryEditImageTask(ctx, task_id)
+	return result, common.WithProviderContext(err, "wan", c.models.Edit)
+}
+
+// queryEditImageTask QueryEditImageTask 的实现，错误由 QueryEditImageTask 附加 provider / 模型信息
+func (c *Client) queryEditImageTask(ctx context.Context, task_id string) (string, error) {
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"task_id":  task_id,
 		"endpoint": c.baseURL + c.editQueryPath + "/" + task_id,
 	}).Info("Querying Wan edit-image task")
 
 	// DashScope 查询任务使用 GET 且 task_id 在 URL 路径中
 	queryPath := fmt.Sprintf("%s/%s", c.editQueryPath, task_id)
-	body, err := c.doRequest(ctx, http.MethodGet, queryPath, nil, nil)
+	body, err := c.fetchTask(ctx, queryPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to query edit image task: %w", err)
 	}
@@ -357,6 +593,156 @@ func (c *Client) QueryEditImageTask(ctx context.Context, task_id string) (string
 	return c.formatImageQueryResult(ctx, body)
 }
 
+// QueryTasks 批量查询多个任务。
+//
+// DashScope 没有提供批量查询任务状态的接口，这里在内部并发逐个查询，
+// 对调用方呈现为一次批量结果。文生图与图像编辑任务共用同一个任务查询端点，
+// 因此统一复用 QueryGenerateImageTask 的查询与结果格式化逻辑。
+func (c *Client) QueryTasks(ctx context.Context, taskIDs []string) []common.TaskQueryResult {
+	common.WithRequestID(ctx).WithField("task_count", len(taskIDs)).Info("Querying Wan tasks in batch")
+	return common.QueryTasksConcurrently(ctx, taskIDs, common.DefaultTaskQueryConcurrency, c.QueryGenerateImageTask)
+}
+
+// QueryTaskRaw 查询任务并原样返回 provider 的响应 JSON。
+//
+// 与 QueryGenerateImageTask / QueryEditImageTask 不同，这里不合并分页、不下载或上传图片，
+// 也不按任务状态返回错误，便于调用方获取生成元数据、安全审核信息等格式化时被省略的字段。
+// 文生图与图像编辑任务共用同一个任务查询端点。
+func (c *Client) QueryTaskRaw(ctx context.Context, task_id string) (string, error) {
+	result, err := c.queryTaskRaw(ctx, task_id)
+	return result, common.WithProviderContext(err, "wan", "")
+}
+
+// queryTaskRaw QueryTaskRaw 的实现，错误由 QueryTaskRaw 附加 provider / 模型信息
+func (c *Client) queryTaskRaw(ctx context.Context, task_id string) (string, error) {
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"task_id":  task_id,
+		"endpoint": c.baseURL + c.generateQueryPath + "/" + task_id,
+	}).Info("Querying Wan task (raw)")
+
+	body, err := c.doRequest(ctx, http.MethodGet, fmt.Sprintf("%s/%s", c.generateQueryPath, task_id), nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to query task: %w", err)
+	}
+	return string(body), nil
+}
+
+// resultPaths 任务查询结果中图片结果数组的位置，用于分页聚合
+var resultPaths = [][]string{{"output", "results"}}
+
+// fetchTask 查询任务并拉取全部分页，耗时计入 query 阶段
+func (c *Client) fetchTask(ctx context.Context, queryPath string) ([]byte, error) {
+	defer common.StartTiming(ctx, common.StageQuery)()
+
+	body, err := c.doRequest(ctx, http.MethodGet, queryPath, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		RequestID string `json:"request_id"`
+		Output    struct {
+			TaskStatus string `json:"task_status"`
+		} `json:"output"`
+	}
+	if json.Unmarshal(body, &resp) == nil {
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"query_path":          queryPath,
+			"task_status":         resp.Output.TaskStatus,
+			"provider_request_id": resp.RequestID,
+		}).Info("Wan task query response received")
+	}
+	body, err = c.fetchAllPages(ctx, queryPath, body)
+	if err != nil {
+		return nil, err
+	}
+	recordTaskError(body)
+	return body, nil
+}
+
+// maxCountedTaskErrors 记住已计入错误统计的任务 ID 的上限，超出时淘汰最早记住的 ID
+const maxCountedTaskErrors = 10000
+
+var (
+	countedTaskErrorsMu sync.Mutex
+	// countedTaskErrors 已计入 provider 错误统计的任务 ID：失败任务会被反复轮询、查询，每个任务只计一次
+	countedTaskErrors = make(map[string]bool)
+	// countedTaskErrorOrder 按记住的先后保存任务 ID，用于淘汰
+	countedTaskErrorOrder []string
+)
+
+// firstTaskErrorCount 记住任务 ID 并返回它是否是第一次计入错误统计；没有任务 ID 时无法去重，总是计入
+func firstTaskErrorCount(taskID string) bool {
+	if taskID == "" {
+		return true
+	}
+	countedTaskErrorsMu.Lock()
+	defer countedTaskErrorsMu.Unlock()
+
+	if countedTaskErrors[taskID] {
+		return false
+	}
+	countedTaskErrors[taskID] = true
+	countedTaskErrorOrder = append(countedTaskErrorOrder, taskID)
+	if len(countedTaskErrorOrder) > maxCountedTaskErrors {
+		delete(countedTaskErrors, countedTaskErrorOrder[0])
+		countedTaskErrorOrder = countedTaskErrorOrder[1:]
+	}
+	return true
+}
+
+// recordTaskError 将任务级失败计入 provider 错误统计：任务以 FAILED 结束（server_error），
+// 或 SUCCEEDED 但没有任何结果图片（empty_result）。这两类结果以正常的查询响应返回，不经过 doRequest 的错误路径。
+// 同一任务之后的轮询与查询不再重复计入。
+func recordTaskError(body []byte) {
+	var resp struct {
+		Output struct {
+			TaskID     string          `json:"task_id"`
+			TaskStatus string          `json:"task_status"`
+			Code       string          `json:"code"`
+			Message    string          `json:"message"`
+			Results    []wanTaskResult `json:"results"`
+		} `json:"output"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return
+	}
+	switch strings.ToUpper(resp.Output.TaskStatus) {
+	case "FAILED":
+		if firstTaskErrorCount(resp.Output.TaskID) {
+			common.RecordProviderError("wan", common.NewError(common.ErrCodeUpstream, false,
+				"wan task failed: %s %s", resp.Output.Code, resp.Output.Message))
+		}
+	case "SUCCEEDED":
+		for i := range resp.Output.Results {
+			if resp.Output.Results[i].imageURL() != "" {
+				return
+			}
+		}
+		if firstTaskErrorCount(resp.Output.TaskID) {
+			common.RecordProviderError("wan", fmt.Errorf("wan task succeeded without an image: %w", common.ErrEmptyResult))
+		}
+	}
+}
+
+// fetchAllPages 若查询结果带有 next_page_token，则依次拉取后续页面并合并 output.results，
+// 最多拉取 utils.DefaultMaxResultPages 页。未分页的响应原样返回。
+func (c *Client) fetchAllPages(ctx context.Context, queryPath string, first []byte) ([]byte, error) {
+	body, truncated, err := utils.AggregatePages(ctx, first, resultPaths, utils.DefaultMaxResultPages,
+		func(ctx context.Context, token string) ([]byte, error) {
+			return c.doRequest(ctx, http.MethodGet, queryPath+"?page_token="+neturl.QueryEscape(token), nil, nil)
+		})
+	if err != nil {
+		return nil, err
+	}
+	if truncated {
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"query_path": queryPath,
+			"max_pages":  utils.DefaultMaxResultPages,
+		}).Warn("Wan: task results truncated at page cap")
+	}
+	return body, nil
+}
+
 // doRequest 统一封装 HTTP 请求逻辑。
 //
 // - method:      GET / POST 等
@@ -370,27 +756,46 @@ func (c *Client) QueryEditImageTask(ctx context.Context, task_id string) (string
 func (c *Client) doRequest(ctx context.Context, method, path string, body interface{}, extraHeaders map[string]string) ([]byte, error) {
 	url := c.baseURL + path
 
-	var reader io.Reader
+	var payload []byte
 	if body != nil {
 		data, err := json.Marshal(body)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal request body: %w", err)
 		}
-		reader = bytes.NewReader(data)
+		payload = data
 	}
 
-	// 为单次请求设置超时
+	// 为单次请求设置超时（创建任务时按请求规模放大；调用方已有更早的截止时间时以其为准），重试共用该超时
 	var cancel context.CancelFunc
-	if _, ok := ctx.Deadline(); !ok && c.timeout > 0 {
-		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+	if timeout := common.RequestTimeout(ctx, c.timeout); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
 	}
 
+	// 连接错误与 429 / 5xx 等短暂错误按 c.retry 重试
+	return c.retry.Do(ctx, "wan", method, func() ([]byte, http.Header, error) {
+		return c.sendRequest(ctx, method, url, payload, extraHeaders)
+	})
+}
+
+// sendRequest 发送一次 HTTP 请求，返回响应体与响应头（未收到响应时为 nil）。非 2xx 响应返回带状态码的错误。
+func (c *Client) sendRequest(ctx context.Context, method, url string, payload []byte, extraHeaders map[string]string) ([]byte, http.Header, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
 	req, err := http.NewRequestWithContext(ctx, method, url, reader)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create http request: %w", err)
+		return nil, nil, fmt.Errorf("failed to create http request: %w", err)
 	}
 
+	// 先附加 GENAI_EXTRA_HEADERS，随后设置的认证 / Content-Type 与单次请求头优先
+	for k, v := range c.extraHeaders {
+		if !common.IsReservedHeader(k) {
+			req.Header.Set(k, v)
+		}
+	}
 	req.Header.Set("Content-Type", "application/json")
 	// 阿里百炼通常使用 Authorization Bearer 认证
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
@@ -401,25 +806,45 @@ func (c *Client) doRequest(ctx context.Context, method, path string, body interf
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("http request failed: %w", err)
+		// 超时 / 取消由 context 错误表达；其它网络错误视为可重试的上游错误
+		if ctx.Err() != nil {
+			err = fmt.Errorf("http request failed: %w", err)
+		} else {
+			err = &common.GenAIError{Code: common.ErrCodeUpstream, Message: "http request failed", Retryable: true, Err: err}
+		}
+		common.RecordProviderError("wan", err)
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
+	// 非成功响应（如 429）同样记录限流信息
+	common.RecordRateLimit(ctx, "wan", resp.Header)
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, resp.Header, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		common.WithFields(map[string]interface{}{
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
 			"status_code": resp.StatusCode,
 			"url":         url,
 			"body":        string(respBody),
 		}).Error("Wan API returned non-success status")
-		return nil, fmt.Errorf("wan api error: status %d, body: %s", resp.StatusCode, string(respBody))
+		statusErr := common.NewHTTPStatusError(resp.StatusCode, "wan api error: status %d, body: %s", resp.StatusCode, string(respBody))
+		common.RecordProviderError("wan", statusErr)
+		return nil, resp.Header, statusErr
 	}
 
-	return respBody, nil
+	// 204 / 空响应体按空 JSON 对象返回，避免调用方解析时报出难以理解的 JSON 错误
+	if len(bytes.TrimSpace(respBody)) == 0 {
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"status_code": resp.StatusCode,
+			"url":         url,
+		}).Debug("Wan API returned an empty success response")
+		return common.EmptyJSONObject(), resp.Header, nil
+	}
+
+	return respBody, resp.Header, nil
 }
 
 // createTaskResponse 用于解析创建任务接口中常见的返回结构。
@@ -434,7 +859,9 @@ func (c *Client) doRequest(ctx context.Context, method, path string, body interf
 //	  }
 //	}
 type createTaskResponse struct {
-	Output struct {
+	// RequestID DashScope 为每次请求返回的 ID，排查问题时提供给阿里云
+	RequestID string `json:"request_id"`
+	Output    struct {
 		TaskID string `json:"task_id"`
 	} `json:"output"`
 }
@@ -443,12 +870,10 @@ type createTaskResponse struct {
 // 实际字段名如有差异，可在不改动 WanIface 的前提下调整该结构体。
 type wanTaskQueryResponse struct {
 	Output *struct {
-		TaskStatus string `json:"task_status,omitempty"`
-		Results    []struct {
-			URL   string `json:"url,omitempty"`
-			Image string `json:"image_url,omitempty"`
-			// 预留其它可能字段，例如 base64 数据等
-		} `json:"results,omitempty"`
+		TaskStatus string          `json:"task_status,omitempty"`
+		Results    []wanTaskResult `json:"results,omitempty"`
+		// TaskMetrics 请求 / 成功 / 失败的图片数，格式化后原样保留，供 tools 层识别部分成功
+		TaskMetrics *wanTaskMetrics `json:"task_metrics,omitempty"`
 	} `json:"output,omitempty"`
 	// 错误场景通常为顶层 code / message：
 	// {
@@ -460,21 +885,59 @@ type wanTaskQueryResponse struct {
 	Message string `json:"message,omitempty"`
 }
 
-// formatImageQueryResult 根据配置的图片格式（base64 / url）格式化 Wan 查询任务返回的 JSON。
-// - 当格式为 base64 时：下载 results[0] 的图片 URL，转为 data URI 替换对应字段。
-// - 当格式为 url 时：若配置了 OSS，则下载图片并上传到 OSS，使用 OSS URL 替换对应字段。
+// wanTaskMetrics 任务查询结果中的图片计数：n > 1 时部分图片可能生成失败（FAILED > 0），任务整体仍为 SUCCEEDED
+type wanTaskMetrics struct {
+	Total     int `json:"TOTAL"`
+	Succeeded int `json:"SUCCEEDED"`
+	Failed    int `json:"FAILED"`
+}
+
+// wanTaskResult 任务查询结果中的单张图片结果
+type wanTaskResult struct {
+	URL   string `json:"url,omitempty"`
+	Image string `json:"image_url,omitempty"`
+	// prompt_extend 开启时 DashScope 返回的原始提示词与改写后实际使用的提示词
+	OrigPrompt   string `json:"orig_prompt,omitempty"`
+	ActualPrompt string `json:"actual_prompt,omitempty"`
+	// Score 开启 GENAI_RANK_RESULTS 时附加的质量启发式得分（非 DashScope 字段）
+	Score *float64 `json:"score,omitempty"`
+	// MimeType base64-raw 输出时 url / image_url 中图片的 MIME 类型（非 DashScope 字段）
+	MimeType string `json:"mime_type,omitempty"`
+	// 预留其它可能字段，例如 base64 数据等
+}
+
+// imageURL 返回结果中的图片 URL（url 优先，其次 image_url）
+func (r *wanTaskResult) imageURL() string {
+	if r.URL != "" {
+		return r.URL
+	}
+	return r.Image
+}
+
+// downloadedImage 已下载的结果图片，评分后在格式化阶段复用，避免重复下载
+type downloadedImage struct {
+	data     []byte
+	mimeType string
+}
+
+// formatImageQueryResult 根据配置的图片格式（base64 / base64-raw / url）格式化 Wan 查询任务返回的 JSON。
+// - 当格式为 base64 时：下载 results 中每张图片，转为 data URI 替换对应字段。
+// - 当格式为 base64-raw 时：替换为纯 base64，并在每个结果中附加 mime_type。
+// - 当格式为 url 时：若配置了 OSS，则将每张图片上传到 OSS，使用 OSS URL 替换对应字段。
 // - 如果无法找到图片 URL 或配置不完整，则返回原始 JSON。
 func (c *Client) formatImageQueryResult(ctx context.Context, body []byte) (string, error) {
+	defer common.StartTiming(ctx, common.StageFormat)()
+
 	// 未设置格式或格式未知时，直接返回原始 JSON
 	if c.imageFormat == "" ||
-		(!strings.EqualFold(c.imageFormat, "base64") && !strings.EqualFold(c.imageFormat, "url")) {
+		(!utils.IsBase64Format(c.imageFormat) && !strings.EqualFold(c.imageFormat, "url")) {
 		return string(body), nil
 	}
 
 	var resp wanTaskQueryResponse
 	if err := json.Unmarshal(body, &resp); err != nil {
 		// 解析失败时，为保持兼容，返回原始 JSON
-		common.WithError(err).WithField("body", string(body)).Warn("Wan: failed to parse task query response for formatting")
+		common.WithRequestID(ctx).WithError(err).WithField("body", string(body)).Warn("Wan: failed to parse task query response for formatting")
 		return string(body), nil
 	}
 
@@ -493,74 +956,160 @@ func (c *Client) formatImageQueryResult(ctx context.Context, body []byte) (strin
 		return string(body), nil
 	}
 
-	// 目前只处理第一个结果，后续如需支持多图可扩展
-	result := &resp.Output.Results[0]
-	imageURL := result.URL
-	if imageURL == "" {
-		imageURL = result.Image
-	}
-	if imageURL == "" {
-		// 没有可用的图片 URL，直接返回
-		return string(body), nil
-	}
-
-	// base64 输出：下载原图并转为 data URI
-	if strings.EqualFold(c.imageFormat, "base64") {
-		data, mimeType, err := utils.DownloadImageFromURL(ctx, imageURL)
+	// 开启结果排序时，先下载所有结果图片评分并按得分重排，下载的数据在格式化时复用
+	var downloaded map[string]downloadedImage
+	if c.rankResults && len(resp.Output.Results) > 1 {
+		var err error
+		downloaded, err = rankTaskResults(ctx, resp.Output.Results)
 		if err != nil {
-			common.WithError(err).WithField("image_url", imageURL).Error("Wan: failed to download image for base64 formatting")
-			return "", fmt.Errorf("failed to download image for base64 formatting: %w", err)
+			return "", err
 		}
+	}
 
-		base64Data := base64.StdEncoding.EncodeToString(data)
-		dataURI := fmt.Sprintf("data:%s;base64,%s", mimeType, base64Data)
-
-		// 将结果中的 URL 替换为 data URI
-		result.URL = dataURI
-		result.Image = dataURI
-	} else if strings.EqualFold(c.imageFormat, "url") {
-		// url 输出：将图片上传到 OSS，返回 OSS URL
-		if !c.ossUploadEnabled || c.ossClient == nil || c.ossBucket == "" {
-			common.WithFields(map[string]interface{}{
-				"oss_enabled": c.ossUploadEnabled,
-				"has_client":  c.ossClient != nil,
-				"bucket":      c.ossBucket,
-			}).Error("Wan: OSS is not properly configured but image format is set to 'url'")
-			return "", fmt.Errorf("OSS is not configured but image format is set to 'url'")
+	// 逐个处理所有结果（n>1 时有多张图片），没有图片 URL 的结果保持原样
+	formatted := 0
+	for i := range resp.Output.Results {
+		result := &resp.Output.Results[i]
+		imageURL := result.imageURL()
+		if imageURL == "" {
+			continue
 		}
 
-		ossURL, err := c.uploadImageToOSS(ctx, imageURL)
+		formattedURL, mimeType, err := c.formatResultImage(ctx, imageURL, downloaded[imageURL])
 		if err != nil {
-			common.WithError(err).WithField("image_url", imageURL).Error("Wan: failed to upload image to OSS")
-			return "", fmt.Errorf("failed to upload image to OSS: %w", err)
+			common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+				"image_url":    imageURL,
+				"result_index": i,
+			}).Error("Wan: failed to format task result image")
+			return "", fmt.Errorf("failed to format result %d: %w", i, err)
+		}
+		result.URL = formattedURL
+		result.Image = formattedURL
+		if strings.EqualFold(c.imageFormat, utils.ImageFormatBase64Raw) {
+			result.MimeType = mimeType
 		}
+		formatted++
+	}
 
-		result.URL = ossURL
-		result.Image = ossURL
+	if formatted == 0 {
+		// 没有可用的图片 URL，直接返回
+		return string(body), nil
 	}
 
 	// 将修改后的结构重新编码为 JSON 字符串返回
 	updated, err := json.Marshal(resp)
 	if err != nil {
-		common.WithError(err).Error("Wan: failed to marshal formatted task query response")
+		common.WithRequestID(ctx).WithError(err).Error("Wan: failed to marshal formatted task query response")
 		return "", fmt.Errorf("failed to marshal formatted task query response: %w", err)
 	}
 
 	return string(updated), nil
 }
 
-// uploadImageToOSS 将给定的 HTTP 图片 URL 下载后上传到 OSS，并返回 OSS URL。
-func (c *Client) uploadImageToOSS(ctx context.Context, imageURL string) (string, error) {
-	data, mimeType, err := utils.DownloadImageFromURL(ctx, imageURL)
+// rankTaskResults 下载所有结果图片并按质量启发式得分从高到低原地重排 results，
+// 同时为每个结果写入 score。返回按 URL 索引的已下载图片，供后续格式化复用。
+// 无法解码评分的图片排在最后。
+func rankTaskResults(ctx context.Context, results []wanTaskResult) (map[string]downloadedImage, error) {
+	downloaded := make(map[string]downloadedImage, len(results))
+	scores := make([]float64, len(results))
+	for i := range results {
+		scores[i] = math.Inf(-1)
+		imageURL := results[i].imageURL()
+		if imageURL == "" {
+			continue
+		}
+
+		data, mimeType, err := utils.DownloadImageFromURL(ctx, imageURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download result %d for ranking: %w", i, err)
+		}
+		downloaded[imageURL] = downloadedImage{data: data, mimeType: mimeType}
+
+		score, err := utils.ScoreImage(data)
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).WithField("result_index", i).Warn("Wan: failed to score result image, ranking it last")
+			continue
+		}
+		scores[i] = score.Score
+		results[i].Score = &score.Score
+	}
+
+	ranked := make([]wanTaskResult, 0, len(results))
+	for _, i := range utils.RankByScore(scores) {
+		ranked = append(ranked, results[i])
+	}
+	copy(results, ranked)
+	return downloaded, nil
+}
+
+// formatResultImage 按配置的图片格式处理单张结果图片：
+// base64 → 转为 data URI；base64-raw → 转为纯 base64；url → 上传到 OSS 并返回 OSS URL。
+// 同时返回图片的 MIME 类型。img 为已下载的图片数据（如排序阶段已下载），为空时从 imageURL 下载。
+func (c *Client) formatResultImage(ctx context.Context, imageURL string, img downloadedImage) (string, string, error) {
+	// url 输出且结果 URL 未签名（持久有效）时直接返回，省去下载与转存
+	if !utils.IsBase64Format(c.imageFormat) && c.directURLs && !utils.IsSignedURL(imageURL) {
+		common.WithRequestID(ctx).WithField("image_url", imageURL).Debug("Wan: returning result URL directly, skipping OSS upload")
+		return imageURL, img.mimeType, nil
+	}
+
+	if !utils.IsBase64Format(c.imageFormat) && (!c.ossUploadEnabled || c.ossClient == nil || c.ossBucket == "") {
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"oss_enabled": c.ossUploadEnabled,
+			"has_client":  c.ossClient != nil,
+			"bucket":      c.ossBucket,
+		}).Error("Wan: OSS is not properly configured but image format is set to 'url'")
+		return "", "", fmt.Errorf("OSS is not configured but image format is set to 'url'")
+	}
+
+	download := func() error {
+		if img.data != nil {
+			return nil
+		}
+		data, mimeType, err := utils.DownloadImageFromURL(ctx, imageURL)
+		if err != nil {
+			return fmt.Errorf("failed to download image from URL: %w", err)
+		}
+		img = downloadedImage{data: data, mimeType: mimeType}
+		return nil
+	}
+
+	// base64 / base64-raw 输出：转为 data URI 或纯 base64
+	if utils.IsBase64Format(c.imageFormat) {
+		if err := download(); err != nil {
+			return "", "", err
+		}
+		encoded, err := c.encodeImage(ctx, img.mimeType, img.data)
+		return encoded, img.mimeType, err
+	}
+
+	// url 输出：将图片上传到 OSS，返回 OSS URL；OSS 不可用且开启降级时返回原图 URL（GENAI_OSS_DEGRADE）
+	ossURL, err := oss.UploadOrDegrade(ctx, "wan", imageURL, img.data, img.mimeType, func() (string, error) {
+		if err := download(); err != nil {
+			return "", err
+		}
+		return c.uploadImageToOSS(ctx, img.data, img.mimeType)
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to download image from URL: %w", err)
+		return "", "", fmt.Errorf("failed to upload image to OSS: %w", err)
 	}
+	return ossURL, img.mimeType, nil
+}
+
+// encodeImage base64 / base64-raw 输出时编码图片；超过 GENAI_BASE64_MAX_BYTES 且 OSS 可用时改为上传 OSS 返回 URL
+func (c *Client) encodeImage(ctx context.Context, mimeType string, data []byte) (string, error) {
+	if utils.Base64Fallback(ctx, "wan", c.base64MaxBytes, len(data), c.ossClient != nil && c.ossBucket != "" && !oss.DegradeActive()) {
+		return c.uploadImageToOSS(ctx, data, mimeType)
+	}
+	return utils.EncodeImage(ctx, c.imageFormat, mimeType, data), nil
+}
 
+// uploadImageToOSS 将图片数据上传到 OSS，并返回 OSS URL。
+func (c *Client) uploadImageToOSS(ctx context.Context, data []byte, mimeType string) (string, error) {
 	path := utils.GenerateImagePath()
 	fileName := utils.GenerateImageFileName(mimeType)
 	key := fmt.Sprintf("%s%s", path, fileName)
 
-	common.WithFields(map[string]interface{}{
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"bucket":       c.ossBucket,
 		"key":          key,
 		"content_type": mimeType,
@@ -568,20 +1117,21 @@ func (c *Client) uploadImageToOSS(ctx context.Context, imageURL string) (string,
 	}).Debug("Wan: uploading image to OSS")
 
 	reader := bytes.NewReader(data)
-	url, err := c.ossClient.UploadFileWithURL(ctx, c.ossBucket, key, reader, mimeType, 3600*24*7)
+	url, err := c.ossClient.UploadFileWithURL(ctx, c.ossBucket, key, reader, mimeType, oss.URLExpiry(ctx, 0))
 	if err != nil {
-		common.WithError(err).WithFields(map[string]interface{}{
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
 			"bucket": c.ossBucket,
 			"key":    key,
 		}).Error("Wan: failed to upload image to OSS")
 		return "", fmt.Errorf("failed to upload image to OSS: %w", err)
 	}
 
-	common.WithFields(map[string]interface{}{
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"bucket": c.ossBucket,
 		"key":    key,
 		"url":    url,
 	}).Debug("Wan: image uploaded to OSS successfully")
 
+	oss.PublishThumbnail(ctx, c.ossClient, c.ossBucket, data, c.thumbnailSize)
 	return url, nil
 }
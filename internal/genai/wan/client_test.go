@@ -0,0 +1,130 @@
+package wan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/utils"
+)
+
+// TestTaskErrorCountedOnce 验证同一个失败 / 无图片的任务被多次查询时，provider 错误统计只计一次
+func TestTaskErrorCountedOnce(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		category common.ErrorCategory
+	}{
+		{
+			name:     "failed",
+			body:     `{"request_id":"req-1","output":{"task_id":"task-failed-once","task_status":"FAILED","code":"InternalError","message":"boom"}}`,
+			category: common.ErrCategoryServerError,
+		},
+		{
+			name:     "succeeded without image",
+			body:     `{"request_id":"req-2","output":{"task_id":"task-empty-once","task_status":"SUCCEEDED","results":[]}}`,
+			category: common.ErrCategoryEmptyResult,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, tt.body)
+			}))
+			defer upstream.Close()
+
+			client, err := NewClient(Config{BaseURL: upstream.URL, APIKey: "test-key", GenModel: "wan2.2-t2i-flash"})
+			if err != nil {
+				t.Fatalf("NewClient: %v", err)
+			}
+
+			before := common.ProviderErrorStats()["wan"][tt.category]
+			for i := 0; i < 2; i++ {
+				// 任务失败或没有图片时查询返回错误，这里只关心错误统计
+				_, _ = client.QueryGenerateImageTask(context.Background(), "task-id")
+			}
+			if got := common.ProviderErrorStats()["wan"][tt.category] - before; got != 1 {
+				t.Fatalf("%s count increased by %d after two queries, want 1", tt.category, got)
+			}
+		})
+	}
+}
+
+// TestFormatEveryQueryResult 验证 n > 1 的查询结果逐张格式化，某一张失败时错误中带有失败的下标
+// （行为由 synth-1955 的 formatImageQueryResult 实现，这里作为回归测试）
+func TestFormatEveryQueryResult(t *testing.T) {
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	// 测试服务器在回环地址上，下载结果图片需要允许内网地址
+	previous := utils.GetImageHostPolicy()
+	utils.SetImageHostPolicy(utils.ImageHostPolicy{AllowPrivate: true})
+	t.Cleanup(func() { utils.SetImageHostPolicy(previous) })
+
+	tests := []struct {
+		name    string
+		missing string // 返回 404 的图片路径，为空表示全部可下载
+		wantErr string
+	}{
+		{name: "all results formatted"},
+		{name: "one result fails", missing: "/img/1.png", wantErr: "failed to format result 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upstream *httptest.Server
+			upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasPrefix(r.URL.Path, "/img/") {
+					if r.URL.Path == tt.missing {
+						http.NotFound(w, r)
+						return
+					}
+					w.Header().Set("Content-Type", "image/png")
+					w.Write(pngData.Bytes())
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"request_id":"req-1","output":{"task_id":"task-multi","task_status":"SUCCEEDED","results":[{"url":"%[1]s/img/0.png"},{"url":"%[1]s/img/1.png"},{"url":"%[1]s/img/2.png"}]}}`, upstream.URL)
+			}))
+			defer upstream.Close()
+
+			client, err := NewClient(Config{BaseURL: upstream.URL, APIKey: "test-key", GenModel: "wan2.2-t2i-flash", ImageFormat: "base64"})
+			if err != nil {
+				t.Fatalf("NewClient: %v", err)
+			}
+
+			result, err := client.QueryGenerateImageTask(context.Background(), "task-multi")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("QueryGenerateImageTask error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("QueryGenerateImageTask: %v", err)
+			}
+			var resp wanTaskQueryResponse
+			if err := json.Unmarshal([]byte(result), &resp); err != nil {
+				t.Fatalf("result %q is not JSON: %v", result, err)
+			}
+			if len(resp.Output.Results) != 3 {
+				t.Fatalf("got %d results, want 3", len(resp.Output.Results))
+			}
+			for i, r := range resp.Output.Results {
+				if !strings.HasPrefix(r.URL, "data:image/png;base64,") {
+					t.Errorf("result %d url = %.40q, want a PNG data URI", i, r.URL)
+				}
+			}
+		})
+	}
+}
@@ -1,13 +1,24 @@
 package wan
 
-import "context"
+import (
+	"context"
+
+	"genai-mcp/common"
+)
 
 type WanIface interface {
-	CreateGenerateImageTask(ctx context.Context, prompt string, negative_prompt string) (string, error)
+	// CreateGenerateImageTask 创建文生图任务；size 为空（1024*1024）、宽高比（如 16:9）或 宽*高，n 为生成图片数（1-4，<= 0 时为 1）
+	CreateGenerateImageTask(ctx context.Context, prompt string, negative_prompt string, size string, n int) (string, error)
 	QueryGenerateImageTask(ctx context.Context, task_id string) (string, error)
+	// QueryGenerateImageTaskStatus 查询文生图任务并解析为与 provider 无关的统一任务状态
+	QueryGenerateImageTaskStatus(ctx context.Context, task_id string) (*common.TaskStatus, error)
 	// CreateEditImageTask 进行图片编辑 / 融合。
 	// - prompt: 编辑/融合文案
 	// - image_urls: 输入图片 URL 列表（单图编辑或多图融合）
 	CreateEditImageTask(ctx context.Context, prompt string, image_urls []string) (string, error)
 	QueryEditImageTask(ctx context.Context, task_id string) (string, error)
+	// QueryTasks 批量查询多个任务（文生图与图像编辑任务均可），按输入顺序返回每个任务的结果
+	QueryTasks(ctx context.Context, taskIDs []string) []common.TaskQueryResult
+	// QueryTaskRaw 查询任务并原样返回 provider 的响应 JSON，不做分页合并与图片格式化
+	QueryTaskRaw(ctx context.Context, task_id string) (string, error)
 }
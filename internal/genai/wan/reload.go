@@ -0,0 +1,73 @@
+package wan
+
+import (
+	"context"
+	"sync/atomic"
+
+	"genai-mcp/common"
+)
+
+// ReloadableClient 可在运行时原子替换底层客户端的 WanIface 实现。
+// 进行中的请求继续使用替换前取得的客户端，不受重新加载影响。
+type ReloadableClient struct {
+	current atomic.Pointer[Client]
+}
+
+// NewReloadableClient 使用初始客户端创建 ReloadableClient
+func NewReloadableClient(client *Client) *ReloadableClient {
+	r := &ReloadableClient{}
+	r.current.Store(client)
+	return r
+}
+
+// Reload 根据新配置重建客户端并原子替换；创建失败时保留原客户端
+func (r *ReloadableClient) Reload(cfg *common.Config) error {
+	client, err := NewWanClientFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if old := r.current.Swap(client); old != nil {
+		_ = old.Close()
+	}
+	return nil
+}
+
+// CreateGenerateImageTask 实现 WanIface
+func (r *ReloadableClient) CreateGenerateImageTask(ctx context.Context, prompt string, negative_prompt string, size string, n int) (string, error) {
+	return r.current.Load().CreateGenerateImageTask(ctx, prompt, negative_prompt, size, n)
+}
+
+// QueryGenerateImageTask 实现 WanIface
+func (r *ReloadableClient) QueryGenerateImageTask(ctx context.Context, task_id string) (string, error) {
+	return r.current.Load().QueryGenerateImageTask(ctx, task_id)
+}
+
+// QueryGenerateImageTaskStatus 实现 WanIface
+func (r *ReloadableClient) QueryGenerateImageTaskStatus(ctx context.Context, task_id string) (*common.TaskStatus, error) {
+	return r.current.Load().QueryGenerateImageTaskStatus(ctx, task_id)
+}
+
+// CreateEditImageTask 实现 WanIface
+func (r *ReloadableClient) CreateEditImageTask(ctx context.Context, prompt string, image_urls []string) (string, error) {
+	return r.current.Load().CreateEditImageTask(ctx, prompt, image_urls)
+}
+
+// QueryEditImageTask 实现 WanIface
+func (r *ReloadableClient) QueryEditImageTask(ctx context.Context, task_id string) (string, error) {
+	return r.current.Load().QueryEditImageTask(ctx, task_id)
+}
+
+// QueryTasks 实现 WanIface
+func (r *ReloadableClient) QueryTasks(ctx context.Context, taskIDs []string) []common.TaskQueryResult {
+	return r.current.Load().QueryTasks(ctx, taskIDs)
+}
+
+// QueryTaskRaw 实现 WanIface
+func (r *ReloadableClient) QueryTaskRaw(ctx context.Context, task_id string) (string, error) {
+	return r.current.Load().QueryTaskRaw(ctx, task_id)
+}
+
+// Close 关闭当前客户端
+func (r *ReloadableClient) Close() error {
+	return r.current.Load().Close()
+}
@@ -0,0 +1,140 @@
+package wan
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"genai-mcp/common"
+)
+
+// Wan 文生图输出尺寸限制：宽、高均在 [minSizeSide, maxSizeSide] 像素内（最高约 200 万像素）
+const (
+	defaultSize = "1024*1024"
+	minSizeSide = 512
+	maxSizeSide = 1440
+
+	// 单个文生图任务最多生成的图片数（parameters.n）
+	maxGenerateImages = 4
+)
+
+// defaultAspectRatioSizes 常见宽高比到 Wan 像素尺寸（宽*高）的内置映射，与其它 provider 的 size 取值保持一致。
+// 可通过 WAN_SIZE_MAP 覆盖或补充。
+var defaultAspectRatioSizes = map[string]string{
+	"1:1":  "1024*1024",
+	"2:3":  "768*1152",
+	"3:2":  "1152*768",
+	"3:4":  "768*1024",
+	"4:3":  "1024*768",
+	"4:5":  "896*1120",
+	"5:4":  "1120*896",
+	"9:16": "720*1280",
+	"16:9": "1280*720",
+	"21:9": "1344*576",
+}
+
+// ParseSizeMap 解析 WAN_SIZE_MAP（JSON 对象，宽高比 → 宽*高），例如 {"16:9": "1440*810"}。
+// 每个尺寸都会按 Wan 的尺寸限制校验。为空时返回 nil。
+func ParseSizeMap(raw string) (map[string]string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+
+	var overrides map[string]string
+	if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+		return nil, fmt.Errorf("WAN_SIZE_MAP must be a JSON object of aspect ratio to WIDTH*HEIGHT: %w", err)
+	}
+	normalized := make(map[string]string, len(overrides))
+	for ratio, size := range overrides {
+		pixelSize, err := parsePixelSize(size)
+		if err != nil {
+			return nil, fmt.Errorf("WAN_SIZE_MAP: size for %q: %w", ratio, err)
+		}
+		normalized[strings.TrimSpace(ratio)] = pixelSize
+	}
+	return normalized, nil
+}
+
+// resolveSize 将请求的 size 转换为 Wan 的 宽*高：
+//   - 为空时使用默认尺寸 1024*1024
+//   - 宽高比（如 16:9）按 overrides、内置表依次查找
+//   - 像素尺寸（1280*720 或 1280x720）直接校验
+func resolveSize(size string, overrides map[string]string) (string, error) {
+	size = strings.TrimSpace(size)
+	if size == "" {
+		return defaultSize, nil
+	}
+
+	if strings.Contains(size, ":") {
+		if pixelSize, ok := overrides[size]; ok {
+			return pixelSize, nil
+		}
+		if pixelSize, ok := defaultAspectRatioSizes[size]; ok {
+			return pixelSize, nil
+		}
+		return "", common.NewError(common.ErrCodeInvalidArgument, false,
+			"unsupported aspect ratio %q for Wan; use one of %s or an explicit WIDTH*HEIGHT", size, strings.Join(supportedAspectRatios(overrides), ", "))
+	}
+
+	pixelSize, err := parsePixelSize(size)
+	if err != nil {
+		return "", common.NewError(common.ErrCodeInvalidArgument, false, "invalid size for Wan: %v", err)
+	}
+	return pixelSize, nil
+}
+
+// parsePixelSize 解析 宽*高（或 宽x高）并按 Wan 的尺寸限制校验，返回规范化的 宽*高
+func parsePixelSize(size string) (string, error) {
+	w, h, err := splitPixelSize(size)
+	if err != nil {
+		return "", err
+	}
+	if w < minSizeSide || w > maxSizeSide || h < minSizeSide || h > maxSizeSide {
+		return "", fmt.Errorf("size %q out of range: width and height must be between %d and %d pixels", size, minSizeSide, maxSizeSide)
+	}
+	return fmt.Sprintf("%d*%d", w, h), nil
+}
+
+// splitPixelSize 拆分 宽*高 / 宽x高 为整数宽高
+func splitPixelSize(size string) (int, int, error) {
+	v := strings.ToLower(strings.TrimSpace(size))
+	for _, sep := range []string{"*", "x"} {
+		if parts := strings.SplitN(v, sep, 2); len(parts) == 2 {
+			w, errW := strconv.Atoi(strings.TrimSpace(parts[0]))
+			h, errH := strconv.Atoi(strings.TrimSpace(parts[1]))
+			if errW != nil || errH != nil {
+				break
+			}
+			return w, h, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("size %q must be WIDTH*HEIGHT (e.g. 1280*720) or an aspect ratio (e.g. 16:9)", size)
+}
+
+// sizeMegapixels 返回 宽*高 尺寸的百万像素数（用于按请求规模估算超时）
+func sizeMegapixels(pixelSize string) float64 {
+	w, h, err := splitPixelSize(pixelSize)
+	if err != nil {
+		return common.Megapixels(defaultOutputLongSide)
+	}
+	return float64(w) * float64(h) / 1e6
+}
+
+// supportedAspectRatios 返回内置表与 overrides 合并后的宽高比列表（用于错误提示）
+func supportedAspectRatios(overrides map[string]string) []string {
+	seen := make(map[string]bool, len(defaultAspectRatioSizes)+len(overrides))
+	var ratios []string
+	for _, table := range []map[string]string{defaultAspectRatioSizes, overrides} {
+		for ratio := range table {
+			if !seen[ratio] {
+				seen[ratio] = true
+				ratios = append(ratios, ratio)
+			}
+		}
+	}
+	sort.Strings(ratios)
+	return ratios
+}
@@ -0,0 +1,91 @@
+package httpserver
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"genai-mcp/common"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+//go:embed debugui.html
+var debugUIPage []byte
+
+// debugToolInfo /debug/tools 返回的工具信息
+type debugToolInfo struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	InputSchema mcp.ToolInputSchema `json:"input_schema"`
+}
+
+// debugCallRequest /debug/call 的请求体
+type debugCallRequest struct {
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// RegisterDebugUI 在 mux 上挂载调试页面（DEBUG_UI=true 时启用）：
+//   - GET  /             调试用 HTML 页面
+//   - GET  /debug/tools  已注册的工具列表
+//   - POST /debug/call   直接调用已注册工具的 handler，返回 CallToolResult JSON
+//
+// 调试接口与 /mcp 共用同一套 tool handler，便于在没有 MCP 客户端时端到端验证部署。
+func RegisterDebugUI(mux *http.ServeMux, s *server.MCPServer) {
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(debugUIPage)
+	})
+
+	mux.HandleFunc("GET /debug/tools", func(w http.ResponseWriter, r *http.Request) {
+		tools := make([]debugToolInfo, 0)
+		for name, tool := range s.ListTools() {
+			tools = append(tools, debugToolInfo{
+				Name:        name,
+				Description: tool.Tool.Description,
+				InputSchema: tool.Tool.InputSchema,
+			})
+		}
+		sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+		writeJSON(w, http.StatusOK, tools)
+	})
+
+	mux.HandleFunc("POST /debug/call", func(w http.ResponseWriter, r *http.Request) {
+		var body debugCallRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 32<<20)).Decode(&body); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body: " + err.Error()})
+			return
+		}
+
+		tool := s.GetTool(body.Tool)
+		if tool == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown tool: " + body.Tool})
+			return
+		}
+
+		var req mcp.CallToolRequest
+		req.Params.Name = body.Tool
+		req.Params.Arguments = body.Arguments
+
+		common.WithField("tool", body.Tool).Info("Debug UI: calling tool")
+		result, err := tool.Handler(r.Context(), req)
+		if err != nil {
+			common.WithError(err).WithField("tool", body.Tool).Error("Debug UI: tool call failed")
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+}
+
+// writeJSON 以 JSON 格式写出响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		common.WithError(err).Warn("Failed to write JSON response")
+	}
+}
@@ -0,0 +1,40 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"genai-mcp/common"
+)
+
+// HealthCheck 浅层健康检查（不发起网络请求），健康时返回 nil，否则返回不健康的原因
+type HealthCheck func() error
+
+// healthResponse 健康检查接口的返回结构
+type healthResponse struct {
+	Status   string `json:"status"`
+	Provider string `json:"provider"`
+	Error    string `json:"error,omitempty"`
+}
+
+// RegisterHealthz 在 mux 上挂载供负载均衡器使用的健康检查接口（GET / HEAD path，默认 /healthz）。
+// 所有检查通过时返回 200 {"status":"ok","provider":"..."}，否则返回 503 并在 error 中说明第一个失败的检查。
+// provider 在每次请求时读取，reload_provider 后同样生效。
+func RegisterHealthz(mux *http.ServeMux, path string, provider func() string, checks ...HealthCheck) {
+	mux.HandleFunc("GET "+path, func(w http.ResponseWriter, r *http.Request) {
+		resp := healthResponse{Status: "ok", Provider: provider()}
+		status := http.StatusOK
+		for _, check := range checks {
+			if err := check(); err != nil {
+				resp.Status, resp.Error = "unavailable", err.Error()
+				status = http.StatusServiceUnavailable
+				common.WithError(err).WithField("path", path).Warn("Health check failed")
+				break
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
@@ -0,0 +1,37 @@
+package httpserver
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"genai-mcp/common"
+)
+
+// ImageSource 按 id 返回缓存的图片（由 oss.MemoryStore 实现）
+type ImageSource interface {
+	Get(id string) (data []byte, contentType string, created time.Time, ok bool)
+	TTL() time.Duration
+}
+
+// RegisterImageEndpoint 在 mux 的 path（如 /image/）下以 GET {path}{id} 提供 source 中缓存的原始图片字节（OSS_BACKEND=memory），
+// 使 url 输出可被浏览器直接加载，不需要外部对象存储。未知或已过期的 id 返回 404。
+func RegisterImageEndpoint(mux *http.ServeMux, path string, source ImageSource) {
+	prefix := strings.TrimRight(path, "/") + "/"
+	mux.HandleFunc("GET "+prefix+"{id}", func(w http.ResponseWriter, r *http.Request) {
+		data, contentType, created, ok := source.Get(r.PathValue("id"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		// 对象内容在 id 下不会变化，可在保留期内缓存
+		maxAge := max(int(time.Until(created.Add(source.TTL())).Seconds()), 0)
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d, immutable", maxAge))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		http.ServeContent(w, r, "", created, bytes.NewReader(data))
+	})
+	common.WithField("path", prefix+"{id}").Info("Serving cached images")
+}
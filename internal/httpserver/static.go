@@ -0,0 +1,28 @@
+package httpserver
+
+import (
+	"net/http"
+	"strings"
+
+	"genai-mcp/common"
+)
+
+// RegisterLocalStorage 在 mux 的 path 下以只读方式提供本地存储目录中的文件（OSS_BACKEND=local 且设置了 OSS_LOCAL_BASE_URL），
+// 使结果 URL 可以直接访问。不提供目录列表，也不返回以 . 开头的文件（如写入中的临时文件）。
+func RegisterLocalStorage(mux *http.ServeMux, path, dir string) {
+	prefix := strings.TrimRight(path, "/") + "/"
+	files := http.StripPrefix(prefix, http.FileServer(http.Dir(dir)))
+	mux.HandleFunc("GET "+prefix, func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, prefix)
+		if name == "" || strings.HasSuffix(name, "/") || strings.HasPrefix(name[strings.LastIndex(name, "/")+1:], ".") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		files.ServeHTTP(w, r)
+	})
+	common.WithFields(map[string]interface{}{
+		"path": prefix,
+		"dir":  dir,
+	}).Info("Serving local storage files")
+}
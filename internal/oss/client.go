@@ -1,17 +1,185 @@
 package oss
 
 import (
+	"sync"
+	"time"
+
 	"genai-mcp/common"
+	"genai-mcp/internal/utils"
 )
 
-// NewOSSClientFromConfig 从配置创建 OSS 客户端
+// NewOSSClientFromConfig 按 OSS_BACKEND 从配置创建 OSS 客户端：s3（默认）、local、gcs 或 memory
 func NewOSSClientFromConfig(cfg *common.Config) (OSSIface, error) {
-	ossCfg := S3Config{
+	switch cfg.OSSBackend {
+	case common.OSSBackendMemory:
+		// 内存存储的对象只能由 /image/{id} 接口背后的共享实例提供，不能另建实例
+		return sharedMemoryClient(cfg)
+	case common.OSSBackendLocal:
+		return NewLocalStorage(localConfigFromConfig(cfg))
+	case common.OSSBackendGCS:
+		return NewGCSClient(gcsConfigFromConfig(cfg))
+	default:
+		return NewS3Client(s3ConfigFromConfig(cfg))
+	}
+}
+
+var (
+	sharedClientsMu sync.Mutex
+	// sharedClients 按 S3Config 缓存的共享客户端，相同配置复用同一实例
+	sharedClients = make(map[S3Config]OSSIface)
+	// newSharedClient 创建共享客户端的工厂函数，测试时可替换
+	newSharedClient = func(cfg S3Config) (OSSIface, error) {
+		return NewS3Client(cfg)
+	}
+	// sharedGCSClients 按 GCSConfig 缓存的共享 GCS 客户端（凭证来自环境，不在配置中）
+	sharedGCSClients = make(map[GCSConfig]OSSIface)
+	// sharedMemoryStore 进程内唯一的内存存储；各 provider 与 /image/{id} 接口必须使用同一实例，配置变化时原地更新
+	sharedMemoryStore *MemoryStore
+)
+
+// SharedOSSClientFromConfig 返回与配置对应的共享 OSS 客户端。
+//
+// 首次调用时按需创建，之后相同的 endpoint / region / 凭证复用同一实例，
+// 避免各 provider 与通用工具重复创建连接和配置。并发安全。
+func SharedOSSClientFromConfig(cfg *common.Config) (OSSIface, error) {
+	switch cfg.OSSBackend {
+	case common.OSSBackendMemory:
+		return sharedMemoryClient(cfg)
+	case common.OSSBackendLocal:
+		// 本地存储没有连接与凭证，直接创建
+		return NewOSSClientFromConfig(cfg)
+	case common.OSSBackendGCS:
+		return sharedGCSClientFromConfig(cfg)
+	}
+	key := s3ConfigFromConfig(cfg)
+
+	sharedClientsMu.Lock()
+	defer sharedClientsMu.Unlock()
+
+	if client, ok := sharedClients[key]; ok {
+		return client, nil
+	}
+
+	client, err := newSharedClient(key)
+	if err != nil {
+		return nil, err
+	}
+	sharedClients[key] = client
+	common.WithFields(map[string]interface{}{
+		"endpoint": key.Endpoint,
+		"region":   key.Region,
+	}).Debug("Created shared OSS client")
+
+	return client, nil
+}
+
+// ResetSharedClients 清空共享客户端缓存（用于测试或重新加载配置）
+func ResetSharedClients() {
+	sharedClientsMu.Lock()
+	defer sharedClientsMu.Unlock()
+	sharedClients = make(map[S3Config]OSSIface)
+	sharedGCSClients = make(map[GCSConfig]OSSIface)
+	sharedMemoryStore = nil
+	utils.SetLocalImageReader(nil)
+}
+
+// SharedMemoryStoreFromConfig 返回进程内唯一的共享内存存储，首次调用时创建。
+// 之后以不同配置调用（如 reload_provider 修改了 OSS_MEMORY_*）时原地应用新配置，
+// 已缓存的对象与 /image/{id} 接口继续使用同一实例。
+func SharedMemoryStoreFromConfig(cfg *common.Config) (*MemoryStore, error) {
+	memCfg := memoryConfigFromConfig(cfg)
+
+	sharedClientsMu.Lock()
+	defer sharedClientsMu.Unlock()
+
+	if sharedMemoryStore != nil {
+		if err := sharedMemoryStore.Reconfigure(memCfg); err != nil {
+			return nil, err
+		}
+		return sharedMemoryStore, nil
+	}
+	store, err := NewMemoryStore(memCfg)
+	if err != nil {
+		return nil, err
+	}
+	sharedMemoryStore = store
+	// 本服务读取自己的 /image/{id} URL 时直接读内存（默认 base URL 为 localhost，经网络下载会被内网地址拦截）
+	utils.SetLocalImageReader(store.ReadURL)
+	common.Debug("Created shared memory storage")
+	return store, nil
+}
+
+// sharedGCSClientFromConfig 返回与配置对应的共享 GCS 客户端，首次调用时创建
+func sharedGCSClientFromConfig(cfg *common.Config) (OSSIface, error) {
+	key := gcsConfigFromConfig(cfg)
+
+	sharedClientsMu.Lock()
+	defer sharedClientsMu.Unlock()
+
+	if client, ok := sharedGCSClients[key]; ok {
+		return client, nil
+	}
+	client, err := NewGCSClient(key)
+	if err != nil {
+		return nil, err
+	}
+	sharedGCSClients[key] = client
+	common.Debug("Created shared GCS client")
+	return client, nil
+}
+
+// s3ConfigFromConfig 从通用配置提取 S3 客户端配置
+func s3ConfigFromConfig(cfg *common.Config) S3Config {
+	return S3Config{
 		Endpoint:  cfg.OSSEndpoint,
 		Region:    cfg.OSSRegion,
 		AccessKey: cfg.OSSAccessKey,
 		SecretKey: cfg.OSSSecretKey,
+
+		SSE:         cfg.OSSSSE,
+		SSEKMSKeyID: cfg.OSSSSEKMSKeyID,
+
+		StorageClass: cfg.OSSStorageClass,
+
+		URLMode:   cfg.OSSURLMode,
+		URLExpiry: int64(cfg.OSSURLExpirySeconds),
+
+		ArchiveQuality: cfg.OSSArchiveQuality,
 	}
+}
+
+// localConfigFromConfig 从通用配置提取本地存储配置
+func localConfigFromConfig(cfg *common.Config) LocalConfig {
+	return LocalConfig{
+		Dir:            cfg.OSSLocalDir,
+		BaseURL:        cfg.OSSLocalBaseURL,
+		ArchiveQuality: cfg.OSSArchiveQuality,
+	}
+}
 
-	return NewS3Client(ossCfg)
+// gcsConfigFromConfig 从通用配置提取 GCS 客户端配置
+func gcsConfigFromConfig(cfg *common.Config) GCSConfig {
+	return GCSConfig{
+		URLMode:        cfg.OSSURLMode,
+		URLExpiry:      int64(cfg.OSSURLExpirySeconds),
+		ArchiveQuality: cfg.OSSArchiveQuality,
+	}
+}
+
+// sharedMemoryClient 以 OSSIface 返回共享内存存储，出错时返回 nil 接口而不是 nil 指针
+func sharedMemoryClient(cfg *common.Config) (OSSIface, error) {
+	store, err := SharedMemoryStoreFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// memoryConfigFromConfig 从通用配置提取内存存储配置
+func memoryConfigFromConfig(cfg *common.Config) MemoryConfig {
+	return MemoryConfig{
+		BaseURL:  cfg.OSSMemoryBaseURL,
+		MaxBytes: int64(cfg.OSSMemoryMaxMB) << 20,
+		TTL:      time.Duration(cfg.OSSMemoryTTLMinutes) * time.Minute,
+	}
 }
@@ -0,0 +1,47 @@
+package oss
+
+import (
+	"strings"
+	"sync"
+)
+
+// defaultContentTypeOverrides 内置的 Content-Type 规范化表：非规范 MIME 类型 → 规范形式
+var defaultContentTypeOverrides = map[string]string{
+	"image/jpg":   "image/jpeg",
+	"image/pjpeg": "image/jpeg",
+	"image/x-png": "image/png",
+}
+
+var (
+	contentTypeOverridesMu sync.RWMutex
+	contentTypeOverrides   = defaultContentTypeOverrides
+)
+
+// SetContentTypeOverrides 设置上传时的 Content-Type 覆盖表（通常在启动时根据配置调用一次）。
+// 自定义项与内置规范化表合并，同名时以自定义项为准。
+func SetContentTypeOverrides(overrides map[string]string) {
+	merged := make(map[string]string, len(defaultContentTypeOverrides)+len(overrides))
+	for from, to := range defaultContentTypeOverrides {
+		merged[from] = to
+	}
+	for from, to := range overrides {
+		merged[strings.ToLower(strings.TrimSpace(from))] = strings.TrimSpace(to)
+	}
+
+	contentTypeOverridesMu.Lock()
+	defer contentTypeOverridesMu.Unlock()
+	contentTypeOverrides = merged
+}
+
+// NormalizeContentType 返回上传时实际使用的 Content-Type：
+// 媒体类型统一为小写并去掉参数，命中覆盖表时替换为对应值。
+func NormalizeContentType(contentType string) string {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+
+	contentTypeOverridesMu.RLock()
+	defer contentTypeOverridesMu.RUnlock()
+	if to, ok := contentTypeOverrides[mediaType]; ok {
+		return to
+	}
+	return mediaType
+}
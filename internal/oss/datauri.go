@@ -0,0 +1,51 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/utils"
+)
+
+// UploadDataURIInputs 将图片输入中的 data URI 解码后上传到 bucket 并替换为对象 URL，普通 URL 保持不变，
+// 供只接受图片 URL 的 provider（Wan、APIMart）使用。上传的 URL 使用默认有效期，只需在 provider 拉取前有效。
+// 返回标记了上传 URL 为受信任内部输入的 ctx（provider 不再按用户输入的主机策略校验它们）、替换后的列表与上传的图片数；
+// 存在 data URI 但未配置 OSS（client 为 nil 或 bucket 为空）时返回 invalid_argument 错误。
+func UploadDataURIInputs(ctx context.Context, client OSSIface, bucket string, imageURLs []string) (context.Context, []string, int, error) {
+	result := make([]string, len(imageURLs))
+	uploaded := 0
+	for i, imageURL := range imageURLs {
+		if !strings.HasPrefix(imageURL, "data:") {
+			result[i] = imageURL
+			continue
+		}
+		if client == nil || bucket == "" {
+			return ctx, nil, 0, common.NewError(common.ErrCodeInvalidArgument, false,
+				"image at index %d is a data URI, but the provider only accepts image URLs and OSS is not configured to upload it", i)
+		}
+
+		data, mimeType, err := utils.DecodeDataURI(imageURL)
+		if err != nil {
+			return ctx, nil, 0, common.NewError(common.ErrCodeInvalidArgument, false, "invalid data URI at index %d: %v", i, err)
+		}
+		// 输入图片只需在 provider 拉取前有效，不生成缩略图
+		key := utils.GenerateImagePath() + utils.GenerateImageFileName(mimeType)
+		url, err := client.UploadFileWithURL(ctx, bucket, key, bytes.NewReader(data), mimeType, 0)
+		if err != nil {
+			return ctx, nil, 0, fmt.Errorf("failed to upload input image at index %d: %w", i, err)
+		}
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"index": i,
+			"key":   key,
+			"size":  len(data),
+		}).Info("Uploaded data URI input to OSS")
+
+		result[i] = url
+		uploaded++
+		ctx = utils.WithTrustedImageURLs(ctx, url)
+	}
+	return ctx, result, uploaded, nil
+}
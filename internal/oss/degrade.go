@@ -0,0 +1,155 @@
+package oss
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/utils"
+)
+
+// DefaultHealthCheckInterval OSS 健康检查的默认间隔
+const DefaultHealthCheckInterval = 30 * time.Second
+
+// unavailable OSS 当前是否被判定为不可用：上传失败或健康检查失败时置位，上传或健康检查成功时恢复
+var unavailable atomic.Bool
+
+var (
+	degradeMu sync.RWMutex
+	// degradeEnabled 是否开启 OSS 不可用时的降级（GENAI_OSS_DEGRADE）
+	degradeEnabled bool
+	// degradeMaxInlineBytes 降级时以 data URI 内联返回的最大图片字节数（GENAI_OSS_DEGRADE_MAX_BYTES）
+	degradeMaxInlineBytes int
+)
+
+// SetDegrade 设置 OSS 不可用时的降级策略（通常在启动时根据配置调用一次）。
+// 开启后，url 输出在 OSS 不可用时改为返回 provider 的原始结果 URL，
+// 或不超过 maxInlineBytes 的图片以 data URI 返回，而不是让请求失败。
+func SetDegrade(enabled bool, maxInlineBytes int) {
+	degradeMu.Lock()
+	defer degradeMu.Unlock()
+	degradeEnabled = enabled
+	degradeMaxInlineBytes = maxInlineBytes
+}
+
+// degradeSettings 返回当前的降级配置
+func degradeSettings() (bool, int) {
+	degradeMu.RLock()
+	defer degradeMu.RUnlock()
+	return degradeEnabled, degradeMaxInlineBytes
+}
+
+// Available 返回 OSS 当前是否被判定为可用
+func Available() bool {
+	return !unavailable.Load()
+}
+
+// DegradeActive 判断是否应跳过 OSS：开启了降级且 OSS 当前被判定为不可用。
+// base64 输出的大图回退到 OSS（GENAI_BASE64_MAX_BYTES）时据此改为直接内联返回。
+func DegradeActive() bool {
+	enabled, _ := degradeSettings()
+	return enabled && !Available()
+}
+
+// recordHealth 根据一次 OSS 请求的结果更新可用状态；调用方 context 已结束导致的失败不计入
+func recordHealth(ctx context.Context, source string, err error) {
+	if err == nil {
+		if unavailable.CompareAndSwap(true, false) {
+			common.WithRequestID(ctx).WithField("source", source).Warn("OSS is available again, resuming uploads")
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if unavailable.CompareAndSwap(false, true) {
+		enabled, _ := degradeSettings()
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"source":  source,
+			"degrade": enabled,
+		}).Error("OSS marked unavailable")
+	}
+}
+
+// UploadOrDegrade 调用 upload 上传结果图片并返回 OSS URL。开启降级（GENAI_OSS_DEGRADE）时：
+//   - OSS 已被判定为不可用：不再尝试上传，直接返回降级结果；
+//   - 上传因 OSS 故障失败（上传使 OSS 被判定为不可用）：返回降级结果，而不是错误。
+//
+// 降级结果优先使用 provider 的原始结果 URL（nativeURL，可能带有效期），
+// 其次在图片不超过 GENAI_OSS_DEGRADE_MAX_BYTES 时返回 data URI；都不可用时返回错误。
+// data 为已取得的图片数据（可为 nil），provider 用于日志。
+func UploadOrDegrade(ctx context.Context, provider, nativeURL string, data []byte, mimeType string, upload func() (string, error)) (string, error) {
+	enabled, maxInlineBytes := degradeSettings()
+	if !enabled {
+		return upload()
+	}
+
+	var cause error
+	if Available() {
+		url, err := upload()
+		if err == nil || Available() {
+			// 成功，或失败原因不在 OSS（如下载原图失败）
+			return url, err
+		}
+		cause = err
+	}
+
+	fields := map[string]interface{}{
+		"provider":   provider,
+		"has_native": nativeURL != "",
+		"size":       len(data),
+	}
+	if nativeURL != "" {
+		common.WithRequestID(ctx).WithError(cause).WithFields(fields).Warn("OSS unavailable, degraded to returning the provider result URL (GENAI_OSS_DEGRADE)")
+		return nativeURL, nil
+	}
+	if data != nil && len(data) <= maxInlineBytes {
+		common.WithRequestID(ctx).WithError(cause).WithFields(fields).Warn("OSS unavailable, degraded to returning the image inline as a data URI (GENAI_OSS_DEGRADE)")
+		return utils.EncodeDataURI(mimeType, data), nil
+	}
+
+	common.WithRequestID(ctx).WithError(cause).WithFields(fields).Error("OSS unavailable and the image cannot be degraded: no provider URL and too large to inline")
+	err := common.NewError(common.ErrCodeUpstream, true,
+		"OSS is unavailable and the image (%d bytes) exceeds GENAI_OSS_DEGRADE_MAX_BYTES (%d) for inline fallback", len(data), maxInlineBytes)
+	err.Err = cause
+	return "", err
+}
+
+// healthCheckTimeout 单次 OSS 健康检查请求的超时
+const healthCheckTimeout = 10 * time.Second
+
+// RunHealthCheck 每隔 interval 列举 bucket 中的一个对象（ListObjectsV2，MaxKeys=1）检查 OSS 是否可达，
+// 更新可用状态，直到 ctx 取消。OSS 被判定为不可用后，降级期间不再上传，只有健康检查能使其恢复。
+func RunHealthCheck(ctx context.Context, client OSSIface, bucket string, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		checkHealth(ctx, client, bucket)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkHealth 执行一次 OSS 健康检查
+func checkHealth(ctx context.Context, client OSSIface, bucket string) {
+	checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	_, err := client.ListObjects(checkCtx, bucket, "", "", 1)
+	if err != nil && ctx.Err() == nil && checkCtx.Err() != nil {
+		// 健康检查自身超时视为不可达，而不是调用方取消
+		err = fmt.Errorf("OSS health check timed out after %s: %w", healthCheckTimeout, err)
+		recordHealth(ctx, "health_check", err)
+		return
+	}
+	recordHealth(checkCtx, "health_check", err)
+}
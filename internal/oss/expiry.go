@@ -0,0 +1,26 @@
+package oss
+
+import "context"
+
+// DefaultURLExpiry 未配置 OSS_URL_EXPIRY_SECONDS 时签名 URL 的默认有效期（秒），也是 S3 SigV4 预签名允许的最大有效期（7 天）
+const DefaultURLExpiry int64 = 3600 * 24 * 7
+
+type urlExpiryKey struct{}
+
+// WithURLExpiry 返回携带签名 URL 有效期覆盖值（秒）的 context，seconds <= 0 时不覆盖。
+// 工具层据 url_expiry_seconds 参数设置，结果图片上传时通过 URLExpiry 读取。
+func WithURLExpiry(ctx context.Context, seconds int64) context.Context {
+	if seconds <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, urlExpiryKey{}, seconds)
+}
+
+// URLExpiry 返回 context 中的签名 URL 有效期覆盖值，未设置时返回 def。
+// def 传 0 表示使用 OSS 客户端配置的默认有效期（见 OSSIface.UploadFileWithURL）
+func URLExpiry(ctx context.Context, def int64) int64 {
+	if seconds, ok := ctx.Value(urlExpiryKey{}).(int64); ok {
+		return seconds
+	}
+	return def
+}
@@ -0,0 +1,258 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/utils"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// GCSConfig Google Cloud Storage 客户端配置（OSS_BACKEND=gcs）。
+// 认证使用 Application Default Credentials：GOOGLE_APPLICATION_CREDENTIALS 指向的服务账号密钥，
+// 或运行在 GCP 上时的元数据服务器凭证。
+type GCSConfig struct {
+	URLMode   string
+	URLExpiry int64
+
+	ArchiveQuality int
+}
+
+// GCSClient 基于 cloud.google.com/go/storage 的 OSSIface 实现。
+// SSE、S3 存储类型与对象标签等 S3 特性不适用；加密与存储类型使用 bucket 的默认设置。
+type GCSClient struct {
+	client *storage.Client
+
+	urlMode        string
+	urlExpiry      int64
+	archiveQuality int
+}
+
+// NewGCSClient 创建 GCS 客户端
+func NewGCSClient(cfg GCSConfig) (*GCSClient, error) {
+	if err := ValidateURLMode(cfg.URLMode); err != nil {
+		return nil, err
+	}
+	urlExpiry := cfg.URLExpiry
+	if urlExpiry <= 0 {
+		urlExpiry = DefaultURLExpiry
+	}
+
+	// 与其它出站请求一样经 GENAI_HTTP_PROXY 访问 GCS：在使用代理的 Transport 上叠加 ADC 认证，
+	// 再以 WithHTTPClient 传入（storage 仍会读取 ADC 凭证用于 V4 签名）
+	ctx := context.Background()
+	transport, err := htransport.NewTransport(ctx, common.NewHTTPTransport(), option.WithScopes(storage.ScopeFullControl))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS transport: %w", err)
+	}
+	client, err := storage.NewClient(ctx, option.WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	return &GCSClient{
+		client:         client,
+		urlMode:        NormalizeURLMode(cfg.URLMode),
+		urlExpiry:      urlExpiry,
+		archiveQuality: cfg.ArchiveQuality,
+	}, nil
+}
+
+// UploadFile 上传文件到 GCS，返回文件路径（bucket/key）
+func (c *GCSClient) UploadFile(ctx context.Context, bucket, key string, reader io.Reader, contentType string) (string, error) {
+	contentType = NormalizeContentType(contentType)
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if c.archiveQuality > 0 {
+		compressed, ok, err := utils.CompressImage(body, contentType, c.archiveQuality)
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).WithField("key", key).Warn("Failed to compress image for GCS, uploading original")
+		} else if ok {
+			body = compressed
+		}
+	}
+
+	started := time.Now()
+	err = c.putObject(ctx, bucket, key, body, contentType)
+	elapsed := time.Since(started)
+	recordUpload(UploadBackendGCS, bucket, key, len(body), elapsed, err)
+	common.RecordTiming(ctx, common.StageUpload, elapsed)
+	recordHealth(ctx, "upload", err)
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"bucket": bucket,
+			"key":    key,
+		}).Error("Failed to upload file to GCS")
+		return "", fmt.Errorf("failed to upload file to GCS: %w", err)
+	}
+
+	filePath := fmt.Sprintf("%s/%s", bucket, key)
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"bucket":    bucket,
+		"key":       key,
+		"file_path": filePath,
+		"size":      len(body),
+	}).Info("File uploaded to GCS successfully")
+	return filePath, nil
+}
+
+// putObject 以一次请求写入对象；Writer 在 Close 时才提交，错误以 Close 的返回为准
+func (c *GCSClient) putObject(ctx context.Context, bucket, key string, body []byte, contentType string) error {
+	w := c.client.Bucket(bucket).Object(key).NewWriter(ctx)
+	w.ContentType = contentType
+	// 图片一般远小于默认的 16 MiB 分块，单次请求上传即可
+	w.ChunkSize = 0
+	if _, err := io.Copy(w, bytes.NewReader(body)); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// GetSignedURL 生成对象的 V4 签名 GET URL，expiresIn 为有效期（秒）。
+// 签名使用凭证中的服务账号私钥；凭证没有私钥时（如 GCE 元数据凭证）通过 IAM signBlob 签名，需要 iam.serviceAccounts.signBlob 权限。
+func (c *GCSClient) GetSignedURL(ctx context.Context, bucket, key string, expiresIn int64) (string, error) {
+	signedURL, err := c.client.Bucket(bucket).SignedURL(key, &storage.SignedURLOptions{
+		Scheme:  storage.SigningSchemeV4,
+		Method:  http.MethodGet,
+		Expires: time.Now().Add(time.Duration(expiresIn) * time.Second),
+	})
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"bucket": bucket,
+			"key":    key,
+		}).Error("Failed to sign GCS URL")
+		return "", fmt.Errorf("failed to generate signed URL: %w", err)
+	}
+	return signedURL, nil
+}
+
+// UploadFileWithURL 上传文件并返回访问 URL：expiresIn > 0 时两种模式都返回该有效期的 V4 签名 URL；
+// 否则 public 模式返回 storage.googleapis.com 下不带签名的对象 URL（需要 bucket 允许公开读），
+// signed 模式返回配置的默认有效期的 V4 签名 URL
+func (c *GCSClient) UploadFileWithURL(ctx context.Context, bucket, key string, reader io.Reader, contentType string, expiresIn int64) (string, error) {
+	if _, err := c.UploadFile(ctx, bucket, key, reader, contentType); err != nil {
+		return "", err
+	}
+	if c.urlMode != URLModeSigned && expiresIn <= 0 {
+		return c.ObjectURL(bucket, key), nil
+	}
+	if expiresIn <= 0 {
+		expiresIn = c.urlExpiry
+	}
+	return c.GetSignedURL(ctx, bucket, key, expiresIn)
+}
+
+// ListObjects 按 key 顺序分页列举 prefix 下的对象
+func (c *GCSClient) ListObjects(ctx context.Context, bucket, prefix, continuationToken string, maxKeys int32) (ListObjectsResult, error) {
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+	it := c.client.Bucket(bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+	var attrs []*storage.ObjectAttrs
+	nextToken, err := iterator.NewPager(it, int(maxKeys), continuationToken).NextPage(&attrs)
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"bucket": bucket,
+			"prefix": prefix,
+		}).Error("Failed to list GCS objects")
+		return ListObjectsResult{}, fmt.Errorf("failed to list objects under %q: %w", prefix, err)
+	}
+
+	result := ListObjectsResult{Objects: make([]ObjectInfo, 0, len(attrs)), NextContinuationToken: nextToken}
+	for _, obj := range attrs {
+		result.Objects = append(result.Objects, ObjectInfo{
+			Key:          obj.Name,
+			Size:         obj.Size,
+			LastModified: obj.Updated,
+		})
+	}
+	return result, nil
+}
+
+// DeleteFile 删除单个对象；对象不存在时不返回错误
+func (c *GCSClient) DeleteFile(ctx context.Context, bucket, key string) error {
+	err := c.client.Bucket(bucket).Object(key).Delete(ctx)
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"bucket": bucket,
+			"key":    key,
+		}).Error("Failed to delete GCS object")
+		return fmt.Errorf("failed to delete object %q: %w", key, err)
+	}
+
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"bucket": bucket,
+		"key":    key,
+	}).Debug("GCS object deleted")
+	return nil
+}
+
+// DeleteObjectsBefore 分页列举 prefix 下的对象，删除最后修改时间早于 cutoff 的对象，实现 ObjectCleaner 以支持 OSS 清理。
+// GCS 没有批量删除接口，以最多 Concurrency 个并发的单对象删除代替，BatchSize 为单页列举数量。
+func (c *GCSClient) DeleteObjectsBefore(ctx context.Context, bucket, prefix string, cutoff time.Time, opts CleanupOptions) (CleanupResult, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 || batchSize > MaxDeleteBatchSize {
+		batchSize = MaxDeleteBatchSize
+	}
+	concurrency := max(opts.Concurrency, 1)
+
+	var (
+		result CleanupResult
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+	)
+	sem := make(chan struct{}, concurrency)
+	token := ""
+	for {
+		page, err := c.ListObjects(ctx, bucket, prefix, token, int32(batchSize))
+		if err != nil {
+			wg.Wait()
+			return result, err
+		}
+		result.Scanned += len(page.Objects)
+		for _, obj := range page.Objects {
+			if !obj.LastModified.Before(cutoff) {
+				continue
+			}
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(key string) {
+				defer func() { <-sem; wg.Done() }()
+				err := c.DeleteFile(ctx, bucket, key)
+				mu.Lock()
+				if err != nil {
+					result.Failed++
+				} else {
+					result.Deleted++
+				}
+				mu.Unlock()
+			}(obj.Key)
+		}
+		if page.NextContinuationToken == "" {
+			break
+		}
+		token = page.NextContinuationToken
+	}
+	wg.Wait()
+	return result, nil
+}
+
+// ObjectURL 返回对象不带签名的公开 URL
+func (c *GCSClient) ObjectURL(bucket, key string) string {
+	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", bucket, (&url.URL{Path: key}).EscapedPath())
+}
@@ -3,8 +3,23 @@ package oss
 import (
 	"context"
 	"io"
+	"time"
 )
 
+// ObjectInfo 列举得到的单个对象信息
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// ListObjectsResult 一页对象列举结果
+type ListObjectsResult struct {
+	Objects []ObjectInfo
+	// NextContinuationToken 下一页的续传令牌，为空表示没有更多对象
+	NextContinuationToken string
+}
+
 // OSSIface OSS 客户端接口
 type OSSIface interface {
 	// UploadFile 上传文件到 OSS，返回文件路径
@@ -15,6 +30,17 @@ type OSSIface interface {
 	GetSignedURL(ctx context.Context, bucket, key string, expiresIn int64) (string, error)
 
 	// UploadFileWithURL 上传文件并返回 URL
-	// 这是一个便捷方法，结合了 UploadFile 和 GetSignedURL
+	// expiresIn > 0（调用方按请求指定，如 url_expiry_seconds）时结合 UploadFile 和 GetSignedURL，返回 expiresIn 秒后失效的预签名 URL；
+	// expiresIn <= 0 时按 URL 模式：public 模式（默认）返回不带签名、不会过期的对象 URL，
+	// signed 模式（OSS_URL_MODE=signed）返回配置的默认有效期（OSS_URL_EXPIRY_SECONDS）的预签名 URL
 	UploadFileWithURL(ctx context.Context, bucket, key string, reader io.Reader, contentType string, expiresIn int64) (string, error)
+
+	// ListObjects 分页列举 prefix 下的对象，continuationToken 为空时从头开始，maxKeys 为单页最大数量
+	ListObjects(ctx context.Context, bucket, prefix, continuationToken string, maxKeys int32) (ListObjectsResult, error)
+
+	// DeleteFile 删除单个对象；对象不存在时不返回错误
+	DeleteFile(ctx context.Context, bucket, key string) error
+
+	// ObjectURL 返回对象不带签名的访问 URL（与 public 模式上传后返回的 URL 格式一致）
+	ObjectURL(bucket, key string) string
 }
@@ -0,0 +1,216 @@
+package oss
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"genai-mcp/common"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// MaxDeleteBatchSize S3 DeleteObjects 单次请求允许的最大 key 数
+const MaxDeleteBatchSize = 1000
+
+// CleanupOptions 批量清理参数
+type CleanupOptions struct {
+	BatchSize   int // 每次 DeleteObjects 请求删除的最大 key 数（1-1000）
+	Concurrency int // 同时进行的 DeleteObjects 请求数
+}
+
+// CleanupResult 一次清理的统计结果
+type CleanupResult struct {
+	Scanned int // 列举到的对象数
+	Deleted int // 成功删除的对象数
+	Failed  int // 删除失败的对象数
+}
+
+// ObjectCleaner 支持按最后修改时间批量清理对象的 OSS 客户端（S3Client 实现）
+type ObjectCleaner interface {
+	DeleteObjectsBefore(ctx context.Context, bucket, prefix string, cutoff time.Time, opts CleanupOptions) (CleanupResult, error)
+}
+
+// DeleteObjectsBefore 分页列举 prefix 下的对象（ListObjectsV2），将最后修改时间早于 cutoff 的对象
+// 按 BatchSize 分批，以最多 Concurrency 个并发的 DeleteObjects 请求删除。
+// 单批删除失败不会中断清理，失败数计入结果；列举失败时返回已完成部分的统计与错误。
+func (c *S3Client) DeleteObjectsBefore(ctx context.Context, bucket, prefix string, cutoff time.Time, opts CleanupOptions) (CleanupResult, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 || batchSize > MaxDeleteBatchSize {
+		batchSize = MaxDeleteBatchSize
+	}
+	concurrency := max(opts.Concurrency, 1)
+
+	var (
+		mu     sync.Mutex
+		result CleanupResult
+		wg     sync.WaitGroup
+	)
+	batches := make(chan []types.ObjectIdentifier)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				deleted, failed := c.deleteBatch(ctx, bucket, batch)
+				mu.Lock()
+				result.Deleted += deleted
+				result.Failed += failed
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// send 将一批 key 交给删除 worker；context 取消时返回 false
+	send := func(batch []types.ObjectIdentifier) bool {
+		select {
+		case batches <- batch:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	var listErr error
+	scanned := 0
+	batch := make([]types.ObjectIdentifier, 0, batchSize)
+	paginator := s3.NewListObjectsV2Paginator(c.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			listErr = fmt.Errorf("failed to list objects under %q: %w", prefix, err)
+			break
+		}
+		for _, obj := range page.Contents {
+			scanned++
+			if obj.Key == nil || obj.LastModified == nil || !obj.LastModified.Before(cutoff) {
+				continue
+			}
+			batch = append(batch, types.ObjectIdentifier{Key: obj.Key})
+			if len(batch) == batchSize {
+				if !send(batch) {
+					listErr = ctx.Err()
+					break
+				}
+				batch = make([]types.ObjectIdentifier, 0, batchSize)
+			}
+		}
+		if listErr != nil {
+			break
+		}
+	}
+	if listErr == nil && len(batch) > 0 && !send(batch) {
+		listErr = ctx.Err()
+	}
+	close(batches)
+	wg.Wait()
+
+	result.Scanned = scanned
+	return result, listErr
+}
+
+// deleteBatch 以一次 DeleteObjects 请求删除一批对象（Quiet 模式只返回失败项），返回成功与失败数
+func (c *S3Client) deleteBatch(ctx context.Context, bucket string, batch []types.ObjectIdentifier) (deleted, failed int) {
+	out, err := c.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &types.Delete{
+			Objects: batch,
+			Quiet:   aws.Bool(true),
+		},
+	})
+	if err != nil {
+		common.WithError(err).WithFields(map[string]interface{}{
+			"bucket":     bucket,
+			"batch_size": len(batch),
+		}).Error("OSS janitor: DeleteObjects request failed")
+		return 0, len(batch)
+	}
+
+	if len(out.Errors) > 0 {
+		first := out.Errors[0]
+		common.WithFields(map[string]interface{}{
+			"bucket":     bucket,
+			"failed":     len(out.Errors),
+			"first_key":  aws.ToString(first.Key),
+			"first_code": aws.ToString(first.Code),
+		}).Warn("OSS janitor: some objects could not be deleted")
+	}
+	return len(batch) - len(out.Errors), len(out.Errors)
+}
+
+// JanitorConfig 定期清理过期生成结果的配置
+type JanitorConfig struct {
+	Bucket   string
+	Prefixes []string      // 只清理这些前缀下的对象（如 images/、archives/）
+	MaxAge   time.Duration // 最后修改时间早于 now-MaxAge 的对象会被删除
+	Interval time.Duration // 两次清理之间的间隔
+	CleanupOptions
+}
+
+// Janitor 定期删除 OSS 中过期的生成结果
+type Janitor struct {
+	cleaner ObjectCleaner
+	cfg     JanitorConfig
+}
+
+// NewJanitor 创建清理器；client 需支持批量清理（ObjectCleaner）
+func NewJanitor(client OSSIface, cfg JanitorConfig) (*Janitor, error) {
+	cleaner, ok := client.(ObjectCleaner)
+	if !ok {
+		return nil, fmt.Errorf("OSS client %T does not support object cleanup", client)
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("OSS janitor requires a bucket")
+	}
+	if len(cfg.Prefixes) == 0 {
+		return nil, fmt.Errorf("OSS janitor requires at least one prefix")
+	}
+	if cfg.MaxAge <= 0 || cfg.Interval <= 0 {
+		return nil, fmt.Errorf("OSS janitor max age and interval must be positive")
+	}
+	return &Janitor{cleaner: cleaner, cfg: cfg}, nil
+}
+
+// Run 立即执行一次清理，之后每隔 Interval 执行一次，直到 ctx 取消
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		j.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce 依次清理每个前缀下的过期对象并记录统计
+func (j *Janitor) RunOnce(ctx context.Context) {
+	cutoff := time.Now().Add(-j.cfg.MaxAge)
+	for _, prefix := range j.cfg.Prefixes {
+		started := time.Now()
+		result, err := j.cleaner.DeleteObjectsBefore(ctx, j.cfg.Bucket, prefix, cutoff, j.cfg.CleanupOptions)
+		entry := common.WithFields(map[string]interface{}{
+			"bucket":      j.cfg.Bucket,
+			"prefix":      prefix,
+			"cutoff":      cutoff.Format(time.RFC3339),
+			"scanned":     result.Scanned,
+			"deleted":     result.Deleted,
+			"failed":      result.Failed,
+			"duration_ms": time.Since(started).Milliseconds(),
+		})
+		if err != nil {
+			entry.WithError(err).Error("OSS janitor: cleanup failed")
+			continue
+		}
+		entry.Info("OSS janitor: cleanup finished")
+	}
+}
@@ -0,0 +1,274 @@
+package oss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/utils"
+)
+
+// LocalConfig 本地文件系统存储的配置（OSS_BACKEND=local）
+type LocalConfig struct {
+	// Dir 存放对象的根目录，对象 key 即相对该目录的路径
+	Dir string
+	// BaseURL 对象的 HTTP 访问前缀（OSS_LOCAL_BASE_URL），为空时返回 file:// URL
+	BaseURL string
+
+	ArchiveQuality int
+}
+
+// LocalStorage 将对象写入本地目录的 OSSIface 实现，供没有 S3 / OSS 的部署使用。
+// bucket 参数被忽略；SSE、存储类型、对象标签与签名 URL 等 S3 特性不适用。
+type LocalStorage struct {
+	dir            string
+	baseURL        string
+	archiveQuality int
+}
+
+// NewLocalStorage 创建本地存储，根目录不存在时自动创建
+func NewLocalStorage(cfg LocalConfig) (*LocalStorage, error) {
+	if strings.TrimSpace(cfg.Dir) == "" {
+		return nil, fmt.Errorf("local storage requires a directory")
+	}
+	dir, err := filepath.Abs(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve local storage directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create local storage directory: %w", err)
+	}
+	return &LocalStorage{
+		dir:            dir,
+		baseURL:        strings.TrimRight(cfg.BaseURL, "/"),
+		archiveQuality: cfg.ArchiveQuality,
+	}, nil
+}
+
+// filePath 返回 key 对应的本地路径；key 为空、为绝对路径或含有 .. 段时返回错误，避免读写根目录之外的文件
+func (c *LocalStorage) filePath(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", common.NewError(common.ErrCodeInvalidArgument, false, "invalid object key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." {
+			return "", common.NewError(common.ErrCodeInvalidArgument, false, "invalid object key %q", key)
+		}
+	}
+	return filepath.Join(c.dir, filepath.FromSlash(key)), nil
+}
+
+// UploadFile 将对象写入根目录下 key 对应的文件，按 key 中的路径（如 images/yyyy-MM-dd/）创建子目录，返回 key
+func (c *LocalStorage) UploadFile(ctx context.Context, bucket, key string, reader io.Reader, contentType string) (string, error) {
+	target, err := c.filePath(key)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if c.archiveQuality > 0 {
+		compressed, ok, err := utils.CompressImage(body, NormalizeContentType(contentType), c.archiveQuality)
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).WithField("key", key).Warn("Failed to compress image for local storage, writing original")
+		} else if ok {
+			body = compressed
+		}
+	}
+
+	started := time.Now()
+	err = writeFileAtomic(target, body)
+	elapsed := time.Since(started)
+	recordUpload(UploadBackendLocal, bucket, key, len(body), elapsed, err)
+	common.RecordTiming(ctx, common.StageUpload, elapsed)
+	recordHealth(ctx, "upload", err)
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithField("key", key).Error("Failed to write file to local storage")
+		return "", fmt.Errorf("failed to write %q to local storage: %w", key, err)
+	}
+
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"key":  key,
+		"path": target,
+		"size": len(body),
+	}).Info("File written to local storage successfully")
+	return key, nil
+}
+
+// writeFileAtomic 先写入同目录下的临时文件再重命名，避免静态文件路由读到写了一半的文件
+func writeFileAtomic(target string, body []byte) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// GetSignedURL 本地存储没有签名机制，返回与 ObjectURL 相同的 URL，忽略 expiresIn
+func (c *LocalStorage) GetSignedURL(ctx context.Context, bucket, key string, expiresIn int64) (string, error) {
+	if _, err := c.filePath(key); err != nil {
+		return "", err
+	}
+	return c.ObjectURL(bucket, key), nil
+}
+
+// UploadFileWithURL 写入文件并返回其 URL（OSS_LOCAL_BASE_URL 下的 HTTP URL，或 file:// URL），忽略 expiresIn
+func (c *LocalStorage) UploadFileWithURL(ctx context.Context, bucket, key string, reader io.Reader, contentType string, expiresIn int64) (string, error) {
+	if _, err := c.UploadFile(ctx, bucket, key, reader, contentType); err != nil {
+		return "", err
+	}
+	return c.ObjectURL(bucket, key), nil
+}
+
+// ListObjects 按 key 顺序列举 prefix 下的文件；continuationToken 为上一页最后一个 key
+func (c *LocalStorage) ListObjects(ctx context.Context, bucket, prefix, continuationToken string, maxKeys int32) (ListObjectsResult, error) {
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+	objects, err := c.walk(ctx, prefix)
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithField("prefix", prefix).Error("Failed to list local storage objects")
+		return ListObjectsResult{}, fmt.Errorf("failed to list objects under %q: %w", prefix, err)
+	}
+
+	start := 0
+	if continuationToken != "" {
+		start = sort.Search(len(objects), func(i int) bool { return objects[i].Key > continuationToken })
+	}
+	end := min(start+int(maxKeys), len(objects))
+	result := ListObjectsResult{Objects: objects[start:end]}
+	if end < len(objects) {
+		result.NextContinuationToken = objects[end-1].Key
+	}
+	return result, nil
+}
+
+// walk 返回 prefix 下全部文件（按 key 排序），跳过写入中的临时文件
+func (c *LocalStorage) walk(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	// 只遍历 prefix 所在的目录，避免每次列举都扫描整个根目录
+	root := c.dir
+	if dir := path.Dir(prefix + "x"); dir != "." {
+		walkRoot, err := c.filePath(dir)
+		if err != nil {
+			return nil, err
+		}
+		root = walkRoot
+	}
+
+	var objects []ObjectInfo
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == root {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(c.dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// DeleteFile 删除单个文件，并移除因此变空的上级目录（不会删除根目录）；文件不存在时不返回错误
+func (c *LocalStorage) DeleteFile(ctx context.Context, bucket, key string) error {
+	target, err := c.filePath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		common.WithRequestID(ctx).WithError(err).WithField("key", key).Error("Failed to delete local storage object")
+		return fmt.Errorf("failed to delete object %q: %w", key, err)
+	}
+	for dir := filepath.Dir(target); dir != c.dir && strings.HasPrefix(dir, c.dir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	common.WithRequestID(ctx).WithField("key", key).Debug("Local storage object deleted")
+	return nil
+}
+
+// DeleteObjectsBefore 删除 prefix 下最后修改时间早于 cutoff 的文件，实现 ObjectCleaner 以支持 OSS 清理。
+// 本地删除没有批量接口，opts 被忽略。
+func (c *LocalStorage) DeleteObjectsBefore(ctx context.Context, bucket, prefix string, cutoff time.Time, opts CleanupOptions) (CleanupResult, error) {
+	var result CleanupResult
+	objects, err := c.walk(ctx, prefix)
+	if err != nil {
+		return result, fmt.Errorf("failed to list objects under %q: %w", prefix, err)
+	}
+	result.Scanned = len(objects)
+	for _, obj := range objects {
+		if !obj.LastModified.Before(cutoff) {
+			continue
+		}
+		if err := c.DeleteFile(ctx, bucket, obj.Key); err != nil {
+			result.Failed++
+			continue
+		}
+		result.Deleted++
+	}
+	return result, nil
+}
+
+// ObjectURL 返回对象的访问 URL：配置了 OSS_LOCAL_BASE_URL 时为其下的 HTTP URL，否则为本地文件的 file:// URL
+func (c *LocalStorage) ObjectURL(bucket, key string) string {
+	if c.baseURL != "" {
+		return c.baseURL + "/" + (&url.URL{Path: key}).EscapedPath()
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(c.dir, filepath.FromSlash(key)))}).String()
+}
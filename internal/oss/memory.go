@@ -0,0 +1,275 @@
+package oss
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"genai-mcp/common"
+)
+
+// ImageEndpointPath 内存存储（OSS_BACKEND=memory）的对象由本服务在该路径下提供：GET /image/{id}
+const ImageEndpointPath = "/image/"
+
+// MemoryConfig 内存存储的配置（OSS_BACKEND=memory）
+type MemoryConfig struct {
+	// BaseURL 本服务对客户端可见的地址（OSS_MEMORY_BASE_URL），结果 URL 为 BaseURL + /image/{id}
+	BaseURL string
+	// MaxBytes 缓存的总字节数上限，超出时淘汰最久未访问的对象
+	MaxBytes int64
+	// TTL 对象的保留时长，过期后不再提供
+	TTL time.Duration
+}
+
+// memoryObject 内存存储中的单个对象
+type memoryObject struct {
+	id          string
+	key         string
+	data        []byte
+	contentType string
+	created     time.Time
+	elem        *list.Element
+}
+
+// MemoryStore 将对象保存在进程内存中的 OSSIface 实现：url 输出返回本服务 /image/{id} 的 URL，
+// 浏览器可直接加载原始图片字节，不需要外部对象存储。对象在 TTL 后过期、超出总大小时按 LRU 淘汰，服务重启后全部丢失。
+// bucket 参数被忽略；对象 id 为 key 的文件名部分（如 {uuid_timestamp_random}.png），同名对象互相覆盖。
+type MemoryStore struct {
+	mu sync.Mutex
+	// 配置可在重新加载时由 Reconfigure 修改，读写均需持有 mu
+	baseURL  string
+	maxBytes int64
+	ttl      time.Duration
+
+	objects map[string]*memoryObject
+	lru     *list.List // 队首为最近访问的对象
+	size    int64
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore(cfg MemoryConfig) (*MemoryStore, error) {
+	if cfg.MaxBytes <= 0 || cfg.TTL <= 0 {
+		return nil, fmt.Errorf("memory storage requires a positive size limit and TTL")
+	}
+	return &MemoryStore{
+		baseURL:  strings.TrimRight(cfg.BaseURL, "/"),
+		maxBytes: cfg.MaxBytes,
+		ttl:      cfg.TTL,
+		objects:  make(map[string]*memoryObject),
+		lru:      list.New(),
+	}, nil
+}
+
+// Reconfigure 应用新的 URL 前缀、大小上限与 TTL（如 reload_provider 之后），已缓存的对象保留，
+// 按新的上限与 TTL 立即淘汰；之后生成的 URL 使用新前缀
+func (c *MemoryStore) Reconfigure(cfg MemoryConfig) error {
+	if cfg.MaxBytes <= 0 || cfg.TTL <= 0 {
+		return fmt.Errorf("memory storage requires a positive size limit and TTL")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.baseURL = strings.TrimRight(cfg.BaseURL, "/")
+	c.maxBytes = cfg.MaxBytes
+	c.ttl = cfg.TTL
+	c.evictLocked()
+	return nil
+}
+
+// objectID 返回 key 对应的对象 id（文件名部分）
+func objectID(key string) string {
+	return path.Base(key)
+}
+
+// UploadFile 保存对象，返回 key；单个对象超过总大小上限时返回错误
+func (c *MemoryStore) UploadFile(ctx context.Context, bucket, key string, reader io.Reader, contentType string) (string, error) {
+	if key == "" || strings.HasSuffix(key, "/") {
+		return "", common.NewError(common.ErrCodeInvalidArgument, false, "invalid object key %q", key)
+	}
+	started := time.Now()
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	c.mu.Lock()
+	if int64(len(body)) > c.maxBytes {
+		c.mu.Unlock()
+		return "", fmt.Errorf("object %q is %d bytes, larger than the memory storage limit of %d bytes (OSS_MEMORY_MAX_MB)", key, len(body), c.maxBytes)
+	}
+	c.removeLocked(objectID(key))
+	obj := &memoryObject{
+		id:          objectID(key),
+		key:         key,
+		data:        body,
+		contentType: NormalizeContentType(contentType),
+		created:     time.Now(),
+	}
+	obj.elem = c.lru.PushFront(obj)
+	c.objects[obj.id] = obj
+	c.size += int64(len(body))
+	evicted := c.evictLocked()
+	c.mu.Unlock()
+
+	elapsed := time.Since(started)
+	recordUpload(UploadBackendMemory, bucket, key, len(body), elapsed, nil)
+	common.RecordTiming(ctx, common.StageUpload, elapsed)
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"key":     key,
+		"id":      obj.id,
+		"size":    len(body),
+		"evicted": evicted,
+	}).Info("File stored in memory storage successfully")
+	return key, nil
+}
+
+// evictLocked 删除过期对象，并按 LRU 淘汰对象直到总大小不超过上限，返回淘汰数；调用方需持有锁
+func (c *MemoryStore) evictLocked() int {
+	evicted := 0
+	now := time.Now()
+	for e := c.lru.Back(); e != nil; {
+		prev := e.Prev()
+		obj := e.Value.(*memoryObject)
+		if c.size > c.maxBytes || now.Sub(obj.created) > c.ttl {
+			c.removeLocked(obj.id)
+			evicted++
+		}
+		e = prev
+	}
+	return evicted
+}
+
+// removeLocked 删除对象；调用方需持有锁
+func (c *MemoryStore) removeLocked(id string) {
+	obj, ok := c.objects[id]
+	if !ok {
+		return
+	}
+	c.lru.Remove(obj.elem)
+	delete(c.objects, id)
+	c.size -= int64(len(obj.data))
+}
+
+// Get 返回 id 对应的未过期对象及其 Content-Type 与保存时间，供 /image/{id} 接口使用
+func (c *MemoryStore) Get(id string) ([]byte, string, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	obj, ok := c.objects[id]
+	if !ok {
+		return nil, "", time.Time{}, false
+	}
+	if time.Since(obj.created) > c.ttl {
+		c.removeLocked(id)
+		return nil, "", time.Time{}, false
+	}
+	c.lru.MoveToFront(obj.elem)
+	return obj.data, obj.contentType, obj.created, true
+}
+
+// ReadURL 按本存储生成的 URL（BaseURL + /image/{id}）读取未过期的对象，实现 utils.LocalImageReader，
+// 使本服务读取自己的结果图片时不经网络下载；不是本存储的 URL 或对象不存在时返回 false
+func (c *MemoryStore) ReadURL(rawURL string) ([]byte, string, bool) {
+	c.mu.Lock()
+	prefix := c.baseURL + ImageEndpointPath
+	c.mu.Unlock()
+
+	escaped, ok := strings.CutPrefix(rawURL, prefix)
+	if !ok {
+		return nil, "", false
+	}
+	id, err := url.PathUnescape(escaped)
+	if err != nil || id == "" || strings.Contains(id, "/") {
+		return nil, "", false
+	}
+	data, contentType, _, ok := c.Get(id)
+	return data, contentType, ok
+}
+
+// TTL 返回对象的保留时长
+func (c *MemoryStore) TTL() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ttl
+}
+
+// GetSignedURL 内存存储没有签名机制，返回与 ObjectURL 相同的 URL，忽略 expiresIn（对象在 TTL 后过期）
+func (c *MemoryStore) GetSignedURL(ctx context.Context, bucket, key string, expiresIn int64) (string, error) {
+	return c.ObjectURL(bucket, key), nil
+}
+
+// UploadFileWithURL 保存对象并返回 /image/{id} 的 URL，忽略 expiresIn
+func (c *MemoryStore) UploadFileWithURL(ctx context.Context, bucket, key string, reader io.Reader, contentType string, expiresIn int64) (string, error) {
+	if _, err := c.UploadFile(ctx, bucket, key, reader, contentType); err != nil {
+		return "", err
+	}
+	return c.ObjectURL(bucket, key), nil
+}
+
+// ListObjects 按 key 顺序列举 prefix 下未过期的对象；continuationToken 为上一页最后一个 key
+func (c *MemoryStore) ListObjects(ctx context.Context, bucket, prefix, continuationToken string, maxKeys int32) (ListObjectsResult, error) {
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+	c.mu.Lock()
+	c.evictLocked()
+	objects := make([]ObjectInfo, 0, len(c.objects))
+	for _, obj := range c.objects {
+		if strings.HasPrefix(obj.key, prefix) && (continuationToken == "" || obj.key > continuationToken) {
+			objects = append(objects, ObjectInfo{Key: obj.key, Size: int64(len(obj.data)), LastModified: obj.created})
+		}
+	}
+	c.mu.Unlock()
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	result := ListObjectsResult{Objects: objects}
+	if len(objects) > int(maxKeys) {
+		result.Objects = objects[:maxKeys]
+		result.NextContinuationToken = objects[maxKeys-1].Key
+	}
+	return result, nil
+}
+
+// DeleteFile 删除对象；对象不存在时不返回错误
+func (c *MemoryStore) DeleteFile(ctx context.Context, bucket, key string) error {
+	c.mu.Lock()
+	if obj, ok := c.objects[objectID(key)]; ok && obj.key == key {
+		c.removeLocked(obj.id)
+	}
+	c.mu.Unlock()
+
+	common.WithRequestID(ctx).WithField("key", key).Debug("Memory storage object deleted")
+	return nil
+}
+
+// ObjectURL 返回对象在本服务 /image/{id} 接口的 URL
+func (c *MemoryStore) ObjectURL(bucket, key string) string {
+	c.mu.Lock()
+	baseURL := c.baseURL
+	c.mu.Unlock()
+	return baseURL + ImageEndpointPath + url.PathEscape(objectID(key))
+}
+
+// DeleteObjectsBefore 删除 prefix 下保存时间早于 cutoff 的对象，实现 ObjectCleaner 以支持 OSS 清理；opts 被忽略
+func (c *MemoryStore) DeleteObjectsBefore(ctx context.Context, bucket, prefix string, cutoff time.Time, opts CleanupOptions) (CleanupResult, error) {
+	var result CleanupResult
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, obj := range c.objects {
+		if !strings.HasPrefix(obj.key, prefix) {
+			continue
+		}
+		result.Scanned++
+		if obj.created.Before(cutoff) {
+			c.removeLocked(id)
+			result.Deleted++
+		}
+	}
+	return result, nil
+}
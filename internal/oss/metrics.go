@@ -0,0 +1,81 @@
+package oss
+
+import (
+	"sync"
+	"time"
+
+	"genai-mcp/common"
+)
+
+// 上传方式标签：阿里云 OSS 使用预签名 PUT，其它 S3 兼容服务使用 SDK PutObject，两者性能差异较大；
+// OSS_BACKEND=local / gcs 时分别写入本地目录与 Google Cloud Storage
+const (
+	UploadBackendPresigned = "presigned"
+	UploadBackendSDK       = "sdk"
+	UploadBackendLocal     = "local"
+	UploadBackendGCS       = "gcs"
+	UploadBackendMemory    = "memory"
+)
+
+// UploadStats 某种上传方式的累计上传统计
+type UploadStats struct {
+	Uploads  int64         // 成功上传次数
+	Failures int64         // 失败次数
+	Bytes    int64         // 成功上传的总字节数
+	Duration time.Duration // 成功上传的总耗时
+}
+
+var (
+	uploadStatsMu sync.Mutex
+	uploadStats   = map[string]*UploadStats{}
+)
+
+// UploadStatsSnapshot 返回各上传方式累计统计的副本，键为上传方式标签
+func UploadStatsSnapshot() map[string]UploadStats {
+	uploadStatsMu.Lock()
+	defer uploadStatsMu.Unlock()
+
+	snapshot := make(map[string]UploadStats, len(uploadStats))
+	for backend, stats := range uploadStats {
+		snapshot[backend] = *stats
+	}
+	return snapshot
+}
+
+// recordUpload 记录一次上传的字节数与耗时，并以结构化 debug 日志输出本次与累计的吞吐量
+func recordUpload(backend, bucket, key string, size int, elapsed time.Duration, err error) {
+	uploadStatsMu.Lock()
+	stats, ok := uploadStats[backend]
+	if !ok {
+		stats = &UploadStats{}
+		uploadStats[backend] = stats
+	}
+	if err != nil {
+		stats.Failures++
+	} else {
+		stats.Uploads++
+		stats.Bytes += int64(size)
+		stats.Duration += elapsed
+	}
+	total := *stats
+	uploadStatsMu.Unlock()
+
+	fields := map[string]interface{}{
+		"backend":        backend,
+		"bucket":         bucket,
+		"key":            key,
+		"bytes":          size,
+		"duration_ms":    elapsed.Milliseconds(),
+		"success":        err == nil,
+		"total_uploads":  total.Uploads,
+		"total_failures": total.Failures,
+		"total_bytes":    total.Bytes,
+	}
+	if err == nil && elapsed > 0 {
+		fields["throughput_kbps"] = float64(size) / 1024 / elapsed.Seconds()
+	}
+	if total.Duration > 0 {
+		fields["avg_throughput_kbps"] = float64(total.Bytes) / 1024 / total.Duration.Seconds()
+	}
+	common.WithFields(fields).Debug("OSS upload metrics")
+}
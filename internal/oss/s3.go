@@ -5,15 +5,18 @@ import (
 	"context"
 	"fmt"
 	"genai-mcp/common"
+	"genai-mcp/internal/utils"
 	"io"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 // S3Client S3 兼容的 OSS 客户端实现
@@ -23,6 +26,17 @@ type S3Client struct {
 	region    string
 	accessKey string
 	secretKey string
+	// 服务端加密设置（为空表示不显式指定）
+	sse         string
+	sseKMSKeyID string
+	// 上传对象的存储类型（为空表示使用 bucket 默认存储类型）
+	storageClass string
+	// UploadFileWithURL 返回的 URL 形式（public / signed）
+	urlMode string
+	// signed 模式下调用方未指定有效期时使用的默认有效期（秒）
+	urlExpiry int64
+	// 上传图片的存储压缩质量，0 表示不压缩
+	archiveQuality int
 }
 
 // S3Config S3 客户端配置
@@ -31,13 +45,66 @@ type S3Config struct {
 	Region    string // 区域，例如：us-east-1 或 cn-hangzhou
 	AccessKey string // Access Key ID
 	SecretKey string // Secret Access Key
+	// 服务端加密（可选）：AES256（SSE-S3）或 aws:kms（SSE-KMS），为空时不显式指定
+	SSE         string
+	SSEKMSKeyID string // SSE-KMS 使用的 KMS Key ID，仅在 SSE=aws:kms 时有效；为空使用默认 KMS key
+	// 存储类型（可选）：如 STANDARD_IA、GLACIER_IR，可用值取决于后端，为空时使用 bucket 默认存储类型
+	StorageClass string
+	// 上传后返回的 URL 形式（可选）：public（默认，不带签名）或 signed（预签名 URL）
+	URLMode string
+	// signed 模式下的默认 URL 有效期（秒），<= 0 时使用 DefaultURLExpiry
+	URLExpiry int64
+	// 存储压缩（可选）：JPEG 按该质量（1-100）重编码，PNG 无损最高压缩后再上传，0 表示原样上传
+	ArchiveQuality int
+}
+
+// 支持的服务端加密方式
+const (
+	SSEAES256 = "AES256"
+	SSEKMS    = "aws:kms"
+)
+
+// ValidateSSE 校验服务端加密配置组合是否合法
+func ValidateSSE(sse, kmsKeyID string) error {
+	switch sse {
+	case "":
+		if kmsKeyID != "" {
+			return fmt.Errorf("OSS_SSE_KMS_KEY_ID requires OSS_SSE=%s", SSEKMS)
+		}
+	case SSEAES256:
+		if kmsKeyID != "" {
+			return fmt.Errorf("OSS_SSE_KMS_KEY_ID is only valid with OSS_SSE=%s, got %s", SSEKMS, sse)
+		}
+	case SSEKMS:
+	default:
+		return fmt.Errorf("unsupported OSS_SSE %q: expected %s or %s", sse, SSEAES256, SSEKMS)
+	}
+	return nil
 }
 
 // NewS3Client 创建新的 S3 客户端
 func NewS3Client(cfg S3Config) (*S3Client, error) {
+	if err := ValidateSSE(cfg.SSE, cfg.SSEKMSKeyID); err != nil {
+		return nil, err
+	}
+	if err := ValidateStorageClass(cfg.Endpoint, cfg.StorageClass); err != nil {
+		return nil, err
+	}
+	if err := ValidateURLMode(cfg.URLMode); err != nil {
+		return nil, err
+	}
+	urlExpiry := cfg.URLExpiry
+	if urlExpiry <= 0 {
+		urlExpiry = DefaultURLExpiry
+	}
+
 	// 构建 AWS 配置选项
 	opts := []func(*config.LoadOptions) error{
 		config.WithRegion(cfg.Region),
+		// SDK 请求同样按 GENAI_HTTP_PROXY / GENAI_NO_PROXY 使用代理
+		config.WithHTTPClient(awshttp.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
+			t.Proxy = common.HTTPProxy
+		})),
 		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
 			cfg.AccessKey,
 			cfg.SecretKey,
@@ -70,17 +137,27 @@ func NewS3Client(cfg S3Config) (*S3Client, error) {
 	})
 
 	return &S3Client{
-		client:    client,
-		endpoint:  cfg.Endpoint,
-		region:    cfg.Region,
-		accessKey: cfg.AccessKey,
-		secretKey: cfg.SecretKey,
+		client:      client,
+		endpoint:    cfg.Endpoint,
+		region:      cfg.Region,
+		accessKey:   cfg.AccessKey,
+		secretKey:   cfg.SecretKey,
+		sse:         cfg.SSE,
+		sseKMSKeyID: cfg.SSEKMSKeyID,
+
+		storageClass:   NormalizeStorageClass(cfg.StorageClass),
+		urlMode:        NormalizeURLMode(cfg.URLMode),
+		urlExpiry:      urlExpiry,
+		archiveQuality: cfg.ArchiveQuality,
 	}, nil
 }
 
 // UploadFile 上传文件到 OSS
 func (c *S3Client) UploadFile(ctx context.Context, bucket, key string, reader io.Reader, contentType string) (string, error) {
-	common.WithFields(map[string]interface{}{
+	// 规范化 Content-Type（如 image/jpg → image/jpeg），避免 CDN / 浏览器处理非规范 MIME 类型时出现问题
+	contentType = NormalizeContentType(contentType)
+
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"bucket":       bucket,
 		"key":          key,
 		"content_type": contentType,
@@ -89,126 +166,189 @@ func (c *S3Client) UploadFile(ctx context.Context, bucket, key string, reader io
 	// 读取文件内容
 	body, err := io.ReadAll(reader)
 	if err != nil {
-		common.WithError(err).WithFields(map[string]interface{}{
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
 			"bucket": bucket,
 			"key":    key,
 		}).Error("Failed to read file for upload")
 		return "", fmt.Errorf("failed to read file: %w", err)
 	}
 
-	// 构建上传参数
-	// 对于阿里云 OSS 等部分 S3 兼容服务，直接使用 SDK 的 PutObject
-	// 会采用 aws-chunked 流式编码，导致
-	// "aws-chunked encoding is not supported with the specified x-amz-content-sha256 value"
-	// 这里改为：使用预签名的 PUT URL + 原生 HTTP 客户端上传，完全避开 aws-chunked。
-
-	if strings.Contains(c.endpoint, ".aliyuncs.com") {
-		common.WithFields(map[string]interface{}{
-			"bucket": bucket,
-			"key":    key,
-		}).Debug("Using presigned PUT URL upload for Aliyun OSS")
-
-		presignClient := s3.NewPresignClient(c.client)
-
-		// 生成预签名 PUT URL
-		reqCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
-		defer cancel()
-
-		presigned, err := presignClient.PresignPutObject(reqCtx, &s3.PutObjectInput{
-			Bucket:      aws.String(bucket),
-			Key:         aws.String(key),
-			ContentType: aws.String(contentType),
-		})
+	// 开启存储压缩时重新编码图片（保持格式，变小时才替换），失败时原样上传
+	if c.archiveQuality > 0 {
+		compressed, ok, err := utils.CompressImage(body, contentType, c.archiveQuality)
 		if err != nil {
-			common.WithError(err).WithFields(map[string]interface{}{
-				"bucket": bucket,
-				"key":    key,
-			}).Error("Failed to presign PUT URL for OSS upload")
-			return "", fmt.Errorf("failed to presign PUT URL: %w", err)
-		}
-
-		// 使用预签名 URL 进行 HTTP PUT 上传（标准 Content-Length，无 aws-chunked）
-		req, err := http.NewRequestWithContext(reqCtx, http.MethodPut, presigned.URL, bytes.NewReader(body))
-		if err != nil {
-			common.WithError(err).WithFields(map[string]interface{}{
-				"bucket": bucket,
-				"key":    key,
-			}).Error("Failed to create HTTP request for OSS upload")
-			return "", fmt.Errorf("failed to create HTTP request: %w", err)
-		}
-
-		// 设置预签名头部
-		for k, v := range presigned.SignedHeader {
-			for _, hv := range v {
-				req.Header.Add(k, hv)
-			}
-		}
-
-		// 确保 Content-Type 正确设置（如预签名中未包含）
-		if contentType != "" && req.Header.Get("Content-Type") == "" {
-			req.Header.Set("Content-Type", contentType)
-		}
-
-		httpClient := &http.Client{
-			Timeout: 60 * time.Second,
+			common.WithRequestID(ctx).WithError(err).WithField("key", key).Warn("Failed to compress image for OSS, uploading original")
+		} else if ok {
+			common.WithRequestID(ctx).WithFields(map[string]interface{}{
+				"key":             key,
+				"original_size":   len(body),
+				"compressed_size": len(compressed),
+				"quality":         c.archiveQuality,
+			}).Debug("Compressed image for OSS storage")
+			body = compressed
 		}
+	}
 
-		resp, err := httpClient.Do(req)
-		if err != nil {
-			common.WithError(err).WithFields(map[string]interface{}{
-				"bucket": bucket,
-				"key":    key,
-			}).Error("Failed to upload file to OSS via presigned PUT")
-			return "", fmt.Errorf("failed to upload file via presigned PUT: %w", err)
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-			common.WithFields(map[string]interface{}{
-				"bucket":      bucket,
-				"key":         key,
-				"status_code": resp.StatusCode,
-				"body":        string(respBody),
-			}).Error("OSS presigned PUT upload returned non-2xx status")
-			return "", fmt.Errorf("OSS upload failed: status code %d, body: %s", resp.StatusCode, string(respBody))
-		}
-	} else {
-		// 标准 S3 或其他兼容服务：使用 SDK 的 PutObject
-		input := &s3.PutObjectInput{
-			Bucket:      aws.String(bucket),
-			Key:         aws.String(key),
-			Body:        bytes.NewReader(body),
-			ContentType: aws.String(contentType),
-		}
+	// 按 endpoint 选择上传方式，并记录字节数与耗时（两种方式性能差异较大，分别统计）
+	backend, put := UploadBackendSDK, c.putObjectSDK
+	if strings.Contains(c.endpoint, ".aliyuncs.com") {
+		backend, put = UploadBackendPresigned, c.putObjectPresigned
+	}
 
-		// 执行上传
-		_, err = c.client.PutObject(ctx, input)
-		if err != nil {
-			common.WithError(err).WithFields(map[string]interface{}{
-				"bucket": bucket,
-				"key":    key,
-				"size":   len(body),
-			}).Error("Failed to upload file to OSS")
-			return "", fmt.Errorf("failed to upload file: %w", err)
-		}
+	started := time.Now()
+	err = put(ctx, bucket, key, body, contentType)
+	elapsed := time.Since(started)
+	recordUpload(backend, bucket, key, len(body), elapsed, err)
+	common.RecordTiming(ctx, common.StageUpload, elapsed)
+	recordHealth(ctx, "upload", err)
+	if err != nil {
+		return "", err
 	}
 
 	filePath := fmt.Sprintf("%s/%s", bucket, key)
-	common.WithFields(map[string]interface{}{
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"bucket":    bucket,
 		"key":       key,
 		"file_path": filePath,
 		"size":      len(body),
+		"backend":   backend,
 	}).Info("File uploaded to OSS successfully")
 
 	// 返回文件路径（格式：bucket/key）
 	return filePath, nil
 }
 
+// presignedHTTPClient 预签名 PUT 上传使用的 HTTP 客户端（按 GENAI_HTTP_PROXY 使用代理）
+var presignedHTTPClient = common.NewHTTPClient(60 * time.Second)
+
+// putObjectPresigned 使用预签名 PUT URL + 原生 HTTP 客户端上传（阿里云 OSS）。
+// 对于阿里云 OSS 等部分 S3 兼容服务，直接使用 SDK 的 PutObject 会采用 aws-chunked 流式编码，导致
+// "aws-chunked encoding is not supported with the specified x-amz-content-sha256 value"，
+// 预签名 PUT 使用标准 Content-Length 上传，完全避开 aws-chunked。
+func (c *S3Client) putObjectPresigned(ctx context.Context, bucket, key string, body []byte, contentType string) error {
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"bucket": bucket,
+		"key":    key,
+	}).Debug("Using presigned PUT URL upload for Aliyun OSS")
+
+	presignClient := s3.NewPresignClient(c.client)
+
+	// 生成预签名 PUT URL
+	reqCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	// SSE、存储类型与对象标签头会包含在预签名的 SignedHeader 中，上传时一并发送
+	presignInput := &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	}
+	c.applySSE(presignInput)
+	c.applyStorageClass(presignInput)
+	applyTagging(ctx, presignInput)
+
+	presigned, err := presignClient.PresignPutObject(reqCtx, presignInput)
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"bucket": bucket,
+			"key":    key,
+		}).Error("Failed to presign PUT URL for OSS upload")
+		return fmt.Errorf("failed to presign PUT URL: %w", err)
+	}
+
+	// 使用预签名 URL 进行 HTTP PUT 上传（标准 Content-Length，无 aws-chunked）
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPut, presigned.URL, bytes.NewReader(body))
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"bucket": bucket,
+			"key":    key,
+		}).Error("Failed to create HTTP request for OSS upload")
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	// 设置预签名头部
+	for k, v := range presigned.SignedHeader {
+		for _, hv := range v {
+			req.Header.Add(k, hv)
+		}
+	}
+
+	// 确保 Content-Type 正确设置（如预签名中未包含）
+	if contentType != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := presignedHTTPClient.Do(req)
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"bucket": bucket,
+			"key":    key,
+		}).Error("Failed to upload file to OSS via presigned PUT")
+		return fmt.Errorf("failed to upload file via presigned PUT: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"bucket":      bucket,
+			"key":         key,
+			"status_code": resp.StatusCode,
+			"body":        string(respBody),
+		}).Error("OSS presigned PUT upload returned non-2xx status")
+		return fmt.Errorf("OSS upload failed: status code %d, body: %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
+
+// putObjectSDK 使用 SDK 的 PutObject 上传（标准 S3 或其他兼容服务）
+func (c *S3Client) putObjectSDK(ctx context.Context, bucket, key string, body []byte, contentType string) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(contentType),
+	}
+	c.applySSE(input)
+	c.applyStorageClass(input)
+	applyTagging(ctx, input)
+
+	// 执行上传
+	_, err := c.client.PutObject(ctx, input)
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"bucket": bucket,
+			"key":    key,
+			"size":   len(body),
+		}).Error("Failed to upload file to OSS")
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	return nil
+}
+
+// applySSE 按配置在上传参数中设置服务端加密
+func (c *S3Client) applySSE(input *s3.PutObjectInput) {
+	if c.sse == "" {
+		return
+	}
+	input.ServerSideEncryption = types.ServerSideEncryption(c.sse)
+	if c.sse == SSEKMS && c.sseKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(c.sseKMSKeyID)
+	}
+}
+
+// applyTagging 在上传参数中设置对象标签（全局标签 + context 中的按操作标签）
+func applyTagging(ctx context.Context, input *s3.PutObjectInput) {
+	if tagging := objectTagging(ctx); tagging != "" {
+		input.Tagging = aws.String(tagging)
+	}
+}
+
 // GetSignedURL 获取文件的带签名 URL
 func (c *S3Client) GetSignedURL(ctx context.Context, bucket, key string, expiresIn int64) (string, error) {
-	common.WithFields(map[string]interface{}{
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"bucket":     bucket,
 		"key":        key,
 		"expires_in": expiresIn,
@@ -224,14 +364,14 @@ func (c *S3Client) GetSignedURL(ctx context.Context, bucket, key string, expires
 	})
 
 	if err != nil {
-		common.WithError(err).WithFields(map[string]interface{}{
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
 			"bucket": bucket,
 			"key":    key,
 		}).Error("Failed to generate signed URL")
 		return "", fmt.Errorf("failed to presign URL: %w", err)
 	}
 
-	common.WithFields(map[string]interface{}{
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
 		"bucket": bucket,
 		"key":    key,
 	}).Debug("Signed URL generated successfully")
@@ -239,7 +379,8 @@ func (c *S3Client) GetSignedURL(ctx context.Context, bucket, key string, expires
 	return request.URL, nil
 }
 
-// 上传文件并返回 URL（不再返回带签名 URL）
+// UploadFileWithURL 上传文件并返回访问 URL：expiresIn > 0（如 url_expiry_seconds）时两种模式都返回该有效期的预签名 URL；
+// 否则 public 模式返回不带签名、不会过期的对象 URL，signed 模式返回配置的默认有效期的预签名 URL
 func (c *S3Client) UploadFileWithURL(ctx context.Context, bucket, key string, reader io.Reader, contentType string, expiresIn int64) (string, error) {
 	// 先上传文件
 	_, err := c.UploadFile(ctx, bucket, key, reader, contentType)
@@ -247,8 +388,76 @@ func (c *S3Client) UploadFileWithURL(ctx context.Context, bucket, key string, re
 		return "", err
 	}
 
-	// 返回对象的普通访问 URL（非签名）
-	return c.buildObjectURL(bucket, key), nil
+	if c.urlMode != URLModeSigned && expiresIn <= 0 {
+		// 返回对象的普通访问 URL（非签名）
+		return c.buildObjectURL(bucket, key), nil
+	}
+	if expiresIn <= 0 {
+		expiresIn = c.urlExpiry
+	}
+	return c.GetSignedURL(ctx, bucket, key, expiresIn)
+}
+
+// ListObjects 以 ListObjectsV2 分页列举 prefix 下的对象
+func (c *S3Client) ListObjects(ctx context.Context, bucket, prefix, continuationToken string, maxKeys int32) (ListObjectsResult, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}
+	if continuationToken != "" {
+		input.ContinuationToken = aws.String(continuationToken)
+	}
+	if maxKeys > 0 {
+		input.MaxKeys = aws.Int32(maxKeys)
+	}
+
+	out, err := c.client.ListObjectsV2(ctx, input)
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"bucket": bucket,
+			"prefix": prefix,
+		}).Error("Failed to list OSS objects")
+		return ListObjectsResult{}, fmt.Errorf("failed to list objects under %q: %w", prefix, err)
+	}
+
+	result := ListObjectsResult{Objects: make([]ObjectInfo, 0, len(out.Contents))}
+	for _, obj := range out.Contents {
+		result.Objects = append(result.Objects, ObjectInfo{
+			Key:          aws.ToString(obj.Key),
+			Size:         aws.ToInt64(obj.Size),
+			LastModified: aws.ToTime(obj.LastModified),
+		})
+	}
+	if aws.ToBool(out.IsTruncated) {
+		result.NextContinuationToken = aws.ToString(out.NextContinuationToken)
+	}
+	return result, nil
+}
+
+// DeleteFile 删除单个对象（S3 对不存在的 key 同样返回成功）
+func (c *S3Client) DeleteFile(ctx context.Context, bucket, key string) error {
+	_, err := c.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"bucket": bucket,
+			"key":    key,
+		}).Error("Failed to delete OSS object")
+		return fmt.Errorf("failed to delete object %q: %w", key, err)
+	}
+
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"bucket": bucket,
+		"key":    key,
+	}).Debug("OSS object deleted")
+	return nil
+}
+
+// ObjectURL 返回对象的公开访问 URL
+func (c *S3Client) ObjectURL(bucket, key string) string {
+	return c.buildObjectURL(bucket, key)
 }
 
 // buildObjectURL 构造对象的公开 URL（不带签名）
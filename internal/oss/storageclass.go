@@ -0,0 +1,66 @@
+package oss
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// 各后端通过 S3 兼容接口（x-amz-storage-class）接受的存储类型
+var (
+	// aliyunStorageClasses 阿里云 OSS：标准、低频访问、归档
+	aliyunStorageClasses = []string{"STANDARD", "STANDARD_IA", "GLACIER"}
+	// tencentStorageClasses 腾讯云 COS：标准、低频、智能分层、归档、深度归档及多 AZ 版本
+	tencentStorageClasses = []string{
+		"STANDARD", "STANDARD_IA", "INTELLIGENT_TIERING", "ARCHIVE", "DEEP_ARCHIVE",
+		"MAZ_STANDARD", "MAZ_STANDARD_IA", "MAZ_INTELLIGENT_TIERING",
+	}
+)
+
+// storageClassBackend 根据端点判断存储后端名称及其支持的存储类型；
+// AWS S3 与其它 S3 兼容服务（MinIO 等）使用 S3 的存储类型列表
+func storageClassBackend(endpoint string) (string, []string) {
+	switch {
+	case strings.Contains(endpoint, ".aliyuncs.com"):
+		return "Aliyun OSS", aliyunStorageClasses
+	case strings.Contains(endpoint, ".myqcloud.com"):
+		return "Tencent COS", tencentStorageClasses
+	default:
+		values := types.StorageClass("").Values()
+		classes := make([]string, len(values))
+		for i, v := range values {
+			classes[i] = string(v)
+		}
+		return "S3", classes
+	}
+}
+
+// NormalizeStorageClass 规范化存储类型（去除空白并转为大写）
+func NormalizeStorageClass(class string) string {
+	return strings.ToUpper(strings.TrimSpace(class))
+}
+
+// ValidateStorageClass 校验存储类型是否被端点对应的后端支持；为空表示使用 bucket 默认存储类型
+func ValidateStorageClass(endpoint, class string) error {
+	class = NormalizeStorageClass(class)
+	if class == "" {
+		return nil
+	}
+	backend, classes := storageClassBackend(endpoint)
+	for _, c := range classes {
+		if c == class {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported OSS_STORAGE_CLASS %q for %s: expected one of %s", class, backend, strings.Join(classes, ", "))
+}
+
+// applyStorageClass 按配置在上传参数中设置存储类型
+func (c *S3Client) applyStorageClass(input *s3.PutObjectInput) {
+	if c.storageClass == "" {
+		return
+	}
+	input.StorageClass = types.StorageClass(c.storageClass)
+}
@@ -0,0 +1,91 @@
+package oss
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// S3 对象标签限制
+const (
+	maxObjectTags        = 10
+	maxObjectTagKeyLen   = 128
+	maxObjectTagValueLen = 256
+)
+
+// 按操作附加的标签名，占用对象标签数量上限中的名额
+const (
+	TagProvider  = "provider"
+	TagOperation = "operation"
+)
+
+var (
+	objectTagsMu sync.RWMutex
+	// objectTags 附加到所有上传对象的全局标签（来自 OSS_OBJECT_TAGS）
+	objectTags map[string]string
+)
+
+// SetObjectTags 设置附加到所有上传对象的全局标签（通常在启动时根据配置调用一次）。
+// 需要为按操作附加的 provider / operation 标签预留名额，超出上限或键值过长时返回错误。
+func SetObjectTags(tags map[string]string) error {
+	if len(tags) > maxObjectTags-2 {
+		return fmt.Errorf("OSS_OBJECT_TAGS allows at most %d tags (%d are reserved for %s / %s), got %d",
+			maxObjectTags-2, 2, TagProvider, TagOperation, len(tags))
+	}
+	for k, v := range tags {
+		if k == "" || len(k) > maxObjectTagKeyLen {
+			return fmt.Errorf("invalid object tag key %q: must be 1-%d characters", k, maxObjectTagKeyLen)
+		}
+		if len(v) > maxObjectTagValueLen {
+			return fmt.Errorf("object tag %q value is longer than %d characters", k, maxObjectTagValueLen)
+		}
+	}
+
+	copied := make(map[string]string, len(tags))
+	for k, v := range tags {
+		copied[k] = v
+	}
+
+	objectTagsMu.Lock()
+	defer objectTagsMu.Unlock()
+	objectTags = copied
+	return nil
+}
+
+type objectTagsKey struct{}
+
+// WithObjectTags 返回携带按操作标签（如 provider / operation）的 context，
+// 使用该 context 上传的对象会在全局标签之外附加这些标签，同名时覆盖全局标签。
+func WithObjectTags(ctx context.Context, tags map[string]string) context.Context {
+	merged := make(map[string]string, len(tags))
+	if existing, ok := ctx.Value(objectTagsKey{}).(map[string]string); ok {
+		for k, v := range existing {
+			merged[k] = v
+		}
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, objectTagsKey{}, merged)
+}
+
+// objectTagging 合并全局标签与 context 中的按操作标签，编码为 PutObject 的 Tagging 字段
+// （URL query 形式，如 app=genai-mcp&provider=wan）。没有任何标签时返回空字符串。
+func objectTagging(ctx context.Context) string {
+	values := url.Values{}
+
+	objectTagsMu.RLock()
+	for k, v := range objectTags {
+		values.Set(k, v)
+	}
+	objectTagsMu.RUnlock()
+
+	if tags, ok := ctx.Value(objectTagsKey{}).(map[string]string); ok {
+		for k, v := range tags {
+			values.Set(k, v)
+		}
+	}
+
+	return values.Encode()
+}
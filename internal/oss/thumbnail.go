@@ -0,0 +1,42 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/utils"
+)
+
+// PublishThumbnail 为结果图片生成长边不超过 maxEdge 的缩略图并上传到 bucket，
+// 成功时通过 common.RecordThumbnailURL 记录其 URL（有效期与结果图片一致，见 URLExpiry）。
+// 缩略图是附加输出：生成或上传失败时只记录 warn 日志，不影响主图结果。maxEdge <= 0 时不生成。
+func PublishThumbnail(ctx context.Context, client OSSIface, bucket string, data []byte, maxEdge int) {
+	if maxEdge <= 0 || client == nil || bucket == "" {
+		return
+	}
+
+	thumb, mimeType, err := utils.Thumbnail(data, maxEdge)
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithField("size", len(data)).Warn("Failed to generate thumbnail, skipping")
+		return
+	}
+
+	key := utils.GenerateImagePath() + "thumb_" + utils.GenerateImageFileName(mimeType)
+	url, err := client.UploadFileWithURL(ctx, bucket, key, bytes.NewReader(thumb), mimeType, URLExpiry(ctx, 0))
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"bucket": bucket,
+			"key":    key,
+		}).Warn("Failed to upload thumbnail, skipping")
+		return
+	}
+
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"bucket":   bucket,
+		"key":      key,
+		"max_edge": maxEdge,
+		"size":     len(thumb),
+	}).Debug("Thumbnail uploaded")
+	common.RecordThumbnailURL(ctx, url)
+}
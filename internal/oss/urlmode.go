@@ -0,0 +1,33 @@
+package oss
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UploadFileWithURL 返回的 URL 形式（OSS_URL_MODE）
+const (
+	// URLModePublic 返回不带签名的对象 URL，要求 bucket 或 CDN 允许公开读取，URL 不会过期
+	URLModePublic = "public"
+	// URLModeSigned 返回预签名 GET URL，私有 bucket 也可访问，到期（expiresIn）后失效
+	URLModeSigned = "signed"
+)
+
+// NormalizeURLMode 规范化 URL 模式（去除空白并转为小写），为空时返回 URLModePublic
+func NormalizeURLMode(mode string) string {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" {
+		return URLModePublic
+	}
+	return mode
+}
+
+// ValidateURLMode 校验 URL 模式是否合法
+func ValidateURLMode(mode string) error {
+	switch NormalizeURLMode(mode) {
+	case URLModePublic, URLModeSigned:
+		return nil
+	default:
+		return fmt.Errorf("unsupported OSS_URL_MODE %q: expected %s or %s", mode, URLModePublic, URLModeSigned)
+	}
+}
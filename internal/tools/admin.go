@@ -0,0 +1,265 @@
+package tools
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"genai-mcp/common"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// ProviderReloader 从最新的配置重建当前 provider 客户端并原子替换，返回生效的新配置
+type ProviderReloader func(ctx context.Context) (*common.Config, error)
+
+// ConfigSource 返回当前生效的配置（启动时加载，reload_provider 成功后更新）
+type ConfigSource func() *common.Config
+
+// reloadResult reload_provider 工具的返回结构
+type reloadResult struct {
+	Provider   string `json:"provider"`
+	GenModel   string `json:"gen_model"`
+	EditModel  string `json:"edit_model"`
+	ReloadedAt string `json:"reloaded_at"`
+}
+
+// RegisterAdminTools 注册管理类 MCP tools，仅在配置了 GENAI_ADMIN_TOKEN 时注册。
+//
+// 约定工具列表：
+//   - reload_provider    从最新配置重建 provider 客户端（密钥轮换、切换模型），无需重启
+//   - get_config         返回当前生效的配置（密钥已隐藏）
+//   - provider_error_stats  返回进程启动以来各 provider 按分类累计的错误次数
+//   - list_oss_objects   分页列举 OSS 中指定前缀下的对象（仅在配置了 OSS 时注册）
+//   - delete_oss_object  按 key 删除 OSS 对象（仅在配置了 OSS 时注册）
+func RegisterAdminTools(s *server.MCPServer, opts Options, reload ProviderReloader, currentConfig ConfigSource) error {
+	if opts.AdminToken == "" {
+		common.Info("GENAI_ADMIN_TOKEN is not set, admin tools are disabled")
+		return nil
+	}
+
+	reloadTool := mcp.NewTool(
+		"reload_provider",
+		mcp.WithDescription("Admin only. Rebuild the active provider client from fresh .env / environment configuration (e.g. rotated API key or new model names) and swap it in atomically. In-flight requests are not affected. Changing GENAI_PROVIDER still requires a restart."),
+		withAdminToken(),
+	)
+
+	opts.addTool(s, reloadTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if errResult := requireAdmin(ctx, req, opts); errResult != nil {
+			return errResult, nil
+		}
+
+		common.WithRequestID(ctx).Info("Reloading provider client")
+		cfg, err := reload(ctx)
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).Error("Failed to reload provider client")
+			return newToolErrorResult("failed to reload provider", err), nil
+		}
+
+		result := reloadResult{
+			Provider:   cfg.GenAIProvider,
+			GenModel:   cfg.GenAIGenModelName,
+			EditModel:  cfg.GenAIEditModelName,
+			ReloadedAt: time.Now().UTC().Format(time.RFC3339),
+		}
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"provider":   result.Provider,
+			"gen_model":  result.GenModel,
+			"edit_model": result.EditModel,
+		}).Info("Provider client reloaded")
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			return newToolErrorResult("failed to encode reload result", err), nil
+		}
+		return mcp.NewToolResultText(string(data)), nil
+	})
+
+	configTool := mcp.NewTool(
+		"get_config",
+		mcp.WithDescription("Admin only. Return the configuration the server is running with: provider, models, base URL, image output, timeouts and OSS settings. API keys, OSS credentials, the admin token and extra header values are masked. Reflects the last successful reload_provider."),
+		withAdminToken(),
+	)
+
+	opts.addTool(s, configTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if errResult := requireAdmin(ctx, req, opts); errResult != nil {
+			return errResult, nil
+		}
+
+		data, err := json.Marshal(currentConfig().Effective())
+		if err != nil {
+			return newToolErrorResult("failed to encode config", err), nil
+		}
+		common.WithRequestID(ctx).Info("Effective configuration returned via admin tool")
+		return mcp.NewToolResultText(string(data)), nil
+	})
+
+	statsTool := mcp.NewTool(
+		"provider_error_stats",
+		mcp.WithDescription("Admin only. Count provider errors since the server started, per provider and category: auth (check API key / permissions), rate_limit, timeout, bad_request, server_error (provider 5xx, network errors, failed tasks), empty_result (request succeeded but no image was returned) and other."),
+		withAdminToken(),
+	)
+
+	opts.addTool(s, statsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if errResult := requireAdmin(ctx, req, opts); errResult != nil {
+			return errResult, nil
+		}
+
+		data, err := json.Marshal(common.ProviderErrorStats())
+		if err != nil {
+			return newToolErrorResult("failed to encode provider error stats", err), nil
+		}
+		return mcp.NewToolResultText(string(data)), nil
+	})
+
+	if ossConfigured(opts) {
+		registerOSSAdminTools(s, opts)
+	} else {
+		common.Info("OSS is not configured, OSS admin tools are disabled")
+	}
+
+	return nil
+}
+
+// OSS 管理工具的默认前缀与单页数量限制
+const (
+	defaultOSSListPrefix = "images/"
+	defaultOSSListLimit  = 100
+	maxOSSListLimit      = 1000
+)
+
+// ossObjectEntry list_oss_objects 返回的单个对象
+type ossObjectEntry struct {
+	Key          string `json:"key"`
+	Size         int64  `json:"size"`
+	LastModified string `json:"last_modified"`
+	URL          string `json:"url"`
+}
+
+// ossListResult list_oss_objects 工具的返回结构
+type ossListResult struct {
+	Bucket                string           `json:"bucket"`
+	Prefix                string           `json:"prefix"`
+	Count                 int              `json:"count"`
+	Objects               []ossObjectEntry `json:"objects"`
+	NextContinuationToken string           `json:"next_continuation_token,omitempty"`
+}
+
+// registerOSSAdminTools 注册 OSS 对象列举与删除工具，操作范围限定在配置的 OSS_BUCKET
+func registerOSSAdminTools(s *server.MCPServer, opts Options) {
+	listTool := mcp.NewTool(
+		"list_oss_objects",
+		mcp.WithDescription("Admin only. List objects stored in the configured OSS bucket under a key prefix, in key order (ListObjectsV2). Keys under images/ are partitioned by OSS_PATH_SCHEME (by upload date by default); keys under archives/ start with the upload date. Use next_continuation_token to fetch the next page."),
+		withAdminToken(),
+		mcp.WithString("prefix",
+			mcp.Description("Key prefix to list (default: images/). Use archives/ for batch archives, or an empty string for the whole bucket."),
+			mcp.DefaultString(defaultOSSListPrefix),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Maximum number of objects per page (1-%d, default: %d).", maxOSSListLimit, defaultOSSListLimit)),
+			mcp.DefaultNumber(defaultOSSListLimit),
+		),
+		mcp.WithString("continuation_token",
+			mcp.Description("next_continuation_token from a previous call, to fetch the next page."),
+		),
+	)
+
+	opts.addTool(s, listTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if errResult := requireAdmin(ctx, req, opts); errResult != nil {
+			return errResult, nil
+		}
+
+		prefix := req.GetString("prefix", defaultOSSListPrefix)
+		limit := req.GetInt("limit", defaultOSSListLimit)
+		if limit < 1 || limit > maxOSSListLimit {
+			return newInvalidArgumentResult(fmt.Sprintf("limit must be between 1 and %d, got %d", maxOSSListLimit, limit)), nil
+		}
+		token := req.GetString("continuation_token", "")
+
+		page, err := opts.OSSClient.ListObjects(ctx, opts.OSSBucket, prefix, token, int32(limit))
+		if err != nil {
+			return newToolErrorResult("failed to list OSS objects", err), nil
+		}
+
+		result := ossListResult{
+			Bucket:                opts.OSSBucket,
+			Prefix:                prefix,
+			Count:                 len(page.Objects),
+			Objects:               make([]ossObjectEntry, 0, len(page.Objects)),
+			NextContinuationToken: page.NextContinuationToken,
+		}
+		for _, obj := range page.Objects {
+			result.Objects = append(result.Objects, ossObjectEntry{
+				Key:          obj.Key,
+				Size:         obj.Size,
+				LastModified: obj.LastModified.UTC().Format(time.RFC3339),
+				URL:          opts.OSSClient.ObjectURL(opts.OSSBucket, obj.Key),
+			})
+		}
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"bucket":    opts.OSSBucket,
+			"prefix":    prefix,
+			"count":     result.Count,
+			"truncated": result.NextContinuationToken != "",
+		}).Info("Listed OSS objects")
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			return newToolErrorResult("failed to encode OSS object list", err), nil
+		}
+		return mcp.NewToolResultText(string(data)), nil
+	})
+
+	deleteTool := mcp.NewTool(
+		"delete_oss_object",
+		mcp.WithDescription("Admin only. Delete a single object from the configured OSS bucket by key (as returned by list_oss_objects). Deleting a key that does not exist succeeds."),
+		withAdminToken(),
+		mcp.WithString("key",
+			mcp.Required(),
+			mcp.Description("Object key to delete, e.g. images/2025-01-01/1735689600_abcd1234.png."),
+		),
+	)
+
+	opts.addTool(s, deleteTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if errResult := requireAdmin(ctx, req, opts); errResult != nil {
+			return errResult, nil
+		}
+
+		key, err := req.RequireString("key")
+		if err != nil || strings.TrimSpace(key) == "" {
+			return newInvalidArgumentResult("key parameter is required"), nil
+		}
+
+		if err := opts.OSSClient.DeleteFile(ctx, opts.OSSBucket, key); err != nil {
+			return newToolErrorResult("failed to delete OSS object", err), nil
+		}
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"bucket": opts.OSSBucket,
+			"key":    key,
+		}).Warn("OSS object deleted via admin tool")
+
+		return mcp.NewToolResultText(fmt.Sprintf("Deleted %s from bucket %s", key, opts.OSSBucket)), nil
+	})
+}
+
+// withAdminToken 管理类工具共用的 admin_token 参数
+func withAdminToken() mcp.ToolOption {
+	return mcp.WithString("admin_token",
+		mcp.Required(),
+		mcp.Description("Admin token (must match the server's GENAI_ADMIN_TOKEN)."),
+	)
+}
+
+// requireAdmin 校验请求中的 admin_token，通过时返回 nil，否则返回 unauthorized 错误结果
+func requireAdmin(ctx context.Context, req mcp.CallToolRequest, opts Options) *mcp.CallToolResult {
+	token := req.GetString("admin_token", "")
+	if opts.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(opts.AdminToken)) != 1 {
+		common.WithRequestID(ctx).Warn("Rejected admin tool call with invalid admin_token")
+		return newToolErrorResultWithCode(common.ErrCodeUnauthorized, false, "invalid or missing admin_token")
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/utils"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// defaultPromptTokenLimit analyze_prompt 未指定 max_tokens 时的提示词 token 上限（偏保守，适用于多数图片模型）
+const defaultPromptTokenLimit = 1000
+
+// promptIssue analyze_prompt 发现的单个问题
+type promptIssue struct {
+	Code    string `json:"code"` // empty / too_long / non_ascii
+	Message string `json:"message"`
+}
+
+// promptAnalysis analyze_prompt 工具的结构化输出
+type promptAnalysis struct {
+	Characters      int           `json:"characters"`
+	EstimatedTokens int           `json:"estimated_tokens"`
+	MaxTokens       int           `json:"max_tokens"`
+	NonASCII        bool          `json:"non_ascii"`
+	Issues          []promptIssue `json:"issues"`
+}
+
+// analyzePrompt 估算提示词 token 数并检查常见问题
+func analyzePrompt(prompt string, maxTokens int) promptAnalysis {
+	analysis := promptAnalysis{
+		Characters:      utf8.RuneCountInString(prompt),
+		EstimatedTokens: utils.EstimateTokens(prompt),
+		MaxTokens:       maxTokens,
+		NonASCII:        utils.HasNonASCII(prompt),
+		Issues:          []promptIssue{},
+	}
+
+	if strings.TrimSpace(prompt) == "" {
+		analysis.Issues = append(analysis.Issues, promptIssue{
+			Code:    "empty",
+			Message: "prompt is empty or whitespace only",
+		})
+	}
+	if analysis.EstimatedTokens > maxTokens {
+		analysis.Issues = append(analysis.Issues, promptIssue{
+			Code:    "too_long",
+			Message: fmt.Sprintf("prompt is about %d tokens, over the limit of %d; the provider may truncate or reject it", analysis.EstimatedTokens, maxTokens),
+		})
+	}
+	if analysis.NonASCII {
+		analysis.Issues = append(analysis.Issues, promptIssue{
+			Code:    "non_ascii",
+			Message: "prompt contains non-ASCII characters; some models follow English prompts more reliably, consider translating",
+		})
+	}
+	return analysis
+}
+
+// registerAnalyzePromptTool 注册 analyze_prompt 工具：本地估算提示词 token 数并标记潜在问题，不调用 provider
+func registerAnalyzePromptTool(s *server.MCPServer, opts Options) {
+	analyzePromptTool := mcp.NewTool(
+		"analyze_prompt",
+		mcp.WithDescription("Estimate a prompt's token count and flag potential issues (empty, too long, non-ASCII text that may need translation) before a paid generation call. The count is a local approximation; the provider is not called."),
+		mcp.WithString("prompt",
+			mcp.Required(),
+			mcp.Description("Prompt text to analyze."),
+		),
+		mcp.WithNumber("max_tokens",
+			mcp.Description(fmt.Sprintf("Optional token limit used for the too_long check. Defaults to %d.", defaultPromptTokenLimit)),
+		),
+	)
+
+	opts.addTool(s, analyzePromptTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		prompt, err := req.RequireString("prompt")
+		if err != nil {
+			return newInvalidArgumentResult(fmt.Sprintf("prompt parameter is required: %v", err)), nil
+		}
+		maxTokens := req.GetInt("max_tokens", defaultPromptTokenLimit)
+		if maxTokens <= 0 {
+			return newInvalidArgumentResult(fmt.Sprintf("max_tokens must be positive, got %d", maxTokens)), nil
+		}
+
+		analysis := analyzePrompt(prompt, maxTokens)
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"characters":       analysis.Characters,
+			"estimated_tokens": analysis.EstimatedTokens,
+			"issues":           len(analysis.Issues),
+		}).Debug("Analyzed prompt")
+
+		text := fmt.Sprintf("Estimated %d tokens (%d characters); no issues found", analysis.EstimatedTokens, analysis.Characters)
+		if len(analysis.Issues) > 0 {
+			codes := make([]string, len(analysis.Issues))
+			for i, issue := range analysis.Issues {
+				codes[i] = issue.Code
+			}
+			text = fmt.Sprintf("Estimated %d tokens (%d characters); issues: %s", analysis.EstimatedTokens, analysis.Characters, strings.Join(codes, ", "))
+		}
+		return mcp.NewToolResultStructured(analysis, text), nil
+	})
+}
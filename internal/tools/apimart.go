@@ -2,7 +2,6 @@ package tools
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -20,15 +19,23 @@ import (
 //   - apimart_query_generate_image_task   文生图：根据 task_id 查询任务结果，返回原始 JSON
 //   - apimart_create_edit_image_task      图像编辑：创建异步任务，返回 task_id
 //   - apimart_query_edit_image_task       图像编辑：根据 task_id 查询任务结果，返回原始 JSON
-func RegisterApimartTools(s *server.MCPServer, apimartClient apimart.ApimartIface) error {
+//   - apimart_query_tasks                 批量查询：一次查询多个 task_id 的结果
+//   - apimart_query_task_raw              原始响应：返回未经格式化的任务查询 JSON
+//   - apimart_query_generate_image_status 统一状态：将文生图任务查询结果解析为与 provider 无关的结构
+//   - edit_image                          统一编辑：接受 URL 与 data URI，创建编辑任务
+//   - generate_then_edit                  生成后编辑：一次调用内依次等待生成与编辑任务完成，返回最终图片
+//   - edit_session                        多轮编辑：按 session_id 记住最新结果图片，后续每轮只需提供提示词
+//   - apimart_get_task_image              结果图片：将已完成任务的结果图片以 MCP image content 返回
+//   - apimart_reformat_task_result        重新格式化：按指定输出格式（base64 / base64-raw / url）返回已完成任务的结果图片
+func RegisterApimartTools(s *server.MCPServer, apimartClient apimart.ApimartIface, opts Options) error {
 	// 1. 文生图 - 创建任务
 	createGenerateTool := mcp.NewTool(
 		"apimart_create_generate_image_task",
 		mcp.WithDescription("Create an asynchronous image generation task using APIMart. Returns a task_id."),
 		mcp.WithString("prompt",
-			mcp.Required(),
-			mcp.Description("Text prompt describing the image to generate."),
+			mcp.Description("Text prompt describing the image to generate. Required unless prompts is given."),
 		),
+		withWeightedPrompts(),
 		mcp.WithString("size",
 			mcp.Description("Image generation size. Supported formats: 1:1, 2:3, 3:2, 3:4, 4:3, 4:5, 5:4, 9:16, 16:9, 21:9"),
 		),
@@ -40,11 +47,11 @@ func RegisterApimartTools(s *server.MCPServer, apimartClient apimart.ApimartIfac
 		),
 	)
 
-	s.AddTool(createGenerateTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		prompt, err := req.RequireString("prompt")
-		if err != nil {
-			common.WithError(err).Error("APIMart: failed to get prompt parameter for create_generate_image_task")
-			return mcp.NewToolResultError(fmt.Sprintf("prompt parameter is required: %v", err)), nil
+	opts.addTool(s, createGenerateTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		// prompt 或加权提示词列表 prompts（合并为单个提示词）
+		prompt, errResult := getGeneratePrompt(req)
+		if errResult != nil {
+			return errResult, nil
 		}
 
 		// 可选参数
@@ -55,25 +62,34 @@ func RegisterApimartTools(s *server.MCPServer, apimartClient apimart.ApimartIfac
 			n = 1
 		}
 
-		common.WithFields(map[string]interface{}{
+		// 调用 provider 前校验输出分辨率是否超出服务端限制（APIMart 默认 1K）
+		if err := opts.checkOutputResolution(resolution, "1K"); err != nil {
+			common.WithRequestID(ctx).WithError(err).WithField("resolution", resolution).Warn("APIMart: requested resolution rejected")
+			return newInvalidArgumentResult(err.Error()), nil
+		}
+
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
 			"prompt":     prompt,
 			"size":       size,
 			"resolution": resolution,
 			"n":          n,
 		}).Info("APIMart: creating generate-image task")
 
-		taskID, err := apimartClient.CreateGenerateImageTask(ctx, prompt, size, resolution, n)
+		prompts := opts.preparePrompt(ctx, prompt)
+		opts.enhancePrompt(ctx, &prompts)
+		ctx = opts.routeModel(ctx, routeGenerate, &prompts)
+		taskID, err := apimartClient.CreateGenerateImageTask(ctx, prompts.EffectivePrompt, size, resolution, n)
 		if err != nil {
-			common.WithError(err).WithFields(map[string]interface{}{
+			common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
 				"prompt":     prompt,
 				"size":       size,
 				"resolution": resolution,
 				"n":          n,
 			}).Error("APIMart: failed to create generate-image task")
-			return mcp.NewToolResultError(fmt.Sprintf("failed to create generate-image task: %v", err)), nil
+			return newToolErrorResult("failed to create generate-image task", err), nil
 		}
 
-		common.WithFields(map[string]interface{}{
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
 			"prompt":     prompt,
 			"size":       size,
 			"resolution": resolution,
@@ -81,7 +97,8 @@ func RegisterApimartTools(s *server.MCPServer, apimartClient apimart.ApimartIfac
 			"task_id":    taskID,
 		}).Info("APIMart: generate-image task created successfully")
 
-		return mcp.NewToolResultText(fmt.Sprintf("generate_image task_id: %s", taskID)), nil
+		return newGenerationResult(generationResult{TaskID: taskID, promptInfo: prompts},
+			fmt.Sprintf("generate_image task_id: %s", taskID)), nil
 	})
 
 	// 2. 文生图 - 查询任务
@@ -92,33 +109,41 @@ func RegisterApimartTools(s *server.MCPServer, apimartClient apimart.ApimartIfac
 			mcp.Required(),
 			mcp.Description("Task ID returned from apimart_create_generate_image_task."),
 		),
+		withWaitSeconds(),
+		withStateHistory(),
 	)
 
-	s.AddTool(queryGenerateTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	opts.addTool(s, queryGenerateTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		taskID, err := req.RequireString("task_id")
 		if err != nil {
-			common.WithError(err).Error("APIMart: failed to get task_id parameter for query_generate_image_task")
-			return mcp.NewToolResultError(fmt.Sprintf("task_id parameter is required: %v", err)), nil
+			common.WithRequestID(ctx).WithError(err).Error("APIMart: failed to get task_id parameter for query_generate_image_task")
+			return newInvalidArgumentResult(fmt.Sprintf("task_id parameter is required: %v", err)), nil
 		}
 
-		common.WithField("task_id", taskID).Info("APIMart: querying generate-image task")
+		common.WithRequestID(ctx).WithField("task_id", taskID).Info("APIMart: querying generate-image task")
+		ctx = withUploadTags(ctx, "apimart", "generate")
+		ctx, providerPrompt := common.WithProviderPromptRecorder(ctx)
 
-		resultJSON, err := apimartClient.QueryGenerateImageTask(ctx, taskID)
-		if err != nil {
-			// 未完成任务，不视为错误，返回状态提示，便于上层继续轮询
-			if strings.Contains(strings.ToLower(err.Error()), "not completed") {
-				common.WithFields(map[string]interface{}{
-					"task_id": taskID,
-					"status":  err.Error(),
-				}).Info("APIMart: generate-image task not completed yet")
-				return mcp.NewToolResultText(err.Error()), nil
+		// wait_seconds > 0 时轮询直到任务进入终态或超时
+		return opts.Poll.pollTask(ctx, opts.Poll.waitDuration(req), includeStateHistory(req), func(ctx context.Context) (*mcp.CallToolResult, string, bool) {
+			resultJSON, err := apimartClient.QueryGenerateImageTask(ctx, taskID)
+			if err != nil {
+				// 未完成任务，不视为错误，返回状态提示，便于上层继续轮询
+				if taskNotCompleted(err) {
+					common.WithRequestID(ctx).WithFields(map[string]interface{}{
+						"task_id": taskID,
+						"status":  err.Error(),
+					}).Info("APIMart: generate-image task not completed yet")
+					return mcp.NewToolResultText(err.Error()), apimartTaskState(err), false
+				}
+				common.WithRequestID(ctx).WithError(err).WithField("task_id", taskID).Error("APIMart: failed to query generate-image task")
+				return newToolErrorResult("failed to query generate-image task", err), apimartTaskState(err), true
 			}
-			common.WithError(err).WithField("task_id", taskID).Error("APIMart: failed to query generate-image task")
-			return mcp.NewToolResultError(fmt.Sprintf("failed to query generate-image task: %v", err)), nil
-		}
 
-		// 直接把 APIMart 接口返回的 JSON 内容作为文本结果返回，由上层解析
-		return mcp.NewToolResultText(resultJSON), nil
+			// 直接把 APIMart 接口返回的 JSON 内容作为文本结果返回，由上层解析；
+			// provider 改写了提示词时在结构化内容中附带 provider_prompt
+			return newProviderPromptResult(taskID, resultJSON, providerPrompt.Prompt()), apimartTaskState(nil), true
+		}), nil
 	})
 
 	// 3. 图像编辑 - 创建任务
@@ -131,64 +156,68 @@ func RegisterApimartTools(s *server.MCPServer, apimartClient apimart.ApimartIfac
 		),
 		mcp.WithString("image_urls",
 			mcp.Required(),
-			mcp.Description("JSON array of image URLs or base64 data URIs to edit. Example: [\"url1\", \"url2\"] or [\"data:image/jpeg;base64,...\"]"),
+			mcp.Description("JSON array of image URLs or base64 data URIs to edit. Example: [\"url1\", \"url2\"] or [\"data:image/jpeg;base64,...\"]. A single value or one URL per line is also accepted."),
 		),
 		mcp.WithString("mask_url",
 			mcp.Description("Optional mask image URL (PNG format). Size must match reference image. Must not exceed 4MB."),
 		),
+		mcp.WithNumber("strength",
+			mcp.Description("Optional. How strongly the output departs from the input images, from 0 (stay close) to 1 (follow the prompt freely). Omit or 0 for the APIMart default."),
+		),
 	)
 
-	s.AddTool(createEditTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	opts.addTool(s, createEditTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		prompt, err := req.RequireString("prompt")
 		if err != nil {
-			common.WithError(err).Error("APIMart: failed to get prompt parameter for create_edit_image_task")
-			return mcp.NewToolResultError(fmt.Sprintf("prompt parameter is required: %v", err)), nil
-		}
-
-		imageURLsJSON, err := req.RequireString("image_urls")
-		if err != nil {
-			common.WithError(err).Error("APIMart: failed to get image_urls parameter for create_edit_image_task")
-			return mcp.NewToolResultError(fmt.Sprintf("image_urls parameter is required: %v", err)), nil
+			common.WithRequestID(ctx).WithError(err).Error("APIMart: failed to get prompt parameter for create_edit_image_task")
+			return newInvalidArgumentResult(fmt.Sprintf("prompt parameter is required: %v", err)), nil
 		}
 
-		// 解析 JSON 数组
-		var imageURLs []string
-		if err := json.Unmarshal([]byte(imageURLsJSON), &imageURLs); err != nil {
-			common.WithError(err).WithField("image_urls", imageURLsJSON).Error("APIMart: failed to parse image_urls as JSON array")
-			return mcp.NewToolResultError(fmt.Sprintf("image_urls must be a valid JSON array: %v", err)), nil
+		// 宽松解析 image_urls（JSON 数组 / 单个值 / 按行分隔），APIMart 同时支持 URL 与 data URI
+		imageURLs, errResult := requireImageURLs(ctx, req, "image_urls", true)
+		if errResult != nil {
+			return errResult, nil
 		}
-
-		if len(imageURLs) == 0 {
-			return mcp.NewToolResultError("image_urls array cannot be empty"), nil
+		if err := opts.checkEditImageCount(len(imageURLs), 0); err != nil {
+			common.WithRequestID(ctx).WithError(err).Warn("APIMart: rejected edit-image request")
+			return newInvalidArgumentResult(err.Error()), nil
 		}
 
-		// 可选参数：mask_url
+		// 可选参数：mask_url、strength
 		maskURL := req.GetString("mask_url", "")
+		strength := req.GetFloat("strength", 0)
+		if strength < 0 || strength > 1 {
+			return newInvalidArgumentResult(fmt.Sprintf("strength must be between 0 and 1, got %v", strength)), nil
+		}
 
-		common.WithFields(map[string]interface{}{
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
 			"prompt":      prompt,
 			"image_count": len(imageURLs),
 			"mask_url":    maskURL,
+			"strength":    strength,
 		}).Info("APIMart: creating edit-image task")
 
-		taskID, err := apimartClient.CreateEditImageTask(ctx, prompt, imageURLs, maskURL)
+		prompts := opts.preparePrompt(ctx, prompt)
+		ctx = opts.routeModel(ctx, routeEdit, &prompts)
+		taskID, err := apimartClient.CreateEditImageTask(ctx, prompts.EffectivePrompt, imageURLs, maskURL, strength)
 		if err != nil {
-			common.WithError(err).WithFields(map[string]interface{}{
+			common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
 				"prompt":      prompt,
 				"image_count": len(imageURLs),
 				"mask_url":    maskURL,
 			}).Error("APIMart: failed to create edit-image task")
-			return mcp.NewToolResultError(fmt.Sprintf("failed to create edit-image task: %v", err)), nil
+			return newToolErrorResult("failed to create edit-image task", err), nil
 		}
 
-		common.WithFields(map[string]interface{}{
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
 			"prompt":      prompt,
 			"image_count": len(imageURLs),
 			"mask_url":    maskURL,
 			"task_id":     taskID,
 		}).Info("APIMart: edit-image task created successfully")
 
-		return mcp.NewToolResultText(fmt.Sprintf("edit_image task_id: %s", taskID)), nil
+		return newGenerationResult(generationResult{TaskID: taskID, promptInfo: prompts},
+			fmt.Sprintf("edit_image task_id: %s", taskID)), nil
 	})
 
 	// 4. 图像编辑 - 查询任务
@@ -199,33 +228,124 @@ func RegisterApimartTools(s *server.MCPServer, apimartClient apimart.ApimartIfac
 			mcp.Required(),
 			mcp.Description("Task ID returned from apimart_create_edit_image_task."),
 		),
+		withWaitSeconds(),
+		withStateHistory(),
 	)
 
-	s.AddTool(queryEditTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	opts.addTool(s, queryEditTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		taskID, err := req.RequireString("task_id")
 		if err != nil {
-			common.WithError(err).Error("APIMart: failed to get task_id parameter for query_edit_image_task")
-			return mcp.NewToolResultError(fmt.Sprintf("task_id parameter is required: %v", err)), nil
+			common.WithRequestID(ctx).WithError(err).Error("APIMart: failed to get task_id parameter for query_edit_image_task")
+			return newInvalidArgumentResult(fmt.Sprintf("task_id parameter is required: %v", err)), nil
 		}
 
-		common.WithField("task_id", taskID).Info("APIMart: querying edit-image task")
+		common.WithRequestID(ctx).WithField("task_id", taskID).Info("APIMart: querying edit-image task")
+		ctx = withUploadTags(ctx, "apimart", "edit")
+		ctx, providerPrompt := common.WithProviderPromptRecorder(ctx)
 
-		resultJSON, err := apimartClient.QueryEditImageTask(ctx, taskID)
-		if err != nil {
-			// 未完成任务，不视为错误，返回状态提示，便于上层继续轮询
-			if strings.Contains(strings.ToLower(err.Error()), "not completed") {
-				common.WithFields(map[string]interface{}{
-					"task_id": taskID,
-					"status":  err.Error(),
-				}).Info("APIMart: edit-image task not completed yet")
-				return mcp.NewToolResultText(err.Error()), nil
+		// wait_seconds > 0 时轮询直到任务进入终态或超时
+		return opts.Poll.pollTask(ctx, opts.Poll.waitDuration(req), includeStateHistory(req), func(ctx context.Context) (*mcp.CallToolResult, string, bool) {
+			resultJSON, err := apimartClient.QueryEditImageTask(ctx, taskID)
+			if err != nil {
+				// 未完成任务，不视为错误，返回状态提示，便于上层继续轮询
+				if taskNotCompleted(err) {
+					common.WithRequestID(ctx).WithFields(map[string]interface{}{
+						"task_id": taskID,
+						"status":  err.Error(),
+					}).Info("APIMart: edit-image task not completed yet")
+					return mcp.NewToolResultText(err.Error()), apimartTaskState(err), false
+				}
+				common.WithRequestID(ctx).WithError(err).WithField("task_id", taskID).Error("APIMart: failed to query edit-image task")
+				return newToolErrorResult("failed to query edit-image task", err), apimartTaskState(err), true
 			}
-			common.WithError(err).WithField("task_id", taskID).Error("APIMart: failed to query edit-image task")
-			return mcp.NewToolResultError(fmt.Sprintf("failed to query edit-image task: %v", err)), nil
-		}
 
-		return mcp.NewToolResultText(resultJSON), nil
+			return newProviderPromptResult(taskID, resultJSON, providerPrompt.Prompt()), apimartTaskState(nil), true
+		}), nil
 	})
 
+	// 5. 批量查询任务（内部并发逐个查询）
+	registerQueryTasksTool(s, opts, "apimart", "APIMart", apimartClient.QueryTasks)
+
+	// 6. 原始响应查询（不做任何格式化）
+	registerQueryTaskRawTool(s, opts, "apimart", "APIMart", apimartClient.QueryTaskRaw)
+
+	// 统一任务状态查询（与 provider 无关的结构化结果）
+	registerQueryStatusTool(s, opts, "apimart", "APIMart", apimartClient.QueryGenerateImageTaskStatus)
+
+	// 7. 统一编辑工具（APIMart 同时支持 URL 与 data URI）
+	registerEditImageTool(s, opts, unifiedEditProvider{
+		Prefix: "apimart",
+		Name:   "APIMart",
+		Edit: func(ctx context.Context, prompt string, imageURLs []string) (string, string, error) {
+			taskID, err := apimartClient.CreateEditImageTask(ctx, prompt, imageURLs, "", 0)
+			return "", taskID, err
+		},
+	})
+
+	// 8. 生成后编辑：两个任务都在内部等待完成，中间图片按 GENAI_IMAGE_FORMAT 格式化后作为编辑输入
+	chain := chainProvider{
+		Prefix: "apimart",
+		Name:   "APIMart",
+		Generate: func(ctx context.Context, prompt string) (string, error) {
+			taskID, err := apimartClient.CreateGenerateImageTask(ctx, prompt, "", "", 1)
+			if err != nil {
+				return "", err
+			}
+			return opts.Poll.waitForTask(ctx, apimartTaskImage(taskID, apimartClient.QueryGenerateImageTask))
+		},
+		Edit: func(ctx context.Context, prompt string, imageURLs []string) (string, error) {
+			taskID, err := apimartClient.CreateEditImageTask(ctx, prompt, imageURLs, "", 0)
+			if err != nil {
+				return "", err
+			}
+			return opts.Poll.waitForTask(ctx, apimartTaskImage(taskID, apimartClient.QueryEditImageTask))
+		},
+	}
+	registerGenerateThenEditTool(s, opts, chain)
+
+	// 多轮编辑会话：每轮在内部等待编辑任务完成，会话保存最新结果图片
+	registerEditSessionTool(s, opts, chain)
+
+	// 9. 结果图片：以 MCP image content 返回已完成任务的图片（文生图与编辑任务共用同一查询端点）
+	apimartResultImage := func(taskID string) taskStepFunc {
+		return apimartTaskImage(taskID, apimartClient.QueryGenerateImageTask)
+	}
+	registerGetTaskImageTool(s, opts, "apimart", "APIMart", apimartResultImage)
+
+	// 10. 结果重新格式化：按调用时指定的输出格式返回已完成任务的结果图片
+	registerReformatTaskTool(s, opts, "apimart", "APIMart", apimartResultImage)
+
 	return nil
 }
+
+// apimartTaskState 从任务查询结果推断任务状态：查询成功即为 completed，
+// 未完成 / 失败时取错误信息中 provider 报告的 status，无法判断时返回空
+func apimartTaskState(err error) string {
+	if err == nil {
+		return "completed"
+	}
+	msg := err.Error()
+	if i := strings.Index(msg, "status="); i >= 0 {
+		return strings.TrimSpace(msg[i+len("status="):])
+	}
+	return ""
+}
+
+// taskNotCompleted 判断查询错误是否表示任务尚未完成（APIMart 对未完成的任务返回 "task not completed: status=..." 错误）
+func taskNotCompleted(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "not completed")
+}
+
+// apimartTaskImage 生成 waitForTask 使用的单次查询：任务未完成（not completed）时继续等待，其它错误直接返回
+func apimartTaskImage(taskID string, query func(ctx context.Context, taskID string) (string, error)) taskStepFunc {
+	return func(ctx context.Context) (string, bool, error) {
+		image, err := query(ctx, taskID)
+		if err != nil {
+			if taskNotCompleted(err) {
+				return "", false, nil
+			}
+			return "", true, err
+		}
+		return image, true, nil
+	}
+}
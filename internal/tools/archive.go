@@ -0,0 +1,224 @@
+package tools
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/oss"
+	"genai-mcp/internal/utils"
+)
+
+// 批量结果压缩包的 Content-Type 与包内清单文件名
+const (
+	archiveContentType  = "application/zip"
+	archiveManifestName = "manifest.json"
+)
+
+// archivedImage 从任务查询结果中提取出的单张图片
+type archivedImage struct {
+	TaskID       string
+	Index        int    // 在该任务结果中的序号（从 0 开始）
+	Ref          string // 图片 URL、data URI 或纯 base64（base64-raw 输出）
+	MimeType     string // Ref 为纯 base64 时图片的 MIME 类型（未记录时为空，按内容识别）
+	Prompt       string // provider 报告的原始提示词（未报告时为空）
+	ActualPrompt string // provider 改写后实际使用的提示词（未报告时为空）
+	Archived     bool   // 由 buildResultsArchive 设置：图片已写入压缩包
+}
+
+// archiveManifestEntry 清单中单个文件的描述
+type archiveManifestEntry struct {
+	File         string `json:"file,omitempty"`
+	TaskID       string `json:"task_id"`
+	Index        int    `json:"index"`
+	Prompt       string `json:"prompt,omitempty"`
+	ActualPrompt string `json:"actual_prompt,omitempty"`
+	SourceURL    string `json:"source_url,omitempty"`
+}
+
+// archiveManifest 压缩包内 manifest.json 的内容
+type archiveManifest struct {
+	CreatedAt string                 `json:"created_at"`
+	Entries   []archiveManifestEntry `json:"entries"`
+	Skipped   []archiveManifestEntry `json:"skipped,omitempty"` // 下载失败未能打包的图片
+}
+
+// extractArchivedImages 从单任务查询结果中提取图片：
+//   - 结果本身是 URL / data URI / 纯 base64（如 APIMart）时视为一张图片，mimeType 为 base64-raw 输出记录的 MIME 类型，
+//     providerPrompt 为查询时 provider 报告的改写后提示词
+//   - 结果是 JSON（如 Wan）时读取 output.results 中的 url / image_url（base64-raw 输出时为纯 base64，类型见 mime_type）及提示词
+//
+// 任务未完成或没有图片时返回空切片。
+func extractArchivedImages(taskID, result, mimeType, providerPrompt string) []archivedImage {
+	result = strings.TrimSpace(result)
+	if strings.HasPrefix(result, "data:") || strings.HasPrefix(result, "http://") || strings.HasPrefix(result, "https://") {
+		return []archivedImage{{TaskID: taskID, Ref: result, ActualPrompt: providerPrompt}}
+	}
+	if result != "" && !strings.HasPrefix(result, "{") {
+		if _, err := base64.StdEncoding.DecodeString(result); err == nil {
+			return []archivedImage{{TaskID: taskID, Ref: result, MimeType: mimeType, ActualPrompt: providerPrompt}}
+		}
+		return nil
+	}
+
+	var resp struct {
+		Output struct {
+			Results []struct {
+				URL          string `json:"url"`
+				Image        string `json:"image_url"`
+				OrigPrompt   string `json:"orig_prompt"`
+				ActualPrompt string `json:"actual_prompt"`
+				MimeType     string `json:"mime_type"`
+			} `json:"results"`
+		} `json:"output"`
+	}
+	if err := json.Unmarshal([]byte(result), &resp); err != nil {
+		return nil
+	}
+
+	var images []archivedImage
+	for i, r := range resp.Output.Results {
+		ref := r.URL
+		if ref == "" {
+			ref = r.Image
+		}
+		if ref == "" {
+			continue
+		}
+		images = append(images, archivedImage{
+			TaskID:       taskID,
+			Index:        i,
+			Ref:          ref,
+			MimeType:     r.MimeType,
+			Prompt:       r.OrigPrompt,
+			ActualPrompt: r.ActualPrompt,
+		})
+	}
+	return images
+}
+
+// readArchivedImage 读取待打包的图片：data URI 与纯 base64 直接解码，URL 直接下载
+// （URL 来自 provider 或本服务上传的 OSS，而非用户输入，因此不经输入图片主机策略校验）。
+// 纯 base64 使用记录的 MIME 类型，未记录时按内容识别。
+func readArchivedImage(ctx context.Context, img archivedImage) ([]byte, string, error) {
+	switch {
+	case strings.HasPrefix(img.Ref, "data:"):
+		return utils.DecodeDataURI(img.Ref)
+	case isArchiveURL(img.Ref):
+		return utils.DownloadImageFromURL(ctx, img.Ref)
+	}
+	data, err := base64.StdEncoding.DecodeString(img.Ref)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode base64 image: %w", err)
+	}
+	mimeType := img.MimeType
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	return data, mimeType, nil
+}
+
+// isArchiveURL 判断图片引用是否为需要下载的 http(s) URL
+func isArchiveURL(ref string) bool {
+	return strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://")
+}
+
+// buildResultsArchive 在内存中将图片打包为 zip，并附带 manifest.json 记录每个文件对应的任务与提示词。
+// 单张图片读取失败不会中断打包，会记录在清单的 skipped 中。返回压缩包数据与成功打包的图片数。
+func buildResultsArchive(ctx context.Context, images []archivedImage) ([]byte, int, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	manifest := archiveManifest{CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	for i := range images {
+		img := &images[i]
+		entry := archiveManifestEntry{
+			TaskID:       img.TaskID,
+			Index:        img.Index,
+			Prompt:       img.Prompt,
+			ActualPrompt: img.ActualPrompt,
+		}
+		if isArchiveURL(img.Ref) {
+			entry.SourceURL = img.Ref
+		}
+
+		data, mimeType, err := readArchivedImage(ctx, *img)
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+				"task_id": img.TaskID,
+				"index":   img.Index,
+			}).Warn("Failed to read result image for archive, skipping")
+			manifest.Skipped = append(manifest.Skipped, entry)
+			continue
+		}
+
+		entry.File = fmt.Sprintf("%03d_%s_%d%s", i+1, sanitizeArchiveName(img.TaskID), img.Index, utils.GetExtensionFromMimeType(mimeType))
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: entry.File, Method: zip.Store, Modified: time.Now()})
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to add %s to archive: %w", entry.File, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, 0, fmt.Errorf("failed to write %s to archive: %w", entry.File, err)
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+		img.Archived = true
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to encode archive manifest: %w", err)
+	}
+	w, err := zw.Create(archiveManifestName)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to add manifest to archive: %w", err)
+	}
+	if _, err := w.Write(manifestData); err != nil {
+		return nil, 0, fmt.Errorf("failed to write manifest to archive: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, 0, fmt.Errorf("failed to finalize archive: %w", err)
+	}
+	return buf.Bytes(), len(manifest.Entries), nil
+}
+
+// ossConfigured 是否配置了可用的 OSS（压缩包上传、输入图片上传与 OSS 管理工具依赖；OSS 配置齐全时才会创建 OSS 客户端）
+func ossConfigured(opts Options) bool {
+	return opts.OSSClient != nil && opts.OSSBucket != ""
+}
+
+// uploadResultsArchive 将压缩包上传到 OSS：archives/yyyy-MM-dd/batch_{timestamp}_{random}.zip
+func uploadResultsArchive(ctx context.Context, opts Options, data []byte) (string, error) {
+	randomBytes := make([]byte, 4)
+	_, _ = rand.Read(randomBytes)
+	now := time.Now()
+	key := fmt.Sprintf("archives/%s/batch_%d_%x.zip", now.Format("2006-01-02"), now.Unix(), randomBytes)
+
+	url, err := opts.OSSClient.UploadFileWithURL(ctx, opts.OSSBucket, key, bytes.NewReader(data), archiveContentType, oss.URLExpiry(ctx, outputURLExpiresIn))
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"bucket": opts.OSSBucket,
+			"key":    key,
+		}).Error("Failed to upload results archive to OSS")
+		return "", fmt.Errorf("failed to upload results archive to OSS: %w", err)
+	}
+	return url, nil
+}
+
+// sanitizeArchiveName 将 task_id 转为安全的文件名片段（仅保留字母、数字、- 和 _）
+func sanitizeArchiveName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,120 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/oss"
+	"genai-mcp/internal/utils"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// chainProvider generate_then_edit 工具所需的 provider 实现。
+// Generate / Edit 都返回最终图片，异步 provider 在内部等待任务完成。
+type chainProvider struct {
+	Prefix string // 工具名前缀，如 wan，用于日志与上传标签
+	Name   string // 展示名称，如 Wan
+	// URLOnly 为 true 时 provider 的编辑只接受图片 URL，data URI 形式的中间图片会先上传到 OSS
+	URLOnly  bool
+	Generate func(ctx context.Context, prompt string) (string, error)
+	Edit     func(ctx context.Context, prompt string, imageURLs []string) (string, error)
+}
+
+// chainResult generate_then_edit 工具的结构化输出
+type chainResult struct {
+	Image    string     `json:"image"`
+	Generate promptInfo `json:"generate"`
+	Edit     promptInfo `json:"edit"`
+	resultMetadata
+}
+
+// registerGenerateThenEditTool 注册 generate_then_edit 工具：一次调用内先生成图片，再把结果作为输入编辑，
+// 中间图片按 provider 的输入要求传递（内联 data URI，或上传 OSS 后传 URL），只返回最终编辑后的图片。
+func registerGenerateThenEditTool(s *server.MCPServer, opts Options, p chainProvider) {
+	chainTool := mcp.NewTool(
+		"generate_then_edit",
+		mcp.WithDescription(fmt.Sprintf("Generate an image with the active provider (%s), then edit the generated image, in a single call. Returns only the final edited image. Asynchronous providers are waited on internally, so this call can take as long as both tasks combined.", p.Name)),
+		mcp.WithString("prompt",
+			mcp.Required(),
+			mcp.Description("Text prompt describing the image to generate."),
+		),
+		mcp.WithString("edit_prompt",
+			mcp.Required(),
+			mcp.Description("Text prompt describing how to edit the generated image."),
+		),
+	)
+
+	opts.addTool(s, chainTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		prompt, err := req.RequireString("prompt")
+		if err != nil {
+			return newInvalidArgumentResult(fmt.Sprintf("prompt parameter is required: %v", err)), nil
+		}
+		editPrompt, err := req.RequireString("edit_prompt")
+		if err != nil {
+			return newInvalidArgumentResult(fmt.Sprintf("edit_prompt parameter is required: %v", err)), nil
+		}
+
+		ctx = withUploadTags(ctx, p.Prefix, "generate_then_edit")
+		genPrompts := opts.preparePrompt(ctx, prompt)
+		opts.enhancePrompt(ctx, &genPrompts)
+		editPrompts := opts.preparePrompt(ctx, editPrompt)
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"provider":    p.Prefix,
+			"prompt":      prompt,
+			"edit_prompt": editPrompt,
+		}).Info("Generating then editing image")
+
+		// 中间图片的 MIME 类型单独记录（base64-raw 时需要补回 data URI 前缀），不计入最终结果
+		genCtx, genMIME := common.WithImageMIMERecorder(opts.routeModel(ctx, routeGenerate, &genPrompts))
+		generated, err := p.Generate(genCtx, genPrompts.EffectivePrompt)
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).WithField("provider", p.Prefix).Error("generate_then_edit: generation failed")
+			return newToolErrorResult("failed to generate image", err), nil
+		}
+
+		inputs := []string{chainEditInput(generated, genMIME.MIMEType())}
+		if p.URLOnly {
+			ctx, inputs, _, err = oss.UploadDataURIInputs(ctx, opts.OSSClient, opts.OSSBucket, inputs)
+			if err != nil {
+				common.WithRequestID(ctx).WithError(err).WithField("provider", p.Prefix).Error("generate_then_edit: failed to upload generated image")
+				return newToolErrorResult("failed to upload generated image for editing", err), nil
+			}
+		}
+		// 中间图片来自本次生成调用（provider 结果 URL 或本服务上传的 OSS URL），不是用户输入，不按用户输入的主机策略校验
+		ctx = utils.WithTrustedImageURLs(ctx, inputs[0])
+
+		common.WithRequestID(ctx).WithFields(common.MergeFields(
+			map[string]interface{}{"provider": p.Prefix},
+			imageLogFields("generated_url", inputs[0]),
+		)).Info("generate_then_edit: generation finished, editing")
+
+		edited, err := p.Edit(opts.routeModel(ctx, routeEdit, &editPrompts), editPrompts.EffectivePrompt, inputs)
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).WithField("provider", p.Prefix).Error("generate_then_edit: edit failed")
+			return newToolErrorResult("failed to edit generated image", err), nil
+		}
+
+		common.WithRequestID(ctx).WithFields(common.MergeFields(
+			map[string]interface{}{"provider": p.Prefix},
+			imageLogFields("edited_url", edited),
+		)).Info("generate_then_edit finished")
+
+		return mcp.NewToolResultStructured(chainResult{
+			Image:    edited,
+			Generate: genPrompts,
+			Edit:     editPrompts,
+		}, fmt.Sprintf("Edited image: %s", edited)), nil
+	})
+}
+
+// chainEditInput 将生成步骤返回的图片转换为编辑输入：base64-raw 输出补回 data URI 前缀，URL 与 data URI 原样使用
+func chainEditInput(image, mimeType string) string {
+	if mimeType == "" || strings.HasPrefix(image, "data:") || strings.HasPrefix(image, "http://") || strings.HasPrefix(image, "https://") {
+		return image
+	}
+	return "data:" + mimeType + ";base64," + image
+}
@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"genai-mcp/common"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// coalescedCall 一次进行中的共享调用
+type coalescedCall struct {
+	done    chan struct{}
+	waiters int
+	result  *mcp.CallToolResult
+	err     error
+}
+
+// coalescer 合并同时进行的相同请求（singleflight）：同一 key 在进行中时，后到的请求等待并共享第一个请求的结果
+type coalescer struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// newCoalescer 创建请求合并器
+func newCoalescer() *coalescer {
+	return &coalescer{calls: make(map[string]*coalescedCall)}
+}
+
+// withCoalescing 合并相同工具、相同（规范化后）参数的并发调用。
+// 共享调用运行在与调用方取消解耦的 context 上（保留 context 中的值），
+// 某个等待方取消只让它自己提前返回，不会取消共享调用；共享调用仍受工具整体超时约束。
+func (c *coalescer) withCoalescing(name string, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		key, ok := coalesceKey(name, req)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		c.mu.Lock()
+		call, inFlight := c.calls[key]
+		if inFlight {
+			call.waiters++
+		} else {
+			call = &coalescedCall{done: make(chan struct{})}
+			c.calls[key] = call
+		}
+		c.mu.Unlock()
+
+		if inFlight {
+			common.WithRequestID(ctx).WithField("tool", name).Info("Coalesced identical in-flight request")
+		} else {
+			go func() {
+				call.result, call.err = handler(context.WithoutCancel(ctx), req)
+
+				c.mu.Lock()
+				delete(c.calls, key)
+				waiters := call.waiters
+				c.mu.Unlock()
+				close(call.done)
+
+				if waiters > 0 {
+					common.WithRequestID(ctx).WithFields(map[string]interface{}{
+						"tool":    name,
+						"waiters": waiters,
+					}).Info("Shared result with coalesced requests")
+				}
+			}()
+		}
+
+		select {
+		case <-call.done:
+			return call.result, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// coalesceKey 由工具名与规范化后的参数（字符串去除首尾空白，键按字典序）生成合并 key；参数无法编码时不合并
+func coalesceKey(name string, req mcp.CallToolRequest) (string, bool) {
+	args := req.GetArguments()
+	normalized := make(map[string]any, len(args))
+	for k, v := range args {
+		if s, ok := v.(string); ok {
+			v = strings.TrimSpace(s)
+		}
+		normalized[k] = v
+	}
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", false
+	}
+	return name + "\x00" + string(data), true
+}
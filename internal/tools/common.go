@@ -0,0 +1,20 @@
+package tools
+
+import (
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// RegisterCommonTools 注册与 provider 无关的通用 MCP tools。
+//
+// 约定工具列表：
+//   - estimate_cost         根据本地价格表估算生成费用
+//   - analyze_prompt        估算提示词 token 数并标记潜在问题
+//   - normalize_image_urls  校验并规范化 image_urls 参数
+//   - convert_image         图片格式转换（png / jpeg），按 GENAI_IMAGE_FORMAT 返回
+func RegisterCommonTools(s *server.MCPServer, opts Options) error {
+	registerEstimateCostTool(s, opts)
+	registerAnalyzePromptTool(s, opts)
+	registerNormalizeImageURLsTool(s, opts)
+	registerConvertImageTool(s, opts)
+	return nil
+}
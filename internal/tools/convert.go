@@ -0,0 +1,91 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/utils"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// registerConvertImageTool 注册 convert_image 工具：将图片重新编码为指定格式，按 GENAI_IMAGE_FORMAT 返回结果
+func registerConvertImageTool(s *server.MCPServer, opts Options) {
+	convertTool := mcp.NewTool(
+		"convert_image",
+		mcp.WithDescription("Convert an image (URL or data URI) to another format (png or jpeg). Returns the converted image as a URL or data URI according to the server's output format."),
+		mcp.WithString("image",
+			mcp.Required(),
+			mcp.Description("HTTP/HTTPS URL or base64 data URI of the source image (png, jpeg or gif)."),
+		),
+		mcp.WithString("format",
+			mcp.Required(),
+			mcp.Description("Target format: png or jpeg. webp is not supported by this server."),
+		),
+		mcp.WithString("background",
+			mcp.Description("Background color (#RRGGBB) used to flatten transparent pixels when converting to jpeg. Defaults to the server's GENAI_FLATTEN_BG_COLOR (white unless configured); use \"none\" to reject images with transparency instead."),
+		),
+		mcp.WithNumber("quality",
+			mcp.Description("JPEG quality from 1 to 100. Defaults to 90."),
+		),
+	)
+
+	opts.addTool(s, convertTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		image, err := req.RequireString("image")
+		if err != nil {
+			return newInvalidArgumentResult(fmt.Sprintf("image parameter is required: %v", err)), nil
+		}
+		format, err := req.RequireString("format")
+		if err != nil {
+			return newInvalidArgumentResult(fmt.Sprintf("format parameter is required: %v", err)), nil
+		}
+
+		convertOpts := utils.ConvertOptions{Quality: req.GetInt("quality", 0)}
+		switch background := strings.TrimSpace(req.GetString("background", "")); {
+		case background == "":
+			convertOpts.Background = utils.FlattenBackground()
+		case strings.EqualFold(background, "none"):
+			convertOpts.Background = nil
+		default:
+			c, err := utils.ParseHexColor(background)
+			if err != nil {
+				return newInvalidArgumentResult(err.Error()), nil
+			}
+			convertOpts.Background = c
+		}
+
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"image":  utils.TruncateForLog(image, 100),
+			"format": format,
+		}).Info("Converting image")
+
+		data, _, err := fetchInputImage(ctx, image)
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).Error("Failed to read image for conversion")
+			return newToolErrorResult("failed to read image", err), nil
+		}
+
+		converted, mimeType, err := utils.ConvertImage(data, format, convertOpts)
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).WithField("format", format).Error("Failed to convert image")
+			return newInvalidArgumentResult(fmt.Sprintf("failed to convert image: %v", err)), nil
+		}
+
+		result, err := publishImage(withUploadTags(ctx, "", "convert"), opts, converted, mimeType)
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).Error("Failed to publish converted image")
+			return newToolErrorResult("failed to publish converted image", err), nil
+		}
+
+		common.WithRequestID(ctx).WithFields(common.MergeFields(map[string]interface{}{
+			"format":      format,
+			"input_size":  len(data),
+			"output_size": len(converted),
+		}, imageLogFields("converted_image", result))).Info("Image converted successfully")
+
+		return mcp.NewToolResultText(fmt.Sprintf("Converted image: %s", result)), nil
+	})
+}
@@ -0,0 +1,143 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"genai-mcp/common"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// PriceEntry 单个模型的价格配置（来自 GENAI_PRICING）
+//
+// 示例：
+//
+//	{
+//	  "apimart/gemini-3-pro-image-preview": {"per_image": 0.05, "sizes": {"2K": 0.08, "4K": 0.15}, "currency": "USD"},
+//	  "wan2.5-t2i-preview": {"per_image": 0.2, "currency": "CNY"}
+//	}
+//
+// 键可以是 "<provider>/<model>"、"<model>" 或 "*"（兜底），按此顺序匹配。
+type PriceEntry struct {
+	PerImage float64            `json:"per_image"`
+	Sizes    map[string]float64 `json:"sizes,omitempty"` // 按 size / resolution 覆盖单价
+	Currency string             `json:"currency,omitempty"`
+}
+
+// costEstimate estimate_cost 工具的返回结构
+type costEstimate struct {
+	Provider   string  `json:"provider"`
+	Model      string  `json:"model"`
+	Size       string  `json:"size,omitempty"`
+	N          int     `json:"n"`
+	PricingKey string  `json:"pricing_key"`
+	UnitPrice  float64 `json:"unit_price"`
+	Total      float64 `json:"total"`
+	Currency   string  `json:"currency,omitempty"`
+}
+
+// parsePricing 解析 GENAI_PRICING JSON
+func parsePricing(raw string) (map[string]PriceEntry, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var pricing map[string]PriceEntry
+	if err := json.Unmarshal([]byte(raw), &pricing); err != nil {
+		return nil, err
+	}
+	return pricing, nil
+}
+
+// lookupPrice 按 "<provider>/<model>" → "<model>" → "*" 的顺序查找价格配置
+func lookupPrice(pricing map[string]PriceEntry, provider, model string) (string, PriceEntry, bool) {
+	for _, key := range []string{provider + "/" + model, model, "*"} {
+		if entry, ok := pricing[key]; ok {
+			return key, entry, true
+		}
+	}
+	return "", PriceEntry{}, false
+}
+
+// unitPrice 返回 size（或其大写形式）对应的单价，没有按尺寸的价格时返回 per_image
+func (e PriceEntry) unitPrice(size string) float64 {
+	if size != "" {
+		if price, ok := e.Sizes[size]; ok {
+			return price
+		}
+		if price, ok := e.Sizes[strings.ToUpper(size)]; ok {
+			return price
+		}
+	}
+	return e.PerImage
+}
+
+// registerEstimateCostTool 注册 estimate_cost 工具：根据本地价格表估算费用，不调用 provider
+func registerEstimateCostTool(s *server.MCPServer, opts Options) {
+	estimateCostTool := mcp.NewTool(
+		"estimate_cost",
+		mcp.WithDescription("Estimate the cost of an image generation request from the server's pricing table (GENAI_PRICING). Does not call the provider."),
+		mcp.WithString("provider",
+			mcp.Description("Provider name (gemini, wan, apimart, stability). Defaults to the active provider."),
+		),
+		mcp.WithString("model",
+			mcp.Description("Model name. Defaults to the configured generation model."),
+		),
+		mcp.WithString("size",
+			mcp.Description("Optional size or resolution (e.g. 1:1, 4K, 1024*1024) used to look up a size-specific price."),
+		),
+		mcp.WithString("n",
+			mcp.Description("Number of images. Defaults to 1."),
+		),
+	)
+
+	opts.addTool(s, estimateCostTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		provider := req.GetString("provider", opts.Provider)
+		model := req.GetString("model", opts.GenModel)
+		size := req.GetString("size", "")
+		n := req.GetInt("n", 1)
+		if n <= 0 {
+			n = 1
+		}
+
+		if len(opts.Pricing) == 0 {
+			return newInvalidArgumentResult("pricing table is not configured (set GENAI_PRICING)"), nil
+		}
+
+		key, entry, ok := lookupPrice(opts.Pricing, provider, model)
+		if !ok {
+			return newToolErrorResultWithCode(common.ErrCodeNotFound, false,
+				fmt.Sprintf("no pricing configured for provider %q model %q", provider, model)), nil
+		}
+
+		unitPrice := entry.unitPrice(size)
+
+		estimate := costEstimate{
+			Provider:   provider,
+			Model:      model,
+			Size:       size,
+			N:          n,
+			PricingKey: key,
+			UnitPrice:  unitPrice,
+			Total:      unitPrice * float64(n),
+			Currency:   entry.Currency,
+		}
+
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"provider": provider,
+			"model":    model,
+			"size":     size,
+			"n":        n,
+			"total":    estimate.Total,
+		}).Info("Estimated generation cost")
+
+		data, err := json.Marshal(estimate)
+		if err != nil {
+			return newToolErrorResult("failed to encode cost estimate", err), nil
+		}
+		return mcp.NewToolResultText(string(data)), nil
+	})
+}
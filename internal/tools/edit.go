@@ -0,0 +1,107 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/oss"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// editFunc 统一编辑工具调用的 provider 编辑实现：同步 provider 返回图片，异步 provider 返回 task_id
+type editFunc func(ctx context.Context, prompt string, imageURLs []string) (image, taskID string, err error)
+
+// unifiedEditProvider 统一编辑工具所需的 provider 信息
+type unifiedEditProvider struct {
+	Prefix string // 工具名前缀，如 wan，用于日志、上传标签与查询工具提示
+	Name   string // 展示名称，如 Wan
+	// URLOnly 为 true 时 provider 只接受图片 URL，data URI 会先上传到 OSS 再替换为 URL
+	URLOnly bool
+	// MaxImages 模型自身允许的最大输入图片数，0 表示未知（仅受 GENAI_MAX_EDIT_IMAGES 限制）
+	MaxImages int
+	Edit      editFunc
+}
+
+// registerEditImageTool 注册与 provider 无关的 edit_image 工具：
+// 同时接受图片 URL 与 data URI，对只支持 URL 的 provider（Wan）自动将 data URI 上传到 OSS 后替换为 URL，
+// 客户端无需关心当前后端的输入格式要求。
+func registerEditImageTool(s *server.MCPServer, opts Options, p unifiedEditProvider) {
+	editTool := mcp.NewTool(
+		"edit_image",
+		mcp.WithDescription(fmt.Sprintf("Edit images with the active provider (%s) using a text prompt. Accepts image URLs and base64 data URIs regardless of provider; data URIs are uploaded automatically when the provider only accepts URLs. Returns the edited image, or a task_id for asynchronous providers.", p.Name)),
+		mcp.WithString("prompt",
+			mcp.Required(),
+			mcp.Description("Text prompt describing how to edit the image."),
+		),
+		mcp.WithString("image_urls",
+			mcp.Required(),
+			mcp.Description("JSON array of image URLs or data URIs to edit. Example: [\"url1\", \"data:image/png;base64,...\"]. A single value or one URL per line is also accepted."),
+		),
+	)
+
+	opts.addTool(s, editTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		prompt, err := req.RequireString("prompt")
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).Error("Failed to get prompt parameter for edit_image")
+			return newInvalidArgumentResult(fmt.Sprintf("prompt parameter is required: %v", err)), nil
+		}
+
+		imageURLs, errResult := requireImageURLs(ctx, req, "image_urls", true)
+		if errResult != nil {
+			return errResult, nil
+		}
+		if err := opts.checkEditImageCount(len(imageURLs), p.MaxImages); err != nil {
+			common.WithRequestID(ctx).WithError(err).WithField("provider", p.Prefix).Warn("Rejected edit_image request")
+			return newInvalidArgumentResult(err.Error()), nil
+		}
+
+		ctx = withUploadTags(ctx, p.Prefix, "edit")
+		uploaded := 0
+		if p.URLOnly {
+			ctx, imageURLs, uploaded, err = oss.UploadDataURIInputs(ctx, opts.OSSClient, opts.OSSBucket, imageURLs)
+			if err != nil {
+				common.WithRequestID(ctx).WithError(err).WithField("provider", p.Prefix).Error("Failed to upload data URI inputs for edit_image")
+				return newToolErrorResult("failed to upload input images", err), nil
+			}
+		}
+
+		prompts := opts.preparePrompt(ctx, prompt)
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"provider":         p.Prefix,
+			"prompt":           prompt,
+			"effective_prompt": prompts.EffectivePrompt,
+			"image_count":      len(imageURLs),
+			"uploaded_inputs":  uploaded,
+		}).Info("Editing image with unified edit tool")
+
+		ctx = opts.routeModel(ctx, routeEdit, &prompts)
+		image, taskID, err := p.Edit(ctx, prompts.EffectivePrompt, imageURLs)
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+				"provider":    p.Prefix,
+				"prompt":      prompt,
+				"image_count": len(imageURLs),
+			}).Error("Unified edit tool failed")
+			return newToolErrorResult("failed to edit image", err), nil
+		}
+
+		result := generationResult{Image: image, TaskID: taskID, promptInfo: prompts}
+		if taskID != "" {
+			common.WithRequestID(ctx).WithFields(map[string]interface{}{
+				"provider": p.Prefix,
+				"task_id":  taskID,
+			}).Info("Unified edit tool created task")
+			return newGenerationResult(result,
+				fmt.Sprintf("edit_image task_id: %s (query it with %s_query_edit_image_task)", taskID, p.Prefix)), nil
+		}
+
+		common.WithRequestID(ctx).WithFields(common.MergeFields(
+			map[string]interface{}{"provider": p.Prefix},
+			imageLogFields("edited_url", image),
+		)).Info("Unified edit tool finished")
+		return newGenerationResult(result, fmt.Sprintf("Edited image: %s", image)), nil
+	})
+}
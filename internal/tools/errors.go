@@ -0,0 +1,43 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"genai-mcp/common"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// toolError MCP tool 结构化错误内容，以 JSON 形式放在错误结果的文本中，
+// 便于 LLM 客户端根据 code / retryable 决定重试、修改输入还是上报。
+type toolError struct {
+	Code      common.ErrorCode `json:"code"`
+	Message   string           `json:"message"`
+	Retryable bool             `json:"retryable"`
+}
+
+// newToolErrorResult 根据底层错误生成结构化错误结果，错误码与可重试标记由 common.ClassifyError 推断
+func newToolErrorResult(message string, err error) *mcp.CallToolResult {
+	classified := common.ClassifyError(err)
+	return newToolErrorResultWithCode(classified.Code, classified.Retryable, fmt.Sprintf("%s: %v", message, err))
+}
+
+// newInvalidArgumentResult 生成参数错误的结构化错误结果
+func newInvalidArgumentResult(message string) *mcp.CallToolResult {
+	return newToolErrorResultWithCode(common.ErrCodeInvalidArgument, false, message)
+}
+
+// newToolErrorResultWithCode 使用指定错误码生成结构化错误结果
+func newToolErrorResultWithCode(code common.ErrorCode, retryable bool, message string) *mcp.CallToolResult {
+	payload, err := json.Marshal(toolError{
+		Code:      code,
+		Message:   message,
+		Retryable: retryable,
+	})
+	if err != nil {
+		// 理论上不会发生，退化为纯文本错误
+		return mcp.NewToolResultError(message)
+	}
+	return mcp.NewToolResultError(string(payload))
+}
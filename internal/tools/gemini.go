@@ -2,7 +2,6 @@ package tools
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -14,52 +13,59 @@ import (
 )
 
 // RegisterGeminiTools 注册 Gemini 图片生成和编辑的 MCP tools
-func RegisterGeminiTools(s *server.MCPServer, geminiClient gemini.GenimiIface, modelName string) error {
+func RegisterGeminiTools(s *server.MCPServer, geminiClient gemini.GenimiIface, modelName string, opts Options) error {
 	// 注册图片生成工具
 	generateImageTool := mcp.NewTool(
 		"gemini_generate_image",
 		mcp.WithDescription("Generate an image using Gemini AI based on a text prompt. Returns the generated image URL or data URI."),
 		mcp.WithString("prompt",
-			mcp.Required(),
-			mcp.Description("Text prompt describing the image to generate"),
+			mcp.Description("Text prompt describing the image to generate. Required unless prompts is given."),
 		),
+		withWeightedPrompts(),
+		withOutputMIME(),
 	)
 
-	s.AddTool(generateImageTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		// 获取参数
-		prompt, err := req.RequireString("prompt")
-		if err != nil {
-			common.WithError(err).Error("Failed to get prompt parameter")
-			return mcp.NewToolResultError(fmt.Sprintf("prompt parameter is required: %v", err)), nil
+	opts.addTool(s, generateImageTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		// 获取参数：prompt 或加权提示词列表 prompts
+		prompt, errResult := getGeneratePrompt(req)
+		if errResult != nil {
+			return errResult, nil
 		}
 
-		common.WithField("prompt", prompt).Info("Generating image with Gemini")
+		outputMIME, errResult := getOutputMIME(req)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		prompts := opts.preparePrompt(ctx, prompt)
+		opts.enhancePrompt(ctx, &prompts)
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"prompt":           prompt,
+			"effective_prompt": prompts.EffectivePrompt,
+			"output_mime":      outputMIME,
+		}).Info("Generating image with Gemini")
 
 		// 调用 Gemini 生成图片
-		imageURL, err := geminiClient.GenerateImage(ctx, prompt)
+		ctx = withUploadTags(ctx, "gemini", "generate")
+		ctx = opts.routeModel(ctx, routeGenerate, &prompts)
+		imageURL, err := geminiClient.GenerateImage(ctx, prompts.EffectivePrompt, outputMIME)
 		if err != nil {
-			common.WithError(err).WithField("prompt", prompt).Error("Failed to generate image")
-			return mcp.NewToolResultError(fmt.Sprintf("failed to generate image: %v", err)), nil
+			common.WithRequestID(ctx).WithError(err).WithField("prompt", prompt).Error("Failed to generate image")
+			return newToolErrorResult("failed to generate image", err), nil
 		}
 
 		// 日志中避免输出完整 base64 内容
-		fields := map[string]interface{}{
+		common.WithRequestID(ctx).WithFields(common.MergeFields(map[string]interface{}{
 			"prompt": prompt,
-		}
-		for k, v := range imageLogFields("image_url", imageURL) {
-			fields[k] = v
-		}
-		common.WithFields(fields).Info("Image generated successfully")
+		}, imageLogFields("image_url", imageURL))).Info("Image generated successfully")
 
-		// 返回结果
-		return mcp.NewToolResultText(fmt.Sprintf("Generated image: %s", imageURL)), nil
+		// 返回结果（结构化内容中附带实际发送的提示词）
+		return newGenerationResult(generationResult{Image: imageURL, promptInfo: prompts},
+			fmt.Sprintf("Generated image: %s", imageURL)), nil
 	})
 
-	// 根据模型名生成 description
-	maxImages := 1
-	if modelName == "gemini-3-pro-image-preview" {
-		maxImages = 14
-	}
+	// 根据模型名与有效的最大图片数（模型上限与 GENAI_MAX_EDIT_IMAGES 取较小值）生成 description
+	maxImages := opts.editImageLimit(geminiClient.MaxEditImages())
 	editImageDescription := fmt.Sprintf("Edit images using Gemini AI based on a text prompt. Takes image URLs (array) and a prompt, returns the edited image URL or data URI. Model '%s' supports up to %d image(s).", modelName, maxImages)
 
 	// 注册图片编辑工具
@@ -72,71 +78,163 @@ func RegisterGeminiTools(s *server.MCPServer, geminiClient gemini.GenimiIface, m
 		),
 		mcp.WithString("image_urls",
 			mcp.Required(),
-			mcp.Description("JSON array of image URLs or data URIs to edit. Example: [\"url1\", \"url2\"]"),
+			mcp.Description("JSON array of image URLs or data URIs to edit. Example: [\"url1\", \"url2\"]. A single value or one URL per line is also accepted."),
 		),
+		withOutputMIME(),
 	)
 
-	s.AddTool(editImageTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	opts.addTool(s, editImageTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		// 获取参数
 		prompt, err := req.RequireString("prompt")
 		if err != nil {
-			common.WithError(err).Error("Failed to get prompt parameter")
-			return mcp.NewToolResultError(fmt.Sprintf("prompt parameter is required: %v", err)), nil
+			common.WithRequestID(ctx).WithError(err).Error("Failed to get prompt parameter")
+			return newInvalidArgumentResult(fmt.Sprintf("prompt parameter is required: %v", err)), nil
 		}
 
-		imageURLsJSON, err := req.RequireString("image_urls")
-		if err != nil {
-			common.WithError(err).Error("Failed to get image_urls parameter")
-			return mcp.NewToolResultError(fmt.Sprintf("image_urls parameter is required: %v", err)), nil
+		// 宽松解析 image_urls（JSON 数组 / 单个值 / 按行分隔），Gemini 同时支持 URL 与 data URI
+		imageURLs, errResult := requireImageURLs(ctx, req, "image_urls", true)
+		if errResult != nil {
+			return errResult, nil
 		}
-
-		// 解析 JSON 数组
-		var imageURLs []string
-		if err := json.Unmarshal([]byte(imageURLsJSON), &imageURLs); err != nil {
-			common.WithError(err).WithField("image_urls", imageURLsJSON).Error("Failed to parse image_urls as JSON array")
-			return mcp.NewToolResultError(fmt.Sprintf("image_urls must be a valid JSON array: %v", err)), nil
+		if err := opts.checkEditImageCount(len(imageURLs), geminiClient.MaxEditImages()); err != nil {
+			common.WithRequestID(ctx).WithError(err).Warn("Rejected Gemini edit request")
+			return newInvalidArgumentResult(err.Error()), nil
 		}
 
-		if len(imageURLs) == 0 {
-			return mcp.NewToolResultError("image_urls array cannot be empty"), nil
+		outputMIME, errResult := getOutputMIME(req)
+		if errResult != nil {
+			return errResult, nil
 		}
 
+		prompts := opts.preparePrompt(ctx, prompt)
 		fields := map[string]interface{}{
-			"prompt":      prompt,
-			"image_count": len(imageURLs),
+			"prompt":           prompt,
+			"effective_prompt": prompts.EffectivePrompt,
+			"image_count":      len(imageURLs),
+			"output_mime":      outputMIME,
 		}
-		common.WithFields(fields).Info("Editing image with Gemini")
+		common.WithRequestID(ctx).WithFields(fields).Info("Editing image with Gemini")
 
 		// 调用 Gemini 编辑图片
-		editedImageURL, err := geminiClient.EditImage(ctx, prompt, imageURLs)
+		ctx = withUploadTags(ctx, "gemini", "edit")
+		ctx = opts.routeModel(ctx, routeEdit, &prompts)
+		editedImageURL, err := geminiClient.EditImage(ctx, prompts.EffectivePrompt, imageURLs, outputMIME)
 		if err != nil {
 			errFields := map[string]interface{}{
 				"prompt":      prompt,
 				"image_count": len(imageURLs),
 			}
-			common.WithError(err).WithFields(errFields).Error("Failed to edit image")
-			return mcp.NewToolResultError(fmt.Sprintf("failed to edit image: %v", err)), nil
+			common.WithRequestID(ctx).WithError(err).WithFields(errFields).Error("Failed to edit image")
+			return newToolErrorResult("failed to edit image", err), nil
 		}
 
-		successFields := map[string]interface{}{
+		common.WithRequestID(ctx).WithFields(common.MergeFields(map[string]interface{}{
 			"prompt":      prompt,
 			"image_count": len(imageURLs),
+		}, imageLogFields("edited_url", editedImageURL))).Info("Image edited successfully")
+
+		// 返回结果（这里可以包含完整 base64 或 URL，因为这是返回给调用方，而不是日志）
+		return newGenerationResult(generationResult{Image: editedImageURL, promptInfo: prompts},
+			fmt.Sprintf("Edited image: %s", editedImageURL)), nil
+	})
+
+	// 注册风格参考生成工具：参考图片只约束风格，内容由 prompt 描述
+	generateWithStyleTool := mcp.NewTool(
+		"gemini_generate_with_style",
+		mcp.WithDescription("Generate a new image using Gemini AI from a text prompt, guided by one or more style-reference images. The references set the visual style (palette, lighting, medium); the prompt sets the content. Returns the generated image URL or data URI."),
+		mcp.WithString("prompt",
+			mcp.Required(),
+			mcp.Description("Text prompt describing the image to generate"),
+		),
+		mcp.WithString("style_image_urls",
+			mcp.Required(),
+			mcp.Description("JSON array of style-reference image URLs or data URIs. Example: [\"url1\", \"url2\"]. A single value or one URL per line is also accepted."),
+		),
+		withOutputMIME(),
+	)
+
+	opts.addTool(s, generateWithStyleTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		// 获取参数
+		prompt, err := req.RequireString("prompt")
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).Error("Failed to get prompt parameter")
+			return newInvalidArgumentResult(fmt.Sprintf("prompt parameter is required: %v", err)), nil
 		}
-		for k, v := range imageLogFields("edited_url", editedImageURL) {
-			successFields[k] = v
+
+		styleImageURLs, errResult := requireImageURLs(ctx, req, "style_image_urls", true)
+		if errResult != nil {
+			return errResult, nil
 		}
-		common.WithFields(successFields).Info("Image edited successfully")
 
-		// 返回结果（这里可以包含完整 base64 或 URL，因为这是返回给调用方，而不是日志）
-		return mcp.NewToolResultText(fmt.Sprintf("Edited image: %s", editedImageURL)), nil
+		outputMIME, errResult := getOutputMIME(req)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		prompts := opts.preparePrompt(ctx, prompt)
+		opts.enhancePrompt(ctx, &prompts)
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"prompt":            prompt,
+			"effective_prompt":  prompts.EffectivePrompt,
+			"style_image_count": len(styleImageURLs),
+			"output_mime":       outputMIME,
+		}).Info("Generating image with style references with Gemini")
+
+		// 调用 Gemini 按风格参考生成图片
+		ctx = withUploadTags(ctx, "gemini", "generate_with_style")
+		ctx = opts.routeModel(ctx, routeGenerate, &prompts)
+		imageURL, err := geminiClient.GenerateWithStyle(ctx, prompts.EffectivePrompt, styleImageURLs, outputMIME)
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+				"prompt":            prompt,
+				"style_image_count": len(styleImageURLs),
+			}).Error("Failed to generate image with style references")
+			return newToolErrorResult("failed to generate image with style references", err), nil
+		}
+
+		common.WithRequestID(ctx).WithFields(common.MergeFields(map[string]interface{}{
+			"prompt":            prompt,
+			"style_image_count": len(styleImageURLs),
+		}, imageLogFields("image_url", imageURL))).Info("Image generated with style references successfully")
+
+		return newGenerationResult(generationResult{Image: imageURL, promptInfo: prompts},
+			fmt.Sprintf("Generated image: %s", imageURL)), nil
 	})
 
+	// 注册统一编辑工具（Gemini 同时支持 URL 与 data URI，同步返回图片）
+	registerEditImageTool(s, opts, unifiedEditProvider{
+		Prefix:    "gemini",
+		Name:      "Gemini",
+		MaxImages: geminiClient.MaxEditImages(),
+		Edit: func(ctx context.Context, prompt string, imageURLs []string) (string, string, error) {
+			image, err := geminiClient.EditImage(ctx, prompt, imageURLs, "")
+			return image, "", err
+		},
+	})
+
+	// 注册生成后编辑的组合工具（同步 provider，两步直接串行调用）
+	chain := chainProvider{
+		Prefix: "gemini",
+		Name:   "Gemini",
+		Generate: func(ctx context.Context, prompt string) (string, error) {
+			return geminiClient.GenerateImage(ctx, prompt, "")
+		},
+		Edit: func(ctx context.Context, prompt string, imageURLs []string) (string, error) {
+			return geminiClient.EditImage(ctx, prompt, imageURLs, "")
+		},
+	}
+	registerGenerateThenEditTool(s, opts, chain)
+
+	// 注册多轮编辑会话工具（复用生成后编辑的同步编辑实现）
+	registerEditSessionTool(s, opts, chain)
+
 	return nil
 }
 
 // imageLogFields 生成用于日志的图片字段，避免在日志中打印完整 base64 内容
 // - 对于 data URI，仅记录是否为 data URI 以及长度
 // - 对于普通 URL，记录完整 URL（通常为短链接或 OSS URL）
+// 每次返回新的 map，与其它字段组合时使用 common.MergeFields
 func imageLogFields(fieldName, ref string) map[string]interface{} {
 	fields := map[string]interface{}{}
 	if strings.HasPrefix(ref, "data:") {
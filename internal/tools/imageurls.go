@@ -0,0 +1,216 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/utils"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// trailingCommaPattern 匹配 JSON 数组中多余的尾随逗号，例如 ["a", "b",]
+var trailingCommaPattern = regexp.MustCompile(`,\s*]`)
+
+// imageURLProblem 单个 image_urls 条目的问题描述
+type imageURLProblem struct {
+	Index  int    `json:"index"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+// parseImageURLs 宽松解析 image_urls 参数，统一为 []string 并逐项校验。
+//
+// 支持的输入形式：
+//   - JSON 数组：["url1", "url2"]（容忍尾随逗号）
+//   - 单个 JSON 字符串："url"
+//   - 单个 URL / data URI，或按行分隔的多个 URL
+//
+// allowDataURI 为 false 时（如 Wan 仅支持 URL），data URI 会被视为无效条目。
+// 返回有效条目与逐项问题；整体无法解析时返回 error。
+func parseImageURLs(raw string, allowDataURI bool) ([]string, []imageURLProblem, error) {
+	entries, err := splitImageURLs(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil, fmt.Errorf("image_urls cannot be empty")
+	}
+
+	var valid []string
+	var problems []imageURLProblem
+	for i, entry := range entries {
+		if reason := validateImageURLEntry(entry, allowDataURI); reason != "" {
+			problems = append(problems, imageURLProblem{
+				Index:  i,
+				Value:  utils.TruncateForLog(entry, 100),
+				Reason: reason,
+			})
+			continue
+		}
+		valid = append(valid, entry)
+	}
+
+	return valid, problems, nil
+}
+
+// splitImageURLs 将原始参数拆分为条目列表（尚未校验）
+func splitImageURLs(raw string) ([]string, error) {
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return nil, nil
+	}
+
+	var entries []string
+	switch {
+	case strings.HasPrefix(s, "["):
+		if err := json.Unmarshal([]byte(s), &entries); err != nil {
+			// 容忍尾随逗号后再尝试一次
+			if err2 := json.Unmarshal([]byte(trailingCommaPattern.ReplaceAllString(s, "]")), &entries); err2 != nil {
+				return nil, fmt.Errorf("image_urls looks like a JSON array but could not be parsed: %v", err)
+			}
+		}
+	case strings.HasPrefix(s, "\""):
+		var single string
+		if err := json.Unmarshal([]byte(s), &single); err != nil {
+			return nil, fmt.Errorf("image_urls looks like a JSON string but could not be parsed: %v", err)
+		}
+		entries = []string{single}
+	default:
+		// 单个值或按行分隔的列表（data URI 中包含逗号，因此不按逗号拆分）
+		for _, line := range strings.Split(s, "\n") {
+			line = strings.TrimSpace(line)
+			line = strings.TrimSuffix(line, ",")
+			line = strings.Trim(line, "\"'")
+			if line != "" {
+				entries = append(entries, line)
+			}
+		}
+	}
+
+	normalized := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		normalized = append(normalized, strings.TrimSpace(entry))
+	}
+	return normalized, nil
+}
+
+// validateImageURLEntry 校验单个条目，返回问题描述；合法时返回空字符串
+func validateImageURLEntry(entry string, allowDataURI bool) string {
+	if entry == "" {
+		return "empty entry"
+	}
+
+	if strings.HasPrefix(entry, "data:") {
+		if !allowDataURI {
+			return "data URIs are not supported by this provider; use an http(s) URL"
+		}
+		header, payload, ok := strings.Cut(entry, ",")
+		if !ok || payload == "" || !strings.HasSuffix(header, ";base64") || !strings.HasPrefix(header, "data:image/") {
+			return "invalid data URI: expected data:image/<type>;base64,<data>"
+		}
+		return ""
+	}
+
+	u, err := url.Parse(entry)
+	if err != nil {
+		return fmt.Sprintf("invalid URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		if allowDataURI {
+			return "unsupported URL: expected an http(s) URL or a data URI"
+		}
+		return "unsupported URL: expected an http(s) URL"
+	}
+	if u.Host == "" {
+		return "invalid URL: missing host"
+	}
+	if u.Scheme == "http" && utils.GetImageHostPolicy().RequireHTTPS {
+		return utils.ErrPlainHTTPImage
+	}
+	return ""
+}
+
+// formatImageURLProblems 将逐项问题格式化为便于阅读的错误信息
+func formatImageURLProblems(problems []imageURLProblem) string {
+	parts := make([]string, 0, len(problems))
+	for _, p := range problems {
+		parts = append(parts, fmt.Sprintf("[%d] %s", p.Index, p.Reason))
+	}
+	return "invalid image_urls entries: " + strings.Join(parts, "; ")
+}
+
+// requireImageURLs 从请求中读取并解析 image_urls 参数。
+// 出错时返回可直接作为 tool 结果的错误结果。
+func requireImageURLs(ctx context.Context, req mcp.CallToolRequest, name string, allowDataURI bool) ([]string, *mcp.CallToolResult) {
+	raw, err := req.RequireString(name)
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithField("param", name).Error("Failed to get image URLs parameter")
+		return nil, newInvalidArgumentResult(fmt.Sprintf("%s parameter is required: %v", name, err))
+	}
+
+	imageURLs, problems, err := parseImageURLs(raw, allowDataURI)
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithField(name, utils.TruncateForLog(raw, 200)).Error("Failed to parse image URLs parameter")
+		return nil, newInvalidArgumentResult(fmt.Sprintf("%s: %v", name, err))
+	}
+	if len(problems) > 0 {
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"param":    name,
+			"problems": problems,
+		}).Error("Image URLs parameter contains invalid entries")
+		return nil, newInvalidArgumentResult(formatImageURLProblems(problems))
+	}
+
+	return imageURLs, nil
+}
+
+// registerNormalizeImageURLsTool 注册 normalize_image_urls 工具：校验并规范化 image_urls 参数，不调用 provider
+func registerNormalizeImageURLsTool(s *server.MCPServer, opts Options) {
+	normalizeTool := mcp.NewTool(
+		"normalize_image_urls",
+		mcp.WithDescription("Validate and normalize an image_urls value (JSON array, single string, or newline-separated list) into a JSON array, reporting problems per entry."),
+		mcp.WithString("image_urls",
+			mcp.Required(),
+			mcp.Description("Image URLs or data URIs as a JSON array, a single value, or one per line."),
+		),
+		mcp.WithBoolean("allow_data_uri",
+			mcp.Description("Whether base64 data URIs are acceptable (false for URL-only providers such as Wan). Defaults to true."),
+		),
+	)
+
+	opts.addTool(s, normalizeTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		raw, err := req.RequireString("image_urls")
+		if err != nil {
+			return newInvalidArgumentResult(fmt.Sprintf("image_urls parameter is required: %v", err)), nil
+		}
+		allowDataURI := req.GetBool("allow_data_uri", true)
+
+		imageURLs, problems, err := parseImageURLs(raw, allowDataURI)
+		if err != nil {
+			return newInvalidArgumentResult(err.Error()), nil
+		}
+		if imageURLs == nil {
+			imageURLs = []string{}
+		}
+		if problems == nil {
+			problems = []imageURLProblem{}
+		}
+
+		data, err := json.Marshal(map[string]interface{}{
+			"image_urls": imageURLs,
+			"problems":   problems,
+			"valid":      len(problems) == 0,
+		})
+		if err != nil {
+			return newToolErrorResult("failed to encode normalized image_urls", err), nil
+		}
+		return mcp.NewToolResultText(string(data)), nil
+	})
+}
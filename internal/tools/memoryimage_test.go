@@ -0,0 +1,67 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/oss"
+)
+
+// TestReadMemoryStoreImageWithDefaultBaseURL 验证默认 OSS_MEMORY_BASE_URL（localhost）下，
+// 本服务读取自己 /image/{id} 结果的各条路径直接读取内存存储，而不是经网络下载被内网地址拦截
+func TestReadMemoryStoreImageWithDefaultBaseURL(t *testing.T) {
+	t.Setenv("GENAI_API_KEY", "test-key")
+	t.Setenv("OSS_BACKEND", common.OSSBackendMemory)
+	t.Setenv("OSS_MEMORY_BASE_URL", "")
+	cfg, err := common.ReloadConfig()
+	if err != nil {
+		t.Fatalf("ReloadConfig: %v", err)
+	}
+	if want := "http://localhost:" + cfg.ServerPort; cfg.OSSMemoryBaseURL != want {
+		t.Fatalf("OSSMemoryBaseURL = %q, want default %q", cfg.OSSMemoryBaseURL, want)
+	}
+
+	oss.ResetSharedClients()
+	t.Cleanup(oss.ResetSharedClients)
+	store, err := oss.SharedMemoryStoreFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("SharedMemoryStoreFromConfig: %v", err)
+	}
+
+	var buf bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	want := buf.Bytes()
+	ctx := context.Background()
+	url, err := store.UploadFileWithURL(ctx, cfg.OSSBucket, "images/2026-01-01/result.png", bytes.NewReader(want), "image/png", 0)
+	if err != nil {
+		t.Fatalf("UploadFileWithURL: %v", err)
+	}
+
+	readers := map[string]func() ([]byte, string, error){
+		"task image": func() ([]byte, string, error) { return taskImageData(ctx, url, "") },
+		"archive": func() ([]byte, string, error) {
+			return readArchivedImage(ctx, archivedImage{Ref: url})
+		},
+		"input image": func() ([]byte, string, error) { return fetchInputImage(ctx, url) },
+	}
+	for name, read := range readers {
+		t.Run(name, func(t *testing.T) {
+			data, mimeType, err := read()
+			if err != nil {
+				t.Fatalf("reading %s: %v", url, err)
+			}
+			if !bytes.Equal(data, want) || mimeType != "image/png" {
+				t.Fatalf("got %d bytes of %s, want the stored %d-byte image/png", len(data), mimeType, len(want))
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/enhance"
+	"genai-mcp/internal/oss"
+	"genai-mcp/internal/utils"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Options tools 层的通用配置，由 server 根据 common.Config 构造后传给各 Register*Tools
+type Options struct {
+	// 当前 provider 及其模型，用于通用工具的默认值
+	Provider  string
+	GenModel  string
+	EditModel string
+
+	// MaxOutputResolution 允许请求的最大输出分辨率（长边像素），0 表示不限制
+	MaxOutputResolution int
+
+	// MaxEditImages 单次编辑请求允许的最大输入图片数（GENAI_MAX_EDIT_IMAGES），0 表示不限制
+	MaxEditImages int
+
+	// Pricing 价格表，用于 estimate_cost 工具
+	Pricing map[string]PriceEntry
+
+	// 通用工具（如 convert_image）的图片输出方式，与 GENAI_IMAGE_FORMAT 一致。
+	// ImageFormat 为 url 时使用 OSSClient 上传到 OSSBucket；
+	// 只要 OSS 配置齐全就会创建 OSSClient（用于压缩包与 edit_image 输入图片上传）。
+	ImageFormat string
+	OSSClient   oss.OSSIface
+	OSSBucket   string
+
+	// Base64MaxBytes base64 输出时内联图片的最大字节数（GENAI_BASE64_MAX_BYTES），超过时改为上传 OSS，0 表示不限制
+	Base64MaxBytes int
+
+	// ThumbnailSize 结果图片上传 OSS 时附带生成的缩略图长边像素数（GENAI_GENERATE_THUMBNAIL），0 表示不生成
+	ThumbnailSize int
+
+	// MaxURLExpiry url_expiry_seconds 参数允许的最大签名 URL 有效期（秒，OSS_URL_MAX_EXPIRY_SECONDS）
+	MaxURLExpiry int64
+
+	// Poll 查询工具 wait_seconds 阻塞等待时的轮询参数
+	Poll PollOptions
+
+	// AdminToken 管理类工具的访问令牌，为空时不注册管理类工具
+	AdminToken string
+
+	// ToolTimeout 单次工具调用的整体超时时间，0 表示不限制
+	ToolTimeout time.Duration
+
+	// MaxRequestTimeout 生成 / 编辑工具 timeout_seconds 参数允许的最大值（GENAI_TIMEOUT_MAX_SECONDS，不小于 GENAI_TIMEOUT_SECONDS）
+	MaxRequestTimeout time.Duration
+
+	// Wan 编辑工具收到空提示词时的处理方式（reject / omit / default）及 default 时使用的提示词
+	WanEditEmptyPrompt   string
+	WanEditDefaultPrompt string
+
+	// DetectLanguage 是否检测提示词语言（GENAI_DETECT_LANGUAGE）
+	DetectLanguage bool
+	// 按提示词语言路由的生成 / 编辑模型（语言代码 → 模型）
+	LanguageGenModels  map[string]string
+	LanguageEditModels map[string]string
+
+	// Enhancer 生成前扩写提示词（GENAI_ENHANCE_PROMPT），为 nil 时不扩写
+	Enhancer enhance.Enhancer
+
+	// EnabledTools 允许注册的工具名集合（GENAI_ENABLED_TOOLS），为 nil 时注册全部工具
+	EnabledTools map[string]bool
+
+	// coalescer 合并并发的相同生成 / 编辑请求（GENAI_COALESCE_REQUESTS），为 nil 时不合并
+	coalescer *coalescer
+
+	// sessions edit_session 工具的多轮编辑会话表（GENAI_EDIT_SESSION_TTL_MINUTES），为 nil 时不注册该工具
+	sessions *sessionStore
+
+	// topUps 部分成功时补齐所需的生成任务创建参数（GENAI_TOP_UP_PARTIAL_RESULTS），为 nil 时只报告不补齐
+	topUps *topUpStore
+	// quota 生成 / 编辑工具的每日用量上限（GENAI_DAILY_REQUEST_LIMIT / GENAI_DAILY_COST_LIMIT），为 nil 时不限
+	quota *quota
+}
+
+// NewOptionsFromConfig 从通用配置创建 tools 配置
+func NewOptionsFromConfig(cfg *common.Config) (Options, error) {
+	opts := Options{
+		Provider:  cfg.GenAIProvider,
+		GenModel:  cfg.GenAIGenModelName,
+		EditModel: cfg.GenAIEditModelName,
+
+		Poll:              newPollOptionsFromConfig(cfg),
+		ToolTimeout:       time.Duration(cfg.ToolTimeoutSeconds) * time.Second,
+		MaxRequestTimeout: common.NewTimeoutScaling(cfg).Ceiling(),
+		AdminToken:        cfg.AdminToken,
+
+		MaxEditImages: cfg.MaxEditImages,
+
+		WanEditEmptyPrompt:   cfg.WanEditEmptyPrompt,
+		WanEditDefaultPrompt: cfg.WanEditDefaultPrompt,
+
+		DetectLanguage:     cfg.DetectLanguage,
+		LanguageGenModels:  cfg.LanguageGenModels,
+		LanguageEditModels: cfg.LanguageEditModels,
+	}
+
+	if cfg.MaxOutputResolution != "" {
+		px, err := utils.ParseResolution(cfg.MaxOutputResolution)
+		if err != nil {
+			return opts, fmt.Errorf("invalid GENAI_MAX_OUTPUT_RESOLUTION: %w", err)
+		}
+		opts.MaxOutputResolution = px
+	}
+
+	pricing, err := parsePricing(cfg.GenAIPricing)
+	if err != nil {
+		return opts, fmt.Errorf("invalid GENAI_PRICING: %w", err)
+	}
+	opts.Pricing = pricing
+
+	if len(cfg.GenAIEnabledTools) > 0 {
+		opts.EnabledTools = make(map[string]bool, len(cfg.GenAIEnabledTools))
+		for _, name := range cfg.GenAIEnabledTools {
+			opts.EnabledTools[name] = true
+		}
+	}
+
+	enhancer, err := enhance.NewFromConfig(cfg)
+	if err != nil {
+		return opts, err
+	}
+	opts.Enhancer = enhancer
+
+	if cfg.CoalesceRequests {
+		opts.coalescer = newCoalescer()
+	}
+	opts.sessions = newSessionStore(time.Duration(cfg.EditSessionTTLMinutes) * time.Minute)
+	if cfg.TopUpPartialResults {
+		opts.topUps = newTopUpStore()
+	}
+	if cfg.DailyCostLimit > 0 && len(opts.Pricing) == 0 {
+		return opts, fmt.Errorf("GENAI_DAILY_COST_LIMIT requires GENAI_PRICING to estimate request costs")
+	}
+	if opts.quota, err = newQuotaFromConfig(cfg); err != nil {
+		return opts, err
+	}
+
+	opts.ImageFormat = cfg.GenAIImageFormat
+	opts.Base64MaxBytes = cfg.Base64MaxBytes
+	opts.ThumbnailSize = cfg.ThumbnailSize
+	opts.MaxURLExpiry = int64(cfg.OSSURLMaxExpirySeconds)
+	if opts.ImageFormat == "url" || cfg.IsOSSConfigured() {
+		ossClient, err := oss.SharedOSSClientFromConfig(cfg)
+		if err != nil {
+			return opts, fmt.Errorf("failed to create OSS client: %w", err)
+		}
+		opts.OSSClient = ossClient
+		opts.OSSBucket = cfg.OSSBucket
+	}
+
+	return opts, nil
+}
+
+// checkOutputResolution 校验请求的输出分辨率是否超出服务端限制。
+// requested 为空时使用 provider 的默认分辨率 defaultResolution 进行校验。
+// 未超限时返回 nil，否则返回描述原因的错误。
+func (o Options) checkOutputResolution(requested, defaultResolution string) error {
+	if o.MaxOutputResolution <= 0 {
+		return nil
+	}
+
+	effective := requested
+	if effective == "" {
+		effective = defaultResolution
+	}
+	if effective == "" {
+		return nil
+	}
+
+	px, err := utils.ParseResolution(effective)
+	if err != nil {
+		return fmt.Errorf("cannot validate output resolution %q against server limit: %w", effective, err)
+	}
+	if px > o.MaxOutputResolution {
+		return fmt.Errorf("requested output resolution %q (%dpx) exceeds server limit of %dpx", effective, px, o.MaxOutputResolution)
+	}
+	return nil
+}
+
+// editImageLimit 返回编辑输入图片数的有效上限：GENAI_MAX_EDIT_IMAGES 与模型自身上限 modelLimit 中较小的值。
+// modelLimit 为 0 表示模型上限未知；返回 0 表示不限制。
+func (o Options) editImageLimit(modelLimit int) int {
+	if o.MaxEditImages <= 0 {
+		return modelLimit
+	}
+	if modelLimit <= 0 || o.MaxEditImages < modelLimit {
+		return o.MaxEditImages
+	}
+	return modelLimit
+}
+
+// checkEditImageCount 校验编辑请求的输入图片数是否超出有效上限（见 editImageLimit），
+// 未超限时返回 nil，否则返回指明生效的是服务端上限还是模型上限的错误。
+func (o Options) checkEditImageCount(count, modelLimit int) error {
+	limit := o.editImageLimit(modelLimit)
+	if limit <= 0 || count <= limit {
+		return nil
+	}
+	if limit == o.MaxEditImages {
+		return fmt.Errorf("too many images: server allows at most %d image(s) per edit request (GENAI_MAX_EDIT_IMAGES), got %d", limit, count)
+	}
+	return fmt.Errorf("too many images: model supports at most %d image(s) per edit request, got %d", limit, count)
+}
+
+// generationTools 会触发付费 provider 调用的生成 / 编辑类工具：
+// 开启请求合并（GENAI_COALESCE_REQUESTS）时参与合并，并接受 timeout_seconds 参数；查询与管理类工具不在其中
+var generationTools = map[string]bool{
+	"gemini_generate_image":              true,
+	"gemini_edit_image":                  true,
+	"gemini_generate_with_style":         true,
+	"wan_create_generate_image_task":     true,
+	"wan_create_edit_image_task":         true,
+	"apimart_create_generate_image_task": true,
+	"apimart_create_edit_image_task":     true,
+	"stability_generate_image":           true,
+	"stability_edit_image":               true,
+	"edit_image":                         true,
+	"generate_then_edit":                 true,
+	"edit_session":                       true,
+}
+
+// urlOutputTools 结果可能是上传到 OSS 的签名 URL 的工具，接受 url_expiry_seconds 参数
+var urlOutputTools = map[string]bool{
+	"gemini_generate_image":               true,
+	"gemini_edit_image":                   true,
+	"gemini_generate_with_style":          true,
+	"wan_query_generate_image_task":       true,
+	"wan_query_generate_image_status":     true,
+	"wan_query_edit_image_task":           true,
+	"wan_query_tasks":                     true,
+	"apimart_query_generate_image_task":   true,
+	"apimart_query_generate_image_status": true,
+	"apimart_query_edit_image_task":       true,
+	"apimart_query_tasks":                 true,
+	"stability_generate_image":            true,
+	"stability_edit_image":                true,
+	"edit_image":                          true,
+	"generate_then_edit":                  true,
+	"edit_session":                        true,
+	"convert_image":                       true,
+	"wan_reformat_task_result":            true,
+	"apimart_reformat_task_result":        true,
+}
+
+// toolEnabled 判断工具是否在允许列表中（未配置允许列表时全部允许）
+func (o Options) toolEnabled(name string) bool {
+	return o.EnabledTools == nil || o.EnabledTools[name]
+}
+
+// addTool 在工具被允许时注册到 MCP 服务器，并记录注册 / 跳过的工具，
+// 各 Register*Tools 统一通过它注册工具，使 GENAI_ENABLED_TOOLS 之外的工具不会暴露给客户端。
+func (o Options) addTool(s *server.MCPServer, tool mcp.Tool, handler server.ToolHandlerFunc) {
+	if !o.toolEnabled(tool.Name) {
+		common.WithField("tool", tool.Name).Info("Skipped MCP tool not in GENAI_ENABLED_TOOLS")
+		return
+	}
+	if generationTools[tool.Name] {
+		withTimeoutSeconds()(&tool)
+		handler = withRequestTimeoutOverride(tool.Name, o.MaxRequestTimeout, handler)
+	}
+	if urlOutputTools[tool.Name] {
+		withURLExpirySeconds()(&tool)
+		handler = withURLExpiryOverride(tool.Name, o.MaxURLExpiry, handler)
+	}
+	if o.ThumbnailSize > 0 {
+		handler = withThumbnailURL(handler)
+	}
+	handler = withImageMIME(withRateLimit(handler))
+	if generationTools[tool.Name] {
+		withOutputs()(&tool)
+		handler = withImageRepresentations(tool.Name, o, handler)
+	}
+	handler = withTiming(tool.Name, handler)
+	if o.ToolTimeout > 0 {
+		handler = withToolTimeout(tool.Name, o.ToolTimeout, handler)
+	}
+	// 用量在合并之内计入：被合并的请求不调用 provider，不占用额度
+	if o.quota != nil && generationTools[tool.Name] {
+		handler = o.withQuota(tool.Name, handler)
+	}
+	if o.coalescer != nil && generationTools[tool.Name] {
+		handler = o.coalescer.withCoalescing(tool.Name, handler)
+	}
+	handler = withRequestID(tool.Name, handler)
+	s.AddTool(tool, handler)
+	common.WithField("tool", tool.Name).Info("Registered MCP tool")
+}
+
+// withToolTimeout 为工具处理函数设置整体截止时间（GENAI_TOOL_TIMEOUT_SECONDS），
+// 与各 provider 客户端的单次请求超时相互独立。超过截止时间时返回 timeout 错误结果。
+func withToolTimeout(name string, timeout time.Duration, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		toolCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		result, err := handler(toolCtx, req)
+		// 仅在整体截止时间触发（而非调用方取消）时改写结果
+		if errors.Is(toolCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			common.WithRequestID(ctx).WithFields(map[string]interface{}{
+				"tool":    name,
+				"timeout": timeout.String(),
+			}).Warn("Tool call exceeded overall timeout")
+			return newToolErrorResultWithCode(common.ErrCodeTimeout, true,
+				fmt.Sprintf("tool %s exceeded the overall timeout of %s", name, timeout)), nil
+		}
+		return result, err
+	}
+}
+
+// withTimeoutSeconds 生成 / 编辑工具的 timeout_seconds 参数定义
+func withTimeoutSeconds() mcp.ToolOption {
+	return mcp.WithNumber("timeout_seconds",
+		mcp.Description("Optional. Provider request timeout in seconds for this call only, replacing the server default (the server caps the maximum). Use it for requests known to be slow, such as 4K output."),
+	)
+}
+
+// withURLExpirySeconds 结果签名 URL 有效期参数，由 addTool 为 urlOutputTools 中的工具统一添加
+func withURLExpirySeconds() mcp.ToolOption {
+	return mcp.WithNumber("url_expiry_seconds",
+		mcp.Description("Optional. Lifetime in seconds of OSS result URLs returned by this call (e.g. short for previews, long for deliverables). When set, OSS result URLs are signed with this lifetime even if the server otherwise returns public, non-expiring URLs. Defaults to the server's URL mode and OSS_URL_EXPIRY_SECONDS; the server caps the maximum. Only applies when the result is uploaded to OSS."),
+	)
+}
+
+// withURLExpiryOverride 读取 url_expiry_seconds 参数并按 maxExpiry 截断，
+// 通过 context 覆盖本次调用中结果上传的签名 URL 有效期（见 oss.WithURLExpiry）；未传或 <= 0 时使用默认值
+func withURLExpiryOverride(name string, maxExpiry int64, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		seconds := int64(req.GetInt("url_expiry_seconds", 0))
+		if seconds <= 0 {
+			return handler(ctx, req)
+		}
+		expiry := seconds
+		if maxExpiry > 0 && expiry > maxExpiry {
+			expiry = maxExpiry
+		}
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"tool":      name,
+			"requested": seconds,
+			"expiry":    expiry,
+		}).Debug("Using per-call OSS URL expiry")
+		return handler(oss.WithURLExpiry(ctx, expiry), req)
+	}
+}
+
+// withRequestTimeoutOverride 读取 timeout_seconds 参数并按 maxTimeout 截断，
+// 通过 context 覆盖本次调用中 provider 请求的超时（见 common.WithTimeoutOverride）；未传或 <= 0 时不覆盖
+func withRequestTimeoutOverride(name string, maxTimeout time.Duration, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		seconds := req.GetInt("timeout_seconds", 0)
+		if seconds <= 0 {
+			return handler(ctx, req)
+		}
+		timeout := time.Duration(seconds) * time.Second
+		if maxTimeout > 0 && timeout > maxTimeout {
+			timeout = maxTimeout
+		}
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"tool":      name,
+			"requested": seconds,
+			"timeout":   timeout.String(),
+		}).Debug("Using per-call provider request timeout")
+		return handler(common.WithTimeoutOverride(ctx, timeout), req)
+	}
+}
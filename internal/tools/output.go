@@ -0,0 +1,143 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/oss"
+	"genai-mcp/internal/utils"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// 通用工具上传到 OSS 的签名 URL 默认有效期（秒）：0 表示使用 OSS_URL_EXPIRY_SECONDS，与各 provider 保持一致；
+// url_expiry_seconds 可按请求覆盖
+const outputURLExpiresIn int64 = 0
+
+// fetchInputImage 读取用户提供的图片：data URI 直接解码，http(s) URL 先经主机策略校验再下载
+func fetchInputImage(ctx context.Context, image string) ([]byte, string, error) {
+	if strings.HasPrefix(image, "data:") {
+		data, mimeType, err := utils.DecodeDataURI(image)
+		if err != nil {
+			return nil, "", common.NewError(common.ErrCodeInvalidArgument, false, "invalid image data URI: %v", err)
+		}
+		return data, mimeType, nil
+	}
+
+	if err := utils.ValidateImageURL(ctx, image); err != nil {
+		return nil, "", &common.GenAIError{Code: common.ErrCodeInvalidArgument, Message: "image URL is not allowed", Err: err}
+	}
+	data, mimeType, err := utils.DownloadImageFromURL(ctx, image)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to download image: %w", err)
+	}
+	return data, mimeType, nil
+}
+
+// withUploadTags 为本次操作中上传到 OSS 的对象附加 provider / operation 标签（provider 为空时不附加）
+func withUploadTags(ctx context.Context, provider, operation string) context.Context {
+	tags := map[string]string{oss.TagOperation: operation}
+	if provider != "" {
+		tags[oss.TagProvider] = provider
+	}
+	return oss.WithObjectTags(ctx, tags)
+}
+
+// publishImage 按配置的输出格式返回图片：base64 → data URI；base64-raw → 纯 base64；url → 上传 OSS 后返回签名 URL。
+// base64 输出的图片超过 GENAI_BASE64_MAX_BYTES 且 OSS 已配置时同样上传 OSS 返回 URL。
+func publishImage(ctx context.Context, opts Options, data []byte, mimeType string) (string, error) {
+	return publishImageAs(ctx, opts, opts.ImageFormat, data, mimeType)
+}
+
+// publishImageAs 与 publishImage 相同，但使用指定的输出格式而不是 GENAI_IMAGE_FORMAT
+func publishImageAs(ctx context.Context, opts Options, format string, data []byte, mimeType string) (string, error) {
+	canUpload := opts.OSSClient != nil && opts.OSSBucket != "" && !oss.DegradeActive()
+	if !strings.EqualFold(format, "url") && !utils.Base64Fallback(ctx, "tools", opts.Base64MaxBytes, len(data), canUpload) {
+		return utils.EncodeImage(ctx, format, mimeType, data), nil
+	}
+
+	if opts.OSSClient == nil || opts.OSSBucket == "" {
+		return "", fmt.Errorf("OSS is not configured but image format is set to 'url'")
+	}
+
+	// OSS 不可用且开启降级时以 data URI 返回（GENAI_OSS_DEGRADE）
+	key := utils.GenerateImagePath() + utils.GenerateImageFileName(mimeType)
+	signedURL, err := oss.UploadOrDegrade(ctx, "tools", "", data, mimeType, func() (string, error) {
+		url, err := opts.OSSClient.UploadFileWithURL(ctx, opts.OSSBucket, key, bytes.NewReader(data), mimeType, oss.URLExpiry(ctx, outputURLExpiresIn))
+		if err == nil {
+			oss.PublishThumbnail(ctx, opts.OSSClient, opts.OSSBucket, data, opts.ThumbnailSize)
+		}
+		return url, err
+	})
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+			"bucket": opts.OSSBucket,
+			"key":    key,
+		}).Error("Failed to upload image to OSS")
+		return "", fmt.Errorf("failed to upload image to OSS: %w", err)
+	}
+	return signedURL, nil
+}
+
+// withThumbnailURL 为工具调用挂载缩略图记录器（GENAI_GENERATE_THUMBNAIL）：
+// 结果图片上传 OSS 时生成的缩略图 URL 在结构化输出的 thumbnail_url 字段中返回。
+func withThumbnailURL(handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, recorder := common.WithThumbnailRecorder(ctx)
+		result, err := handler(ctx, req)
+		if url := recorder.URL(); url != "" && err == nil && result != nil && !result.IsError {
+			updateMetadata(result, func(m *resultMetadata) { m.ThumbnailURL = url })
+		}
+		return result, err
+	}
+}
+
+// withRateLimit 为工具调用挂载限流信息记录器：provider 响应头中的限流信息（剩余额度、重置时间）
+// 在结构化输出的 rate_limit 字段中返回，客户端可据此自行控制调用节奏。
+func withRateLimit(handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, recorder := common.WithRateLimitRecorder(ctx)
+		result, err := handler(ctx, req)
+		if rl := recorder.RateLimit(); rl != nil && err == nil && result != nil && !result.IsError {
+			updateMetadata(result, func(m *resultMetadata) { m.RateLimit = rl })
+		}
+		return result, err
+	}
+}
+
+// withImageMIME 为工具调用挂载 MIME 类型记录器：base64-raw 输出不带 data URI 前缀，
+// 格式化图片时记录的 MIME 类型在结构化输出的 mime_type 字段中返回。
+func withImageMIME(handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, recorder := common.WithImageMIMERecorder(ctx)
+		result, err := handler(ctx, req)
+		if mimeType := recorder.MIMEType(); mimeType != "" && err == nil && result != nil && !result.IsError {
+			updateMetadata(result, func(m *resultMetadata) { m.MimeType = mimeType })
+		}
+		return result, err
+	}
+}
+
+// withOutputMIME 生成类工具的 output_mime 参数定义
+func withOutputMIME() mcp.ToolOption {
+	return mcp.WithString("output_mime",
+		mcp.Description("Optional output image format: image/png or image/jpeg (png / jpeg also accepted). The image is converted when the model returns a different format. Omit to keep the model's format."),
+	)
+}
+
+// getOutputMIME 读取并校验 output_mime 参数，未提供时返回空字符串
+func getOutputMIME(req mcp.CallToolRequest) (string, *mcp.CallToolResult) {
+	raw := strings.TrimSpace(req.GetString("output_mime", ""))
+	if raw == "" {
+		return "", nil
+	}
+	outputMIME, err := utils.ParseOutputMIME(raw)
+	if err != nil {
+		return "", newInvalidArgumentResult(err.Error())
+	}
+	return outputMIME, nil
+}
@@ -0,0 +1,166 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"genai-mcp/common"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// topUpRetention 记录创建参数以便补齐的时长：DashScope 任务结果保留 24 小时，之后无法再查询
+const topUpRetention = 24 * time.Hour
+
+// imageCount 任务请求与实际返回的图片数（provider 报告请求数时），返回数少于请求数即部分成功
+type imageCount struct {
+	Requested int `json:"requested"`
+	Returned  int `json:"returned"`
+	// TopUpTaskID 开启 GENAI_TOP_UP_PARTIAL_RESULTS 时为缺少的图片创建的补齐任务
+	TopUpTaskID string `json:"top_up_task_id,omitempty"`
+	// TopUpError 补齐任务创建失败的原因
+	TopUpError string `json:"top_up_error,omitempty"`
+}
+
+// topUpFunc 以原任务的参数创建生成 n 张图片的新任务，返回其 task_id
+type topUpFunc func(ctx context.Context, n int) (string, error)
+
+// topUpRequest 一个可补齐的生成任务：补齐任务只创建一次，重复查询时返回同一个 task_id
+type topUpRequest struct {
+	create topUpFunc
+	// unitCost 原任务每张图片的估算费用，补齐时按缺少的张数计入每日用量
+	unitCost  float64
+	createdAt time.Time
+
+	once   sync.Once
+	taskID string
+	err    error
+}
+
+// topUpStore 内存中 task_id → 创建参数的记录表（GENAI_TOP_UP_PARTIAL_RESULTS），
+// 记录在 topUpRetention 之后过期，服务重启后全部丢失（此后的部分成功只报告不补齐）
+type topUpStore struct {
+	mu       sync.Mutex
+	requests map[string]*topUpRequest
+}
+
+// newTopUpStore 创建补齐记录表
+func newTopUpStore() *topUpStore {
+	return &topUpStore{requests: make(map[string]*topUpRequest)}
+}
+
+// put 记录任务的创建参数，并顺带清理过期记录
+func (s *topUpStore) put(taskID string, unitCost float64, create topUpFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, r := range s.requests {
+		if now.Sub(r.createdAt) > topUpRetention {
+			delete(s.requests, key)
+		}
+	}
+	s.requests[taskID] = &topUpRequest{create: create, unitCost: unitCost, createdAt: now}
+}
+
+// get 返回未过期的记录，没有时返回 nil
+func (s *topUpStore) get(taskID string) *topUpRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.requests[taskID]
+	if !ok || time.Since(r.createdAt) > topUpRetention {
+		return nil
+	}
+	return r
+}
+
+// rememberTopUp 开启补齐时记录生成任务的创建方式与每张图片的估算费用；补齐任务本身不记录，避免连锁补齐
+func (o Options) rememberTopUp(taskID string, unitCost float64, create topUpFunc) {
+	if o.topUps != nil {
+		o.topUps.put(taskID, unitCost, create)
+	}
+}
+
+// reportImageCount 在 provider 报告了请求图片数时，把请求 / 返回数放入结构化输出的 image_count；
+// 返回数少于请求数时记录 warn 日志，开启 GENAI_TOP_UP_PARTIAL_RESULTS 时为缺少的图片创建一次补齐任务。
+func (o Options) reportImageCount(ctx context.Context, result *mcp.CallToolResult, provider, taskID string, requested, returned int) {
+	if requested <= 0 || result == nil || result.IsError {
+		return
+	}
+	count := &imageCount{Requested: requested, Returned: returned}
+	if returned < requested {
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"provider":  provider,
+			"task_id":   taskID,
+			"requested": requested,
+			"returned":  returned,
+		}).Warn("Provider returned fewer images than requested")
+
+		if o.topUps != nil {
+			if r := o.topUps.get(taskID); r != nil {
+				r.once.Do(func() {
+					fields := map[string]interface{}{
+						"provider": provider,
+						"task_id":  taskID,
+						"missing":  requested - returned,
+					}
+					// 补齐任务不经过 withQuota，在此计入一次请求与缺少图片的费用
+					release, err := o.reserveQuota(ctx, r.unitCost*float64(requested-returned))
+					if err != nil {
+						r.err = err
+						common.WithRequestID(ctx).WithError(err).WithFields(fields).Warn("Top-up task not created")
+						return
+					}
+					r.taskID, r.err = r.create(ctx, requested-returned)
+					if r.err != nil && common.ClassifyError(r.err).Code == common.ErrCodeInvalidArgument {
+						release()
+					}
+					if r.err != nil {
+						common.WithRequestID(ctx).WithError(r.err).WithFields(fields).Error("Failed to create top-up task")
+						return
+					}
+					fields["top_up_task_id"] = r.taskID
+					common.WithRequestID(ctx).WithFields(fields).Info("Created top-up task for missing images")
+				})
+				count.TopUpTaskID = r.taskID
+				if r.err != nil {
+					// 带上错误码，便于调用方区分额度用尽（quota_exceeded）与 provider 错误
+					count.TopUpError = fmt.Sprintf("%s: %v", common.ClassifyError(r.err).Code, r.err)
+				}
+			}
+		}
+	}
+	updateMetadata(result, func(m *resultMetadata) { m.ImageCount = count })
+}
+
+// wanImageCount 返回 Wan 任务查询结果中请求的图片数（output.task_metrics.TOTAL）与返回的图片数，
+// 任务未成功或响应中没有 task_metrics 时请求数为 0
+func wanImageCount(resultJSON string) (int, int) {
+	var resp struct {
+		Output struct {
+			TaskStatus  string `json:"task_status"`
+			TaskMetrics struct {
+				Total int `json:"TOTAL"`
+			} `json:"task_metrics"`
+			Results []struct {
+				URL   string `json:"url"`
+				Image string `json:"image_url"`
+			} `json:"results"`
+		} `json:"output"`
+	}
+	if err := json.Unmarshal([]byte(resultJSON), &resp); err != nil || !strings.EqualFold(resp.Output.TaskStatus, "SUCCEEDED") {
+		return 0, 0
+	}
+	returned := 0
+	for _, r := range resp.Output.Results {
+		if r.URL != "" || r.Image != "" {
+			returned++
+		}
+	}
+	return resp.Output.TaskMetrics.Total, returned
+}
@@ -0,0 +1,169 @@
+package tools
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"genai-mcp/common"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// PollOptions 查询工具阻塞等待任务完成（wait_seconds）时的轮询参数
+type PollOptions struct {
+	Interval    time.Duration // 初始轮询间隔
+	MaxInterval time.Duration // 退避后的最大轮询间隔
+	Backoff     float64       // 每次轮询后间隔的增长倍数，1 表示不退避
+	Jitter      float64       // 随机抖动比例，实际间隔在 [1-Jitter, 1+Jitter] 倍之间
+	MaxWait     time.Duration // 单次调用允许等待的最长时间
+}
+
+// newPollOptionsFromConfig 从通用配置创建轮询参数
+func newPollOptionsFromConfig(cfg *common.Config) PollOptions {
+	return PollOptions{
+		Interval:    time.Duration(cfg.PollIntervalSeconds) * time.Second,
+		MaxInterval: time.Duration(cfg.PollMaxIntervalSeconds) * time.Second,
+		Backoff:     cfg.PollBackoff,
+		Jitter:      cfg.PollJitter,
+		MaxWait:     time.Duration(cfg.PollMaxWaitSeconds) * time.Second,
+	}
+}
+
+// nextInterval 计算第 attempt 次（从 0 开始）轮询后的等待时间：
+// 间隔随任务时长按 Backoff 倍数增长并以 MaxInterval 封顶，再叠加 ±Jitter 的随机抖动，
+// 避免大量并发等待的请求在同一时刻集中查询上游。
+func (p PollOptions) nextInterval(attempt int) time.Duration {
+	interval := float64(p.Interval)
+	for i := 0; i < attempt && interval < float64(p.MaxInterval); i++ {
+		interval *= p.Backoff
+	}
+	if p.MaxInterval > 0 && interval > float64(p.MaxInterval) {
+		interval = float64(p.MaxInterval)
+	}
+	if p.Jitter > 0 {
+		interval *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(interval)
+}
+
+// pollQueryFunc 单次查询任务状态：state 为 provider 报告的任务状态（未知时为空），
+// done 为 true 表示任务已进入终态（成功或失败）
+type pollQueryFunc func(ctx context.Context) (result *mcp.CallToolResult, state string, done bool)
+
+// stateTransition 轮询过程中观察到的一次任务状态变化
+type stateTransition struct {
+	State string    `json:"state"`
+	At    time.Time `json:"at"`
+	// ElapsedMs 距本次工具调用开始查询的毫秒数
+	ElapsedMs int64 `json:"elapsed_ms"`
+}
+
+// pollTask 反复调用 query 直到任务进入终态或超过 wait；wait <= 0 时只查询一次。
+// 超时后返回最后一次查询的结果（任务仍未完成），由调用方决定是否继续轮询。
+// history 为 true 时在结构化输出中附带 state_history（每次状态变化及其时间，连续相同的状态只记录一次）。
+func (p PollOptions) pollTask(ctx context.Context, wait time.Duration, history bool, query pollQueryFunc) *mcp.CallToolResult {
+	start := time.Now()
+	deadline := start.Add(wait)
+	// 不超过工具调用的整体截止时间，保证超时前能返回最后一次查询的状态
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	var transitions []stateTransition
+	finish := func(result *mcp.CallToolResult) *mcp.CallToolResult {
+		if history && len(transitions) > 0 {
+			updateMetadata(result, func(m *resultMetadata) { m.StateHistory = transitions })
+		}
+		return result
+	}
+
+	for attempt := 0; ; attempt++ {
+		result, state, done := query(ctx)
+		if state != "" && (len(transitions) == 0 || transitions[len(transitions)-1].State != state) {
+			now := time.Now()
+			transitions = append(transitions, stateTransition{State: state, At: now, ElapsedMs: now.Sub(start).Milliseconds()})
+		}
+		if done || wait <= 0 {
+			return finish(result)
+		}
+
+		delay := p.nextInterval(attempt)
+		if time.Now().Add(delay).After(deadline) {
+			return finish(result)
+		}
+
+		waitStart := time.Now()
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			common.RecordTiming(ctx, common.StagePollWait, time.Since(waitStart))
+			return finish(result)
+		case <-timer.C:
+		}
+		common.RecordTiming(ctx, common.StagePollWait, time.Since(waitStart))
+	}
+}
+
+// taskStepFunc 单次查询任务，返回任务完成后的图片；done 为 false 表示任务仍在进行中
+type taskStepFunc func(ctx context.Context) (image string, done bool, err error)
+
+// waitForTask 在一次工具调用内部等待异步任务完成并返回图片（如 generate_then_edit 的中间步骤），
+// 最长等待 MaxWait（为 0 时只受工具整体截止时间限制）；超时返回 timeout 错误。
+func (p PollOptions) waitForTask(ctx context.Context, query taskStepFunc) (string, error) {
+	if p.MaxWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.MaxWait)
+		defer cancel()
+	}
+	for attempt := 0; ; attempt++ {
+		image, done, err := query(ctx)
+		if err != nil || done {
+			return image, err
+		}
+
+		waitStart := time.Now()
+		timer := time.NewTimer(p.nextInterval(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			common.RecordTiming(ctx, common.StagePollWait, time.Since(waitStart))
+			return "", common.NewError(common.ErrCodeTimeout, true, "task did not finish in time: %v", ctx.Err())
+		case <-timer.C:
+		}
+		common.RecordTiming(ctx, common.StagePollWait, time.Since(waitStart))
+	}
+}
+
+// waitDuration 读取 wait_seconds 参数并按 MaxWait 截断
+func (p PollOptions) waitDuration(req mcp.CallToolRequest) time.Duration {
+	seconds := req.GetInt("wait_seconds", 0)
+	if seconds <= 0 {
+		return 0
+	}
+	wait := time.Duration(seconds) * time.Second
+	if wait > p.MaxWait {
+		wait = p.MaxWait
+	}
+	return wait
+}
+
+// withWaitSeconds 查询工具的 wait_seconds 参数定义
+func withWaitSeconds() mcp.ToolOption {
+	return mcp.WithNumber("wait_seconds",
+		mcp.Description("Optional. Block up to this many seconds, polling until the task finishes (the server caps the maximum). 0 or omitted returns the current status immediately."),
+	)
+}
+
+// withStateHistory 查询工具的 include_state_history 参数定义
+func withStateHistory() mcp.ToolOption {
+	return mcp.WithBoolean("include_state_history",
+		mcp.Description("Optional. When true, add state_history to the structured output: each task state observed while polling (e.g. PENDING, RUNNING, SUCCEEDED) with its timestamp and elapsed_ms. Most useful with wait_seconds."),
+	)
+}
+
+// includeStateHistory 读取 include_state_history 参数
+func includeStateHistory(req mcp.CallToolRequest) bool {
+	return req.GetBool("include_state_history", false)
+}
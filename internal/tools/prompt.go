@@ -0,0 +1,228 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"genai-mcp/common"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// promptInfo 生成 / 编辑类工具结构化输出中的提示词信息，便于调试与复现
+type promptInfo struct {
+	// Prompt 调用方输入的原始提示词
+	Prompt string `json:"prompt"`
+	// EffectivePrompt 经服务端全部处理后、实际发送给 provider 的提示词
+	EffectivePrompt string `json:"effective_prompt"`
+	// ProviderPrompt provider 侧改写后的提示词（如 Wan prompt_extend 返回的 actual_prompt），未报告时为空
+	ProviderPrompt string `json:"provider_prompt,omitempty"`
+	// Language 检测到的提示词语言（ISO 639-1，GENAI_DETECT_LANGUAGE 开启时）
+	Language string `json:"language,omitempty"`
+	// RoutedModel 按提示词语言路由到的模型（命中 GENAI_LANGUAGE_*_MODELS 时），未路由时为空
+	RoutedModel string `json:"routed_model,omitempty"`
+	// EnhancedPrompt 文本模型扩写后的提示词（GENAI_ENHANCE_PROMPT 开启且扩写成功时），同时作为 effective_prompt
+	EnhancedPrompt string `json:"enhanced_prompt,omitempty"`
+}
+
+// generationResult 生成 / 编辑类工具的结构化输出
+type generationResult struct {
+	Image  string `json:"image,omitempty"`
+	TaskID string `json:"task_id,omitempty"`
+	promptInfo
+	resultMetadata
+}
+
+// resultMetadata 由工具包装器（withTiming / withImageMIME）在返回前填充的结构化输出字段。
+// 没有其它结构化内容的工具结果只携带这些字段。
+type resultMetadata struct {
+	// MimeType base64-raw 输出时图片的 MIME 类型
+	MimeType string `json:"mime_type,omitempty"`
+	// ThumbnailURL 结果图片的缩略图 URL（GENAI_GENERATE_THUMBNAIL 开启且结果上传到 OSS 时）
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	// Representations 按 outputs 参数额外返回的结果图片表示形式
+	Representations *imageRepresentations `json:"representations,omitempty"`
+	// ImageCount 请求与实际返回的图片数（provider 报告请求数时，见 reportImageCount）
+	ImageCount *imageCount `json:"image_count,omitempty"`
+	// Quota 本服务每日用量上限的当前用量（设置了 GENAI_DAILY_*_LIMIT 时）
+	Quota *quotaUsage `json:"quota,omitempty"`
+	// RateLimit provider 响应头中的限流信息（provider 返回限流头时）
+	RateLimit *common.RateLimit `json:"rate_limit,omitempty"`
+	// Timing 各阶段耗时（毫秒）
+	Timing map[string]int64 `json:"timing,omitempty"`
+	// StateHistory 查询工具轮询期间观察到的任务状态变化（include_state_history 为 true 时）
+	StateHistory []stateTransition `json:"state_history,omitempty"`
+}
+
+// updateMetadata 修改结果结构化内容中的 resultMetadata；纯文本结果补充只含 resultMetadata 的结构化内容，文本内容保持不变
+func updateMetadata(result *mcp.CallToolResult, update func(*resultMetadata)) {
+	switch content := result.StructuredContent.(type) {
+	case generationResult:
+		update(&content.resultMetadata)
+		result.StructuredContent = content
+	case chainResult:
+		update(&content.resultMetadata)
+		result.StructuredContent = content
+	case sessionResult:
+		update(&content.resultMetadata)
+		result.StructuredContent = content
+	case taskStatusResult:
+		update(&content.resultMetadata)
+		result.StructuredContent = content
+	case resultMetadata:
+		update(&content)
+		result.StructuredContent = content
+	case nil:
+		var metadata resultMetadata
+		update(&metadata)
+		result.StructuredContent = metadata
+	}
+}
+
+// preparePrompt 对用户输入的提示词执行服务端处理，返回原始与实际发送的提示词。
+// 所有生成 / 编辑工具都应通过这里得到发送给 provider 的提示词，保证 effective_prompt 与实际请求一致。
+// 开启 GENAI_DETECT_LANGUAGE 时同时检测提示词语言。
+func (o Options) preparePrompt(ctx context.Context, prompt string) promptInfo {
+	info := promptInfo{
+		Prompt:          prompt,
+		EffectivePrompt: prompt,
+	}
+	if o.DetectLanguage {
+		info.Language = common.DetectLanguage(prompt)
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"prompt":   prompt,
+			"language": info.Language,
+		}).Info("Detected prompt language")
+	}
+	return info
+}
+
+// enhancePrompt 开启 GENAI_ENHANCE_PROMPT 时在生成前用文本模型扩写提示词，扩写结果作为 effective_prompt 发送给 provider。
+// 只用于生成：编辑提示词是修改指令，扩写会改变其含义。扩写失败时记录 warn 日志并使用原提示词，不影响生成。
+func (o Options) enhancePrompt(ctx context.Context, prompts *promptInfo) {
+	if o.Enhancer == nil || strings.TrimSpace(prompts.EffectivePrompt) == "" {
+		return
+	}
+
+	stop := common.StartTiming(ctx, common.StageEnhance)
+	enhanced, err := o.Enhancer.Enhance(ctx, prompts.EffectivePrompt)
+	stop()
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).WithField("prompt", prompts.EffectivePrompt).Warn("Prompt enhancement failed, using the original prompt")
+		return
+	}
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"prompt":          prompts.EffectivePrompt,
+		"enhanced_prompt": enhanced,
+	}).Info("Enhanced prompt")
+	prompts.EnhancedPrompt = enhanced
+	prompts.EffectivePrompt = enhanced
+}
+
+// 按提示词语言路由模型时的操作类型
+const (
+	routeGenerate = "generate"
+	routeEdit     = "edit"
+)
+
+// routeModel 按检测到的提示词语言选择模型（GENAI_LANGUAGE_GEN_MODELS / GENAI_LANGUAGE_EDIT_MODELS）：
+// 命中时返回携带路由模型的 context 并记录到 prompts.RoutedModel，否则原样返回 ctx（使用配置的模型）
+func (o Options) routeModel(ctx context.Context, operation string, prompts *promptInfo) context.Context {
+	model, ok := o.languageModel(operation, prompts.Language)
+	if !ok {
+		return ctx
+	}
+	prompts.RoutedModel = model
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"language":  prompts.Language,
+		"operation": operation,
+		"model":     model,
+	}).Info("Routing request to model by prompt language")
+	return common.WithRoutedModel(ctx, model)
+}
+
+// languageModel 返回 operation 在 language 下路由到的模型，未配置路由时返回 false
+func (o Options) languageModel(operation, language string) (string, bool) {
+	models := o.LanguageGenModels
+	if operation == routeEdit {
+		models = o.LanguageEditModels
+	}
+	model, ok := models[language]
+	return model, ok
+}
+
+// effectiveModel 返回一次 operation 实际使用的模型：请求的 model 参数优先，其次为按提示词语言路由的模型
+// （与 routeModel 的决策一致），否则为配置的生成 / 编辑模型。用于在调用 provider 之前按实际模型计价。
+func (o Options) effectiveModel(operation, prompt string, req mcp.CallToolRequest) string {
+	if model := strings.TrimSpace(req.GetString("model", "")); model != "" {
+		return model
+	}
+	if o.DetectLanguage && prompt != "" {
+		if model, ok := o.languageModel(operation, common.DetectLanguage(prompt)); ok {
+			return model
+		}
+	}
+	if operation == routeEdit {
+		return o.EditModel
+	}
+	return o.GenModel
+}
+
+// newGenerationResult 生成带结构化内容的工具结果，text 作为兼容旧客户端的文本内容
+func newGenerationResult(result generationResult, text string) *mcp.CallToolResult {
+	return mcp.NewToolResultStructured(result, text)
+}
+
+// wanQueryPrompts 从 Wan 任务查询结果中提取 provider 侧的提示词（prompt_extend 开启时 DashScope 会返回）
+func wanQueryPrompts(resultJSON string) (origPrompt, actualPrompt string) {
+	var resp struct {
+		Output struct {
+			Results []struct {
+				OrigPrompt   string `json:"orig_prompt"`
+				ActualPrompt string `json:"actual_prompt"`
+			} `json:"results"`
+		} `json:"output"`
+	}
+	if err := json.Unmarshal([]byte(resultJSON), &resp); err != nil || len(resp.Output.Results) == 0 {
+		return "", ""
+	}
+	return resp.Output.Results[0].OrigPrompt, resp.Output.Results[0].ActualPrompt
+}
+
+// newWanQueryResult 生成 Wan 查询工具的结果：文本内容保持原始 JSON，
+// 若 provider 报告了改写后的提示词，则在结构化内容中附带 effective_prompt。
+func newWanQueryResult(ctx context.Context, taskID, resultJSON string) *mcp.CallToolResult {
+	origPrompt, actualPrompt := wanQueryPrompts(resultJSON)
+	if actualPrompt == "" {
+		return mcp.NewToolResultText(resultJSON)
+	}
+	if actualPrompt != origPrompt {
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"task_id":         taskID,
+			"prompt":          origPrompt,
+			"provider_prompt": actualPrompt,
+		}).Info("Wan: provider rewrote the prompt")
+	}
+	return newGenerationResult(generationResult{
+		TaskID: taskID,
+		promptInfo: promptInfo{
+			Prompt:          origPrompt,
+			EffectivePrompt: origPrompt,
+			ProviderPrompt:  actualPrompt,
+		},
+	}, resultJSON)
+}
+
+// newProviderPromptResult 生成只返回图片的查询工具结果：文本内容保持原样，
+// provider 报告了改写后的提示词时，在结构化内容中附带 provider_prompt。
+func newProviderPromptResult(taskID, result, providerPrompt string) *mcp.CallToolResult {
+	if providerPrompt == "" {
+		return mcp.NewToolResultText(result)
+	}
+	return newGenerationResult(generationResult{
+		Image:      result,
+		TaskID:     taskID,
+		promptInfo: promptInfo{ProviderPrompt: providerPrompt},
+	}, result)
+}
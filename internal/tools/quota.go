@@ -0,0 +1,319 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"genai-mcp/common"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/redis/go-redis/v9"
+)
+
+// quotaWindow 用量统计窗口：按 UTC 自然日，每天 00:00 UTC 重置
+const quotaWindow = 24 * time.Hour
+
+// quotaUsage 当前窗口的用量与上限，放入结构化输出的 quota 字段
+type quotaUsage struct {
+	Requests     int64   `json:"requests"`
+	RequestLimit int64   `json:"request_limit,omitempty"`
+	Cost         float64 `json:"cost,omitempty"`
+	CostLimit    float64 `json:"cost_limit,omitempty"`
+	// ResetsAt 窗口重置时间（RFC 3339，UTC）
+	ResetsAt string `json:"resets_at"`
+}
+
+// quotaLimits 每个窗口的上限，0 表示不限
+type quotaLimits struct {
+	Requests int64
+	Cost     float64
+}
+
+// quotaStore 用量计数的存储：单实例使用内存，多实例共享额度时使用 Redis
+type quotaStore interface {
+	// reserve 在 window 窗口内原子地增加用量；增加后超过任一上限时不计入，返回 ok=false 与当前用量
+	reserve(ctx context.Context, window time.Time, requests int64, cost float64, limits quotaLimits) (used quotaLimits, ok bool, err error)
+	// release 退还已计入的用量（请求在调用 provider 前被拒绝时）
+	release(ctx context.Context, window time.Time, requests int64, cost float64) error
+}
+
+// quota 生成 / 编辑工具的用量上限（GENAI_DAILY_REQUEST_LIMIT / GENAI_DAILY_COST_LIMIT）
+type quota struct {
+	store  quotaStore
+	limits quotaLimits
+}
+
+// newQuotaFromConfig 按配置创建用量上限，未设置任何上限时返回 nil
+func newQuotaFromConfig(cfg *common.Config) (*quota, error) {
+	if cfg.DailyRequestLimit <= 0 && cfg.DailyCostLimit <= 0 {
+		return nil, nil
+	}
+	q := &quota{limits: quotaLimits{Requests: int64(cfg.DailyRequestLimit), Cost: cfg.DailyCostLimit}}
+	if cfg.QuotaRedisURL == "" {
+		q.store = &memoryQuotaStore{}
+		return q, nil
+	}
+	redisOpts, err := redis.ParseURL(cfg.QuotaRedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GENAI_QUOTA_REDIS_URL: %w", err)
+	}
+	q.store = &redisQuotaStore{client: redis.NewClient(redisOpts)}
+	return q, nil
+}
+
+// currentQuotaWindow 返回 t 所在窗口的起始时间
+func currentQuotaWindow(t time.Time) time.Time {
+	return t.UTC().Truncate(quotaWindow)
+}
+
+// requestCost 按价格表估算一次工具调用的费用：编辑工具按编辑、其它按生成的实际模型（见 effectiveModel）计价，
+// generate_then_edit 计入两者；n 与 resolution / size 取自请求参数。没有匹配的价格时为 0。
+func (o Options) requestCost(name string, req mcp.CallToolRequest) float64 {
+	if len(o.Pricing) == 0 {
+		return 0
+	}
+	n := req.GetInt("n", 1)
+	if n <= 0 {
+		n = 1
+	}
+	size := req.GetString("resolution", "")
+	if size == "" {
+		size = req.GetString("size", "")
+	}
+
+	var models []string
+	switch {
+	case name == "generate_then_edit":
+		models = []string{
+			o.effectiveModel(routeGenerate, req.GetString("prompt", ""), req),
+			o.effectiveModel(routeEdit, req.GetString("edit_prompt", ""), req),
+		}
+	case strings.Contains(name, "edit"):
+		models = []string{o.effectiveModel(routeEdit, req.GetString("prompt", ""), req)}
+	default:
+		prompt, _ := getGeneratePrompt(req)
+		models = []string{o.effectiveModel(routeGenerate, prompt, req)}
+	}
+	return o.imagesCost(models, size, n)
+}
+
+// imagesCost 按价格表计算每个模型生成 n 张 size 图片的费用之和，没有匹配价格的模型不计费
+func (o Options) imagesCost(models []string, size string, n int) float64 {
+	total := 0.0
+	for _, model := range models {
+		if _, entry, ok := lookupPrice(o.Pricing, o.Provider, model); ok {
+			total += entry.unitPrice(size) * float64(n)
+		}
+	}
+	return total
+}
+
+// withQuota 在调用 provider 前计入本次请求的次数与估算费用，超出当日上限时拒绝请求并说明重置时间。
+// 请求因参数错误被拒绝时退还用量；成功时在结构化输出的 quota 字段中返回当前用量。
+func (o Options) withQuota(name string, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		window := currentQuotaWindow(time.Now())
+		resetsAt := window.Add(quotaWindow)
+		cost := o.requestCost(name, req)
+
+		used, ok, err := o.quota.store.reserve(ctx, window, 1, cost, o.quota.limits)
+		if err != nil {
+			// 额度存储不可用时拒绝请求，避免在无法计数时超支
+			common.WithRequestID(ctx).WithError(err).WithField("tool", name).Error("Failed to record request quota")
+			return newToolErrorResultWithCode(common.ErrCodeUpstream, true,
+				fmt.Sprintf("quota accounting is unavailable: %v", err)), nil
+		}
+		if !ok {
+			message := o.quota.exceededMessage(used, cost, resetsAt)
+			common.WithRequestID(ctx).WithFields(map[string]interface{}{
+				"tool":          name,
+				"requests":      used.Requests,
+				"request_limit": o.quota.limits.Requests,
+				"cost":          used.Cost,
+				"cost_limit":    o.quota.limits.Cost,
+				"resets_at":     resetsAt.Format(time.RFC3339),
+			}).Warn("Rejected request over daily quota")
+			return newToolErrorResultWithCode(common.ErrCodeQuotaExceeded, false, message), nil
+		}
+
+		result, err := handler(ctx, req)
+		if err == nil && result != nil && result.IsError && resultErrorCode(result) == common.ErrCodeInvalidArgument {
+			if releaseErr := o.quota.store.release(ctx, window, 1, cost); releaseErr != nil {
+				common.WithRequestID(ctx).WithError(releaseErr).WithField("tool", name).Warn("Failed to release request quota")
+			}
+			return result, err
+		}
+		if err == nil && result != nil && !result.IsError {
+			usage := &quotaUsage{
+				Requests:     used.Requests,
+				RequestLimit: o.quota.limits.Requests,
+				Cost:         used.Cost,
+				CostLimit:    o.quota.limits.Cost,
+				ResetsAt:     resetsAt.Format(time.RFC3339),
+			}
+			updateMetadata(result, func(m *resultMetadata) { m.Quota = usage })
+		}
+		return result, err
+	}
+}
+
+// reserveQuota 为不经过 withQuota 的 provider 调用（如补齐任务）计入一次请求与 cost，未设置上限时直接放行。
+// 超出上限时返回 quota_exceeded 错误，额度存储不可用时返回可重试的 upstream 错误；
+// 成功时返回退还本次用量的函数，供调用因参数错误被拒绝时使用。
+func (o Options) reserveQuota(ctx context.Context, cost float64) (func(), error) {
+	if o.quota == nil {
+		return func() {}, nil
+	}
+	window := currentQuotaWindow(time.Now())
+	used, ok, err := o.quota.store.reserve(ctx, window, 1, cost, o.quota.limits)
+	if err != nil {
+		return nil, common.NewError(common.ErrCodeUpstream, true, "quota accounting is unavailable: %v", err)
+	}
+	if !ok {
+		return nil, common.NewError(common.ErrCodeQuotaExceeded, false, "%s", o.quota.exceededMessage(used, cost, window.Add(quotaWindow)))
+	}
+	return func() {
+		if err := o.quota.store.release(ctx, window, 1, cost); err != nil {
+			common.WithRequestID(ctx).WithError(err).Warn("Failed to release request quota")
+		}
+	}, nil
+}
+
+// exceededMessage 说明超出的上限与重置时间
+func (q *quota) exceededMessage(used quotaLimits, cost float64, resetsAt time.Time) string {
+	var reason string
+	if q.limits.Requests > 0 && used.Requests+1 > q.limits.Requests {
+		reason = fmt.Sprintf("daily request limit of %d reached (GENAI_DAILY_REQUEST_LIMIT)", q.limits.Requests)
+	} else {
+		reason = fmt.Sprintf("daily cost limit of %s would be exceeded: %s used, this request is estimated at %s (GENAI_DAILY_COST_LIMIT)",
+			formatCost(q.limits.Cost), formatCost(used.Cost), formatCost(cost))
+	}
+	return fmt.Sprintf("%s; the quota resets at %s (in %s)",
+		reason, resetsAt.Format(time.RFC3339), time.Until(resetsAt).Round(time.Minute))
+}
+
+// formatCost 格式化费用，去掉多余的小数位
+func formatCost(cost float64) string {
+	return strconv.FormatFloat(cost, 'f', -1, 64)
+}
+
+// resultErrorCode 返回结构化错误结果中的错误码，不是结构化错误时返回空字符串
+func resultErrorCode(result *mcp.CallToolResult) common.ErrorCode {
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			var te toolError
+			if json.Unmarshal([]byte(text.Text), &te) == nil {
+				return te.Code
+			}
+		}
+	}
+	return ""
+}
+
+// memoryQuotaStore 进程内的用量计数，只保留当前窗口；服务重启后清零
+type memoryQuotaStore struct {
+	mu     sync.Mutex
+	window time.Time
+	used   quotaLimits
+}
+
+// reserve 实现 quotaStore
+func (s *memoryQuotaStore) reserve(ctx context.Context, window time.Time, requests int64, cost float64, limits quotaLimits) (quotaLimits, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.window.Equal(window) {
+		s.window, s.used = window, quotaLimits{}
+	}
+	if exceedsQuota(s.used.Requests+requests, s.used.Cost+cost, limits) {
+		return s.used, false, nil
+	}
+	s.used.Requests += requests
+	s.used.Cost += cost
+	return s.used, true, nil
+}
+
+// release 实现 quotaStore
+func (s *memoryQuotaStore) release(ctx context.Context, window time.Time, requests int64, cost float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.window.Equal(window) {
+		s.used.Requests = max(s.used.Requests-requests, 0)
+		s.used.Cost = max(s.used.Cost-cost, 0)
+	}
+	return nil
+}
+
+// exceedsQuota 判断用量是否超过任一上限（上限为 0 时不限）
+func exceedsQuota(requests int64, cost float64, limits quotaLimits) bool {
+	return (limits.Requests > 0 && requests > limits.Requests) || (limits.Cost > 0 && cost > limits.Cost)
+}
+
+// redisQuotaStore 以 Redis 计数，多个实例共享同一份额度（GENAI_QUOTA_REDIS_URL）。
+// 每个窗口一个 hash（requests / cost），在窗口结束后过期。
+type redisQuotaStore struct {
+	client *redis.Client
+}
+
+// redisQuotaKeyPrefix Redis 中用量 hash 的 key 前缀，后接窗口日期（yyyy-MM-dd）
+const redisQuotaKeyPrefix = "genai-mcp:quota:"
+
+// reserveScript 原子地增加用量；超过上限（ARGV[3] / ARGV[4]，0 为不限）时回滚并返回 0。
+// 返回 {ok, requests, cost}，cost 为字符串以保留小数。
+var reserveScript = redis.NewScript(`
+local requests = redis.call('HINCRBY', KEYS[1], 'requests', ARGV[1])
+local cost = tonumber(redis.call('HINCRBYFLOAT', KEYS[1], 'cost', ARGV[2]))
+redis.call('EXPIREAT', KEYS[1], ARGV[5])
+local requestLimit = tonumber(ARGV[3])
+local costLimit = tonumber(ARGV[4])
+if (requestLimit > 0 and requests > requestLimit) or (costLimit > 0 and cost > costLimit) then
+  requests = redis.call('HINCRBY', KEYS[1], 'requests', -tonumber(ARGV[1]))
+  cost = tonumber(redis.call('HINCRBYFLOAT', KEYS[1], 'cost', -tonumber(ARGV[2])))
+  return {0, requests, tostring(cost)}
+end
+return {1, requests, tostring(cost)}
+`)
+
+// reserve 实现 quotaStore
+func (s *redisQuotaStore) reserve(ctx context.Context, window time.Time, requests int64, cost float64, limits quotaLimits) (quotaLimits, bool, error) {
+	res, err := reserveScript.Run(ctx, s.client, []string{redisQuotaKey(window)},
+		requests, cost, limits.Requests, limits.Cost, window.Add(quotaWindow).Unix()).Slice()
+	if err != nil {
+		return quotaLimits{}, false, fmt.Errorf("redis quota update failed: %w", err)
+	}
+	if len(res) != 3 {
+		return quotaLimits{}, false, fmt.Errorf("unexpected redis quota reply: %v", res)
+	}
+	ok, _ := res[0].(int64)
+	usedRequests, _ := res[1].(int64)
+	usedCostText, _ := res[2].(string)
+	usedCost, _ := strconv.ParseFloat(usedCostText, 64)
+	return quotaLimits{Requests: usedRequests, Cost: usedCost}, ok == 1, nil
+}
+
+// release 实现 quotaStore
+func (s *redisQuotaStore) release(ctx context.Context, window time.Time, requests int64, cost float64) error {
+	key := redisQuotaKey(window)
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, key, "requests", -requests)
+		pipe.HIncrByFloat(ctx, key, "cost", -cost)
+		pipe.ExpireAt(ctx, key, window.Add(quotaWindow))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("redis quota release failed: %w", err)
+	}
+	return nil
+}
+
+// redisQuotaKey 返回窗口对应的 hash key
+func redisQuotaKey(window time.Time) string {
+	return redisQuotaKeyPrefix + window.Format("2006-01-02")
+}
@@ -0,0 +1,214 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/oss"
+	"genai-mcp/internal/utils"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// 结果图片可按请求额外返回的表示形式（outputs 参数）
+const (
+	outputURL             = "url"
+	outputBase64          = "base64"
+	outputThumbnailBase64 = "thumbnail_base64"
+	outputThumbnailURL    = "thumbnail_url"
+)
+
+// defaultRepresentationThumbnailSize 未配置 GENAI_GENERATE_THUMBNAIL 时 outputs 中缩略图的长边像素
+const defaultRepresentationThumbnailSize = 256
+
+// imageRepresentations 结果图片的多种表示形式（outputs 参数），只包含请求且成功生成的项
+type imageRepresentations struct {
+	// URL 原图的 OSS URL（或 provider 直接返回的 URL）
+	URL string `json:"url,omitempty"`
+	// Base64 原图的 data URI
+	Base64 string `json:"base64,omitempty"`
+	// ThumbnailBase64 缩略图的 data URI
+	ThumbnailBase64 string `json:"thumbnail_base64,omitempty"`
+	// ThumbnailURL 缩略图的 OSS URL
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+// withOutputs 生成 / 编辑工具的 outputs 参数定义，由 addTool 统一添加
+func withOutputs() mcp.ToolOption {
+	return mcp.WithString("outputs",
+		mcp.Description("Optional. Comma-separated extra representations of the result image to return together in structuredContent.representations: url (full image OSS URL), base64 (full image data URI), thumbnail_base64 (thumbnail data URI), thumbnail_url (thumbnail OSS URL). Useful for galleries that show a preview immediately and keep the full image for later. url and thumbnail_url require OSS. Only applies when the call returns an image, not a task ID."),
+	)
+}
+
+// parseOutputs 解析 outputs 参数，返回按规范顺序去重的表示形式列表；为空时返回 nil
+func parseOutputs(raw string) ([]string, error) {
+	requested := make(map[string]bool)
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		switch item {
+		case outputURL, outputBase64, outputThumbnailBase64, outputThumbnailURL:
+			requested[item] = true
+		default:
+			return nil, fmt.Errorf("unknown output %q: expected url, base64, thumbnail_base64 or thumbnail_url", item)
+		}
+	}
+	var outputs []string
+	for _, item := range []string{outputURL, outputBase64, outputThumbnailBase64, outputThumbnailURL} {
+		if requested[item] {
+			outputs = append(outputs, item)
+		}
+	}
+	return outputs, nil
+}
+
+// resultImage 返回结果结构化内容中的图片及其 MIME 类型（base64-raw 输出时），没有图片（如只返回任务 ID）时返回空字符串
+func resultImage(result *mcp.CallToolResult) (string, string) {
+	switch content := result.StructuredContent.(type) {
+	case generationResult:
+		return content.Image, content.MimeType
+	case chainResult:
+		return content.Image, content.MimeType
+	case sessionResult:
+		return content.Image, content.MimeType
+	}
+	return "", ""
+}
+
+// withImageRepresentations 读取 outputs 参数，在工具返回图片后按请求生成原图 / 缩略图的 URL 与 data URI，
+// 放入结构化输出的 representations 字段。某一项生成失败时只记录 warn 日志并省略该项，不影响主图结果。
+func withImageRepresentations(name string, opts Options, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		outputs, err := parseOutputs(req.GetString("outputs", ""))
+		if err != nil {
+			return newInvalidArgumentResult(err.Error()), nil
+		}
+		if len(outputs) == 0 {
+			return handler(ctx, req)
+		}
+		for _, output := range outputs {
+			if (output == outputURL || output == outputThumbnailURL) && (opts.OSSClient == nil || opts.OSSBucket == "") {
+				return newInvalidArgumentResult(fmt.Sprintf("output %q requires OSS to be configured", output)), nil
+			}
+		}
+
+		result, err := handler(ctx, req)
+		if err != nil || result == nil || result.IsError {
+			return result, err
+		}
+		image, mimeType := resultImage(result)
+		if image == "" {
+			return result, err
+		}
+
+		reps := buildRepresentations(ctx, opts, outputs, image, mimeType)
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"tool":    name,
+			"outputs": outputs,
+		}).Debug("Image representations built")
+		updateMetadata(result, func(m *resultMetadata) { m.Representations = reps })
+		return result, err
+	}
+}
+
+// buildRepresentations 按 outputs 生成结果图片的各表示形式：结果本身是 URL 时直接复用，
+// 其它形式需要时才下载 / 解码原图；缩略图只生成一次，供 thumbnail_base64 与 thumbnail_url 共用
+func buildRepresentations(ctx context.Context, opts Options, outputs []string, image, mimeType string) *imageRepresentations {
+	reps := &imageRepresentations{}
+	isURL := strings.HasPrefix(image, "http://") || strings.HasPrefix(image, "https://")
+
+	var (
+		data         []byte
+		thumb        []byte
+		thumbMIME    string
+		loadErr      error
+		loaded       bool
+		thumbErr     error
+		thumbCreated bool
+	)
+	load := func() ([]byte, string, error) {
+		if !loaded {
+			data, mimeType, loadErr = taskImageData(ctx, image, mimeType)
+			loaded = true
+		}
+		return data, mimeType, loadErr
+	}
+	thumbnail := func() ([]byte, string, error) {
+		if !thumbCreated {
+			thumbCreated = true
+			full, _, err := load()
+			if err != nil {
+				thumbErr = err
+			} else {
+				size := opts.ThumbnailSize
+				if size <= 0 {
+					size = defaultRepresentationThumbnailSize
+				}
+				thumb, thumbMIME, thumbErr = utils.Thumbnail(full, size)
+			}
+		}
+		return thumb, thumbMIME, thumbErr
+	}
+
+	for _, output := range outputs {
+		var err error
+		switch output {
+		case outputURL:
+			if isURL {
+				reps.URL = image
+				continue
+			}
+			var full []byte
+			var fullMIME string
+			if full, fullMIME, err = load(); err == nil {
+				reps.URL, err = uploadRepresentation(ctx, opts, "", full, fullMIME)
+			}
+		case outputBase64:
+			if strings.HasPrefix(image, "data:") {
+				reps.Base64 = image
+				continue
+			}
+			var full []byte
+			var fullMIME string
+			if full, fullMIME, err = load(); err == nil {
+				reps.Base64 = utils.EncodeDataURI(fullMIME, full)
+			}
+		case outputThumbnailBase64:
+			var t []byte
+			var tMIME string
+			if t, tMIME, err = thumbnail(); err == nil {
+				reps.ThumbnailBase64 = utils.EncodeDataURI(tMIME, t)
+			}
+		case outputThumbnailURL:
+			var t []byte
+			var tMIME string
+			if t, tMIME, err = thumbnail(); err == nil {
+				reps.ThumbnailURL, err = uploadRepresentation(ctx, opts, "thumb_", t, tMIME)
+			}
+		}
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).WithField("output", output).Warn("Failed to build image representation, skipping")
+		}
+	}
+	return reps
+}
+
+// uploadRepresentation 将图片上传到 OSS 并返回 URL（有效期同结果图片，见 oss.URLExpiry）。
+// 与 publishImageAs 不同，OSS 不可用时不降级为 data URI：调用方请求的就是 URL。
+func uploadRepresentation(ctx context.Context, opts Options, prefix string, data []byte, mimeType string) (string, error) {
+	if oss.DegradeActive() {
+		return "", fmt.Errorf("OSS is currently unavailable")
+	}
+	key := utils.GenerateImagePath() + prefix + utils.GenerateImageFileName(mimeType)
+	url, err := opts.OSSClient.UploadFileWithURL(ctx, opts.OSSBucket, key, bytes.NewReader(data), mimeType, oss.URLExpiry(ctx, outputURLExpiresIn))
+	if err != nil {
+		return "", fmt.Errorf("failed to upload image to OSS: %w", err)
+	}
+	return url, nil
+}
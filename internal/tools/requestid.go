@@ -0,0 +1,22 @@
+package tools
+
+import (
+	"context"
+
+	"genai-mcp/common"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// withRequestID 为每次工具调用设置请求 ID：沿用调用方通过 X-Request-ID 传入的 ID，没有时生成一个新的。
+// 本次调用中经 common.WithRequestID(ctx) 记录的日志都带有 request_id 字段，便于按调用检索日志。
+func withRequestID(name string, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if common.RequestIDFromContext(ctx) == "" {
+			ctx = common.ContextWithRequestID(ctx, common.NewRequestID())
+		}
+		common.WithRequestID(ctx).WithField("tool", name).Debug("Handling MCP tool call")
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,192 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/oss"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// editSession 一个多轮编辑会话：保存编辑链中最新的图片
+type editSession struct {
+	Image     string // 最新图片（URL 或 data URI），作为下一轮的编辑输入
+	Turns     int    // 已完成的编辑轮数
+	UpdatedAt time.Time
+}
+
+// sessionStore 内存中的编辑会话表，会话在最后一次更新 ttl 之后过期。
+// 过期会话在访问或写入时清理，服务重启后会话全部丢失。
+type sessionStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*editSession
+}
+
+// newSessionStore 创建编辑会话表
+func newSessionStore(ttl time.Duration) *sessionStore {
+	return &sessionStore{ttl: ttl, sessions: make(map[string]*editSession)}
+}
+
+// get 返回未过期的会话副本
+func (s *sessionStore) get(id string) (editSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return editSession{}, false
+	}
+	if time.Since(session.UpdatedAt) > s.ttl {
+		delete(s.sessions, id)
+		return editSession{}, false
+	}
+	return *session, true
+}
+
+// put 保存会话的最新图片与轮数，并顺带清理过期会话
+func (s *sessionStore) put(id, image string, turns int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, session := range s.sessions {
+		if now.Sub(session.UpdatedAt) > s.ttl {
+			delete(s.sessions, key)
+		}
+	}
+	s.sessions[id] = &editSession{Image: image, Turns: turns, UpdatedAt: now}
+}
+
+// newSessionID 生成随机会话 ID
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// sessionResult edit_session 工具的结构化输出
+type sessionResult struct {
+	SessionID string `json:"session_id"`
+	Turn      int    `json:"turn"`
+	Image     string `json:"image"`
+	promptInfo
+	resultMetadata
+}
+
+// registerEditSessionTool 注册 edit_session 工具：服务端按 session_id 记住编辑链的最新图片，
+// 客户端后续每轮只需提供提示词（如「再暖一点」），无需重复传图。
+func registerEditSessionTool(s *server.MCPServer, opts Options, p chainProvider) {
+	if opts.sessions == nil {
+		return
+	}
+
+	sessionTool := mcp.NewTool(
+		"edit_session",
+		mcp.WithDescription(fmt.Sprintf("Edit an image over several turns with the active provider (%s). Start a session by passing image_url; the result includes a session_id. Pass that session_id in later calls to edit the latest result again with just a prompt. Sessions expire after a period of inactivity.", p.Name)),
+		mcp.WithString("prompt",
+			mcp.Required(),
+			mcp.Description("Text prompt describing how to edit the current image."),
+		),
+		mcp.WithString("session_id",
+			mcp.Description("Optional. session_id returned by a previous edit_session call. Omit it to start a new session."),
+		),
+		mcp.WithString("image_url",
+			mcp.Description("Image URL or data URI to edit. Required when starting a session; when continuing a session it replaces the session's current image."),
+		),
+	)
+
+	opts.addTool(s, sessionTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		prompt, err := req.RequireString("prompt")
+		if err != nil {
+			return newInvalidArgumentResult(fmt.Sprintf("prompt parameter is required: %v", err)), nil
+		}
+		sessionID := strings.TrimSpace(req.GetString("session_id", ""))
+		rawImage := strings.TrimSpace(req.GetString("image_url", ""))
+
+		// 确定本轮的输入图片：新会话使用 image_url，已有会话默认使用其最新图片
+		var input string
+		turns := 0
+		if sessionID != "" {
+			session, ok := opts.sessions.get(sessionID)
+			if !ok {
+				return newToolErrorResultWithCode(common.ErrCodeNotFound, false,
+					fmt.Sprintf("edit session %q not found or expired; start a new session with image_url", sessionID)), nil
+			}
+			input, turns = session.Image, session.Turns
+		}
+		if rawImage != "" {
+			images, problems, err := parseImageURLs(rawImage, true)
+			if err != nil {
+				return newInvalidArgumentResult(fmt.Sprintf("image_url: %v", err)), nil
+			}
+			if len(problems) > 0 {
+				return newInvalidArgumentResult(formatImageURLProblems(problems)), nil
+			}
+			if len(images) != 1 {
+				return newInvalidArgumentResult(fmt.Sprintf("image_url must contain exactly one image, got %d", len(images))), nil
+			}
+			input = images[0]
+		}
+		if input == "" {
+			return newInvalidArgumentResult("image_url is required when starting a new edit session"), nil
+		}
+		if sessionID == "" {
+			sessionID = newSessionID()
+		}
+
+		ctx = withUploadTags(ctx, p.Prefix, "edit")
+		inputs := []string{input}
+		if p.URLOnly {
+			ctx, inputs, _, err = oss.UploadDataURIInputs(ctx, opts.OSSClient, opts.OSSBucket, inputs)
+			if err != nil {
+				common.WithRequestID(ctx).WithError(err).WithField("provider", p.Prefix).Error("edit_session: failed to upload input image")
+				return newToolErrorResult("failed to upload input image", err), nil
+			}
+		}
+
+		prompts := opts.preparePrompt(ctx, prompt)
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"provider":   p.Prefix,
+			"session_id": sessionID,
+			"turn":       turns + 1,
+			"prompt":     prompt,
+		}).Info("Editing image in session")
+
+		// 结果的 MIME 类型单独记录，base64-raw 输出时补回 data URI 前缀后保存为下一轮输入
+		editCtx, editMIME := common.WithImageMIMERecorder(opts.routeModel(ctx, routeEdit, &prompts))
+		edited, err := p.Edit(editCtx, prompts.EffectivePrompt, inputs)
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+				"provider":   p.Prefix,
+				"session_id": sessionID,
+			}).Error("edit_session: edit failed")
+			return newToolErrorResult("failed to edit image", err), nil
+		}
+		common.RecordImageMIME(ctx, editMIME.MIMEType())
+
+		turns++
+		opts.sessions.put(sessionID, chainEditInput(edited, editMIME.MIMEType()), turns)
+
+		common.WithRequestID(ctx).WithFields(common.MergeFields(map[string]interface{}{
+			"provider":   p.Prefix,
+			"session_id": sessionID,
+			"turn":       turns,
+		}, imageLogFields("edited_url", edited))).Info("edit_session turn finished")
+
+		return mcp.NewToolResultStructured(sessionResult{
+			SessionID:  sessionID,
+			Turn:       turns,
+			Image:      edited,
+			promptInfo: prompts,
+		}, fmt.Sprintf("Edited image (session_id: %s, turn %d): %s", sessionID, turns, edited)), nil
+	})
+}
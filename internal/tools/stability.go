@@ -0,0 +1,202 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/genai/stability"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// RegisterStabilityTools 注册 Stability AI（Stable Image：SD3 / Core / Ultra）图片生成和编辑的 MCP tools。
+// Stability 同步返回图片，工具直接返回按 GENAI_IMAGE_FORMAT 格式化后的图片。
+//
+// 约定工具列表：
+//   - stability_generate_image  文生图
+//   - stability_edit_image      图生图：以单张输入图片和提示词生成新图片
+//   - edit_image                统一编辑：接受 URL 与 data URI（单张图片）
+//   - generate_then_edit        生成后编辑：一次调用内先生成，再以其结果编辑
+//   - edit_session              多轮编辑：按 session_id 记住最新结果图片，后续每轮只需提供提示词
+func RegisterStabilityTools(s *server.MCPServer, stabilityClient stability.StabilityIface, opts Options) error {
+	generateImageTool := mcp.NewTool(
+		"stability_generate_image",
+		mcp.WithDescription("Generate an image using Stability AI (Stable Diffusion 3 / Stable Image Core / Ultra) based on a text prompt. Returns the generated image URL or data URI."),
+		mcp.WithString("prompt",
+			mcp.Description("Text prompt describing the image to generate. Required unless prompts is given."),
+		),
+		withWeightedPrompts(),
+		withStabilityNegativePrompt(),
+		mcp.WithString("aspect_ratio",
+			mcp.Description("Optional aspect ratio of the output image. Default: 1:1."),
+			mcp.Enum("16:9", "1:1", "21:9", "2:3", "3:2", "4:5", "5:4", "9:16", "9:21"),
+		),
+		withStabilitySeed(),
+		withStabilityOutputFormat(),
+	)
+
+	opts.addTool(s, generateImageTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		// prompt 或加权提示词列表 prompts（合并为单个提示词）
+		prompt, errResult := getGeneratePrompt(req)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		// 可选参数由 client 校验，为空 / 0 时使用 Stability 默认值
+		negativePrompt := req.GetString("negative_prompt", "")
+		aspectRatio := req.GetString("aspect_ratio", "")
+		seed := int64(req.GetInt("seed", 0))
+		outputFormat := req.GetString("output_format", "")
+
+		prompts := opts.preparePrompt(ctx, prompt)
+		opts.enhancePrompt(ctx, &prompts)
+		fields := map[string]interface{}{
+			"prompt":           prompt,
+			"effective_prompt": prompts.EffectivePrompt,
+			"negative_prompt":  negativePrompt,
+			"aspect_ratio":     aspectRatio,
+			"seed":             seed,
+			"output_format":    outputFormat,
+		}
+		common.WithRequestID(ctx).WithFields(fields).Info("Generating image with Stability")
+
+		ctx = withUploadTags(ctx, "stability", "generate")
+		ctx = opts.routeModel(ctx, routeGenerate, &prompts)
+		imageURL, err := stabilityClient.GenerateImage(ctx, prompts.EffectivePrompt, negativePrompt, aspectRatio, seed, outputFormat)
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).WithField("prompt", prompt).Error("Failed to generate image with Stability")
+			return newToolErrorResult("failed to generate image", err), nil
+		}
+
+		common.WithRequestID(ctx).WithFields(common.MergeFields(map[string]interface{}{
+			"prompt": prompt,
+		}, imageLogFields("image_url", imageURL))).Info("Image generated with Stability successfully")
+
+		return newGenerationResult(generationResult{Image: imageURL, promptInfo: prompts},
+			fmt.Sprintf("Generated image: %s", imageURL)), nil
+	})
+
+	editImageTool := mcp.NewTool(
+		"stability_edit_image",
+		mcp.WithDescription("Edit an image using Stability AI image-to-image (Stable Diffusion 3 / Stable Image Ultra). Takes one image URL or data URI and a prompt, returns the new image URL or data URI."),
+		mcp.WithString("prompt",
+			mcp.Required(),
+			mcp.Description("Text prompt describing the desired result"),
+		),
+		mcp.WithString("image_url",
+			mcp.Required(),
+			mcp.Description("Input image URL or data URI"),
+		),
+		withStabilityNegativePrompt(),
+		mcp.WithNumber("strength",
+			mcp.Description("Optional. How much the input image is changed, from 0 (keep the input) to 1 (ignore it). An explicit 0 is sent as is; omit the parameter for the default of 0.5."),
+		),
+		withStabilitySeed(),
+		withStabilityOutputFormat(),
+	)
+
+	opts.addTool(s, editImageTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		prompt, err := req.RequireString("prompt")
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).Error("Failed to get prompt parameter")
+			return newInvalidArgumentResult(fmt.Sprintf("prompt parameter is required: %v", err)), nil
+		}
+		imageURL, err := req.RequireString("image_url")
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).Error("Failed to get image_url parameter")
+			return newInvalidArgumentResult(fmt.Sprintf("image_url parameter is required: %v", err)), nil
+		}
+
+		negativePrompt := req.GetString("negative_prompt", "")
+		// 0 是合法取值（保持原图），只有未传该参数时才使用默认值
+		strength := stability.DefaultStrength
+		if _, ok := req.GetArguments()["strength"]; ok {
+			strength = req.GetFloat("strength", 0)
+			if strength < 0 || strength > 1 {
+				return newInvalidArgumentResult(fmt.Sprintf("strength must be between 0 and 1, got %v", strength)), nil
+			}
+		}
+		seed := int64(req.GetInt("seed", 0))
+		outputFormat := req.GetString("output_format", "")
+
+		prompts := opts.preparePrompt(ctx, prompt)
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"prompt":           prompt,
+			"effective_prompt": prompts.EffectivePrompt,
+			"negative_prompt":  negativePrompt,
+			"strength":         strength,
+			"seed":             seed,
+			"output_format":    outputFormat,
+		}).Info("Editing image with Stability")
+
+		ctx = withUploadTags(ctx, "stability", "edit")
+		ctx = opts.routeModel(ctx, routeEdit, &prompts)
+		editedImageURL, err := stabilityClient.EditImage(ctx, prompts.EffectivePrompt, imageURL, negativePrompt, strength, seed, outputFormat)
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).WithField("prompt", prompt).Error("Failed to edit image with Stability")
+			return newToolErrorResult("failed to edit image", err), nil
+		}
+
+		common.WithRequestID(ctx).WithFields(common.MergeFields(map[string]interface{}{
+			"prompt": prompt,
+		}, imageLogFields("edited_url", editedImageURL))).Info("Image edited with Stability successfully")
+
+		return newGenerationResult(generationResult{Image: editedImageURL, promptInfo: prompts},
+			fmt.Sprintf("Edited image: %s", editedImageURL)), nil
+	})
+
+	// 统一编辑 / 生成后编辑 / 多轮编辑使用 Stability 默认参数；图生图只接受单张输入图片
+	editSingle := func(ctx context.Context, prompt string, imageURLs []string) (string, error) {
+		if len(imageURLs) != 1 {
+			return "", common.NewError(common.ErrCodeInvalidArgument, false, "stability edits exactly one image, got %d", len(imageURLs))
+		}
+		return stabilityClient.EditImage(ctx, prompt, imageURLs[0], "", stability.DefaultStrength, 0, "")
+	}
+
+	registerEditImageTool(s, opts, unifiedEditProvider{
+		Prefix:    "stability",
+		Name:      "Stability",
+		MaxImages: 1,
+		Edit: func(ctx context.Context, prompt string, imageURLs []string) (string, string, error) {
+			image, err := editSingle(ctx, prompt, imageURLs)
+			return image, "", err
+		},
+	})
+
+	chain := chainProvider{
+		Prefix: "stability",
+		Name:   "Stability",
+		Generate: func(ctx context.Context, prompt string) (string, error) {
+			return stabilityClient.GenerateImage(ctx, prompt, "", "", 0, "")
+		},
+		Edit: editSingle,
+	}
+	registerGenerateThenEditTool(s, opts, chain)
+	registerEditSessionTool(s, opts, chain)
+
+	return nil
+}
+
+// withStabilityNegativePrompt Stability 生成 / 编辑工具的 negative_prompt 参数
+func withStabilityNegativePrompt() mcp.ToolOption {
+	return mcp.WithString("negative_prompt",
+		mcp.Description("Optional negative prompt describing what should not appear in the image."),
+	)
+}
+
+// withStabilitySeed Stability 生成 / 编辑工具的 seed 参数
+func withStabilitySeed() mcp.ToolOption {
+	return mcp.WithNumber("seed",
+		mcp.Description("Optional seed (0-4294967294) for reproducible results. Omit or 0 for a random seed."),
+	)
+}
+
+// withStabilityOutputFormat Stability 生成 / 编辑工具的 output_format 参数（图片编码，与 GENAI_IMAGE_FORMAT 无关）
+func withStabilityOutputFormat() mcp.ToolOption {
+	return mcp.WithString("output_format",
+		mcp.Description("Optional image encoding requested from Stability: png, jpeg or webp (webp is not available for sd3 models). Default: png. The server still returns the image as a URL or base64 according to its output setting."),
+		mcp.Enum("png", "jpeg", "webp"),
+	)
+}
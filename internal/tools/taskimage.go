@@ -0,0 +1,205 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"genai-mcp/common"
+	"genai-mcp/internal/utils"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// taskImageStep 返回查询指定任务结果图片的单次查询函数
+type taskImageStep func(taskID string) taskStepFunc
+
+// registerGetTaskImageTool 注册 <prefix>_get_task_image 工具：查询已完成的异步任务，
+// 将结果图片（必要时先下载）以 MCP image content（base64 + MIME）返回，客户端可直接渲染，无需再单独获取。
+func registerGetTaskImageTool(s *server.MCPServer, opts Options, prefix, providerName string, step taskImageStep) {
+	tool := mcp.NewTool(
+		prefix+"_get_task_image",
+		mcp.WithDescription(fmt.Sprintf("Fetch the result image of a completed %s task as MCP image content (base64 with MIME type) that clients can display directly. Works for both generate and edit tasks.", providerName)),
+		mcp.WithString("task_id",
+			mcp.Required(),
+			mcp.Description(fmt.Sprintf("Task ID returned from a %s create task tool.", prefix)),
+		),
+		withWaitSeconds(),
+	)
+
+	opts.addTool(s, tool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		taskID, err := req.RequireString("task_id")
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).WithField("provider", prefix).Error("Failed to get task_id parameter for get_task_image")
+			return newInvalidArgumentResult(fmt.Sprintf("task_id parameter is required: %v", err)), nil
+		}
+
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"provider": prefix,
+			"task_id":  taskID,
+		}).Info("Fetching task result image")
+
+		return opts.Poll.pollTask(ctx, opts.Poll.waitDuration(req), false, func(ctx context.Context) (*mcp.CallToolResult, string, bool) {
+			// 单独记录本次查询结果的 MIME 类型（base64-raw 输出时图片本身不带 MIME）
+			queryCtx, mimeRecorder := common.WithImageMIMERecorder(ctx)
+			image, done, err := step(taskID)(queryCtx)
+			if err != nil {
+				common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+					"provider": prefix,
+					"task_id":  taskID,
+				}).Error("Failed to query task for get_task_image")
+				return newToolErrorResult("failed to query task", err), "", true
+			}
+			if !done {
+				return mcp.NewToolResultText(fmt.Sprintf("task %s is not completed yet; retry later or pass wait_seconds", taskID)), "", false
+			}
+
+			data, mimeType, err := taskImageData(ctx, image, mimeRecorder.MIMEType())
+			if err != nil {
+				common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+					"provider": prefix,
+					"task_id":  taskID,
+				}).Error("Failed to load task result image")
+				return newToolErrorResult("failed to load task result image", err), "", true
+			}
+
+			common.WithRequestID(ctx).WithFields(map[string]interface{}{
+				"provider":  prefix,
+				"task_id":   taskID,
+				"mime_type": mimeType,
+				"size":      len(data),
+			}).Info("Task result image fetched")
+			return mcp.NewToolResultImage(fmt.Sprintf("Result image of task %s (%s)", taskID, mimeType),
+				base64.StdEncoding.EncodeToString(data), mimeType), "", true
+		}), nil
+	})
+}
+
+// registerReformatTaskTool 注册 <prefix>_reformat_task_result 工具：重新查询已完成的任务，
+// 将结果图片（首张）按调用时指定的输出格式返回，与服务端的 GENAI_IMAGE_FORMAT 无关。
+// 用于创建任务后需求变化的场景（例如原本使用 base64，现在需要 OSS URL）；provider 已不再保留结果时返回明确的错误。
+func registerReformatTaskTool(s *server.MCPServer, opts Options, prefix, providerName string, step taskImageStep) {
+	tool := mcp.NewTool(
+		prefix+"_reformat_task_result",
+		mcp.WithDescription(fmt.Sprintf("Re-query a completed %s task and return its result image in a different output format than the server default, for example an OSS URL instead of base64. Works for both generate and edit tasks while the provider still keeps the result; fails with a clear error once the result has expired.", providerName)),
+		mcp.WithString("task_id",
+			mcp.Required(),
+			mcp.Description(fmt.Sprintf("Task ID returned from a %s create task tool.", prefix)),
+		),
+		mcp.WithString("output_format",
+			mcp.Required(),
+			mcp.Description("Output format for the result image: base64 (data URI), base64-raw (plain base64, MIME type in structured output) or url (uploaded to OSS; requires OSS to be configured)."),
+		),
+		withWaitSeconds(),
+	)
+
+	opts.addTool(s, tool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		taskID, err := req.RequireString("task_id")
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).WithField("provider", prefix).Error("Failed to get task_id parameter for reformat_task_result")
+			return newInvalidArgumentResult(fmt.Sprintf("task_id parameter is required: %v", err)), nil
+		}
+		format := strings.ToLower(strings.TrimSpace(req.GetString("output_format", "")))
+		switch format {
+		case "base64", utils.ImageFormatBase64Raw:
+		case "url":
+			if opts.OSSClient == nil || opts.OSSBucket == "" {
+				return newInvalidArgumentResult("output_format url requires OSS to be configured (OSS_BUCKET, OSS_ACCESS_KEY, OSS_SECRET_KEY)"), nil
+			}
+		default:
+			return newInvalidArgumentResult(fmt.Sprintf("output_format must be base64, base64-raw or url, got %q", format)), nil
+		}
+
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"provider":      prefix,
+			"task_id":       taskID,
+			"output_format": format,
+		}).Info("Re-formatting task result")
+		ctx = withUploadTags(ctx, prefix, "query")
+
+		return opts.Poll.pollTask(ctx, opts.Poll.waitDuration(req), false, func(ctx context.Context) (*mcp.CallToolResult, string, bool) {
+			queryCtx, mimeRecorder := common.WithImageMIMERecorder(ctx)
+			image, done, err := step(taskID)(queryCtx)
+			if errors.Is(err, utils.ErrImageGone) {
+				return resultGoneResult(ctx, prefix, taskID, err), "", true
+			}
+			if err != nil {
+				common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+					"provider": prefix,
+					"task_id":  taskID,
+				}).Error("Failed to query task for reformat_task_result")
+				return newToolErrorResult("failed to query task", err), "", true
+			}
+			if !done {
+				return mcp.NewToolResultText(fmt.Sprintf("task %s is not completed yet; retry later or pass wait_seconds", taskID)), "", false
+			}
+
+			data, mimeType, err := taskImageData(ctx, image, mimeRecorder.MIMEType())
+			if errors.Is(err, utils.ErrImageGone) {
+				return resultGoneResult(ctx, prefix, taskID, err), "", true
+			}
+			if err != nil {
+				common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+					"provider": prefix,
+					"task_id":  taskID,
+				}).Error("Failed to load task result image for reformat")
+				return newToolErrorResult("failed to load task result image", err), "", true
+			}
+
+			formatted, err := publishImageAs(ctx, opts, format, data, mimeType)
+			if err != nil {
+				common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+					"provider": prefix,
+					"task_id":  taskID,
+				}).Error("Failed to re-format task result image")
+				return newToolErrorResult("failed to re-format task result image", err), "", true
+			}
+
+			common.WithRequestID(ctx).WithFields(common.MergeFields(map[string]interface{}{
+				"provider":      prefix,
+				"task_id":       taskID,
+				"output_format": format,
+			}, imageLogFields("image", formatted))).Info("Task result re-formatted")
+			return newGenerationResult(generationResult{Image: formatted, TaskID: taskID},
+				fmt.Sprintf("Result of task %s as %s: %s", taskID, format, formatted)), "", true
+		}), nil
+	})
+}
+
+// resultGoneResult provider 已不再保留任务结果图片（结果 URL 过期或图片已删除）时的错误结果
+func resultGoneResult(ctx context.Context, prefix, taskID string, err error) *mcp.CallToolResult {
+	common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+		"provider": prefix,
+		"task_id":  taskID,
+	}).Warn("Task result image is no longer available")
+	return newToolErrorResultWithCode(common.ErrCodeNotFound, false,
+		fmt.Sprintf("the result image of task %s is no longer available: the provider's result URL has expired or the image was deleted, so it cannot be re-formatted; create a new task", taskID))
+}
+
+// taskImageData 将任务结果图片转为原始数据与 MIME 类型：data URI 直接解码，http(s) URL 下载，
+// 其它内容按 base64-raw 解码（MIME 使用 provider 记录的 mimeType，缺失时按内容推断）
+func taskImageData(ctx context.Context, image, mimeType string) ([]byte, string, error) {
+	switch {
+	case strings.HasPrefix(image, "data:"):
+		return utils.DecodeDataURI(image)
+	case strings.HasPrefix(image, "http://") || strings.HasPrefix(image, "https://"):
+		data, downloadedMIME, err := utils.DownloadImageFromURL(ctx, image)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to download result image: %w", err)
+		}
+		return data, downloadedMIME, nil
+	default:
+		data, err := base64.StdEncoding.DecodeString(image)
+		if err != nil {
+			return nil, "", fmt.Errorf("unrecognized result image format: %w", err)
+		}
+		if mimeType == "" {
+			mimeType = http.DetectContentType(data)
+		}
+		return data, mimeType, nil
+	}
+}
@@ -0,0 +1,292 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"genai-mcp/common"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// maxBatchTaskIDs 单次批量查询允许的最大任务数
+const maxBatchTaskIDs = 50
+
+// batchTaskResult 批量查询结果中单个任务的输出
+type batchTaskResult struct {
+	TaskID string `json:"task_id"`
+	Result string `json:"result,omitempty"`
+	// 任务尚未完成时为 provider 返回的任务状态（如 pending / processing），此时没有 result 与 error
+	Status string `json:"status,omitempty"`
+	// ProviderPrompt provider 报告的改写后提示词（如 APIMart 的 revised_prompt），未报告时为空
+	ProviderPrompt string `json:"provider_prompt,omitempty"`
+	// MimeType base64-raw 输出时 result 中图片的 MIME 类型
+	MimeType string     `json:"mime_type,omitempty"`
+	Error    *toolError `json:"error,omitempty"`
+}
+
+// batchTaskResponse 批量查询工具的 JSON 输出
+type batchTaskResponse struct {
+	Results   []batchTaskResult `json:"results"`
+	Succeeded int               `json:"succeeded"`
+	Pending   int               `json:"pending"`
+	Failed    int               `json:"failed"`
+	// zip=true 时：压缩包下载地址与打包的图片数（已打包任务的 result 不再重复返回）
+	ArchiveURL     string `json:"archive_url,omitempty"`
+	ArchivedImages int    `json:"archived_images,omitempty"`
+}
+
+// parseTaskIDs 解析 task_ids 参数：支持 JSON 数组，或以逗号 / 换行分隔的列表。重复的 task_id 会被去重。
+func parseTaskIDs(raw string) ([]string, error) {
+	s := strings.TrimSpace(raw)
+
+	var items []string
+	if strings.HasPrefix(s, "[") {
+		if err := json.Unmarshal([]byte(trailingCommaPattern.ReplaceAllString(s, "]")), &items); err != nil {
+			return nil, fmt.Errorf("task_ids looks like a JSON array but could not be parsed: %v", err)
+		}
+	} else {
+		items = strings.FieldsFunc(s, func(r rune) bool {
+			return r == ',' || r == '\n'
+		})
+	}
+
+	seen := make(map[string]bool, len(items))
+	taskIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		id := strings.Trim(strings.TrimSpace(item), "\"'")
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		taskIDs = append(taskIDs, id)
+	}
+
+	if len(taskIDs) == 0 {
+		return nil, fmt.Errorf("task_ids cannot be empty")
+	}
+	if len(taskIDs) > maxBatchTaskIDs {
+		return nil, fmt.Errorf("too many task_ids: got %d, at most %d are allowed per call", len(taskIDs), maxBatchTaskIDs)
+	}
+	return taskIDs, nil
+}
+
+// registerQueryTasksTool 注册批量查询任务的工具（<prefix>_query_tasks），供异步 provider 共用。
+// providerName 仅用于描述与日志。
+func registerQueryTasksTool(s *server.MCPServer, opts Options, prefix, providerName string, queryTasks func(ctx context.Context, taskIDs []string) []common.TaskQueryResult) {
+	queryTasksTool := mcp.NewTool(
+		prefix+"_query_tasks",
+		mcp.WithDescription(fmt.Sprintf("Query the results of multiple %s tasks (generate or edit) in one call. Returns a JSON object with one entry per task_id; each entry has either a result or a structured error.", providerName)),
+		mcp.WithString("task_ids",
+			mcp.Required(),
+			mcp.Description(fmt.Sprintf("Task IDs to query, as a JSON array or a comma/newline-separated list (at most %d).", maxBatchTaskIDs)),
+		),
+		mcp.WithBoolean("zip",
+			mcp.Description("Optional. Package all result images into one zip archive (with a manifest.json mapping each file to its task and prompt), upload it to OSS and return archive_url instead of per-task results. Requires OSS upload to be configured."),
+		),
+	)
+
+	opts.addTool(s, queryTasksTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		raw, err := req.RequireString("task_ids")
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).Errorf("%s: failed to get task_ids parameter for query_tasks", providerName)
+			return newInvalidArgumentResult(fmt.Sprintf("task_ids parameter is required: %v", err)), nil
+		}
+
+		taskIDs, err := parseTaskIDs(raw)
+		if err != nil {
+			return newInvalidArgumentResult(err.Error()), nil
+		}
+
+		zipResults := req.GetBool("zip", false)
+		if zipResults && !ossConfigured(opts) {
+			return newInvalidArgumentResult("zip output requires OSS upload (GENAI_IMAGE_FORMAT=url with OSS configured)"), nil
+		}
+
+		common.WithRequestID(ctx).WithField("task_count", len(taskIDs)).Infof("%s: querying tasks in batch", providerName)
+		ctx = withUploadTags(ctx, prefix, "query")
+
+		resp := batchTaskResponse{Results: make([]batchTaskResult, 0, len(taskIDs))}
+		for _, r := range queryTasks(ctx, taskIDs) {
+			item := batchTaskResult{TaskID: r.TaskID, Result: r.Result, ProviderPrompt: r.ProviderPrompt, MimeType: r.MimeType}
+			switch {
+			case taskNotCompleted(r.Err):
+				// 未完成的任务与单任务查询一样不视为失败，返回其状态以便调用方稍后重试
+				item.Status = apimartTaskState(r.Err)
+				resp.Pending++
+			case r.Err != nil:
+				classified := common.ClassifyError(r.Err)
+				item.Result = ""
+				item.MimeType = ""
+				item.Error = &toolError{
+					Code:      classified.Code,
+					Message:   r.Err.Error(),
+					Retryable: classified.Retryable,
+				}
+				resp.Failed++
+			default:
+				resp.Succeeded++
+			}
+			resp.Results = append(resp.Results, item)
+		}
+
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"task_count": len(taskIDs),
+			"succeeded":  resp.Succeeded,
+			"pending":    resp.Pending,
+			"failed":     resp.Failed,
+		}).Infof("%s: batch task query finished", providerName)
+
+		if zipResults {
+			if errResult := archiveBatchResults(ctx, opts, providerName, &resp); errResult != nil {
+				return errResult, nil
+			}
+		}
+
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return newToolErrorResult("failed to encode batch task results", err), nil
+		}
+		return mcp.NewToolResultText(string(data)), nil
+	})
+}
+
+// archiveBatchResults 将批量查询结果中的图片打包为 zip 并上传 OSS，写入 resp.ArchiveURL。
+// 全部图片都写入压缩包的任务的 result 会被清空；未完成、失败、没有可打包图片或有图片读取失败的任务保持原样。
+// 没有可打包的图片时不生成压缩包。
+func archiveBatchResults(ctx context.Context, opts Options, providerName string, resp *batchTaskResponse) *mcp.CallToolResult {
+	var images []archivedImage
+	// taskImages 结果序号 → 该任务的图片在 images 中的下标
+	taskImages := make(map[int][]int)
+	for i, item := range resp.Results {
+		if item.Error != nil {
+			continue
+		}
+		for _, img := range extractArchivedImages(item.TaskID, item.Result, item.MimeType, item.ProviderPrompt) {
+			taskImages[i] = append(taskImages[i], len(images))
+			images = append(images, img)
+		}
+	}
+	if len(images) == 0 {
+		common.WithRequestID(ctx).Infof("%s: no result images to archive", providerName)
+		return nil
+	}
+
+	data, archived, err := buildResultsArchive(ctx, images)
+	if err != nil {
+		common.WithRequestID(ctx).WithError(err).Errorf("%s: failed to build results archive", providerName)
+		return newToolErrorResult("failed to build results archive", err)
+	}
+	url, err := uploadResultsArchive(ctx, opts, data)
+	if err != nil {
+		return newToolErrorResult("failed to upload results archive", err)
+	}
+
+	for i, indexes := range taskImages {
+		written := true
+		for _, j := range indexes {
+			written = written && images[j].Archived
+		}
+		if written {
+			resp.Results[i].Result = ""
+		}
+	}
+	resp.ArchiveURL = url
+	resp.ArchivedImages = archived
+
+	common.WithRequestID(ctx).WithFields(map[string]interface{}{
+		"archive_url":     url,
+		"archived_images": archived,
+		"size":            len(data),
+	}).Infof("%s: batch results archived", providerName)
+	return nil
+}
+
+// registerQueryTaskRawTool 注册 {prefix}_query_task_raw 工具：原样返回 provider 的任务查询响应。
+// 常规查询工具会对结果做格式化（图片转 base64 / OSS URL、按状态返回提示等），
+// 该工具用于需要完整原始字段（生成元数据、安全审核信息等）的场景。
+func registerQueryTaskRawTool(s *server.MCPServer, opts Options, prefix, providerName string, queryRaw func(ctx context.Context, taskID string) (string, error)) {
+	queryRawTool := mcp.NewTool(
+		prefix+"_query_task_raw",
+		mcp.WithDescription(fmt.Sprintf("Query a %s task (generate or edit) and return the provider's raw, untransformed JSON response, including metadata the formatted query tools omit. Images are not downloaded or re-uploaded and pagination is not merged.", providerName)),
+		mcp.WithString("task_id",
+			mcp.Required(),
+			mcp.Description(fmt.Sprintf("Task ID returned from a %s create-task tool.", prefix)),
+		),
+	)
+
+	opts.addTool(s, queryRawTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		taskID, err := req.RequireString("task_id")
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).Errorf("%s: failed to get task_id parameter for query_task_raw", providerName)
+			return newInvalidArgumentResult(fmt.Sprintf("task_id parameter is required: %v", err)), nil
+		}
+
+		common.WithRequestID(ctx).WithField("task_id", taskID).Infof("%s: querying raw task response", providerName)
+
+		resultJSON, err := queryRaw(ctx, taskID)
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).WithField("task_id", taskID).Errorf("%s: failed to query raw task response", providerName)
+			return newToolErrorResult("failed to query task", err), nil
+		}
+
+		return mcp.NewToolResultText(resultJSON), nil
+	})
+}
+
+// taskStatusResult {prefix}_query_generate_image_status 工具的结构化输出
+type taskStatusResult struct {
+	common.TaskStatus
+	resultMetadata
+}
+
+// registerQueryStatusTool 注册 {prefix}_query_generate_image_status 工具：查询文生图任务，
+// 返回与 provider 无关的统一任务状态（status / progress / image_urls / error），调用方无需解析各家的响应 JSON。
+func registerQueryStatusTool(s *server.MCPServer, opts Options, prefix, providerName string, queryStatus func(ctx context.Context, taskID string) (*common.TaskStatus, error)) {
+	queryStatusTool := mcp.NewTool(
+		prefix+"_query_generate_image_status",
+		mcp.WithDescription(fmt.Sprintf("Query an image generation task created by %s and return a provider-independent status: status (pending, running, succeeded or failed), progress when reported, image_urls when succeeded, and error when failed.", prefix+"_create_generate_image_task")),
+		mcp.WithString("task_id",
+			mcp.Required(),
+			mcp.Description(fmt.Sprintf("Task ID returned from %s_create_generate_image_task.", prefix)),
+		),
+		withWaitSeconds(),
+		withStateHistory(),
+	)
+
+	opts.addTool(s, queryStatusTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		taskID, err := req.RequireString("task_id")
+		if err != nil {
+			common.WithRequestID(ctx).WithError(err).Errorf("%s: failed to get task_id parameter for query_generate_image_status", providerName)
+			return newInvalidArgumentResult(fmt.Sprintf("task_id parameter is required: %v", err)), nil
+		}
+
+		common.WithRequestID(ctx).WithField("task_id", taskID).Infof("%s: querying generate-image task status", providerName)
+		ctx = withUploadTags(ctx, prefix, "generate")
+
+		// wait_seconds > 0 时轮询直到任务进入终态或超时
+		return opts.Poll.pollTask(ctx, opts.Poll.waitDuration(req), includeStateHistory(req), func(ctx context.Context) (*mcp.CallToolResult, string, bool) {
+			status, err := queryStatus(ctx, taskID)
+			if err != nil {
+				common.WithRequestID(ctx).WithError(err).WithField("task_id", taskID).Errorf("%s: failed to query generate-image task status", providerName)
+				return newToolErrorResult("failed to query generate-image task status", err), "", true
+			}
+
+			text := fmt.Sprintf("task %s: %s", taskID, status.Status)
+			switch {
+			case len(status.ImageURLs) > 0:
+				text += "\n" + strings.Join(status.ImageURLs, "\n")
+			case status.Error != "":
+				text += ": " + status.Error
+			}
+			result := mcp.NewToolResultStructured(taskStatusResult{TaskStatus: *status}, text)
+			if status.Status == common.TaskStatusSucceeded {
+				opts.reportImageCount(ctx, result, prefix, taskID, status.Requested, len(status.ImageURLs))
+			}
+			return result, status.Status, status.Finished()
+		}), nil
+	})
+}
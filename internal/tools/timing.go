@@ -0,0 +1,39 @@
+package tools
+
+import (
+	"context"
+	"time"
+
+	"genai-mcp/common"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// withTiming 为工具调用挂载耗时记录器：provider client、下载、OSS 上传与轮询等待通过 context 记录各阶段耗时，
+// 调用成功且记录到任何阶段时，在结构化输出中附带 timing 对象（各阶段累计毫秒数与 total_ms）。
+func withTiming(name string, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, timing := common.WithTiming(ctx)
+		start := time.Now()
+
+		result, err := handler(ctx, req)
+
+		stages := timing.Milliseconds()
+		if stages == nil {
+			return result, err
+		}
+		stages["total_ms"] = time.Since(start).Milliseconds()
+
+		fields := map[string]interface{}{"tool": name}
+		for stage, ms := range stages {
+			fields[stage] = ms
+		}
+		common.WithRequestID(ctx).WithFields(fields).Debug("Tool call timing")
+
+		if err == nil && result != nil && !result.IsError {
+			updateMetadata(result, func(m *resultMetadata) { m.Timing = stages })
+		}
+		return result, err
+	}
+}
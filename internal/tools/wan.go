@@ -2,11 +2,13 @@ package tools
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 
 	"genai-mcp/common"
 	"genai-mcp/internal/genai/wan"
+	"genai-mcp/internal/utils"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
@@ -19,53 +21,92 @@ import (
 //   - wan_query_generate_image_task   文生图：根据 task_id 查询任务结果，返回原始 JSON
 //   - wan_create_edit_image_task      图像编辑：创建异步任务，返回 task_id
 //   - wan_query_edit_image_task       图像编辑：根据 task_id 查询任务结果，返回原始 JSON
+//   - wan_query_tasks                 批量查询：一次查询多个 task_id 的结果
+//   - wan_query_task_raw              原始响应：返回未经格式化的任务查询 JSON
+//   - wan_query_generate_image_status 统一状态：将文生图任务查询结果解析为与 provider 无关的结构
+//   - edit_image                      统一编辑：接受 URL 与 data URI，data URI 自动上传 OSS 后创建编辑任务
+//   - generate_then_edit              生成后编辑：一次调用内等待生成任务完成，再以其结果创建编辑任务并等待完成
+//   - edit_session                    多轮编辑：按 session_id 记住最新结果图片，后续每轮只需提供提示词
+//   - wan_get_task_image              结果图片：将已完成任务的结果图片以 MCP image content 返回
+//   - wan_reformat_task_result        重新格式化：按指定输出格式（base64 / base64-raw / url）返回已完成任务的结果图片
 //
 // WanIface 的具体实现由调用方创建（例如使用 internal/genai/wan/client.go）。
-func RegisterWanTools(s *server.MCPServer, wanClient wan.WanIface) error {
+func RegisterWanTools(s *server.MCPServer, wanClient wan.WanIface, opts Options) error {
 	// 1. 文生图 - 创建任务
 	createGenerateTool := mcp.NewTool(
 		"wan_create_generate_image_task",
 		mcp.WithDescription("Create an asynchronous image generation task using Ali Bailian Wanxiang. Returns a task_id."),
 		mcp.WithString("prompt",
-			mcp.Required(),
-			mcp.Description("Text prompt describing the image to generate."),
+			mcp.Description("Text prompt describing the image to generate. Required unless prompts is given."),
 		),
+		withWeightedPrompts(),
 		mcp.WithString("negative_prompt",
 			mcp.Description("Optional negative prompt to describe what should be avoided in the image."),
 		),
+		mcp.WithString("size",
+			mcp.Description("Optional output size: an aspect ratio (1:1, 2:3, 3:2, 3:4, 4:3, 4:5, 5:4, 9:16, 16:9, 21:9) or explicit WIDTH*HEIGHT with each side between 512 and 1440 (e.g. 1280*720). Default: 1024*1024."),
+		),
+		mcp.WithString("n",
+			mcp.Description("Number of images to generate (1-4). Default: 1."),
+		),
 	)
 
-	s.AddTool(createGenerateTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		prompt, err := req.RequireString("prompt")
-		if err != nil {
-			common.WithError(err).Error("Wan: failed to get prompt parameter for create_generate_image_task")
-			return mcp.NewToolResultError(fmt.Sprintf("prompt parameter is required: %v", err)), nil
+	opts.addTool(s, createGenerateTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		// prompt 或加权提示词列表 prompts（合并为单个提示词）
+		prompt, errResult := getGeneratePrompt(req)
+		if errResult != nil {
+			return errResult, nil
 		}
 
-		// 可选参数：negative_prompt（如果未传则为空字符串）
-		negativePrompt := ""
+		// 可选参数：negative_prompt（未传时为空字符串，client 不写入请求 input）
+		negativePrompt := req.GetString("negative_prompt", "")
+		// 可选参数：size（宽高比或 宽*高，由 client 转换并校验）
+		size := req.GetString("size", "")
+		// 可选参数：n（生成图片数，超出范围时由 client 返回参数错误）
+		n := req.GetInt("n", 1)
+		if n <= 0 {
+			n = 1
+		}
 
-		common.WithFields(map[string]interface{}{
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
 			"prompt":          prompt,
 			"negative_prompt": negativePrompt,
+			"size":            size,
+			"n":               n,
 		}).Info("Wan: creating generate-image task")
 
-		taskID, err := wanClient.CreateGenerateImageTask(ctx, prompt, negativePrompt)
+		prompts := opts.preparePrompt(ctx, prompt)
+		opts.enhancePrompt(ctx, &prompts)
+		ctx = opts.routeModel(ctx, routeGenerate, &prompts)
+		taskID, err := wanClient.CreateGenerateImageTask(ctx, prompts.EffectivePrompt, negativePrompt, size, n)
 		if err != nil {
-			common.WithError(err).WithFields(map[string]interface{}{
+			common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
 				"prompt":          prompt,
 				"negative_prompt": negativePrompt,
+				"size":            size,
+				"n":               n,
 			}).Error("Wan: failed to create generate-image task")
-			return mcp.NewToolResultError(fmt.Sprintf("failed to create generate-image task: %v", err)), nil
+			return newToolErrorResult("failed to create generate-image task", err), nil
 		}
 
-		common.WithFields(map[string]interface{}{
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
 			"prompt":          prompt,
 			"negative_prompt": negativePrompt,
 			"task_id":         taskID,
 		}).Info("Wan: generate-image task created successfully")
 
-		return mcp.NewToolResultText(fmt.Sprintf("generate_image task_id: %s", taskID)), nil
+		// 部分图片生成失败时以相同参数补齐缺少的数量（GENAI_TOP_UP_PARTIAL_RESULTS）
+		// 补齐任务同样计入每日用量，按本次实际使用的模型计价
+		unitCost := opts.imagesCost([]string{common.RoutedModel(ctx, opts.GenModel)}, size, 1)
+		opts.rememberTopUp(taskID, unitCost, func(ctx context.Context, n int) (string, error) {
+			if prompts.RoutedModel != "" {
+				ctx = common.WithRoutedModel(ctx, prompts.RoutedModel)
+			}
+			return wanClient.CreateGenerateImageTask(ctx, prompts.EffectivePrompt, negativePrompt, size, n)
+		})
+
+		return newGenerationResult(generationResult{TaskID: taskID, promptInfo: prompts},
+			fmt.Sprintf("generate_image task_id: %s", taskID)), nil
 	})
 
 	// 2. 文生图 - 查询任务
@@ -76,82 +117,126 @@ func RegisterWanTools(s *server.MCPServer, wanClient wan.WanIface) error {
 			mcp.Required(),
 			mcp.Description("Task ID returned from wan_create_generate_image_task."),
 		),
+		withWaitSeconds(),
+		withStateHistory(),
 	)
 
-	s.AddTool(queryGenerateTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	opts.addTool(s, queryGenerateTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		taskID, err := req.RequireString("task_id")
 		if err != nil {
-			common.WithError(err).Error("Wan: failed to get task_id parameter for query_generate_image_task")
-			return mcp.NewToolResultError(fmt.Sprintf("task_id parameter is required: %v", err)), nil
+			common.WithRequestID(ctx).WithError(err).Error("Wan: failed to get task_id parameter for query_generate_image_task")
+			return newInvalidArgumentResult(fmt.Sprintf("task_id parameter is required: %v", err)), nil
 		}
 
-		common.WithField("task_id", taskID).Info("Wan: querying generate-image task")
+		common.WithRequestID(ctx).WithField("task_id", taskID).Info("Wan: querying generate-image task")
+		ctx = withUploadTags(ctx, "wan", "generate")
 
-		resultJSON, err := wanClient.QueryGenerateImageTask(ctx, taskID)
-		if err != nil {
-			common.WithError(err).WithField("task_id", taskID).Error("Wan: failed to query generate-image task")
-			return mcp.NewToolResultError(fmt.Sprintf("failed to query generate-image task: %v", err)), nil
-		}
+		// wait_seconds > 0 时轮询直到任务进入终态或超时
+		return opts.Poll.pollTask(ctx, opts.Poll.waitDuration(req), includeStateHistory(req), func(ctx context.Context) (*mcp.CallToolResult, string, bool) {
+			resultJSON, err := wanClient.QueryGenerateImageTask(ctx, taskID)
+			if err != nil {
+				common.WithRequestID(ctx).WithError(err).WithField("task_id", taskID).Error("Wan: failed to query generate-image task")
+				return newToolErrorResult("failed to query generate-image task", err), "", true
+			}
 
-		// 直接把 Wan 接口返回的 JSON 内容作为文本结果返回，由上层解析
-		return mcp.NewToolResultText(resultJSON), nil
+			// 直接把 Wan 接口返回的 JSON 内容作为文本结果返回，由上层解析；
+			// prompt_extend 改写了提示词时，结构化内容中附带实际使用的提示词；
+			// Wan 报告了请求的图片数时附带请求 / 返回的图片数
+			status := wanTaskStatus(resultJSON)
+			result := newWanQueryResult(ctx, taskID, resultJSON)
+			requested, returned := wanImageCount(resultJSON)
+			opts.reportImageCount(ctx, result, "wan", taskID, requested, returned)
+			return result, status, wanTaskFinished(resultJSON)
+		}), nil
 	})
 
 	// 3. 图像编辑 - 创建任务
+	// 提示词是否必填取决于 WAN_EDIT_EMPTY_PROMPT：reject 时必填，omit / default 时允许省略（无文字引导的融合 / 变体）
+	editPromptOptions := []mcp.PropertyOption{
+		mcp.Required(),
+		mcp.Description("Text prompt describing how to edit the image."),
+	}
+	if opts.WanEditEmptyPrompt != "reject" {
+		editPromptOptions = []mcp.PropertyOption{
+			mcp.Description("Optional text prompt describing how to edit the image. Omit it for a prompt-free blend or variation of the input image."),
+		}
+	}
+	// Wan 只接受图片 URL；配置了 OSS 时 data URI 由客户端先上传到 OSS 再替换为 URL
+	acceptDataURI := ossConfigured(opts)
+	imageURLsDescription := "JSON array of HTTP/HTTPS URLs of the source images. One image is edited; several are fused into one result (multi-image fusion). Example: [\"url1\", \"url2\"]. A single URL or one URL per line is also accepted. Wan only supports image URLs, not base64 or data URIs."
+	if acceptDataURI {
+		imageURLsDescription = "JSON array of HTTP/HTTPS URLs or base64 data URIs (data:image/<type>;base64,...) of the source images. One image is edited; several are fused into one result (multi-image fusion). Example: [\"url1\", \"data:image/png;base64,...\"]. A single value or one URL per line is also accepted. Wan only fetches URLs, so data URIs are uploaded to OSS first and replaced with their URLs."
+	}
 	createEditTool := mcp.NewTool(
 		"wan_create_edit_image_task",
-		mcp.WithDescription("Create an asynchronous image editing task using Ali Bailian Wanxiang. Returns a task_id."),
-		mcp.WithString("prompt",
-			mcp.Required(),
-			mcp.Description("Text prompt describing how to edit the image."),
+		mcp.WithDescription("Create an asynchronous image editing or multi-image fusion task using Ali Bailian Wanxiang. Returns a task_id."),
+		mcp.WithString("prompt", editPromptOptions...),
+		mcp.WithString("image_urls",
+			mcp.Description(imageURLsDescription+" Required unless image_url is given."),
 		),
 		mcp.WithString("image_url",
-			mcp.Required(),
-			mcp.Description("HTTP/HTTPS URL of the source image to be edited. Wan only supports image URLs, not base64 or data URIs."),
+			mcp.Description("Deprecated: a single source image, accepted for backwards compatibility. Ignored when image_urls is given."),
 		),
 	)
 
-	s.AddTool(createEditTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		prompt, err := req.RequireString("prompt")
-		if err != nil {
-			common.WithError(err).Error("Wan: failed to get prompt parameter for create_edit_image_task")
-			return mcp.NewToolResultError(fmt.Sprintf("prompt parameter is required: %v", err)), nil
+	opts.addTool(s, createEditTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		prompt := req.GetString("prompt", "")
+		if strings.TrimSpace(prompt) == "" && opts.WanEditEmptyPrompt == "reject" {
+			common.WithRequestID(ctx).Error("Wan: failed to get prompt parameter for create_edit_image_task")
+			return newInvalidArgumentResult("prompt parameter is required"), nil
 		}
 
-		imageURL, err := req.RequireString("image_url")
-		if err != nil {
-			common.WithError(err).Error("Wan: failed to get image_url parameter for create_edit_image_task")
-			return mcp.NewToolResultError(fmt.Sprintf("image_url parameter is required: %v", err)), nil
+		// 优先使用 image_urls，未传时兼容旧的单图参数 image_url；
+		// 使用共享的宽松解析逻辑，未配置 OSS 时拒绝 base64 / data URI
+		param := "image_urls"
+		if strings.TrimSpace(req.GetString("image_urls", "")) == "" && strings.TrimSpace(req.GetString("image_url", "")) != "" {
+			param = "image_url"
 		}
-
-		// Wan 只支持图片 URL 输入：必须是 http 或 https
-		if !strings.HasPrefix(imageURL, "http://") && !strings.HasPrefix(imageURL, "https://") {
-			common.WithField("image_url", imageURL).Error("Wan: image_url must be an HTTP/HTTPS URL (no base64 or data URIs)")
-			return mcp.NewToolResultError("image_url must be an HTTP/HTTPS URL; Wan does not support base64 or data URIs"), nil
+		imageURLs, errResult := requireImageURLs(ctx, req, param, acceptDataURI)
+		if errResult != nil {
+			return errResult, nil
+		}
+		// Wan 各编辑模型支持的输入图片数不同，模型上限未知，只应用 GENAI_MAX_EDIT_IMAGES，超出模型能力时由 DashScope 报错
+		if err := opts.checkEditImageCount(len(imageURLs), 0); err != nil {
+			common.WithRequestID(ctx).WithError(err).Warn("Wan: rejected edit-image request")
+			return newInvalidArgumentResult(err.Error()), nil
 		}
 
-		common.WithFields(map[string]interface{}{
-			"prompt":    prompt,
-			"image_url": imageURL,
+		logURLs := make([]string, len(imageURLs))
+		for i, imageURL := range imageURLs {
+			logURLs[i] = utils.TruncateForLog(imageURL, 200)
+		}
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"prompt":     prompt,
+			"image_urls": logURLs,
 		}).Info("Wan: creating edit-image task")
 
-		// MCP 工具目前仍只接受单个 image_url，这里用单元素切片适配底层多图接口
-		taskID, err := wanClient.CreateEditImageTask(ctx, prompt, []string{imageURL})
+		prompts := opts.preparePrompt(ctx, prompt)
+		if strings.TrimSpace(prompt) == "" {
+			// omit：不发送 prompt 字段；default：发送配置的中性提示词
+			prompts.EffectivePrompt = ""
+			if opts.WanEditEmptyPrompt == "default" {
+				prompts.EffectivePrompt = opts.WanEditDefaultPrompt
+			}
+		}
+		ctx = opts.routeModel(ctx, routeEdit, &prompts)
+		taskID, err := wanClient.CreateEditImageTask(ctx, prompts.EffectivePrompt, imageURLs)
 		if err != nil {
-			common.WithError(err).WithFields(map[string]interface{}{
-				"prompt":    prompt,
-				"image_url": imageURL,
+			common.WithRequestID(ctx).WithError(err).WithFields(map[string]interface{}{
+				"prompt":     prompt,
+				"image_urls": logURLs,
 			}).Error("Wan: failed to create edit-image task")
-			return mcp.NewToolResultError(fmt.Sprintf("failed to create edit-image task: %v", err)), nil
+			return newToolErrorResult("failed to create edit-image task", err), nil
 		}
 
-		common.WithFields(map[string]interface{}{
-			"prompt":    prompt,
-			"image_url": imageURL,
-			"task_id":   taskID,
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"prompt":      prompt,
+			"image_count": len(imageURLs),
+			"task_id":     taskID,
 		}).Info("Wan: edit-image task created successfully")
 
-		return mcp.NewToolResultText(fmt.Sprintf("edit_image task_id: %s", taskID)), nil
+		return newGenerationResult(generationResult{TaskID: taskID, promptInfo: prompts},
+			fmt.Sprintf("edit_image task_id: %s", taskID)), nil
 	})
 
 	// 4. 图像编辑 - 查询任务
@@ -162,25 +247,163 @@ func RegisterWanTools(s *server.MCPServer, wanClient wan.WanIface) error {
 			mcp.Required(),
 			mcp.Description("Task ID returned from wan_create_edit_image_task."),
 		),
+		withWaitSeconds(),
+		withStateHistory(),
 	)
 
-	s.AddTool(queryEditTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	opts.addTool(s, queryEditTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		taskID, err := req.RequireString("task_id")
 		if err != nil {
-			common.WithError(err).Error("Wan: failed to get task_id parameter for query_edit_image_task")
-			return mcp.NewToolResultError(fmt.Sprintf("task_id parameter is required: %v", err)), nil
+			common.WithRequestID(ctx).WithError(err).Error("Wan: failed to get task_id parameter for query_edit_image_task")
+			return newInvalidArgumentResult(fmt.Sprintf("task_id parameter is required: %v", err)), nil
 		}
 
-		common.WithField("task_id", taskID).Info("Wan: querying edit-image task")
+		common.WithRequestID(ctx).WithField("task_id", taskID).Info("Wan: querying edit-image task")
+		ctx = withUploadTags(ctx, "wan", "edit")
 
-		resultJSON, err := wanClient.QueryEditImageTask(ctx, taskID)
-		if err != nil {
-			common.WithError(err).WithField("task_id", taskID).Error("Wan: failed to query edit-image task")
-			return mcp.NewToolResultError(fmt.Sprintf("failed to query edit-image task: %v", err)), nil
-		}
+		return opts.Poll.pollTask(ctx, opts.Poll.waitDuration(req), includeStateHistory(req), func(ctx context.Context) (*mcp.CallToolResult, string, bool) {
+			resultJSON, err := wanClient.QueryEditImageTask(ctx, taskID)
+			if err != nil {
+				common.WithRequestID(ctx).WithError(err).WithField("task_id", taskID).Error("Wan: failed to query edit-image task")
+				return newToolErrorResult("failed to query edit-image task", err), "", true
+			}
+
+			status := wanTaskStatus(resultJSON)
+			return newWanQueryResult(ctx, taskID, resultJSON), status, wanTaskFinished(resultJSON)
+		}), nil
+	})
+
+	// 5. 批量查询任务（内部并发逐个查询）
+	registerQueryTasksTool(s, opts, "wan", "Wan", wanClient.QueryTasks)
+
+	// 6. 原始响应查询（不做任何格式化）
+	registerQueryTaskRawTool(s, opts, "wan", "Wan", wanClient.QueryTaskRaw)
 
-		return mcp.NewToolResultText(resultJSON), nil
+	// 统一任务状态查询（与 provider 无关的结构化结果）
+	registerQueryStatusTool(s, opts, "wan", "Wan", wanClient.QueryGenerateImageTaskStatus)
+
+	// 7. 统一编辑工具（Wan 只接受图片 URL，data URI 先上传到 OSS）
+	registerEditImageTool(s, opts, unifiedEditProvider{
+		Prefix:  "wan",
+		Name:    "Wan",
+		URLOnly: true,
+		Edit: func(ctx context.Context, prompt string, imageURLs []string) (string, string, error) {
+			taskID, err := wanClient.CreateEditImageTask(ctx, prompt, imageURLs)
+			return "", taskID, err
+		},
 	})
 
+	// 8. 生成后编辑：生成任务完成后直接把 DashScope 返回的图片 URL 作为编辑输入，无需下载或上传中间图片
+	chain := chainProvider{
+		Prefix:  "wan",
+		Name:    "Wan",
+		URLOnly: true,
+		Generate: func(ctx context.Context, prompt string) (string, error) {
+			taskID, err := wanClient.CreateGenerateImageTask(ctx, prompt, "", "", 1)
+			if err != nil {
+				return "", err
+			}
+			return opts.Poll.waitForTask(ctx, func(ctx context.Context) (string, bool, error) {
+				resultJSON, err := wanClient.QueryTaskRaw(ctx, taskID)
+				if err != nil {
+					return "", true, err
+				}
+				return wanTaskImage(resultJSON)
+			})
+		},
+		Edit: func(ctx context.Context, prompt string, imageURLs []string) (string, error) {
+			taskID, err := wanClient.CreateEditImageTask(ctx, prompt, imageURLs)
+			if err != nil {
+				return "", err
+			}
+			return opts.Poll.waitForTask(ctx, func(ctx context.Context) (string, bool, error) {
+				resultJSON, err := wanClient.QueryEditImageTask(ctx, taskID)
+				if err != nil {
+					return "", true, err
+				}
+				return wanTaskImage(resultJSON)
+			})
+		},
+	}
+	registerGenerateThenEditTool(s, opts, chain)
+
+	// 多轮编辑会话：每轮在内部等待编辑任务完成，会话保存最新结果图片
+	registerEditSessionTool(s, opts, chain)
+
+	// 9. 结果图片：下载已完成任务的首张结果图片，以 MCP image content 返回（文生图与编辑任务均可）
+	wanResultImage := func(taskID string) taskStepFunc {
+		return func(ctx context.Context) (string, bool, error) {
+			resultJSON, err := wanClient.QueryTaskRaw(ctx, taskID)
+			if err != nil {
+				return "", true, err
+			}
+			return wanTaskImage(resultJSON)
+		}
+	}
+	registerGetTaskImageTool(s, opts, "wan", "Wan", wanResultImage)
+
+	// 10. 结果重新格式化：按调用时指定的输出格式返回已完成任务的首张结果图片
+	registerReformatTaskTool(s, opts, "wan", "Wan", wanResultImage)
+
 	return nil
 }
+
+// wanTaskFinished 判断 Wan 任务查询结果是否已进入终态（PENDING / SUSPENDED / RUNNING 以外的状态）。
+// 无法解析状态时视为终态，直接把结果返回给调用方。
+func wanTaskFinished(resultJSON string) bool {
+	switch wanTaskStatus(resultJSON) {
+	case "PENDING", "SUSPENDED", "RUNNING":
+		return false
+	default:
+		return true
+	}
+}
+
+// wanTaskStatus 返回 Wan 任务查询结果中的 task_status（大写），无法解析时返回空
+func wanTaskStatus(resultJSON string) string {
+	var resp struct {
+		Output struct {
+			TaskStatus string `json:"task_status"`
+		} `json:"output"`
+	}
+	if err := json.Unmarshal([]byte(resultJSON), &resp); err != nil {
+		return ""
+	}
+	return strings.ToUpper(resp.Output.TaskStatus)
+}
+
+// wanTaskImage 从 Wan 任务查询结果中取出首张结果图片：任务进行中（PENDING / SUSPENDED / RUNNING）返回 done=false，
+// 失败或成功但没有图片时返回错误
+func wanTaskImage(resultJSON string) (string, bool, error) {
+	var resp struct {
+		Output struct {
+			TaskStatus string `json:"task_status"`
+			Code       string `json:"code"`
+			Message    string `json:"message"`
+			Results    []struct {
+				URL   string `json:"url"`
+				Image string `json:"image_url"`
+			} `json:"results"`
+		} `json:"output"`
+	}
+	if err := json.Unmarshal([]byte(resultJSON), &resp); err != nil {
+		return "", true, fmt.Errorf("failed to parse wan task result: %w", err)
+	}
+
+	switch status := strings.ToUpper(resp.Output.TaskStatus); status {
+	case "PENDING", "SUSPENDED", "RUNNING":
+		return "", false, nil
+	case "SUCCEEDED":
+		for _, r := range resp.Output.Results {
+			if r.URL != "" {
+				return r.URL, true, nil
+			}
+			if r.Image != "" {
+				return r.Image, true, nil
+			}
+		}
+		return "", true, fmt.Errorf("wan task succeeded without an image: %w", common.ErrEmptyResult)
+	default:
+		return "", true, common.NewError(common.ErrCodeUpstream, false, "wan task %s: %s %s", status, resp.Output.Code, resp.Output.Message)
+	}
+}
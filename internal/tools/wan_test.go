@@ -0,0 +1,88 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"genai-mcp/internal/genai/wan"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// TestWanGenerateNegativePrompt 验证 wan_create_generate_image_task 的 negative_prompt 参数写入请求 input，未传时不写入
+func TestWanGenerateNegativePrompt(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      map[string]any
+		wantInput map[string]any
+	}{
+		{
+			name:      "non-empty",
+			args:      map[string]any{"prompt": "a cat", "negative_prompt": "blurry, low quality"},
+			wantInput: map[string]any{"prompt": "a cat", "negative_prompt": "blurry, low quality"},
+		},
+		{
+			name:      "empty",
+			args:      map[string]any{"prompt": "a cat", "negative_prompt": ""},
+			wantInput: map[string]any{"prompt": "a cat"},
+		},
+		{
+			name:      "omitted",
+			args:      map[string]any{"prompt": "a cat"},
+			wantInput: map[string]any{"prompt": "a cat"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ = io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, `{"output":{"task_id":"task-1","task_status":"PENDING"},"request_id":"req-1"}`)
+			}))
+			defer upstream.Close()
+
+			client, err := wan.NewClient(wan.Config{BaseURL: upstream.URL, APIKey: "test-key", GenModel: "wan2.2-t2i-flash"})
+			if err != nil {
+				t.Fatalf("NewClient: %v", err)
+			}
+			s := server.NewMCPServer("test", "0.0.0")
+			if err := RegisterWanTools(s, client, Options{}); err != nil {
+				t.Fatalf("RegisterWanTools: %v", err)
+			}
+			tool := s.GetTool("wan_create_generate_image_task")
+			if tool == nil {
+				t.Fatal("wan_create_generate_image_task is not registered")
+			}
+
+			var req mcp.CallToolRequest
+			req.Params.Name = "wan_create_generate_image_task"
+			req.Params.Arguments = tt.args
+			result, err := tool.Handler(context.Background(), req)
+			if err != nil || result == nil || result.IsError {
+				t.Fatalf("handler returned %+v, %v", result, err)
+			}
+
+			var payload struct {
+				Input map[string]any `json:"input"`
+			}
+			if err := json.Unmarshal(body, &payload); err != nil {
+				t.Fatalf("upstream request body %q is not JSON: %v", body, err)
+			}
+			if len(payload.Input) != len(tt.wantInput) {
+				t.Fatalf("input = %v, want %v", payload.Input, tt.wantInput)
+			}
+			for k, v := range tt.wantInput {
+				if payload.Input[k] != v {
+					t.Errorf("input[%q] = %v, want %v", k, payload.Input[k], v)
+				}
+			}
+		})
+	}
+}
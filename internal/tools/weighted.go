@@ -0,0 +1,103 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxWeightedPrompts 加权提示词列表允许的最大条目数
+const maxWeightedPrompts = 20
+
+// weightedPrompt 加权提示词列表中的一项；weight 省略时为 1
+type weightedPrompt struct {
+	Text   string   `json:"text"`
+	Weight *float64 `json:"weight,omitempty"`
+}
+
+// withWeightedPrompts 生成工具的加权提示词参数（prompts），与 prompt 二选一
+func withWeightedPrompts() mcp.ToolOption {
+	return mcp.WithString("prompts",
+		mcp.Description(`Optional. Weighted prompt list used instead of prompt, as a JSON array: [{"text": "a red fox", "weight": 1.5}, {"text": "watercolor", "weight": 0.5}]. Weights must be positive (default 1). The current providers do not accept weights natively, so the list is folded into one prompt, highest weight first, with each weight other than 1 written inline as (text:weight).`),
+	)
+}
+
+// getGeneratePrompt 读取生成工具的提示词：提供 prompts 时按加权列表合并为单个提示词，否则使用 prompt。
+// 两者都缺失、同时提供或 prompts 不合法时返回参数错误结果。
+func getGeneratePrompt(req mcp.CallToolRequest) (string, *mcp.CallToolResult) {
+	prompt := req.GetString("prompt", "")
+	raw := strings.TrimSpace(req.GetString("prompts", ""))
+	if raw == "" {
+		if strings.TrimSpace(prompt) == "" {
+			return "", newInvalidArgumentResult("prompt parameter is required (or pass a weighted prompts list)")
+		}
+		return prompt, nil
+	}
+	if strings.TrimSpace(prompt) != "" {
+		return "", newInvalidArgumentResult("pass either prompt or prompts, not both")
+	}
+
+	items, err := parseWeightedPrompts(raw)
+	if err != nil {
+		return "", newInvalidArgumentResult(fmt.Sprintf("prompts: %v", err))
+	}
+	return collapseWeightedPrompts(items), nil
+}
+
+// parseWeightedPrompts 解析并校验加权提示词列表：每项 text 非空，weight 为有限正数
+func parseWeightedPrompts(raw string) ([]weightedPrompt, error) {
+	var items []weightedPrompt
+	if err := json.Unmarshal([]byte(raw), &items); err != nil {
+		return nil, fmt.Errorf(`must be a JSON array of {"text": ..., "weight": ...} objects: %w`, err)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("must contain at least one entry")
+	}
+	if len(items) > maxWeightedPrompts {
+		return nil, fmt.Errorf("too many entries: %d (max %d)", len(items), maxWeightedPrompts)
+	}
+
+	for i := range items {
+		items[i].Text = strings.TrimSpace(items[i].Text)
+		if items[i].Text == "" {
+			return nil, fmt.Errorf("entry %d: text must not be empty", i)
+		}
+		if w := items[i].Weight; w != nil && (math.IsNaN(*w) || math.IsInf(*w, 0) || *w <= 0) {
+			return nil, fmt.Errorf("entry %d: weight must be a positive number, got %v", i, *w)
+		}
+	}
+	return items, nil
+}
+
+// weight 返回条目的权重，省略时为 1
+func (p weightedPrompt) weight() float64 {
+	if p.Weight == nil {
+		return 1
+	}
+	return *p.Weight
+}
+
+// collapseWeightedPrompts 将加权提示词合并为纯文本提示词：按权重从高到低（同权重保持原顺序）以逗号连接，
+// 权重不为 1 的条目写成 (text:weight)，供不支持加权提示词的 provider 使用
+func collapseWeightedPrompts(items []weightedPrompt) string {
+	sorted := make([]weightedPrompt, len(items))
+	copy(sorted, items)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].weight() > sorted[j].weight()
+	})
+
+	texts := make([]string, len(sorted))
+	for i, item := range sorted {
+		if w := item.weight(); w != 1 {
+			texts[i] = fmt.Sprintf("(%s:%s)", item.Text, strconv.FormatFloat(w, 'g', -1, 64))
+		} else {
+			texts[i] = item.Text
+		}
+	}
+	return strings.Join(texts, ", ")
+}
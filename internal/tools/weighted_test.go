@@ -0,0 +1,34 @@
+package tools
+
+import "testing"
+
+// TestCollapseWeightedPrompts 验证加权提示词按权重排序，且权重不为 1 的条目以 (text:weight) 写入提示词
+func TestCollapseWeightedPrompts(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{
+			name: "mixed weights",
+			raw:  `[{"text": "soft light", "weight": 0.5}, {"text": "a red fox", "weight": 2}, {"text": "watercolor"}]`,
+			want: "(a red fox:2), watercolor, (soft light:0.5)",
+		},
+		{
+			name: "default weights keep order",
+			raw:  `[{"text": "a cat"}, {"text": "oil painting", "weight": 1}]`,
+			want: "a cat, oil painting",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := parseWeightedPrompts(tt.raw)
+			if err != nil {
+				t.Fatalf("parseWeightedPrompts: %v", err)
+			}
+			if got := collapseWeightedPrompts(items); got != tt.want {
+				t.Errorf("collapseWeightedPrompts = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // 注册 GIF 解码器
+	"image/jpeg"
+	"image/png"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 默认 JPEG 编码质量
+const defaultJPEGQuality = 90
+
+var (
+	flattenBackgroundMu sync.RWMutex
+	// flattenBackground 透明图片转为 JPEG 时默认合成的背景色（GENAI_FLATTEN_BG_COLOR），默认白色
+	flattenBackground color.Color = color.White
+)
+
+// SetFlattenBackground 设置默认的透明合成背景色（#RRGGBB / #RGB），为空时恢复为白色
+func SetFlattenBackground(hex string) error {
+	c := color.Color(color.White)
+	if strings.TrimSpace(hex) != "" {
+		parsed, err := ParseHexColor(hex)
+		if err != nil {
+			return err
+		}
+		c = parsed
+	}
+
+	flattenBackgroundMu.Lock()
+	defer flattenBackgroundMu.Unlock()
+	flattenBackground = c
+	return nil
+}
+
+// FlattenBackground 返回默认的透明合成背景色，用于未显式指定背景时的格式转换
+func FlattenBackground() color.Color {
+	flattenBackgroundMu.RLock()
+	defer flattenBackgroundMu.RUnlock()
+	return flattenBackground
+}
+
+// ConvertOptions 图片格式转换选项
+type ConvertOptions struct {
+	// Background 转为不支持透明度的格式（JPEG）时用于合成透明像素的背景色；
+	// 为 nil 时若源图含有透明像素则拒绝转换
+	Background color.Color
+	// Quality JPEG 编码质量（1-100），0 表示使用默认值
+	Quality int
+}
+
+// ConvertImage 将图片数据重新编码为目标格式（png / jpeg），返回新数据与 MIME 类型。
+//
+// 支持的输入格式：PNG、JPEG、GIF（取第一帧）。
+// 目标格式为 JPEG 且源图含透明像素时，按 opts.Background 合成背景；未设置背景则返回错误。
+// 标准库不包含 WebP 编解码器，目标格式为 webp 时返回错误。
+func ConvertImage(data []byte, targetFormat string, opts ConvertOptions) ([]byte, string, error) {
+	target := strings.ToLower(strings.TrimSpace(targetFormat))
+	switch target {
+	case "jpg":
+		target = "jpeg"
+	case "png", "jpeg":
+	case "webp":
+		return nil, "", fmt.Errorf("webp encoding is not supported by this server; use png or jpeg")
+	default:
+		return nil, "", fmt.Errorf("unsupported target format %q: expected png or jpeg", targetFormat)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image (supported inputs: png, jpeg, gif): %w", err)
+	}
+
+	var buf bytes.Buffer
+	switch target {
+	case "png":
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", fmt.Errorf("failed to encode png: %w", err)
+		}
+		return buf.Bytes(), "image/png", nil
+	default:
+		if hasTransparency(img) {
+			if opts.Background == nil {
+				return nil, "", fmt.Errorf("image has transparent pixels and JPEG does not support alpha; specify a background color or convert to png")
+			}
+			img = flattenOnBackground(img, opts.Background)
+		}
+
+		quality := opts.Quality
+		if quality <= 0 || quality > 100 {
+			quality = defaultJPEGQuality
+		}
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, "", fmt.Errorf("failed to encode jpeg: %w", err)
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	}
+}
+
+// CompressImage 为节省存储重新编码图片，保持原格式：JPEG 按 quality（1-100）有损重编码，
+// PNG 以最高压缩级别无损重编码。其它格式或重编码后没有变小时返回原数据与 false。
+func CompressImage(data []byte, mimeType string, quality int) ([]byte, bool, error) {
+	if quality <= 0 || quality > 100 {
+		return data, false, nil
+	}
+
+	var buf bytes.Buffer
+	switch strings.ToLower(mimeType) {
+	case "image/jpeg":
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return data, false, fmt.Errorf("failed to decode jpeg: %w", err)
+		}
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return data, false, fmt.Errorf("failed to encode jpeg: %w", err)
+		}
+	case "image/png":
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return data, false, fmt.Errorf("failed to decode png: %w", err)
+		}
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := encoder.Encode(&buf, img); err != nil {
+			return data, false, fmt.Errorf("failed to encode png: %w", err)
+		}
+	default:
+		return data, false, nil
+	}
+
+	if buf.Len() >= len(data) {
+		return data, false, nil
+	}
+	return buf.Bytes(), true, nil
+}
+
+// thumbnailJPEGQuality 缩略图的 JPEG 编码质量
+const thumbnailJPEGQuality = 80
+
+// Thumbnail 生成长边不超过 maxEdge 像素的缩略图（保持宽高比，按区域平均缩小，不放大），返回数据与 MIME 类型。
+// 含透明像素时输出 PNG，否则输出 JPEG。支持的输入格式同 ConvertImage。
+func Thumbnail(data []byte, maxEdge int) ([]byte, string, error) {
+	if maxEdge <= 0 {
+		return nil, "", fmt.Errorf("thumbnail size must be positive, got %d", maxEdge)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image (supported inputs: png, jpeg, gif): %w", err)
+	}
+	thumb := downscale(img, maxEdge)
+
+	var buf bytes.Buffer
+	if hasTransparency(thumb) {
+		if err := png.Encode(&buf, thumb); err != nil {
+			return nil, "", fmt.Errorf("failed to encode png thumbnail: %w", err)
+		}
+		return buf.Bytes(), "image/png", nil
+	}
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: thumbnailJPEGQuality}); err != nil {
+		return nil, "", fmt.Errorf("failed to encode jpeg thumbnail: %w", err)
+	}
+	return buf.Bytes(), "image/jpeg", nil
+}
+
+// downscale 将图片缩小到长边不超过 maxEdge：每个目标像素取其覆盖的源像素区域的平均值（预乘 alpha 下求平均）。
+// 图片已不超过 maxEdge 时原样返回。
+func downscale(img image.Image, maxEdge int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= maxEdge && h <= maxEdge {
+		return img
+	}
+
+	tw, th := maxEdge, maxEdge
+	if w >= h {
+		th = max(1, h*maxEdge/w)
+	} else {
+		tw = max(1, w*maxEdge/h)
+	}
+
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+
+	for y := 0; y < th; y++ {
+		y0 := y * h / th
+		y1 := max((y+1)*h/th, y0+1)
+		for x := 0; x < tw; x++ {
+			x0 := x * w / tw
+			x1 := max((x+1)*w/tw, x0+1)
+
+			var sum [4]uint64
+			for sy := y0; sy < y1; sy++ {
+				off := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += uint64(src.Pix[off+c])
+					}
+					off += 4
+				}
+			}
+
+			n := uint64((y1 - y0) * (x1 - x0))
+			i := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// ParseOutputMIME 解析请求的输出图片格式，支持 png / jpeg / jpg 及对应的 MIME 类型（不区分大小写），
+// 返回规范化后的 MIME 类型（image/png 或 image/jpeg）。
+func ParseOutputMIME(s string) (string, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	switch strings.TrimPrefix(v, "image/") {
+	case "png":
+		return "image/png", nil
+	case "jpeg", "jpg":
+		return "image/jpeg", nil
+	case "webp":
+		return "", fmt.Errorf("webp output is not supported by this server; use image/png or image/jpeg")
+	default:
+		return "", fmt.Errorf("unsupported output_mime %q: expected image/png or image/jpeg", s)
+	}
+}
+
+// hasTransparency 判断图片是否含有非完全不透明的像素
+func hasTransparency(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return !o.Opaque()
+	}
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// flattenOnBackground 将图片合成到纯色背景上，去除透明度
+func flattenOnBackground(img image.Image, background color.Color) image.Image {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, &image.Uniform{C: background}, image.Point{}, draw.Src)
+	draw.Draw(dst, bounds, img, bounds.Min, draw.Over)
+	return dst
+}
+
+// ParseHexColor 解析 #RRGGBB / #RGB 形式的颜色（# 可省略）
+func ParseHexColor(s string) (color.Color, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return nil, fmt.Errorf("invalid color %q: expected #RRGGBB or #RGB", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid color %q: expected #RRGGBB or #RGB", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// DecodeDataURI 解析 data:<mime>;base64,<data> 形式的 data URI，返回图片数据与 MIME 类型
+func DecodeDataURI(dataURI string) ([]byte, string, error) {
+	header, payload, ok := strings.Cut(dataURI, ",")
+	if !ok || !strings.HasPrefix(header, "data:") || !strings.HasSuffix(header, ";base64") {
+		return nil, "", fmt.Errorf("invalid data URI format")
+	}
+	mimeType := strings.TrimSuffix(strings.TrimPrefix(header, "data:"), ";base64")
+
+	data, err := DecodeBase64(payload)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode base64 data: %w", err)
+	}
+	return data, mimeType, nil
+}
+
+// base64Encodings DecodeBase64 依次尝试的编码：标准、URL 安全、以及两者的无填充形式
+var base64Encodings = []*base64.Encoding{
+	base64.StdEncoding,
+	base64.URLEncoding,
+	base64.RawStdEncoding,
+	base64.RawURLEncoding,
+}
+
+// DecodeBase64 宽松地解码 base64：依次尝试标准编码、URL 安全编码与无填充（raw）编码，
+// 兼容部分客户端在 data URI 中使用的非标准但有效的 base64。全部失败时返回标准编码的错误。
+func DecodeBase64(s string) ([]byte, error) {
+	var firstErr error
+	for _, enc := range base64Encodings {
+		data, err := enc.DecodeString(s)
+		if err == nil {
+			return data, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
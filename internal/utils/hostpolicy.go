@@ -0,0 +1,284 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"genai-mcp/common"
+)
+
+// ImageHostPolicy 输入图片 URL 的主机访问策略，用于防止通过图片 URL 发起 SSRF。
+//
+// 主机匹配规则：列表项 "example.com" 同时匹配 example.com 及其所有子域名（如 cdn.example.com）。
+type ImageHostPolicy struct {
+	// Allowlist 非空时，仅允许列表中的主机
+	Allowlist []string
+	// Denylist 始终拒绝列表中的主机，优先级高于 Allowlist
+	Denylist []string
+	// AllowPrivate 为 true 时允许访问回环 / 内网 / 链路本地地址，仅用于受信任的内网部署
+	AllowPrivate bool
+	// RequireHTTPS 为 true 时拒绝 http:// URL（包括重定向到 http 的下载），只允许 https
+	RequireHTTPS bool
+}
+
+var (
+	imageHostPolicyMu sync.RWMutex
+	imageHostPolicy   ImageHostPolicy
+)
+
+// SetImageHostPolicy 设置全局的输入图片主机访问策略（通常在启动时根据配置调用一次）。
+func SetImageHostPolicy(policy ImageHostPolicy) {
+	imageHostPolicyMu.Lock()
+	defer imageHostPolicyMu.Unlock()
+
+	imageHostPolicy = ImageHostPolicy{
+		Allowlist:    normalizeHosts(policy.Allowlist),
+		Denylist:     normalizeHosts(policy.Denylist),
+		AllowPrivate: policy.AllowPrivate,
+		RequireHTTPS: policy.RequireHTTPS,
+	}
+}
+
+// GetImageHostPolicy 返回当前生效的输入图片主机访问策略。
+func GetImageHostPolicy() ImageHostPolicy {
+	imageHostPolicyMu.RLock()
+	defer imageHostPolicyMu.RUnlock()
+	return imageHostPolicy
+}
+
+// trustedImageURLsKey context 中受信任图片 URL 集合的 key
+type trustedImageURLsKey struct{}
+
+// WithTrustedImageURLs 将本服务自己上传到 OSS 的图片 URL（如 data URI 输入上传后的 URL）标记为受信任的内部输入：
+// ValidateImageURL 不再按用户输入的主机策略校验这些 URL，下载时也不做内网地址拦截
+func WithTrustedImageURLs(ctx context.Context, urls ...string) context.Context {
+	if len(urls) == 0 {
+		return ctx
+	}
+	existing, _ := ctx.Value(trustedImageURLsKey{}).(map[string]bool)
+	trusted := make(map[string]bool, len(existing)+len(urls))
+	for u := range existing {
+		trusted[u] = true
+	}
+	for _, u := range urls {
+		trusted[u] = true
+	}
+	return context.WithValue(ctx, trustedImageURLsKey{}, trusted)
+}
+
+// isTrustedImageURL 判断 URL 是否由 WithTrustedImageURLs 标记为受信任
+func isTrustedImageURL(ctx context.Context, rawURL string) bool {
+	trusted, _ := ctx.Value(trustedImageURLsKey{}).(map[string]bool)
+	return trusted[rawURL]
+}
+
+// ValidateImageURL 校验用户提供的图片 URL 是否允许访问。
+// 应在服务端下载图片或将 URL 交给模型拉取之前调用。
+// 除主机名本身外，还会解析 DNS，拒绝解析到回环 / 内网 / 链路本地地址的主机。
+// 由 WithTrustedImageURLs 标记的内部 URL 与本服务自己提供的图片（见 SetLocalImageReader）直接放行。
+func ValidateImageURL(ctx context.Context, rawURL string) error {
+	if isTrustedImageURL(ctx, rawURL) {
+		return nil
+	}
+	if _, _, ok := readLocalImage(rawURL); ok {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid image URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported image URL scheme %q: only http and https are allowed", u.Scheme)
+	}
+	if err := checkHTTPS(u); err != nil {
+		return err
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "" {
+		return fmt.Errorf("invalid image URL: missing host")
+	}
+
+	policy := GetImageHostPolicy()
+	if matchHost(host, policy.Denylist) {
+		return fmt.Errorf("image host %q is denied by GENAI_IMAGE_HOST_DENYLIST", host)
+	}
+	if len(policy.Allowlist) > 0 && !matchHost(host, policy.Allowlist) {
+		return fmt.Errorf("image host %q is not in GENAI_IMAGE_HOST_ALLOWLIST", host)
+	}
+	if !policy.AllowPrivate {
+		if isPrivateHost(host) {
+			return fmt.Errorf("image host %q is a private or loopback address", host)
+		}
+		if _, err := resolvePublicIPs(ctx, host); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ErrPlainHTTPImage GENAI_REQUIRE_HTTPS_IMAGES 开启时 http:// 图片 URL 的拒绝原因
+const ErrPlainHTTPImage = "plain http image URLs are not allowed (GENAI_REQUIRE_HTTPS_IMAGES); use https"
+
+// checkHTTPS 策略要求 https 时拒绝 http:// URL
+func checkHTTPS(u *url.URL) error {
+	if strings.EqualFold(u.Scheme, "http") && GetImageHostPolicy().RequireHTTPS {
+		return fmt.Errorf("%s: %s", ErrPlainHTTPImage, u.Redacted())
+	}
+	return nil
+}
+
+// checkRedirect 下载时的重定向校验：每一跳的目标都按 ValidateImageURL 校验（https 要求、主机黑白名单与内网地址），
+// 避免允许的主机上的开放重定向把请求带到策略之外的主机；保留默认的 10 次上限
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	if err := ValidateImageURL(req.Context(), req.URL.String()); err != nil {
+		return fmt.Errorf("redirect rejected: %w", err)
+	}
+	return nil
+}
+
+// resolvePublicIPs 解析主机名，若任一地址为回环 / 内网 / 链路本地地址则返回错误
+func resolvePublicIPs(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve image host %q: %w", host, err)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("image host %q did not resolve to any address", host)
+	}
+	for _, ip := range ips {
+		if isPrivateIP(ip.IP) {
+			return nil, fmt.Errorf("image host %q resolves to private or loopback address %s", host, ip.IP)
+		}
+	}
+	return ips, nil
+}
+
+// safeDialContext 在建立连接前解析 DNS 并校验地址，随后直接连接已校验的 IP，
+// 避免解析与连接之间被 DNS rebinding 替换为内网地址。
+func safeDialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	// 连接代理本身（GENAI_HTTP_PROXY）时放行，目标主机已在 safeProxy 中校验
+	if GetImageHostPolicy().AllowPrivate || (addr != "" && addr == common.HTTPProxyAddr()) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IPAddr
+	if ip := net.ParseIP(host); ip != nil {
+		if isPrivateIP(ip) {
+			return nil, fmt.Errorf("refusing to connect to private or loopback address %s", ip)
+		}
+		ips = []net.IPAddr{{IP: ip}}
+	} else {
+		ips, err = resolvePublicIPs(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.IP.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// safeTransport 用于下载图片的 HTTP Transport，连接前会执行 SSRF 校验
+var safeTransport = newSafeTransport()
+
+// trustedTransport 用于下载受信任的内部图片 URL（本服务上传到 OSS 的对象），只按 GENAI_HTTP_PROXY 选择代理
+var trustedTransport = common.NewHTTPTransport()
+
+func newSafeTransport() *http.Transport {
+	transport := common.NewHTTPTransport()
+	transport.DialContext = safeDialContext
+	transport.Proxy = safeProxy
+	return transport
+}
+
+// safeProxy 按 GENAI_HTTP_PROXY 为图片下载选择代理。经代理访问时由代理解析并连接目标主机，
+// 连接阶段只能看到代理地址，因此在这里先按策略解析并校验目标主机（无法防御其后的 DNS rebinding）。
+func safeProxy(req *http.Request) (*url.URL, error) {
+	proxy, err := common.HTTPProxy(req)
+	if err != nil || proxy == nil {
+		return proxy, err
+	}
+	if !GetImageHostPolicy().AllowPrivate {
+		host := req.URL.Hostname()
+		if isPrivateHost(host) {
+			return nil, fmt.Errorf("refusing to fetch private or loopback host %q", host)
+		}
+		if _, err := resolvePublicIPs(req.Context(), host); err != nil {
+			return nil, err
+		}
+	}
+	return proxy, nil
+}
+
+// matchHost 判断 host 是否命中列表中的某一项（精确匹配或子域名匹配）
+func matchHost(host string, list []string) bool {
+	for _, item := range list {
+		if host == item || strings.HasSuffix(host, "."+item) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrivateHost 判断主机名本身是否指向本机或内网（仅检查字面量 IP 与 localhost）
+func isPrivateHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return isPrivateIP(ip)
+	}
+	return false
+}
+
+// isPrivateIP 判断 IP 是否为回环、内网、链路本地或未指定地址
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsUnspecified()
+}
+
+// normalizeHosts 统一转为小写并去除空白、通配前缀和空项
+func normalizeHosts(hosts []string) []string {
+	result := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		h = strings.ToLower(strings.TrimSpace(h))
+		h = strings.TrimPrefix(h, "*.")
+		h = strings.TrimPrefix(h, ".")
+		if h != "" {
+			result = append(result, h)
+		}
+	}
+	return result
+}
@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// setTestHostPolicy 在测试期间设置全局主机策略，结束时恢复
+func setTestHostPolicy(t *testing.T, policy ImageHostPolicy) {
+	t.Helper()
+	previous := GetImageHostPolicy()
+	SetImageHostPolicy(policy)
+	t.Cleanup(func() { SetImageHostPolicy(previous) })
+}
+
+// TestDownloadImageRedirectToDeniedHost 验证允许的主机重定向到黑名单 / 白名单外的主机时下载被拒绝
+func TestDownloadImageRedirectToDeniedHost(t *testing.T) {
+	tests := []struct {
+		name     string
+		location string
+		wantErr  string
+	}{
+		{name: "denied host", location: "http://evil.example/cat.png", wantErr: "GENAI_IMAGE_HOST_DENYLIST"},
+		{name: "host not in allowlist", location: "http://other.example/cat.png", wantErr: "GENAI_IMAGE_HOST_ALLOWLIST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.RedirectHandler(tt.location, http.StatusFound))
+			defer srv.Close()
+			// 测试服务器在回环地址上，因此允许内网地址，只验证黑白名单
+			setTestHostPolicy(t, ImageHostPolicy{
+				Allowlist:    []string{"127.0.0.1", "evil.example"},
+				Denylist:     []string{"evil.example"},
+				AllowPrivate: true,
+			})
+
+			_, _, err := DownloadImageFromURL(context.Background(), srv.URL+"/cat.png")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("DownloadImageFromURL error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestValidateImageURL 验证输入图片 URL 的协议、https 要求、主机黑白名单、内网地址与受信任 URL 放行
+func TestValidateImageURL(t *testing.T) {
+	trusted := "http://127.0.0.1:8080/image/abc.png"
+	tests := []struct {
+		name    string
+		policy  ImageHostPolicy
+		url     string
+		trusted bool
+		wantErr string // 为空表示期望通过
+	}{
+		{name: "public IP", url: "https://93.184.216.34/cat.png"},
+		{name: "unsupported scheme", url: "ftp://93.184.216.34/cat.png", wantErr: "unsupported image URL scheme"},
+		{name: "missing host", url: "http:///cat.png", wantErr: "missing host"},
+		{name: "plain http when https required", policy: ImageHostPolicy{RequireHTTPS: true}, url: "http://93.184.216.34/cat.png", wantErr: ErrPlainHTTPImage},
+		{name: "loopback IP", url: "http://127.0.0.1/cat.png", wantErr: "private or loopback"},
+		{name: "IPv6 loopback", url: "http://[::1]/cat.png", wantErr: "private or loopback"},
+		{name: "localhost", url: "http://localhost:8080/cat.png", wantErr: "private or loopback"},
+		{name: "private network", url: "http://10.0.0.5/cat.png", wantErr: "private or loopback"},
+		{name: "link-local metadata address", url: "http://169.254.169.254/latest/meta-data", wantErr: "private or loopback"},
+		{name: "private allowed", policy: ImageHostPolicy{AllowPrivate: true}, url: "http://10.0.0.5/cat.png"},
+		{name: "denylist subdomain", policy: ImageHostPolicy{Denylist: []string{"example.com"}}, url: "https://cdn.example.com/cat.png", wantErr: "GENAI_IMAGE_HOST_DENYLIST"},
+		{name: "denylist wins over allowlist", policy: ImageHostPolicy{Allowlist: []string{"example.com"}, Denylist: []string{"cdn.example.com"}}, url: "https://cdn.example.com/cat.png", wantErr: "GENAI_IMAGE_HOST_DENYLIST"},
+		{name: "not in allowlist", policy: ImageHostPolicy{Allowlist: []string{"example.com"}}, url: "https://example.org/cat.png", wantErr: "GENAI_IMAGE_HOST_ALLOWLIST"},
+		{name: "allowlist wildcard and case", policy: ImageHostPolicy{Allowlist: []string{"*.Example.COM"}, AllowPrivate: true}, url: "https://CDN.example.com./cat.png"},
+		{name: "trusted URL bypasses policy", policy: ImageHostPolicy{Allowlist: []string{"example.com"}, RequireHTTPS: true}, url: trusted, trusted: true},
+		{name: "untrusted URL on same host", url: "http://127.0.0.1:8080/image/other.png", trusted: true, wantErr: "private or loopback"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestHostPolicy(t, tt.policy)
+			ctx := context.Background()
+			if tt.trusted {
+				ctx = WithTrustedImageURLs(ctx, trusted)
+			}
+
+			err := ValidateImageURL(ctx, tt.url)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateImageURL(%q) = %v, want nil", tt.url, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidateImageURL(%q) = %v, want containing %q", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestMatchHost 验证列表项匹配自身及其子域名，但不匹配仅后缀相同的其它域名
+func TestMatchHost(t *testing.T) {
+	list := []string{"example.com", "cdn.example.org"}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"example.com", true},
+		{"img.example.com", true},
+		{"a.b.example.com", true},
+		{"badexample.com", false},
+		{"example.com.evil.net", false},
+		{"cdn.example.org", true},
+		{"example.org", false},
+	}
+	for _, tt := range tests {
+		if got := matchHost(tt.host, list); got != tt.want {
+			t.Errorf("matchHost(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+	if matchHost("example.com", nil) {
+		t.Error("matchHost with an empty list = true, want false")
+	}
+}
+
+// TestCheckRedirect 验证重定向目标按主机策略与 https 要求校验，并限制重定向次数
+func TestCheckRedirect(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  ImageHostPolicy
+		target  string
+		hops    int
+		wantErr string
+	}{
+		{name: "allowed target", policy: ImageHostPolicy{Allowlist: []string{"example.com"}, AllowPrivate: true}, target: "https://cdn.example.com/cat.png"},
+		{name: "denied target", policy: ImageHostPolicy{Denylist: []string{"evil.example"}}, target: "https://evil.example/cat.png", wantErr: "GENAI_IMAGE_HOST_DENYLIST"},
+		{name: "target not in allowlist", policy: ImageHostPolicy{Allowlist: []string{"example.com"}}, target: "https://other.example/cat.png", wantErr: "GENAI_IMAGE_HOST_ALLOWLIST"},
+		{name: "private target", target: "http://192.168.1.10/cat.png", wantErr: "private or loopback"},
+		{name: "downgrade to http", policy: ImageHostPolicy{RequireHTTPS: true, AllowPrivate: true}, target: "http://cdn.example.com/cat.png", wantErr: ErrPlainHTTPImage},
+		{name: "too many redirects", policy: ImageHostPolicy{AllowPrivate: true}, target: "https://cdn.example.com/cat.png", hops: 10, wantErr: "stopped after 10 redirects"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestHostPolicy(t, tt.policy)
+			req, err := http.NewRequest(http.MethodGet, tt.target, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			via := make([]*http.Request, tt.hops)
+
+			err = checkRedirect(req, via)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkRedirect(%q) = %v, want nil", tt.target, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("checkRedirect(%q) = %v, want containing %q", tt.target, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestSafeDialContext 验证连接前按解析后的地址拒绝回环 / 内网地址（域名解析到内网地址同样拒绝），允许内网时正常连接
+func TestSafeDialContext(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	_, port, _ := strings.Cut(srv.Listener.Addr().String(), ":")
+
+	for _, addr := range []string{"127.0.0.1:" + port, "localhost:" + port} {
+		t.Run("reject "+addr, func(t *testing.T) {
+			setTestHostPolicy(t, ImageHostPolicy{})
+			conn, err := safeDialContext(context.Background(), "tcp", addr)
+			if err == nil {
+				conn.Close()
+				t.Fatalf("safeDialContext(%q) succeeded, want private address error", addr)
+			}
+			if !strings.Contains(err.Error(), "private or loopback") {
+				t.Fatalf("safeDialContext(%q) = %v, want private address error", addr, err)
+			}
+		})
+	}
+
+	t.Run("allow private", func(t *testing.T) {
+		setTestHostPolicy(t, ImageHostPolicy{AllowPrivate: true})
+		conn, err := safeDialContext(context.Background(), "tcp", "127.0.0.1:"+port)
+		if err != nil {
+			t.Fatalf("safeDialContext with AllowPrivate = %v, want nil", err)
+		}
+		conn.Close()
+	})
+}
@@ -4,18 +4,103 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+
+	"genai-mcp/common"
 )
 
-// DownloadImageFromURL 从 URL 下载图片，返回图片数据和 MIME 类型
+// ErrImageGone 图片 URL 返回 403 / 404 / 410：签名链接已过期或图片已被删除
+var ErrImageGone = errors.New("image URL has expired or the image no longer exists")
+
+// DefaultMaxImageBytes 下载图片的默认大小上限（20MB）
+const DefaultMaxImageBytes = 20 << 20
+
+// ErrImageTooLarge 下载的图片超过大小上限（GENAI_MAX_IMAGE_BYTES）
+var ErrImageTooLarge = errors.New("image exceeds max size")
+
+// maxImageBytes 下载图片的大小上限，防止异常或恶意 URL 返回超大响应耗尽内存
+var maxImageBytes atomic.Int64
+
+func init() {
+	maxImageBytes.Store(DefaultMaxImageBytes)
+}
+
+// SetMaxImageBytes 设置下载图片的大小上限（通常在启动时根据配置调用一次），<= 0 时使用默认值
+func SetMaxImageBytes(n int64) {
+	if n <= 0 {
+		n = DefaultMaxImageBytes
+	}
+	maxImageBytes.Store(n)
+}
+
+// LocalImageReader 按 URL 读取本服务自己提供的图片（如内存存储的 /image/{id}），返回图片数据与 MIME 类型；
+// 不是本服务的 URL 或图片不存在时返回 false
+type LocalImageReader func(rawURL string) ([]byte, string, bool)
+
+// localImageReader 当前注册的 LocalImageReader，未注册时为 nil
+var localImageReader atomic.Pointer[LocalImageReader]
+
+// SetLocalImageReader 注册本服务图片的读取函数（由内存存储在创建时注册），nil 表示取消注册。
+// 注册后 DownloadImageFromURL 直接读取这些图片而不经网络下载，ValidateImageURL 也将其视为受信任的内部 URL：
+// 默认的 OSS_MEMORY_BASE_URL 为 localhost，经网络下载会被内网地址拦截
+func SetLocalImageReader(reader LocalImageReader) {
+	if reader == nil {
+		localImageReader.Store(nil)
+		return
+	}
+	localImageReader.Store(&reader)
+}
+
+// readLocalImage 通过注册的 LocalImageReader 读取本服务提供的图片
+func readLocalImage(rawURL string) ([]byte, string, bool) {
+	reader := localImageReader.Load()
+	if reader == nil {
+		return nil, "", false
+	}
+	return (*reader)(rawURL)
+}
+
+// imageTooLargeError 图片超过大小上限时返回的错误（invalid_argument，不可重试）
+func imageTooLargeError(size string, limit int64) error {
+	err := common.NewError(common.ErrCodeInvalidArgument, false,
+		"image is %s bytes, limit is %d (GENAI_MAX_IMAGE_BYTES)", size, limit)
+	err.Err = ErrImageTooLarge
+	return err
+}
+
+// DownloadImageFromURL 从 URL 下载图片，返回图片数据和 MIME 类型。
+// 图片超过 GENAI_MAX_IMAGE_BYTES 时返回 ErrImageTooLarge：Content-Length 过大时直接拒绝，
+// 否则最多读取上限 + 1 字节，避免无 Content-Length 的超大响应耗尽内存。
 func DownloadImageFromURL(ctx context.Context, url string) ([]byte, string, error) {
-	// 创建 HTTP 客户端
+	defer common.StartTiming(ctx, common.StageDownload)()
+
+	// 本服务自己提供的图片（内存存储）直接读取
+	if data, mimeType, ok := readLocalImage(url); ok {
+		return data, mimeType, nil
+	}
+
+	// 创建 HTTP 客户端（连接前会校验目标地址，拒绝回环 / 内网地址）；本服务上传的受信任 URL 不做这些校验
 	client := &http.Client{
-		Timeout: 30 * time.Second,
+		Timeout:       30 * time.Second,
+		Transport:     safeTransport,
+		CheckRedirect: checkRedirect,
+	}
+	if isTrustedImageURL(ctx, url) {
+		client.Transport = trustedTransport
+		client.CheckRedirect = nil
+	} else if u, err := neturl.Parse(url); err == nil {
+		// 要求 https 时拒绝 http:// URL（重定向由 checkRedirect 校验）
+		if err := checkHTTPS(u); err != nil {
+			return nil, "", err
+		}
 	}
 
 	// 创建请求
@@ -31,26 +116,158 @@ func DownloadImageFromURL(ctx context.Context, url string) ([]byte, string, erro
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+		return nil, "", fmt.Errorf("failed to download image: status code %d: %w", resp.StatusCode, ErrImageGone)
+	default:
 		return nil, "", fmt.Errorf("failed to download image: status code %d", resp.StatusCode)
 	}
 
-	// 读取图片数据
-	imageData, err := io.ReadAll(resp.Body)
+	limit := maxImageBytes.Load()
+	if resp.ContentLength > limit {
+		return nil, "", imageTooLargeError(strconv.FormatInt(resp.ContentLength, 10), limit)
+	}
+
+	// 读取图片数据（多读 1 字节以判断是否超过上限）
+	imageData, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
 	if err != nil {
 		return nil, "", err
 	}
+	if int64(len(imageData)) > limit {
+		return nil, "", imageTooLargeError("more than "+strconv.FormatInt(limit, 10), limit)
+	}
 
-	// 获取 Content-Type
-	mimeType := resp.Header.Get("Content-Type")
-	if mimeType == "" {
-		// 根据文件扩展名推断 MIME 类型
-		mimeType = InferMimeTypeFromURL(url)
+	// 按内容嗅探图片类型，拒绝 HTML 错误页等非图片内容；与 Content-Type 不一致时以嗅探结果为准
+	mimeType, err := sniffImageMIME(imageData)
+	if err != nil {
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"url":          url,
+			"content_type": resp.Header.Get("Content-Type"),
+			"size":         len(imageData),
+		}).Warn("Downloaded content is not an image")
+		return nil, "", err
+	}
+	if header := resp.Header.Get("Content-Type"); header != "" && baseMIME(header) != mimeType {
+		common.WithRequestID(ctx).WithFields(map[string]interface{}{
+			"url":          url,
+			"content_type": header,
+			"sniffed_type": mimeType,
+		}).Debug("Content-Type disagrees with image content, using sniffed type")
 	}
 
 	return imageData, mimeType, nil
 }
 
+// allowedImageMIMETypes 下载内容嗅探后允许的图片类型
+var allowedImageMIMETypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+}
+
+// sniffImageMIME 按内容（前 512 字节，http.DetectContentType）判断图片类型，
+// 不是 jpeg / png / gif / webp / bmp 时返回 invalid_argument 错误（不可重试）
+func sniffImageMIME(data []byte) (string, error) {
+	detected := baseMIME(http.DetectContentType(data))
+	if !allowedImageMIMETypes[detected] {
+		return "", common.NewError(common.ErrCodeInvalidArgument, false, "downloaded content is not an image (detected %s)", detected)
+	}
+	return detected, nil
+}
+
+// baseMIME 去掉 MIME 类型中的参数（如 "; charset=utf-8"）并转为小写
+func baseMIME(mimeType string) string {
+	base, _, _ := strings.Cut(mimeType, ";")
+	return strings.ToLower(strings.TrimSpace(base))
+}
+
+// EncodeDataURI 将图片数据编码为 data URI：data:<mime>;base64,<data>
+//
+// 通过 base64.NewEncoder 直接流式写入预先分配好容量的 strings.Builder，
+// 避免 EncodeToString + fmt.Sprintf 额外产生的完整副本，降低大图输出时的峰值内存。
+func EncodeDataURI(mimeType string, data []byte) string {
+	prefix := "data:" + mimeType + ";base64,"
+
+	var sb strings.Builder
+	sb.Grow(len(prefix) + base64.StdEncoding.EncodedLen(len(data)))
+	sb.WriteString(prefix)
+
+	// strings.Builder 的写入不会失败，这里忽略返回的错误
+	encoder := base64.NewEncoder(base64.StdEncoding, &sb)
+	_, _ = encoder.Write(data)
+	_ = encoder.Close()
+
+	return sb.String()
+}
+
+// ImageFormatBase64Raw 返回不带 data URI 前缀的 base64 的图片输出格式，MIME 类型通过结构化输出单独返回
+const ImageFormatBase64Raw = "base64-raw"
+
+// IsBase64Format 判断图片输出格式是否以 base64 内联返回图片（base64 或 base64-raw）
+func IsBase64Format(format string) bool {
+	return strings.EqualFold(format, "base64") || strings.EqualFold(format, ImageFormatBase64Raw)
+}
+
+// EncodeImage 按图片输出格式编码图片数据：base64-raw 返回纯 base64 并记录 MIME 类型
+// （见 common.RecordImageMIME），其它格式返回 data URI
+func EncodeImage(ctx context.Context, format, mimeType string, data []byte) string {
+	if strings.EqualFold(format, ImageFormatBase64Raw) {
+		common.RecordImageMIME(ctx, mimeType)
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	return EncodeDataURI(mimeType, data)
+}
+
+// Base64Fallback 判断 base64 / base64-raw 输出的图片是否应改为上传 OSS 并返回 URL：
+// 图片大小超过 maxBytes（GENAI_BASE64_MAX_BYTES，0 表示不限制）且 canUpload（OSS 已配置）时返回 true 并记录日志；
+// 超限但 OSS 未配置时记录 warn 日志，仍以 base64 内联返回
+func Base64Fallback(ctx context.Context, provider string, maxBytes, size int, canUpload bool) bool {
+	if maxBytes <= 0 || size <= maxBytes {
+		return false
+	}
+	fields := map[string]interface{}{
+		"provider":  provider,
+		"size":      size,
+		"max_bytes": maxBytes,
+	}
+	if !canUpload {
+		common.WithRequestID(ctx).WithFields(fields).Warn("Image exceeds GENAI_BASE64_MAX_BYTES but OSS is not configured, returning base64")
+		return false
+	}
+	common.WithRequestID(ctx).WithFields(fields).Info("Image exceeds GENAI_BASE64_MAX_BYTES, uploading to OSS and returning URL instead of base64")
+	return true
+}
+
+// signedURLParams 常见对象存储 / CDN 签名 URL 的查询参数（小写），带有这些参数的 URL 通常会在短时间内过期
+var signedURLParams = []string{
+	"x-amz-signature", "x-amz-expires", // AWS S3 / S3 兼容（SigV4）
+	"signature", "expires", "ossaccesskeyid", // 阿里云 OSS / S3 SigV2
+	"x-oss-signature", "x-oss-expires", // 阿里云 OSS V4
+	"x-goog-signature", "x-goog-expires", // Google Cloud Storage
+	"sig", "se", // Azure Blob SAS
+	"auth_key", // CDN URL 鉴权
+}
+
+// IsSignedURL 判断 URL 是否带有签名 / 过期参数（短期有效），解析失败时视为已签名
+func IsSignedURL(rawURL string) bool {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return true
+	}
+	for key := range u.Query() {
+		key = strings.ToLower(key)
+		for _, param := range signedURLParams {
+			if key == param {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // InferMimeTypeFromURL 从 URL 推断 MIME 类型（不区分大小写）
 func InferMimeTypeFromURL(url string) string {
 	// 简单的 MIME 类型推断
@@ -71,13 +288,6 @@ func InferMimeTypeFromURL(url string) string {
 	return "image/jpeg"
 }
 
-// GenerateImagePath 生成图片路径：images/yyyy-MM-dd/
-func GenerateImagePath() string {
-	now := time.Now()
-	// 格式：yyyy-MM-dd
-	return fmt.Sprintf("images/%s/", now.Format("2006-01-02"))
-}
-
 // GenerateImageFileName 生成图片文件名：{uuid_timestamp_random}
 func GenerateImageFileName(mimeType string) string {
 	// 生成 UUID（base64 去掉填充，缩短长度）
@@ -119,6 +329,48 @@ func GetExtensionFromMimeType(mimeType string) string {
 	}
 }
 
+// ParseResolution 解析分辨率描述，返回图片长边像素数。支持的格式：
+//   - 档位：1K / 2K / 4K（不区分大小写）
+//   - 尺寸：1024*1024、1280x720
+//   - 纯数字：2048
+func ParseResolution(s string) (int, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	if v == "" {
+		return 0, fmt.Errorf("empty resolution")
+	}
+
+	// 档位：nK
+	if strings.HasSuffix(v, "K") {
+		n, err := strconv.Atoi(strings.TrimSuffix(v, "K"))
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid resolution %q", s)
+		}
+		return n * 1024, nil
+	}
+
+	// 尺寸：W*H 或 WxH，取长边
+	for _, sep := range []string{"*", "X"} {
+		if parts := strings.SplitN(v, sep, 2); len(parts) == 2 {
+			w, errW := strconv.Atoi(strings.TrimSpace(parts[0]))
+			h, errH := strconv.Atoi(strings.TrimSpace(parts[1]))
+			if errW != nil || errH != nil || w <= 0 || h <= 0 {
+				return 0, fmt.Errorf("invalid resolution %q", s)
+			}
+			if w > h {
+				return w, nil
+			}
+			return h, nil
+		}
+	}
+
+	// 纯数字
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid resolution %q", s)
+	}
+	return n, nil
+}
+
 // TruncateForLog 截断长字符串用于日志，避免打印过长内容（如 base64）
 func TruncateForLog(s string, max int) string {
 	if len(s) <= max {
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 内置的图片路径分区方案（OSS_PATH_SCHEME）
+const (
+	PathSchemeDaily  = "daily"  // images/yyyy-MM-dd/（默认）
+	PathSchemeHourly = "hourly" // images/yyyy-MM-dd/HH/
+	PathSchemeFlat   = "flat"   // images/
+)
+
+// imagePathRoot 所有图片对象的公共前缀，OSS 清理与 oss_list_objects 默认按该前缀列举
+const imagePathRoot = "images/"
+
+// pathSchemeTemplates 内置方案对应的模板
+var pathSchemeTemplates = map[string]string{
+	PathSchemeDaily:  "%Y-%m-%d",
+	PathSchemeHourly: "%Y-%m-%d/%H",
+	PathSchemeFlat:   "",
+}
+
+// pathDirectives 模板中支持的 strftime 风格占位符，按服务器本地时间展开
+var pathDirectives = map[byte]string{
+	'Y': "2006",
+	'm': "01",
+	'd': "02",
+	'H': "15",
+	'M': "04",
+	'j': "002",
+}
+
+var (
+	imagePathMu sync.RWMutex
+	// imagePathTemplate images/ 之下的分区模板，默认按天分区
+	imagePathTemplate = pathSchemeTemplates[PathSchemeDaily]
+)
+
+// SetImagePathScheme 设置图片对象的路径分区方案：daily / hourly / flat，或 images/ 之下的自定义模板，
+// 如 %Y/%m/%d/%H。模板支持 %Y %m %d %H %M %j 与 %%，为空时使用 daily。
+func SetImagePathScheme(scheme string) error {
+	scheme = strings.TrimSpace(scheme)
+	template, ok := pathSchemeTemplates[strings.ToLower(scheme)]
+	if scheme == "" {
+		template, ok = pathSchemeTemplates[PathSchemeDaily], true
+	}
+	if !ok {
+		if err := validatePathTemplate(scheme); err != nil {
+			return err
+		}
+		template = strings.Trim(scheme, "/")
+	}
+
+	imagePathMu.Lock()
+	defer imagePathMu.Unlock()
+	imagePathTemplate = template
+	return nil
+}
+
+// validatePathTemplate 校验自定义模板：只允许已知占位符，且不得包含空段或 . / .. 段
+func validatePathTemplate(template string) error {
+	if !strings.Contains(template, "%") {
+		return fmt.Errorf("unknown path scheme %q: expected daily, hourly, flat or a template such as %%Y/%%m/%%d", template)
+	}
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' {
+			continue
+		}
+		if i+1 >= len(template) {
+			return fmt.Errorf("path template %q ends with a lone %%", template)
+		}
+		if _, ok := pathDirectives[template[i+1]]; !ok && template[i+1] != '%' {
+			return fmt.Errorf("path template %q has unsupported directive %%%c: expected %%Y, %%m, %%d, %%H, %%M, %%j or %%%%", template, template[i+1])
+		}
+		i++
+	}
+	for _, segment := range strings.Split(strings.Trim(template, "/"), "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("path template %q has an empty, . or .. segment", template)
+		}
+	}
+	return nil
+}
+
+// formatPathTemplate 按时间展开模板中的占位符
+func formatPathTemplate(template string, t time.Time) string {
+	var b strings.Builder
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' || i+1 >= len(template) {
+			b.WriteByte(template[i])
+			continue
+		}
+		i++
+		if layout, ok := pathDirectives[template[i]]; ok {
+			b.WriteString(t.Format(layout))
+		} else {
+			b.WriteByte(template[i])
+		}
+	}
+	return b.String()
+}
+
+// GenerateImagePath 按 OSS_PATH_SCHEME 生成图片路径，默认为 images/yyyy-MM-dd/
+func GenerateImagePath() string {
+	imagePathMu.RLock()
+	template := imagePathTemplate
+	imagePathMu.RUnlock()
+
+	if template == "" {
+		return imagePathRoot
+	}
+	return imagePathRoot + formatPathTemplate(template, time.Now()) + "/"
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// DefaultMaxResultPages 聚合分页结果时最多拉取的页数（含第一页），防止 next_page_token 异常导致死循环
+const DefaultMaxResultPages = 10
+
+// nextPageTokenKey 分页响应中下一页令牌的字段名
+const nextPageTokenKey = "next_page_token"
+
+// AggregatePages 对返回 next_page_token 的分页查询结果，依次拉取后续页面并合并结果数组。
+//
+//   - first:        第一页响应体
+//   - resultsPaths: 结果数组在 JSON 中的路径（可提供多个候选，如 {"output","results"}），存在的路径都会被合并
+//   - maxPages:     最多拉取的页数（含第一页），<=0 时使用 DefaultMaxResultPages
+//   - fetch:        根据 page token 拉取下一页
+//
+// next_page_token 可以位于顶层或任一结果数组所在的对象中。第一页没有 next_page_token 时原样返回 first。
+// 达到页数上限时停止拉取，并在合并结果中保留剩余的 next_page_token，便于调用方发现结果被截断。
+func AggregatePages(ctx context.Context, first []byte, resultsPaths [][]string, maxPages int, fetch func(ctx context.Context, token string) ([]byte, error)) ([]byte, bool, error) {
+	if maxPages <= 0 {
+		maxPages = DefaultMaxResultPages
+	}
+
+	var merged map[string]interface{}
+	if err := json.Unmarshal(first, &merged); err != nil {
+		// 非 JSON 对象，无法分页，原样返回
+		return first, false, nil
+	}
+
+	token := findNextPageToken(merged, resultsPaths)
+	if token == "" {
+		return first, false, nil
+	}
+
+	seen := map[string]bool{}
+	pages := 1
+	for token != "" && pages < maxPages {
+		if seen[token] {
+			return nil, false, fmt.Errorf("pagination loop detected: page token %q repeated", token)
+		}
+		seen[token] = true
+
+		body, err := fetch(ctx, token)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to fetch result page %d: %w", pages+1, err)
+		}
+		pages++
+
+		var page map[string]interface{}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, false, fmt.Errorf("failed to parse result page %d: %w", pages, err)
+		}
+
+		for _, path := range resultsPaths {
+			items, ok := lookupArray(page, path)
+			if !ok {
+				continue
+			}
+			existing, _ := lookupArray(merged, path)
+			setArray(merged, path, append(existing, items...))
+		}
+		token = findNextPageToken(page, resultsPaths)
+	}
+
+	truncated := token != ""
+	clearNextPageToken(merged, resultsPaths)
+	if truncated {
+		merged[nextPageTokenKey] = token
+	}
+
+	out, err := json.Marshal(merged)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode aggregated pages: %w", err)
+	}
+	return out, truncated, nil
+}
+
+// findNextPageToken 查找顶层或结果数组所在对象中的 next_page_token
+func findNextPageToken(doc map[string]interface{}, resultsPaths [][]string) string {
+	if token, ok := doc[nextPageTokenKey].(string); ok && token != "" {
+		return token
+	}
+	for _, path := range resultsPaths {
+		if parent, ok := lookupObject(doc, path[:len(path)-1]); ok {
+			if token, ok := parent[nextPageTokenKey].(string); ok && token != "" {
+				return token
+			}
+		}
+	}
+	return ""
+}
+
+// clearNextPageToken 删除合并结果中的所有 next_page_token
+func clearNextPageToken(doc map[string]interface{}, resultsPaths [][]string) {
+	delete(doc, nextPageTokenKey)
+	for _, path := range resultsPaths {
+		if parent, ok := lookupObject(doc, path[:len(path)-1]); ok {
+			delete(parent, nextPageTokenKey)
+		}
+	}
+}
+
+// lookupObject 按路径查找嵌套对象
+func lookupObject(doc map[string]interface{}, path []string) (map[string]interface{}, bool) {
+	current := doc
+	for _, key := range path {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	return current, true
+}
+
+// lookupArray 按路径查找数组
+func lookupArray(doc map[string]interface{}, path []string) ([]interface{}, bool) {
+	parent, ok := lookupObject(doc, path[:len(path)-1])
+	if !ok {
+		return nil, false
+	}
+	items, ok := parent[path[len(path)-1]].([]interface{})
+	return items, ok
+}
+
+// setArray 按路径写入数组（父对象必须已存在）
+func setArray(doc map[string]interface{}, path []string, items []interface{}) {
+	if parent, ok := lookupObject(doc, path[:len(path)-1]); ok {
+		parent[path[len(path)-1]] = items
+	}
+}
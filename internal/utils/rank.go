@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+)
+
+// 计算清晰度时采样的最大边长（像素），大图按步长抽样以控制开销
+const sharpnessSampleSize = 512
+
+// ImageScore 图片质量启发式评分结果
+type ImageScore struct {
+	Width     int
+	Height    int
+	Sharpness float64 // 灰度图拉普拉斯响应的方差，越大表示边缘越清晰
+	Score     float64 // 综合得分，越大越好
+}
+
+// ScoreImage 按启发式规则为图片打分：综合分辨率与清晰度估计。
+//
+//	Score = log2(宽 × 高) + log1p(Sharpness)
+//
+// 两项均取对数，避免超大分辨率或高噪声图片单项压倒另一项。
+// 支持的输入格式与 ConvertImage 一致（PNG、JPEG、GIF）。
+func ScoreImage(data []byte) (ImageScore, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return ImageScore{}, fmt.Errorf("failed to decode image for scoring: %w", err)
+	}
+
+	bounds := img.Bounds()
+	score := ImageScore{
+		Width:     bounds.Dx(),
+		Height:    bounds.Dy(),
+		Sharpness: laplacianVariance(img),
+	}
+	if score.Width > 0 && score.Height > 0 {
+		score.Score = math.Log2(float64(score.Width)*float64(score.Height)) + math.Log1p(score.Sharpness)
+	}
+	return score, nil
+}
+
+// laplacianVariance 在抽样后的灰度图上计算 4 邻域拉普拉斯响应的方差
+func laplacianVariance(img image.Image) float64 {
+	bounds := img.Bounds()
+	step := 1
+	if longest := max(bounds.Dx(), bounds.Dy()); longest > sharpnessSampleSize {
+		step = (longest + sharpnessSampleSize - 1) / sharpnessSampleSize
+	}
+
+	w := bounds.Dx() / step
+	h := bounds.Dy() / step
+	if w < 3 || h < 3 {
+		return 0
+	}
+
+	gray := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x*step, bounds.Min.Y+y*step).RGBA()
+			// ITU-R BT.601 亮度，RGBA() 返回 16 位分量
+			gray[y*w+x] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+		}
+	}
+
+	var sum, sumSq float64
+	n := 0
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			lap := gray[i-w] + gray[i+w] + gray[i-1] + gray[i+1] - 4*gray[i]
+			sum += lap
+			sumSq += lap * lap
+			n++
+		}
+	}
+	mean := sum / float64(n)
+	return sumSq/float64(n) - mean*mean
+}
+
+// RankByScore 返回按得分从高到低排列的下标；得分相同时保持原有顺序。
+// 无法评分的项可传入 math.Inf(-1)，会被排在最后。
+func RankByScore(scores []float64) []int {
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+	return order
+}
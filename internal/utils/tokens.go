@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"unicode"
+)
+
+// approxCharsPerToken 英文等拉丁文字平均每个 token 对应的字符数（常见 BPE 分词器的经验值）
+const approxCharsPerToken = 4
+
+// EstimateTokens 粗略估算文本的 token 数，不依赖具体模型的分词器：
+//   - 连续的字母 / 数字视为一个词，按每 4 个字符 1 个 token 计（向上取整）
+//   - 中日韩文字每个字符计 1 个 token
+//   - 标点与其它符号每个计 1 个 token，空白不计
+//
+// 结果仅用于预检提示词长度，与 provider 实际计费的 token 数可能有出入。
+func EstimateTokens(text string) int {
+	tokens := 0
+	wordLen := 0
+	flushWord := func() {
+		if wordLen > 0 {
+			tokens += (wordLen + approxCharsPerToken - 1) / approxCharsPerToken
+			wordLen = 0
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			tokens++
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			wordLen++
+		case unicode.IsSpace(r):
+			flushWord()
+		default:
+			flushWord()
+			tokens++
+		}
+	}
+	flushWord()
+	return tokens
+}
+
+// HasNonASCII 判断文本是否包含非 ASCII 字符
+func HasNonASCII(text string) bool {
+	for _, r := range text {
+		if r > unicode.MaxASCII {
+			return true
+		}
+	}
+	return false
+}
+
+// isCJK 判断字符是否为中日韩文字（汉字、假名、谚文）
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
@@ -2,17 +2,24 @@ package main
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"genai-mcp/common"
 	"genai-mcp/internal/genai/apimart"
 	"genai-mcp/internal/genai/gemini"
+	"genai-mcp/internal/genai/stability"
 	"genai-mcp/internal/genai/wan"
+	"genai-mcp/internal/httpserver"
+	"genai-mcp/internal/oss"
 	"genai-mcp/internal/tools"
+	"genai-mcp/internal/utils"
 
 	"github.com/mark3labs/mcp-go/server"
 )
@@ -31,11 +38,104 @@ func main() {
 		"genai_base_url":     config.GenAIBaseURL,
 		"genai_gen_model":    config.GenAIGenModelName,
 		"genai_edit_model":   config.GenAIEditModelName,
-		"api_key":            maskAPIKey(config.GenAIAPIKey),
+		"api_key":            common.MaskSecret(config.GenAIAPIKey),
 		"server_address":     config.GetServerAddr(),
 		"genai_image_format": config.GenAIImageFormat,
+		"image_format_mode":  os.Getenv("GENAI_IMAGE_FORMAT"),
 	}).Info("Server configuration loaded")
 
+	// 设置所有出站 HTTP 请求（provider、图片下载、OSS）使用的代理
+	if err := common.SetHTTPProxy(config.HTTPProxy, config.NoProxy); err != nil {
+		common.WithError(err).Fatal("Invalid GENAI_HTTP_PROXY")
+	}
+	if addr := common.HTTPProxyAddr(); addr != "" {
+		common.WithFields(map[string]interface{}{
+			"proxy":    addr,
+			"no_proxy": config.NoProxy,
+		}).Info("Outbound HTTP proxy configured")
+	}
+
+	// 设置输入图片的主机访问策略（所有 provider 在获取输入图片前都会校验）
+	utils.SetImageHostPolicy(utils.ImageHostPolicy{
+		Allowlist:    config.ImageHostAllowlist,
+		Denylist:     config.ImageHostDenylist,
+		AllowPrivate: config.AllowPrivateImageHosts,
+		RequireHTTPS: config.RequireHTTPSImages,
+	})
+	common.WithFields(map[string]interface{}{
+		"allowlist":     config.ImageHostAllowlist,
+		"denylist":      config.ImageHostDenylist,
+		"allow_private": config.AllowPrivateImageHosts,
+		"require_https": config.RequireHTTPSImages,
+	}).Info("Image host policy configured")
+
+	// 设置服务端下载图片的大小上限
+	utils.SetMaxImageBytes(int64(config.MaxImageBytes))
+
+	// 设置透明图片转为 JPEG 时的默认背景色
+	if err := utils.SetFlattenBackground(config.GenAIFlattenBGColor); err != nil {
+		common.WithError(err).Fatal("Invalid GENAI_FLATTEN_BG_COLOR")
+	}
+
+	// 设置图片对象的路径分区方案
+	if err := utils.SetImagePathScheme(config.OSSPathScheme); err != nil {
+		common.WithError(err).Fatal("Invalid OSS_PATH_SCHEME")
+	}
+
+	// 设置 OSS 上传时的 Content-Type 规范化 / 覆盖表
+	oss.SetContentTypeOverrides(config.OSSContentTypeOverrides)
+
+	// 设置附加到所有上传对象的标签
+	if err := oss.SetObjectTags(config.OSSObjectTags); err != nil {
+		common.WithError(err).Fatal("Invalid OSS_OBJECT_TAGS")
+	}
+
+	// 定期清理 OSS 中过期的生成结果（OSS_JANITOR_ENABLED）
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	defer stopJanitor()
+	if config.OSSJanitorEnabled {
+		ossClient, err := oss.SharedOSSClientFromConfig(config)
+		if err != nil {
+			common.WithError(err).Fatal("Failed to create OSS client for janitor")
+		}
+		janitor, err := oss.NewJanitor(ossClient, oss.JanitorConfig{
+			Bucket:   config.OSSBucket,
+			Prefixes: config.OSSJanitorPrefixes,
+			MaxAge:   time.Duration(config.OSSJanitorMaxAgeHours) * time.Hour,
+			Interval: time.Duration(config.OSSJanitorIntervalMinutes) * time.Minute,
+			CleanupOptions: oss.CleanupOptions{
+				BatchSize:   config.OSSJanitorBatchSize,
+				Concurrency: config.OSSJanitorConcurrency,
+			},
+		})
+		if err != nil {
+			common.WithError(err).Fatal("Failed to create OSS janitor")
+		}
+		common.WithFields(map[string]interface{}{
+			"prefixes":         config.OSSJanitorPrefixes,
+			"max_age_hours":    config.OSSJanitorMaxAgeHours,
+			"interval_minutes": config.OSSJanitorIntervalMinutes,
+			"batch_size":       config.OSSJanitorBatchSize,
+			"concurrency":      config.OSSJanitorConcurrency,
+		}).Info("OSS janitor enabled")
+		go janitor.Run(janitorCtx)
+	}
+
+	// OSS 不可用时 url 输出的降级（GENAI_OSS_DEGRADE），并定期检查 OSS 是否恢复
+	oss.SetDegrade(config.OSSDegrade, config.OSSDegradeMaxBytes)
+	if config.OSSDegrade && config.IsOSSConfigured() {
+		ossClient, err := oss.SharedOSSClientFromConfig(config)
+		if err != nil {
+			common.WithError(err).Fatal("Failed to create OSS client for health check")
+		}
+		common.WithFields(map[string]interface{}{
+			"max_inline_bytes": config.OSSDegradeMaxBytes,
+			"interval_seconds": config.OSSHealthCheckIntervalSeconds,
+		}).Info("OSS degradation enabled")
+		go oss.RunHealthCheck(janitorCtx, ossClient, config.OSSBucket,
+			time.Duration(config.OSSHealthCheckIntervalSeconds)*time.Second)
+	}
+
 	// 创建 MCP 服务器
 	common.Info("Creating MCP server")
 	mcpServer := server.NewMCPServer(
@@ -44,63 +144,190 @@ func main() {
 		server.WithToolCapabilities(true),
 	)
 
+	// tools 层通用配置
+	toolOptions, err := tools.NewOptionsFromConfig(config)
+	if err != nil {
+		common.WithError(err).Fatal("Failed to build tool options")
+	}
+
 	// 根据 GENAI_PROVIDER 注册对应的工具
+	// 各 provider 客户端均包装为可在运行时重新加载的实现，供 reload_provider 工具使用
+	var reloadClient func(cfg *common.Config) error
 	switch config.GenAIProvider {
 	case "wan":
 		// 初始化 Wan 客户端并注册 Wan tools
 		common.Info("Initializing Wan client")
-		wanClient, err := wan.NewWanClientFromConfig(config)
+		client, err := wan.NewWanClientFromConfig(config)
 		if err != nil {
 			common.WithError(err).Fatal("Failed to create Wan client")
 		}
+		runPreflight(config, client.Preflight)
+		wanClient := wan.NewReloadableClient(client)
 		defer wanClient.Close()
+		reloadClient = wanClient.Reload
 		common.Info("Wan client initialized successfully")
 
 		common.Info("Registering Wan tools")
-		if err := tools.RegisterWanTools(mcpServer, wanClient); err != nil {
+		if err := tools.RegisterWanTools(mcpServer, wanClient, toolOptions); err != nil {
 			common.WithError(err).Fatal("Failed to register Wan tools")
 		}
 		common.Info("Wan tools registered successfully")
 	case "apimart":
 		// 初始化 APIMart 客户端并注册 APIMart tools
 		common.Info("Initializing APIMart client")
-		apimartClient, err := apimart.NewApimartClientFromConfig(config)
+		client, err := apimart.NewApimartClientFromConfig(config)
 		if err != nil {
 			common.WithError(err).Fatal("Failed to create APIMart client")
 		}
+		runPreflight(config, client.Preflight)
+		apimartClient := apimart.NewReloadableClient(client)
 		defer apimartClient.Close()
+		reloadClient = apimartClient.Reload
 		common.Info("APIMart client initialized successfully")
 
 		common.Info("Registering APIMart tools")
-		if err := tools.RegisterApimartTools(mcpServer, apimartClient); err != nil {
+		if err := tools.RegisterApimartTools(mcpServer, apimartClient, toolOptions); err != nil {
 			common.WithError(err).Fatal("Failed to register APIMart tools")
 		}
 		common.Info("APIMart tools registered successfully")
+	case "stability":
+		// 初始化 Stability 客户端并注册 Stability tools
+		common.Info("Initializing Stability client")
+		client, err := stability.NewStabilityClientFromConfig(config)
+		if err != nil {
+			common.WithError(err).Fatal("Failed to create Stability client")
+		}
+		runPreflight(config, client.Preflight)
+		stabilityClient := stability.NewReloadableClient(client)
+		defer stabilityClient.Close()
+		reloadClient = stabilityClient.Reload
+		common.Info("Stability client initialized successfully")
+
+		common.Info("Registering Stability tools")
+		if err := tools.RegisterStabilityTools(mcpServer, stabilityClient, toolOptions); err != nil {
+			common.WithError(err).Fatal("Failed to register Stability tools")
+		}
+		common.Info("Stability tools registered successfully")
 	default:
 		// 默认使用 Gemini
 		common.Info("Initializing Gemini client")
-		geminiClient, err := gemini.NewGeminiClientFromConfig(config)
+		client, err := gemini.NewGeminiClientFromConfig(config)
 		if err != nil {
 			common.WithError(err).Fatal("Failed to create Gemini client")
 		}
+		runPreflight(config, client.Preflight)
+		geminiClient := gemini.NewReloadableClient(client)
 		defer geminiClient.Close()
+		reloadClient = geminiClient.Reload
 		common.Info("Gemini client initialized successfully")
 
 		common.Info("Registering Gemini tools")
 		// 编辑工具的最大图片数与编辑模型相关，因此这里传入编辑模型名称
-		if err := tools.RegisterGeminiTools(mcpServer, geminiClient, config.GenAIEditModelName); err != nil {
+		if err := tools.RegisterGeminiTools(mcpServer, geminiClient, config.GenAIEditModelName, toolOptions); err != nil {
 			common.WithError(err).Fatal("Failed to register Gemini tools")
 		}
 		common.Info("Gemini tools registered successfully")
 	}
 
+	// 注册与 provider 无关的通用工具
+	common.Info("Registering common tools")
+	if err := tools.RegisterCommonTools(mcpServer, toolOptions); err != nil {
+		common.WithError(err).Fatal("Failed to register common tools")
+	}
+
+	// 注册管理类工具（仅在配置了 GENAI_ADMIN_TOKEN 时生效）
+	// activeConfig 为当前生效的配置，reload_provider 成功后替换，供 get_config 工具返回
+	var activeConfig atomic.Pointer[common.Config]
+	activeConfig.Store(config)
+	reloadProvider := func(ctx context.Context) (*common.Config, error) {
+		newConfig, err := common.ReloadConfig()
+		if err != nil {
+			return nil, err
+		}
+		// 工具按 provider 注册，切换 provider 需要重启
+		if newConfig.GenAIProvider != config.GenAIProvider {
+			return nil, common.NewError(common.ErrCodeInvalidArgument, false,
+				"GENAI_PROVIDER changed from %s to %s; switching providers requires a restart", config.GenAIProvider, newConfig.GenAIProvider)
+		}
+		// /image/{id} 接口在启动时按 OSS_BACKEND 挂载，切换到或离开 memory 后端需要重启
+		if (newConfig.OSSBackend == common.OSSBackendMemory) != (config.OSSBackend == common.OSSBackendMemory) {
+			return nil, common.NewError(common.ErrCodeInvalidArgument, false,
+				"OSS_BACKEND changed from %s to %s; switching to or from the memory backend requires a restart", config.OSSBackend, newConfig.OSSBackend)
+		}
+		if err := reloadClient(newConfig); err != nil {
+			return nil, err
+		}
+		activeConfig.Store(newConfig)
+		return newConfig, nil
+	}
+	if err := tools.RegisterAdminTools(mcpServer, toolOptions, reloadProvider, activeConfig.Load); err != nil {
+		common.WithError(err).Fatal("Failed to register admin tools")
+	}
+
 	// 创建 Streamable HTTP 服务器
+	// 使用自定义的 http.Server 和路由，便于在 /mcp 之外挂载中间件
 	common.Info("Creating Streamable HTTP server")
+	mux := http.NewServeMux()
+	srv := &http.Server{
+		Addr:    config.GetServerAddr(),
+		Handler: mux,
+	}
 	httpServer := server.NewStreamableHTTPServer(
 		mcpServer,
 		server.WithEndpointPath("/mcp"),
 		server.WithHeartbeatInterval(30*time.Second),
+		server.WithStreamableHTTPServer(srv),
+		// 调用方传入的 X-Request-ID 作为本次调用的请求 ID，未传入时由工具层生成
+		server.WithHTTPContextFunc(func(ctx context.Context, r *http.Request) context.Context {
+			return common.ContextWithRequestID(ctx, r.Header.Get(common.RequestIDHeader))
+		}),
+	)
+
+	var mcpHandler http.Handler = httpServer
+	if config.HTTPCompression {
+		// 仅压缩 JSON 响应，SSE 流式响应与心跳保持原样
+		common.Info("HTTP gzip compression enabled")
+		mcpHandler = httpserver.GzipMiddleware(mcpHandler)
+	}
+	mux.Handle("/mcp", mcpHandler)
+
+	// 健康检查接口：浅层检查 provider 客户端已创建且 API Key 已配置，不请求上游
+	httpserver.RegisterHealthz(mux, config.HealthzPath,
+		func() string { return activeConfig.Load().GenAIProvider },
+		func() error {
+			if reloadClient == nil {
+				return errors.New("provider client is not initialized")
+			}
+			return nil
+		},
+		func() error {
+			if activeConfig.Load().GenAIAPIKey == "" {
+				return errors.New("GENAI_API_KEY is not set")
+			}
+			return nil
+		},
 	)
+	common.WithField("path", config.HealthzPath).Info("Health check endpoint enabled")
+
+	// 本地存储（OSS_BACKEND=local）的结果 URL 由本服务在 OSS_LOCAL_BASE_URL 的路径下提供
+	if config.OSSBackend == common.OSSBackendLocal && config.OSSLocalBaseURL != "" {
+		baseURL, _ := url.Parse(config.OSSLocalBaseURL)
+		httpserver.RegisterLocalStorage(mux, baseURL.Path, config.OSSLocalDir)
+	}
+	// 内存存储（OSS_BACKEND=memory）的结果由本服务在 /image/{id} 提供，与各 provider 共用同一存储实例
+	if config.OSSBackend == common.OSSBackendMemory {
+		store, err := oss.SharedMemoryStoreFromConfig(config)
+		if err != nil {
+			common.WithError(err).Fatal("Failed to create memory storage")
+		}
+		httpserver.RegisterImageEndpoint(mux, oss.ImageEndpointPath, store)
+	}
+
+	if config.DebugUI {
+		// 调试页面直接调用已注册的 tool handler，仅用于验证部署，默认关闭
+		common.Warn("Debug UI enabled at / (DEBUG_UI=true); do not expose it publicly")
+		httpserver.RegisterDebugUI(mux, mcpServer)
+	}
 
 	// 设置优雅关闭
 	sigChan := make(chan os.Signal, 1)
@@ -129,10 +356,23 @@ func main() {
 	common.Info("Server stopped gracefully")
 }
 
-// maskAPIKey 隐藏 API Key 的敏感部分
-func maskAPIKey(key string) string {
-	if len(key) <= 8 {
-		return "****"
+// runPreflight 在 GENAI_PREFLIGHT=true 时预检配置的模型，模型不存在或不可访问时拒绝启动
+func runPreflight(config *common.Config, preflight func(ctx context.Context) error) {
+	if !config.GenAIPreflight {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.GenAITimeoutSeconds)*time.Second)
+	defer cancel()
+
+	fields := map[string]interface{}{
+		"provider":   config.GenAIProvider,
+		"gen_model":  config.GenAIGenModelName,
+		"edit_model": config.GenAIEditModelName,
+	}
+	common.WithFields(fields).Info("Running model preflight")
+	if err := preflight(ctx); err != nil {
+		common.WithError(err).WithFields(fields).Fatal("Model preflight failed")
 	}
-	return key[:4] + "****" + key[len(key)-4:]
+	common.WithFields(fields).Info("Model preflight passed")
 }